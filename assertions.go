@@ -0,0 +1,76 @@
+package stubsrv
+
+import (
+	"strings"
+	"testing"
+)
+
+// AssertCalled fails t unless the stub received at least one request
+// matching method and path. path may be a template such as /users/:id.
+func (s *Stub) AssertCalled(t testing.TB, method, path string) bool {
+	t.Helper()
+
+	if len(s.RequestsFor(method, path)) == 0 {
+		t.Errorf("expected %s %s to be called, but it was not%s", strings.ToUpper(method), path, s.receivedSummary())
+		return false
+	}
+	return true
+}
+
+func (s *Stub) AssertNotCalled(t testing.TB, method, path string) bool {
+	t.Helper()
+
+	if n := len(s.RequestsFor(method, path)); n > 0 {
+		t.Errorf("expected %s %s not to be called, but it was called %d time(s)", strings.ToUpper(method), path, n)
+		return false
+	}
+	return true
+}
+
+func (s *Stub) AssertCalledTimes(t testing.TB, method, path string, n int) bool {
+	t.Helper()
+
+	if got := len(s.RequestsFor(method, path)); got != n {
+		t.Errorf("expected %s %s to be called %d time(s), but it was called %d time(s)%s", strings.ToUpper(method), path, n, got, s.receivedSummary())
+		return false
+	}
+	return true
+}
+
+// UnexpectedRequests returns the requests that matched no route while
+// strict mode was on.
+func (s *Stub) UnexpectedRequests() []RecordedRequest {
+	return s.journal.allUnexpected()
+}
+
+// VerifyNoUnexpectedRequests fails t listing every request that matched no
+// route. It requires WithStrictMode.
+func (s *Stub) VerifyNoUnexpectedRequests(t testing.TB) bool {
+	t.Helper()
+
+	recs := s.UnexpectedRequests()
+	if len(recs) == 0 {
+		return true
+	}
+
+	var b strings.Builder
+	for _, rec := range recs {
+		b.WriteString("\n\t" + rec.Method + " " + rec.Path)
+	}
+	t.Errorf("expected no unexpected requests, but got %d:%s", len(recs), b.String())
+	return false
+}
+
+func (s *Stub) receivedSummary() string {
+	recs := s.Requests()
+	if len(recs) == 0 {
+		return "; no requests received"
+	}
+
+	var b strings.Builder
+	b.WriteString("; received:")
+	for _, rec := range recs {
+		b.WriteString("\n\t" + rec.Method + " " + rec.Path)
+	}
+	return b.String()
+}
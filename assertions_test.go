@@ -0,0 +1,139 @@
+package stubsrv
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeT struct {
+	testing.TB
+	errors []string
+}
+
+func (f *fakeT) Helper() {}
+
+func (f *fakeT) Errorf(format string, args ...any) {
+	f.errors = append(f.errors, fmt.Sprintf(format, args...))
+}
+
+func TestStub_Assertions(t *testing.T) {
+	t.Parallel()
+
+	stub := NewStub(noopLogger())
+	stub.AddHandler(http.MethodGet, "/users/:id", func(w http.ResponseWriter, r *http.Request) {})
+	stub.AddHandler(http.MethodGet, "/foo", func(w http.ResponseWriter, r *http.Request) {})
+	require.NoError(t, stub.Start())
+	defer stub.Close()
+
+	for _, p := range []string{"/foo", "/users/1", "/users/2"} {
+		resp, err := http.Get(stub.URL() + p)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	testCases := []struct {
+		name           string
+		givenAssertion func(t testing.TB) bool
+		expectedOK     bool
+		expectedError  string
+	}{
+		{
+			name:           "called exact route",
+			givenAssertion: func(t testing.TB) bool { return stub.AssertCalled(t, "GET", "/foo") },
+			expectedOK:     true,
+		},
+		{
+			name:           "called template route",
+			givenAssertion: func(t testing.TB) bool { return stub.AssertCalled(t, "GET", "/users/:id") },
+			expectedOK:     true,
+		},
+		{
+			name:           "not called fails with summary",
+			givenAssertion: func(t testing.TB) bool { return stub.AssertCalled(t, "POST", "/foo") },
+			expectedError:  "expected POST /foo to be called, but it was not; received:\n\tGET /foo\n\tGET /users/1\n\tGET /users/2",
+		},
+		{
+			name:           "not called passes",
+			givenAssertion: func(t testing.TB) bool { return stub.AssertNotCalled(t, "DELETE", "/foo") },
+			expectedOK:     true,
+		},
+		{
+			name:           "not called fails",
+			givenAssertion: func(t testing.TB) bool { return stub.AssertNotCalled(t, "GET", "/users/:id") },
+			expectedError:  "expected GET /users/:id not to be called, but it was called 2 time(s)",
+		},
+		{
+			name:           "called times passes",
+			givenAssertion: func(t testing.TB) bool { return stub.AssertCalledTimes(t, "get", "/users/:id", 2) },
+			expectedOK:     true,
+		},
+		{
+			name:           "called times fails",
+			givenAssertion: func(t testing.TB) bool { return stub.AssertCalledTimes(t, "GET", "/foo", 3) },
+			expectedError:  "expected GET /foo to be called 3 time(s), but it was called 1 time(s)",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ft := &fakeT{}
+
+			ok := tc.givenAssertion(ft)
+
+			assert.Equal(t, tc.expectedOK, ok)
+			if tc.expectedOK {
+				assert.Empty(t, ft.errors)
+				return
+			}
+			require.Len(t, ft.errors, 1)
+			assert.Contains(t, ft.errors[0], tc.expectedError)
+		})
+	}
+}
+
+func TestStub_VerifyNoUnexpectedRequests(t *testing.T) {
+	t.Parallel()
+
+	stub := NewStub(noopLogger(), WithStrictMode())
+	stub.AddHandler(http.MethodGet, "/foo", func(w http.ResponseWriter, r *http.Request) {})
+	require.NoError(t, stub.Start())
+	defer stub.Close()
+
+	get := func(method, path string) {
+		req, err := http.NewRequest(method, stub.URL()+path, nil)
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	get(http.MethodGet, "/foo")
+	assert.True(t, stub.VerifyNoUnexpectedRequests(&fakeT{}))
+
+	get(http.MethodGet, "/bar")
+	get(http.MethodPost, "/foo")
+
+	ft := &fakeT{}
+	assert.False(t, stub.VerifyNoUnexpectedRequests(ft))
+	require.Len(t, ft.errors, 1)
+	assert.Equal(t, "expected no unexpected requests, but got 2:\n\tGET /bar\n\tPOST /foo", ft.errors[0])
+
+	stub.Reset()
+	assert.Empty(t, stub.UnexpectedRequests())
+
+	t.Run("off without strict mode", func(t *testing.T) {
+		lax := NewStub(noopLogger())
+		require.NoError(t, lax.Start())
+		defer lax.Close()
+
+		resp, err := http.Get(lax.URL() + "/bar")
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		assert.True(t, lax.VerifyNoUnexpectedRequests(&fakeT{}))
+	})
+}
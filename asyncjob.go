@@ -0,0 +1,100 @@
+package stubsrv
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type AsyncJobConfig struct {
+	// Method submits the job. Defaults to POST.
+	Method string
+	// PendingPolls is how many status polls answer "pending".
+	PendingPolls int
+	// PendingFor keeps the job pending for a duration after submission.
+	// Both limits must be satisfied before the job completes.
+	PendingFor time.Duration
+	// Status, Body and Headers describe the final result. Status defaults to 200.
+	Status  int
+	Body    string
+	Headers map[string]string
+}
+
+type asyncJob struct {
+	created time.Time
+	polls   int
+}
+
+type asyncJobStatus struct {
+	ID        string `json:"id"`
+	Status    string `json:"status"`
+	StatusURL string `json:"status_url,omitempty"`
+}
+
+// AddAsyncJob models a long-running-operation API: submitting to path returns
+// 202 with the job status URL (path/<id>), which serves "pending" until the
+// configured polls or duration are exhausted and then the final result.
+func (s *Stub) AddAsyncJob(jobPath string, cfg AsyncJobConfig) {
+	if cfg.Method == "" {
+		cfg.Method = http.MethodPost
+	}
+	if cfg.Status == 0 {
+		cfg.Status = http.StatusOK
+	}
+
+	var (
+		mu     sync.Mutex
+		nextID int
+		jobs   = make(map[string]*asyncJob)
+	)
+
+	s.AddHandler(cfg.Method, jobPath, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		nextID++
+		id := strconv.Itoa(nextID)
+		jobs[id] = &asyncJob{created: time.Now()}
+		mu.Unlock()
+
+		statusURL := path.Join(jobPath, id)
+		w.Header().Set("Location", statusURL)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(asyncJobStatus{ID: id, Status: "pending", StatusURL: statusURL})
+	})
+
+	s.AddHandler(http.MethodGet, path.Join(jobPath, ":id"), func(w http.ResponseWriter, r *http.Request) {
+		id := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+
+		mu.Lock()
+		job, ok := jobs[id]
+		var pending bool
+		if ok {
+			pending = job.polls < cfg.PendingPolls || time.Since(job.created) < cfg.PendingFor
+			job.polls++
+		}
+		mu.Unlock()
+
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		if pending {
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(asyncJobStatus{ID: id, Status: "pending"})
+			return
+		}
+
+		for k, v := range cfg.Headers {
+			w.Header().Set(k, v)
+		}
+		w.WriteHeader(cfg.Status)
+		if cfg.Body != "" {
+			_, _ = w.Write([]byte(cfg.Body))
+		}
+	})
+}
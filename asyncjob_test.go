@@ -0,0 +1,97 @@
+package stubsrv
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStub_AddAsyncJob(t *testing.T) {
+	t.Parallel()
+
+	t.Run("serves pending for N polls then the result", func(t *testing.T) {
+		t.Parallel()
+
+		stub := NewStub(noopLogger())
+		stub.AddAsyncJob("/exports", AsyncJobConfig{
+			PendingPolls: 2,
+			Body:         `{"url":"/files/1"}`,
+		})
+		require.NoError(t, stub.Start())
+		defer stub.Close()
+
+		resp, err := http.Post(stub.URL()+"/exports", "application/json", nil)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		require.Equal(t, http.StatusAccepted, resp.StatusCode)
+		assert.Equal(t, "/exports/1", resp.Header.Get("Location"))
+
+		var submitted asyncJobStatus
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&submitted))
+		assert.Equal(t, "1", submitted.ID)
+
+		for range 2 {
+			assert.Equal(t, `{"id":"1","status":"pending"}`+"\n", getBody(t, stub.URL()+submitted.StatusURL))
+		}
+		assert.Equal(t, `{"url":"/files/1"}`, getBody(t, stub.URL()+submitted.StatusURL))
+	})
+
+	t.Run("stays pending for the configured duration", func(t *testing.T) {
+		t.Parallel()
+
+		stub := NewStub(noopLogger())
+		stub.AddAsyncJob("/jobs", AsyncJobConfig{
+			PendingFor: 50 * time.Millisecond,
+			Status:     http.StatusCreated,
+			Body:       "done",
+		})
+		require.NoError(t, stub.Start())
+		defer stub.Close()
+
+		resp, err := http.Post(stub.URL()+"/jobs", "", nil)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		statusURL := stub.URL() + resp.Header.Get("Location")
+		assert.Contains(t, getBody(t, statusURL), "pending")
+
+		time.Sleep(60 * time.Millisecond)
+
+		final, err := http.Get(statusURL)
+		require.NoError(t, err)
+		defer final.Body.Close()
+		assert.Equal(t, http.StatusCreated, final.StatusCode)
+	})
+
+	t.Run("unknown job returns 404", func(t *testing.T) {
+		t.Parallel()
+
+		stub := NewStub(noopLogger())
+		stub.AddAsyncJob("/jobs", AsyncJobConfig{})
+		require.NoError(t, stub.Start())
+		defer stub.Close()
+
+		resp, err := http.Get(stub.URL() + "/jobs/99")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func getBody(t *testing.T, url string) string {
+	t.Helper()
+
+	resp, err := http.Get(url)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(body)
+}
@@ -0,0 +1,152 @@
+package stubsrv
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// JWTSecret is the HS256 key IssueJWT signs with and RequireJWT verifies
+// against. Configure the system under test to trust it.
+const JWTSecret = "stubsrv-jwt-secret"
+
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// IssueJWT returns an HS256 JWT carrying claims, signed with JWTSecret. It
+// panics if claims cannot be encoded as JSON.
+func IssueJWT(claims map[string]any) string {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		panic(err)
+	}
+	unsigned := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + jwtSignature(unsigned)
+}
+
+func jwtSignature(unsigned string) string {
+	mac := hmac.New(sha256.New, []byte(JWTSecret))
+	mac.Write([]byte(unsigned))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// parseJWT verifies token's signature and time claims and returns its
+// claims.
+func parseJWT(token string, now time.Time) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+	if !hmac.Equal([]byte(jwtSignature(parts[0]+"."+parts[1])), []byte(parts[2])) {
+		return nil, errors.New("invalid signature")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errors.New("malformed token")
+	}
+	var claims map[string]any
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, errors.New("malformed token")
+	}
+
+	if exp, ok := claims["exp"].(float64); ok && !now.Before(time.Unix(int64(exp), 0)) {
+		return nil, errors.New("token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Before(time.Unix(int64(nbf), 0)) {
+		return nil, errors.New("token not yet valid")
+	}
+	return claims, nil
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+	return token, true
+}
+
+func unauthorized(w http.ResponseWriter, description string) {
+	challenge := `Bearer`
+	if description != "" {
+		challenge += ` error="invalid_token", error_description="` + description + `"`
+	}
+	w.Header().Set("WWW-Authenticate", challenge)
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
+
+// RequireBearer returns a middleware answering 401 unless the request
+// carries Authorization: Bearer token. An empty token accepts any bearer
+// token.
+func RequireBearer(token string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got, ok := bearerToken(r)
+			if !ok {
+				unauthorized(w, "")
+				return
+			}
+			if token != "" && !hmac.Equal([]byte(got), []byte(token)) {
+				unauthorized(w, "unknown token")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireJWT returns a middleware answering 401 unless the request carries
+// a bearer JWT signed with JWTSecret, unexpired, and holding every claim in
+// required with an equal value. exp and nbf are checked against the stub's
+// clock, see WithClock.
+func RequireJWT(required map[string]any) Middleware {
+	// round-trip so Go values compare equal to decoded JSON
+	var want map[string]any
+	if raw, err := json.Marshal(required); err == nil {
+		_ = json.Unmarshal(raw, &want)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := bearerToken(r)
+			if !ok {
+				unauthorized(w, "")
+				return
+			}
+			claims, err := parseJWT(token, requestNow(r))
+			if err != nil {
+				unauthorized(w, err.Error())
+				return
+			}
+			for k, v := range want {
+				if !reflect.DeepEqual(claims[k], v) {
+					unauthorized(w, "claim "+k+" does not match")
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// controlJWT serves POST /_control/jwt, answering with a token for the
+// posted claims so clients outside Go can authenticate against RequireJWT.
+func (s *Stub) controlJWT(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	var claims map[string]any
+	if err := json.NewDecoder(r.Body).Decode(&claims); err != nil {
+		http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"token": IssueJWT(claims)})
+}
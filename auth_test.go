@@ -0,0 +1,122 @@
+package stubsrv
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStub_Auth(t *testing.T) {
+	t.Parallel()
+
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+
+	stub := NewStub(noopLogger())
+	stub.AddHandler(http.MethodGet, "/static", ok, RequireBearer("s3cr3t"))
+	stub.AddHandler(http.MethodGet, "/admin", ok, RequireJWT(map[string]any{"role": "admin", "tenant": 7}))
+	require.NoError(t, stub.Start())
+	t.Cleanup(stub.Close)
+
+	controlAdd(t, stub, `{"method":"GET","path":"/any","require_bearer":"*"}`)
+	controlAdd(t, stub, `{"method":"GET","path":"/me","require_jwt":{}}`)
+
+	var issued struct{ Token string }
+	controlDo(t, stub, http.MethodPost, "/_control/jwt", `{"sub":"alice","role":"admin","tenant":7}`, http.StatusOK, &issued)
+
+	admin := IssueJWT(map[string]any{"sub": "alice", "role": "admin", "tenant": 7, "exp": time.Now().Add(time.Hour).Unix()})
+	user := IssueJWT(map[string]any{"sub": "bob", "role": "user", "tenant": 7})
+	expired := IssueJWT(map[string]any{"role": "admin", "tenant": 7, "exp": time.Now().Add(-time.Minute).Unix()})
+
+	testCases := []struct {
+		name              string
+		givenPath         string
+		givenAuth         string
+		expectedStatus    int
+		expectedChallenge string
+	}{
+		{name: "static token", givenPath: "/static", givenAuth: "Bearer s3cr3t", expectedStatus: http.StatusOK},
+		{name: "wrong static token", givenPath: "/static", givenAuth: "Bearer nope", expectedStatus: http.StatusUnauthorized, expectedChallenge: `Bearer error="invalid_token", error_description="unknown token"`},
+		{name: "missing header", givenPath: "/static", expectedStatus: http.StatusUnauthorized, expectedChallenge: "Bearer"},
+		{name: "basic auth", givenPath: "/any", givenAuth: "Basic YTpi", expectedStatus: http.StatusUnauthorized, expectedChallenge: "Bearer"},
+		{name: "any bearer", givenPath: "/any", givenAuth: "bearer whatever", expectedStatus: http.StatusOK},
+		{name: "JWT with claims", givenPath: "/admin", givenAuth: "Bearer " + admin, expectedStatus: http.StatusOK},
+		{name: "JWT from control plane", givenPath: "/admin", givenAuth: "Bearer " + issued.Token, expectedStatus: http.StatusOK},
+		{name: "JWT claim mismatch", givenPath: "/admin", givenAuth: "Bearer " + user, expectedStatus: http.StatusUnauthorized, expectedChallenge: `Bearer error="invalid_token", error_description="claim role does not match"`},
+		{name: "expired JWT", givenPath: "/admin", givenAuth: "Bearer " + expired, expectedStatus: http.StatusUnauthorized, expectedChallenge: `Bearer error="invalid_token", error_description="token expired"`},
+		{name: "tampered JWT", givenPath: "/me", givenAuth: "Bearer " + user[:len(user)-2] + "xx", expectedStatus: http.StatusUnauthorized, expectedChallenge: `Bearer error="invalid_token", error_description="invalid signature"`},
+		{name: "any valid JWT", givenPath: "/me", givenAuth: "Bearer " + user, expectedStatus: http.StatusOK},
+		{name: "not a JWT", givenPath: "/me", givenAuth: "Bearer s3cr3t", expectedStatus: http.StatusUnauthorized, expectedChallenge: `Bearer error="invalid_token", error_description="malformed token"`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			req, err := http.NewRequest(http.MethodGet, stub.URL()+tc.givenPath, nil)
+			require.NoError(t, err)
+			if tc.givenAuth != "" {
+				req.Header.Set("Authorization", tc.givenAuth)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+
+			assert.Equal(t, tc.expectedStatus, resp.StatusCode)
+			assert.Equal(t, tc.expectedChallenge, resp.Header.Get("WWW-Authenticate"))
+		})
+	}
+}
+
+func TestStub_AuthClock(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+	stub := NewStub(noopLogger(), WithClock(func() time.Time { return now }))
+	stub.AddHandler(http.MethodGet, "/admin", func(w http.ResponseWriter, r *http.Request) {}, RequireJWT(map[string]any{}))
+	require.NoError(t, stub.Start())
+	t.Cleanup(stub.Close)
+
+	testCases := []struct {
+		name              string
+		givenClaims       map[string]any
+		expectedStatus    int
+		expectedChallenge string
+	}{
+		{
+			name:           "valid on the stub's clock",
+			givenClaims:    map[string]any{"nbf": now.Add(-time.Minute).Unix(), "exp": now.Add(time.Minute).Unix()},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:              "expired on the stub's clock",
+			givenClaims:       map[string]any{"exp": now.Add(-time.Minute).Unix()},
+			expectedStatus:    http.StatusUnauthorized,
+			expectedChallenge: `Bearer error="invalid_token", error_description="token expired"`,
+		},
+		{
+			name:              "not yet valid on the stub's clock",
+			givenClaims:       map[string]any{"nbf": now.Add(time.Minute).Unix()},
+			expectedStatus:    http.StatusUnauthorized,
+			expectedChallenge: `Bearer error="invalid_token", error_description="token not yet valid"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			req, err := http.NewRequest(http.MethodGet, stub.URL()+"/admin", nil)
+			require.NoError(t, err)
+			req.Header.Set("Authorization", "Bearer "+IssueJWT(tc.givenClaims))
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+
+			assert.Equal(t, tc.expectedStatus, resp.StatusCode)
+			assert.Equal(t, tc.expectedChallenge, resp.Header.Get("WWW-Authenticate"))
+		})
+	}
+}
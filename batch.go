@@ -0,0 +1,77 @@
+package stubsrv
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+)
+
+type BatchConfig struct {
+	// Status is the status of the batch response itself. Defaults to 200.
+	Status int
+	// FailAt lists the indexes of operations that fail.
+	FailAt []int
+	// FailStatus is the per-item status of failing operations. Defaults to 500.
+	FailStatus int
+	// Handle computes each item result, overriding FailAt when set.
+	Handle func(index int, op json.RawMessage) BatchResult
+}
+
+type BatchResult struct {
+	Index  int             `json:"index"`
+	Status int             `json:"status"`
+	Body   json.RawMessage `json:"body,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+type batchResponse struct {
+	Errors bool          `json:"errors"`
+	Items  []BatchResult `json:"items"`
+}
+
+// AddBatch registers a batch endpoint that accepts a JSON array of operations
+// and answers with one result per operation.
+func (s *Stub) AddBatch(method, path string, cfg BatchConfig, middlewares ...Middleware) {
+	if cfg.Status == 0 {
+		cfg.Status = http.StatusOK
+	}
+	if cfg.FailStatus == 0 {
+		cfg.FailStatus = http.StatusInternalServerError
+	}
+	s.AddHandler(method, path, batchHandler(cfg), middlewares...)
+}
+
+func batchHandler(cfg BatchConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var ops []json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&ops); err != nil {
+			http.Error(w, "invalid batch: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		resp := batchResponse{Items: make([]BatchResult, 0, len(ops))}
+		for i, op := range ops {
+			var res BatchResult
+			switch {
+			case cfg.Handle != nil:
+				res = cfg.Handle(i, op)
+			case slices.Contains(cfg.FailAt, i):
+				res = BatchResult{Status: cfg.FailStatus, Error: "simulated failure"}
+			default:
+				res = BatchResult{Status: http.StatusOK, Body: op}
+			}
+			res.Index = i
+			if res.Status == 0 {
+				res.Status = http.StatusOK
+			}
+			if res.Status >= http.StatusBadRequest {
+				resp.Errors = true
+			}
+			resp.Items = append(resp.Items, res)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(cfg.Status)
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
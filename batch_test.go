@@ -0,0 +1,88 @@
+package stubsrv
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStub_AddBatch(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name             string
+		givenConfig      BatchConfig
+		givenBody        string
+		expectedStatus   int
+		expectedErrors   bool
+		expectedStatuses []int
+	}{
+		{
+			name:             "all operations succeed by default",
+			givenConfig:      BatchConfig{},
+			givenBody:        `[{"op":"a"},{"op":"b"}]`,
+			expectedStatus:   http.StatusOK,
+			expectedStatuses: []int{http.StatusOK, http.StatusOK},
+		},
+		{
+			name:             "mixed results with FailAt",
+			givenConfig:      BatchConfig{Status: http.StatusMultiStatus, FailAt: []int{1}, FailStatus: http.StatusConflict},
+			givenBody:        `[{"op":"a"},{"op":"b"},{"op":"c"}]`,
+			expectedStatus:   http.StatusMultiStatus,
+			expectedErrors:   true,
+			expectedStatuses: []int{http.StatusOK, http.StatusConflict, http.StatusOK},
+		},
+		{
+			name: "custom handler decides per item",
+			givenConfig: BatchConfig{Handle: func(i int, op json.RawMessage) BatchResult {
+				if strings.Contains(string(op), "bad") {
+					return BatchResult{Status: http.StatusBadRequest, Error: "bad op"}
+				}
+				return BatchResult{Status: http.StatusCreated}
+			}},
+			givenBody:        `[{"op":"bad"},{"op":"good"}]`,
+			expectedStatus:   http.StatusOK,
+			expectedErrors:   true,
+			expectedStatuses: []int{http.StatusBadRequest, http.StatusCreated},
+		},
+		{
+			name:           "non-array body is rejected",
+			givenConfig:    BatchConfig{},
+			givenBody:      `{"op":"a"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			stub := NewStub(noopLogger())
+			stub.AddBatch(http.MethodPost, "/_bulk", tc.givenConfig)
+			require.NoError(t, stub.Start())
+			defer stub.Close()
+
+			resp, err := http.Post(stub.URL()+"/_bulk", "application/json", strings.NewReader(tc.givenBody))
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, tc.expectedStatus, resp.StatusCode)
+			if tc.expectedStatuses == nil {
+				return
+			}
+
+			var got batchResponse
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+			assert.Equal(t, tc.expectedErrors, got.Errors)
+			require.Len(t, got.Items, len(tc.expectedStatuses))
+			for i, status := range tc.expectedStatuses {
+				assert.Equal(t, i, got.Items[i].Index)
+				assert.Equal(t, status, got.Items[i].Status)
+			}
+		})
+	}
+}
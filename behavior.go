@@ -0,0 +1,106 @@
+package stubsrv
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"strings"
+)
+
+// Behavior is a named, reusable response definition that specs reference
+// with "behavior". Fields set on the spec itself take precedence.
+type Behavior struct {
+	Status  int               `json:"status"`
+	Body    string            `json:"body"`
+	Headers map[string]string `json:"headers"`
+	DelayMS int               `json:"delay_ms"`
+	Fault   Fault             `json:"fault"`
+}
+
+func defaultBehaviors() map[string]Behavior {
+	return map[string]Behavior{
+		"throttle": {
+			Status:  http.StatusTooManyRequests,
+			Body:    `{"error":"too_many_requests"}`,
+			Headers: map[string]string{"Content-Type": "application/json", "Retry-After": "1"},
+		},
+		"auth_expired": {
+			Status:  http.StatusUnauthorized,
+			Body:    `{"error":"invalid_token","error_description":"The access token expired"}`,
+			Headers: map[string]string{"Content-Type": "application/json", "WWW-Authenticate": `Bearer error="invalid_token"`},
+		},
+		"maintenance": {
+			Status:  http.StatusServiceUnavailable,
+			Body:    `{"error":"maintenance"}`,
+			Headers: map[string]string{"Content-Type": "application/json", "Retry-After": "60"},
+		},
+	}
+}
+
+// DefineBehavior adds or replaces the behavior called name. The throttle,
+// auth_expired and maintenance behaviors are predefined. Routes resolve
+// behaviors when they are added.
+func (s *Stub) DefineBehavior(name string, b Behavior) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.behaviors[name] = b
+}
+
+// applyBehavior fills the fields spec leaves unset from its behavior in
+// behaviors.
+func applyBehavior(spec *DynamicHandlerSpec, behaviors map[string]Behavior) bool {
+	b, ok := behaviors[spec.Behavior]
+	if !ok {
+		return false
+	}
+
+	if spec.Status == 0 {
+		spec.Status = b.Status
+	}
+	if spec.Body == "" && spec.BodyFile == "" && len(spec.Chunks) == 0 {
+		spec.Body = b.Body
+	}
+	if len(b.Headers) > 0 {
+		headers := maps.Clone(b.Headers)
+		maps.Copy(headers, spec.Headers)
+		spec.Headers = headers
+	}
+	if spec.DelayMS == 0 {
+		spec.DelayMS = b.DelayMS
+	}
+	if spec.Fault == "" {
+		spec.Fault = b.Fault
+	}
+	return true
+}
+
+// controlBehaviors serves the behavior table:
+//
+//	GET /_control/behaviors          list behaviors by name
+//	PUT /_control/behaviors/{name}   define a behavior
+func (s *Stub) controlBehaviors(w http.ResponseWriter, r *http.Request) {
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/_control/behaviors"), "/")
+
+	switch {
+	case r.Method == http.MethodGet && name == "":
+		s.mu.Lock()
+		behaviors := maps.Clone(s.behaviors)
+		s.mu.Unlock()
+		writeJSON(w, http.StatusOK, behaviors)
+	case r.Method == http.MethodPut && name != "":
+		var b Behavior
+		if err := json.NewDecoder(r.Body).Decode(&b); err != nil {
+			http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if b.Fault != "" && !b.Fault.valid() {
+			http.Error(w, "unknown fault: "+string(b.Fault), http.StatusBadRequest)
+			return
+		}
+		s.DefineBehavior(name, b)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,85 @@
+package stubsrv
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStub_Behaviors(t *testing.T) {
+	t.Parallel()
+
+	stub := NewStub(noopLogger())
+	stub.DefineBehavior("gone", Behavior{Status: http.StatusGone, Body: "gone", Headers: map[string]string{"X-Reason": "sunset"}})
+	require.NoError(t, stub.Start())
+	defer stub.Close()
+
+	controlAdd(t, stub, `{"method":"GET","path":"/a","behavior":"throttle"}`)
+	controlAdd(t, stub, `{"method":"GET","path":"/b","behavior":"throttle","headers":{"Retry-After":"5"}}`)
+	controlAdd(t, stub, `{"method":"GET","path":"/c","behavior":"gone","status":404}`)
+	controlDo(t, stub, http.MethodPut, "/_control/behaviors/teapot", `{"status":418,"body":"short and stout"}`, http.StatusNoContent, nil)
+	_, err := stub.AddSpec(DynamicHandlerSpec{Method: http.MethodGet, Path: "/d", Behavior: "teapot"})
+	require.NoError(t, err)
+
+	controlDo(t, stub, http.MethodPost, "/_control/handlers", `{"method":"GET","path":"/x","behavior":"nope"}`, http.StatusBadRequest, nil)
+	controlDo(t, stub, http.MethodPut, "/_control/behaviors/bad", `{"fault":"nope"}`, http.StatusBadRequest, nil)
+	controlDo(t, stub, http.MethodPost, "/_control/behaviors", "", http.StatusMethodNotAllowed, nil)
+
+	testCases := []struct {
+		name            string
+		givenPath       string
+		expectedStatus  int
+		expectedBody    string
+		expectedHeaders map[string]string
+	}{
+		{
+			name:            "predefined behavior",
+			givenPath:       "/a",
+			expectedStatus:  http.StatusTooManyRequests,
+			expectedBody:    `{"error":"too_many_requests"}`,
+			expectedHeaders: map[string]string{"Retry-After": "1", "Content-Type": "application/json"},
+		},
+		{
+			name:            "spec headers override the behavior",
+			givenPath:       "/b",
+			expectedStatus:  http.StatusTooManyRequests,
+			expectedHeaders: map[string]string{"Retry-After": "5", "Content-Type": "application/json"},
+		},
+		{
+			name:            "spec status overrides the behavior",
+			givenPath:       "/c",
+			expectedStatus:  http.StatusNotFound,
+			expectedBody:    "gone",
+			expectedHeaders: map[string]string{"X-Reason": "sunset"},
+		},
+		{
+			name:           "behavior defined through the control plane",
+			givenPath:      "/d",
+			expectedStatus: http.StatusTeapot,
+			expectedBody:   "short and stout",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := http.Get(stub.URL() + tc.givenPath)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, tc.expectedStatus, resp.StatusCode)
+			if tc.expectedBody != "" {
+				assert.Equal(t, tc.expectedBody, readAll(t, resp))
+			}
+			for k, v := range tc.expectedHeaders {
+				assert.Equal(t, v, resp.Header.Get(k), k)
+			}
+		})
+	}
+
+	var behaviors map[string]Behavior
+	controlDo(t, stub, http.MethodGet, "/_control/behaviors", "", http.StatusOK, &behaviors)
+	assert.Contains(t, behaviors, "maintenance")
+	assert.Equal(t, http.StatusTeapot, behaviors["teapot"].Status)
+}
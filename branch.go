@@ -0,0 +1,151 @@
+package stubsrv
+
+import (
+	"cmp"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// SpecBranch serves Then when every condition of When holds. A spec's
+// branches are tried in order and its own response is the else branch.
+type SpecBranch struct {
+	When SpecCondition `json:"when"`
+	Then SpecResponse  `json:"then"`
+}
+
+// SpecCondition holds conditions over request data and scenario state. Empty
+// fields always hold.
+type SpecCondition struct {
+	Query    map[string]string `json:"query"`
+	Headers  map[string]string `json:"headers"`
+	Params   map[string]string `json:"params"`
+	Body     string            `json:"body"`
+	BodyMode BodyMatchMode     `json:"body_mode"`
+	Scenario string            `json:"scenario"`
+	State    string            `json:"state"`
+}
+
+type SpecResponse struct {
+	Status  int               `json:"status"`
+	Body    string            `json:"body"`
+	Headers map[string]string `json:"headers"`
+	Chunks  []SpecChunk       `json:"chunks"`
+}
+
+// SpecChunk is one piece of a streamed body, written and flushed after
+// waiting DelayMS.
+type SpecChunk struct {
+	Body    string `json:"body"`
+	DelayMS int    `json:"delay_ms"`
+}
+
+func (resp SpecResponse) validate() error {
+	if resp.Body != "" && len(resp.Chunks) > 0 {
+		return errors.New("body and chunks are mutually exclusive")
+	}
+	for _, c := range resp.Chunks {
+		if c.DelayMS < 0 {
+			return errors.New("chunk delay_ms must not be negative")
+		}
+	}
+	return nil
+}
+
+func (resp SpecResponse) write(w http.ResponseWriter, r *http.Request) {
+	for k, v := range resp.Headers {
+		w.Header().Set(k, v)
+	}
+	w.WriteHeader(resp.Status)
+	if resp.Body != "" {
+		_, _ = w.Write([]byte(resp.Body))
+	}
+
+	rc := http.NewResponseController(w)
+	for _, c := range resp.Chunks {
+		if c.DelayMS > 0 {
+			select {
+			case <-time.After(time.Duration(c.DelayMS) * time.Millisecond):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if _, err := w.Write([]byte(c.Body)); err != nil {
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Stub) conditionMatchers(cond SpecCondition) ([]Matcher, error) {
+	var matchers []Matcher
+	if len(cond.Query) > 0 {
+		query := cond.Query
+		matchers = append(matchers, func(r *http.Request) bool {
+			return queryMatch(query, r.URL.Query())
+		})
+	}
+	if len(cond.Headers) > 0 {
+		matchers = append(matchers, MatchHeaders(cond.Headers))
+	}
+	if len(cond.Params) > 0 {
+		params := cond.Params
+		matchers = append(matchers, func(r *http.Request) bool {
+			for k, v := range params {
+				if PathParam(r, k) != v {
+					return false
+				}
+			}
+			return true
+		})
+	}
+	if cond.Body != "" || cond.BodyMode != "" {
+		m, err := bodyMatcher(cmp.Or(cond.BodyMode, BodyExact), cond.Body)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, m)
+	}
+	if cond.State != "" {
+		if cond.Scenario == "" {
+			return nil, errors.New("branch state requires a scenario")
+		}
+		matchers = append(matchers, s.WhenState(cond.Scenario, cond.State))
+	}
+	return matchers, nil
+}
+
+// branchHandler serves the first branch whose conditions hold, or otherwise.
+func (s *Stub) branchHandler(branches []SpecBranch, otherwise http.HandlerFunc) (http.HandlerFunc, error) {
+	type compiled struct {
+		matchers []Matcher
+		resp     SpecResponse
+	}
+
+	cases := make([]compiled, 0, len(branches))
+	for _, b := range branches {
+		matchers, err := s.conditionMatchers(b.When)
+		if err != nil {
+			return nil, err
+		}
+		if err := b.Then.validate(); err != nil {
+			return nil, err
+		}
+		if b.Then.Status == 0 {
+			b.Then.Status = http.StatusOK
+		}
+		cases = append(cases, compiled{matchers: matchers, resp: b.Then})
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		for _, c := range cases {
+			if matchersMatch(c.matchers, r) {
+				c.resp.write(w, r)
+				return
+			}
+		}
+		otherwise(w, r)
+	}, nil
+}
@@ -0,0 +1,101 @@
+package stubsrv
+
+import (
+	"cmp"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStub_SpecBranches(t *testing.T) {
+	t.Parallel()
+
+	stub := NewStub(noopLogger())
+	require.NoError(t, stub.Start())
+	defer stub.Close()
+
+	controlAdd(t, stub, `{
+		"method": "POST",
+		"path": "/accounts/:id/charges",
+		"branches": [
+			{"when": {"params": {"id": "blocked"}}, "then": {"status": 403, "body": "blocked"}},
+			{"when": {"headers": {"Idempotency-Key": "replay"}}, "then": {"status": 409, "body": "replayed"}},
+			{"when": {"body": "\"amount\":0", "body_mode": "contains"}, "then": {"status": 422, "body": "zero"}},
+			{"when": {"query": {"dry_run": "1"}}, "then": {"body": "dry run"}},
+			{"when": {"scenario": "billing", "state": "down"}, "then": {"status": 503}}
+		],
+		"status": 201,
+		"body": "charged"
+	}`)
+	controlDo(t, stub, http.MethodPost, "/_control/handlers", `{"method":"GET","path":"/x","branches":[{"when":{"state":"a"}}]}`, http.StatusBadRequest, nil)
+	controlDo(t, stub, http.MethodPost, "/_control/handlers", `{"method":"GET","path":"/x","branches":[{"when":{"body":"(","body_mode":"regex"}}]}`, http.StatusBadRequest, nil)
+
+	testCases := []struct {
+		name           string
+		givenPath      string
+		givenHeaders   map[string]string
+		givenBody      string
+		givenState     string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{name: "else branch", givenPath: "/accounts/1/charges", givenBody: `{"amount":5}`, expectedStatus: http.StatusCreated, expectedBody: "charged"},
+		{name: "path param", givenPath: "/accounts/blocked/charges", expectedStatus: http.StatusForbidden, expectedBody: "blocked"},
+		{name: "header", givenPath: "/accounts/1/charges", givenHeaders: map[string]string{"Idempotency-Key": "replay"}, expectedStatus: http.StatusConflict, expectedBody: "replayed"},
+		{name: "body", givenPath: "/accounts/1/charges", givenBody: `{"amount":0}`, expectedStatus: http.StatusUnprocessableEntity, expectedBody: "zero"},
+		{name: "query with default status", givenPath: "/accounts/1/charges?dry_run=1", expectedStatus: http.StatusOK, expectedBody: "dry run"},
+		{name: "scenario state", givenPath: "/accounts/1/charges", givenState: "down", expectedStatus: http.StatusServiceUnavailable},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stub.SetScenarioState("billing", cmp.Or(tc.givenState, ScenarioStarted))
+
+			req, err := http.NewRequest(http.MethodPost, stub.URL()+tc.givenPath, strings.NewReader(tc.givenBody))
+			require.NoError(t, err)
+			for k, v := range tc.givenHeaders {
+				req.Header.Set(k, v)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, tc.expectedStatus, resp.StatusCode)
+			assert.Equal(t, tc.expectedBody, readAll(t, resp))
+		})
+	}
+}
+
+func TestStub_SpecChunks(t *testing.T) {
+	t.Parallel()
+
+	stub := NewStub(noopLogger())
+	require.NoError(t, stub.Start())
+	defer stub.Close()
+
+	controlAdd(t, stub, `{"method":"GET","path":"/stream","headers":{"Content-Type":"text/plain"},
+		"chunks":[{"body":"first\n"},{"body":"second\n","delay_ms":100}]}`)
+	controlDo(t, stub, http.MethodPost, "/_control/handlers", `{"method":"GET","path":"/x","body":"a","chunks":[{"body":"b"}]}`, http.StatusBadRequest, nil)
+	controlDo(t, stub, http.MethodPost, "/_control/handlers", `{"method":"GET","path":"/x","chunks":[{"body":"b","delay_ms":-1}]}`, http.StatusBadRequest, nil)
+
+	resp, err := http.Get(stub.URL() + "/stream")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	// the first chunk arrives before the delayed one is written
+	start := time.Now()
+	buf := make([]byte, len("first\n"))
+	_, err = io.ReadFull(resp.Body, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "first\n", string(buf))
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+
+	assert.Equal(t, "second\n", readAll(t, resp))
+	assert.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond)
+	assert.Equal(t, []string{"chunked"}, resp.TransferEncoding)
+}
@@ -0,0 +1,162 @@
+package stubsrv
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// RequestPattern is the method and path a builder route answers.
+type RequestPattern struct {
+	method string
+	path   string
+}
+
+func Get(path string) RequestPattern    { return RequestPattern{http.MethodGet, path} }
+func Post(path string) RequestPattern   { return RequestPattern{http.MethodPost, path} }
+func Put(path string) RequestPattern    { return RequestPattern{http.MethodPut, path} }
+func Patch(path string) RequestPattern  { return RequestPattern{http.MethodPatch, path} }
+func Delete(path string) RequestPattern { return RequestPattern{http.MethodDelete, path} }
+
+// RouteBuilder declares a canned route fluently:
+//
+//	stub.When(stubsrv.Get("/users/:id")).WithQuery("v", "2").Reply(200).JSON(user)
+//
+// The route is registered by the final JSON, Body or Empty call.
+type RouteBuilder struct {
+	stub        *Stub
+	pattern     RequestPattern
+	queries     map[string]string
+	matchers    []Matcher
+	middlewares []Middleware
+	priority    int
+}
+
+func (s *Stub) When(p RequestPattern) *RouteBuilder {
+	return &RouteBuilder{stub: s, pattern: p}
+}
+
+func (rb *RouteBuilder) WithQuery(key, value string) *RouteBuilder {
+	if rb.queries == nil {
+		rb.queries = make(map[string]string)
+	}
+	rb.queries[key] = value
+	return rb
+}
+
+func (rb *RouteBuilder) WithHeader(key, value string) *RouteBuilder {
+	rb.matchers = append(rb.matchers, MatchHeader(key, value))
+	return rb
+}
+
+func (rb *RouteBuilder) WithBody(mode BodyMatchMode, value string) *RouteBuilder {
+	rb.matchers = append(rb.matchers, MatchBody(mode, value))
+	return rb
+}
+
+func (rb *RouteBuilder) WithXPath(expr, value string) *RouteBuilder {
+	rb.matchers = append(rb.matchers, MatchXPath(expr, value))
+	return rb
+}
+
+func (rb *RouteBuilder) WithGraphQL(m GraphQLMatch) *RouteBuilder {
+	rb.matchers = append(rb.matchers, MatchGraphQL(m))
+	return rb
+}
+
+// WithPriority sets the route's priority. When several routes could serve
+// a request, the highest priority wins, then the path with the most literal
+// segments, then the most constraints, then the exact route or the first
+// registered. The default priority is 0.
+func (rb *RouteBuilder) WithPriority(priority int) *RouteBuilder {
+	rb.priority = priority
+	return rb
+}
+
+// Matching adds arbitrary matchers.
+func (rb *RouteBuilder) Matching(matchers ...Matcher) *RouteBuilder {
+	rb.matchers = append(rb.matchers, matchers...)
+	return rb
+}
+
+// Using adds per-route middlewares.
+func (rb *RouteBuilder) Using(middlewares ...Middleware) *RouteBuilder {
+	rb.middlewares = append(rb.middlewares, middlewares...)
+	return rb
+}
+
+func (rb *RouteBuilder) Reply(status int) *ResponseBuilder {
+	return &ResponseBuilder{route: rb, status: status, headers: make(http.Header)}
+}
+
+type ResponseBuilder struct {
+	route   *RouteBuilder
+	status  int
+	headers http.Header
+	delay   time.Duration
+}
+
+func (b *ResponseBuilder) Header(key, value string) *ResponseBuilder {
+	b.headers.Add(key, value)
+	return b
+}
+
+func (b *ResponseBuilder) Delay(d time.Duration) *ResponseBuilder {
+	b.delay = d
+	return b
+}
+
+// JSON registers the route answering with v encoded as JSON and returns its
+// ID. It panics if v cannot be encoded.
+func (b *ResponseBuilder) JSON(v any) string {
+	body, err := json.Marshal(v)
+	if err != nil {
+		panic("could not encode reply body: " + err.Error())
+	}
+	if b.headers.Get("Content-Type") == "" {
+		b.headers.Set("Content-Type", "application/json")
+	}
+	return b.register(body)
+}
+
+// Body registers the route answering with body and returns its ID.
+func (b *ResponseBuilder) Body(body string) string {
+	return b.register([]byte(body))
+}
+
+// Empty registers the route answering without a body and returns its ID.
+func (b *ResponseBuilder) Empty() string {
+	return b.register(nil)
+}
+
+func (b *ResponseBuilder) register(body []byte) string {
+	rb := b.route
+	status, headers := b.status, b.headers.Clone()
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		for k, v := range headers {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(status)
+		_, _ = w.Write(body)
+	}
+
+	middlewares := slices.Clone(rb.middlewares)
+	if b.delay > 0 {
+		middlewares = append(middlewares, WithDelay(b.delay))
+	}
+
+	rb.stub.mu.Lock()
+	defer rb.stub.mu.Unlock()
+
+	if rb.stub.closed {
+		panic("cannot add handlers on a closed stub server")
+	}
+	return rb.stub.addRoute(rb.pattern.method, rb.pattern.path, rb.queries, routeInfo{
+		handler:     http.HandlerFunc(handler),
+		middlewares: middlewares,
+		matchers:    rb.matchers,
+		priority:    rb.priority,
+	})
+}
@@ -0,0 +1,100 @@
+package stubsrv
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStub_When(t *testing.T) {
+	t.Parallel()
+
+	type user struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	}
+
+	stub := NewStub(noopLogger())
+	stub.When(Get("/users/:id")).Reply(http.StatusOK).JSON(user{ID: 1, Name: "v1"})
+	stub.When(Get("/users/:id")).WithQuery("v", "2").Reply(http.StatusOK).Header("X-Version", "2").JSON(user{ID: 1, Name: "v2"})
+	stub.When(Post("/users")).WithHeader("Authorization", "Bearer x").WithBody(BodyContains, "alice").Reply(http.StatusCreated).Body("created")
+	stub.When(Delete("/users/:id")).Reply(http.StatusNoContent).Delay(20 * time.Millisecond).Empty()
+	require.NoError(t, stub.Start())
+	defer stub.Close()
+
+	testCases := []struct {
+		name            string
+		givenMethod     string
+		givenPath       string
+		givenHeaders    map[string]string
+		givenBody       string
+		expectedStatus  int
+		expectedBody    string
+		expectedHeaders map[string]string
+	}{
+		{
+			name:            "JSON reply",
+			givenMethod:     http.MethodGet,
+			givenPath:       "/users/1",
+			expectedStatus:  http.StatusOK,
+			expectedBody:    `{"id":1,"name":"v1"}`,
+			expectedHeaders: map[string]string{"Content-Type": "application/json"},
+		},
+		{
+			name:            "query constraint",
+			givenMethod:     http.MethodGet,
+			givenPath:       "/users/1?v=2",
+			expectedStatus:  http.StatusOK,
+			expectedBody:    `{"id":1,"name":"v2"}`,
+			expectedHeaders: map[string]string{"X-Version": "2"},
+		},
+		{
+			name:           "header and body matchers",
+			givenMethod:    http.MethodPost,
+			givenPath:      "/users",
+			givenHeaders:   map[string]string{"Authorization": "Bearer x"},
+			givenBody:      `{"name":"alice"}`,
+			expectedStatus: http.StatusCreated,
+			expectedBody:   "created",
+		},
+		{
+			name:           "matchers reject",
+			givenMethod:    http.MethodPost,
+			givenPath:      "/users",
+			givenBody:      `{"name":"alice"}`,
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   "404 page not found\n",
+		},
+		{
+			name:           "empty reply",
+			givenMethod:    http.MethodDelete,
+			givenPath:      "/users/1",
+			expectedStatus: http.StatusNoContent,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(tc.givenMethod, stub.URL()+tc.givenPath, strings.NewReader(tc.givenBody))
+			require.NoError(t, err)
+			for k, v := range tc.givenHeaders {
+				req.Header.Set(k, v)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, tc.expectedStatus, resp.StatusCode)
+			assert.Equal(t, tc.expectedBody, readAll(t, resp))
+			for k, v := range tc.expectedHeaders {
+				assert.Equal(t, v, resp.Header.Get(k))
+			}
+		})
+	}
+
+	assert.Panics(t, func() { stub.When(Get("/bad")).Reply(http.StatusOK).JSON(make(chan int)) })
+}
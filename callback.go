@@ -0,0 +1,363 @@
+package stubsrv
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+const (
+	defaultCallbackWorkers  = 4
+	callbackQueueSize       = 256
+	callbackAttempts        = 3
+	callbackBackoff         = 100 * time.Millisecond
+	callbackTimeout         = 10 * time.Second
+	callbackDeliveriesLimit = 1000
+)
+
+// Callback is an outbound request fired after a route responds, emulating
+// webhooks such as payment notifications. URL, Body and header values are
+// text/template templates over the triggering request:
+//
+//	.Method .Path        request line
+//	.Params .Query       path parameters and first query values
+//	.Headers             first header values, canonical keys
+//	.Body                request body decoded as JSON, or nil
+//	.RawBody             request body as a string
+//
+// so {"url":"{{.Body.callback_url}}"} calls back the URL the client sent.
+type Callback struct {
+	URL     string            `json:"url"`
+	Method  string            `json:"method"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+	DelayMS int               `json:"delay_ms"`
+}
+
+// Delivery is the outcome of one callback.
+type Delivery struct {
+	Method   string    `json:"method"`
+	URL      string    `json:"url"`
+	Attempts int       `json:"attempts"`
+	Status   int       `json:"status,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// WithCallbackWorkers sets how many callbacks are delivered concurrently.
+// Defaults to 4. Callbacks beyond the queue are dropped and recorded as
+// failed deliveries.
+func WithCallbackWorkers(n int) Option {
+	return func(cfg *stubConfig) {
+		cfg.callbackWorkers = n
+	}
+}
+
+type compiledCallback struct {
+	method  string
+	url     *template.Template
+	body    *template.Template
+	headers map[string]*template.Template
+	delay   time.Duration
+}
+
+type callbackData struct {
+	Method  string
+	Path    string
+	Params  map[string]string
+	Query   map[string]string
+	Headers map[string]string
+	Body    any
+	RawBody string
+}
+
+func compileCallback(cb Callback) (*compiledCallback, error) {
+	if cb.URL == "" {
+		return nil, errors.New("callback url is required")
+	}
+	if cb.DelayMS < 0 {
+		return nil, errors.New("callback delay_ms must not be negative")
+	}
+
+	parse := func(name, text string) (*template.Template, error) {
+		t, err := template.New(name).Option("missingkey=zero").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid callback %s template: %w", name, err)
+		}
+		return t, nil
+	}
+
+	c := compiledCallback{
+		method:  strings.ToUpper(cmp.Or(cb.Method, http.MethodPost)),
+		headers: make(map[string]*template.Template, len(cb.Headers)),
+		delay:   time.Duration(cb.DelayMS) * time.Millisecond,
+	}
+	var err error
+	if c.url, err = parse("url", cb.URL); err != nil {
+		return nil, err
+	}
+	if c.body, err = parse("body", cb.Body); err != nil {
+		return nil, err
+	}
+	for k, v := range cb.Headers {
+		if c.headers[k], err = parse("header "+k, v); err != nil {
+			return nil, err
+		}
+	}
+	return &c, nil
+}
+
+// render builds the outbound request from data.
+func (c *compiledCallback) render(data callbackData) (*http.Request, error) {
+	exec := func(t *template.Template) (string, error) {
+		var b strings.Builder
+		err := t.Execute(&b, data)
+		return b.String(), err
+	}
+
+	url, err := exec(c.url)
+	if err != nil {
+		return nil, err
+	}
+	body, err := exec(c.body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(c.method, strings.TrimSpace(url), strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, t := range c.headers {
+		v, err := exec(t)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set(k, v)
+	}
+	return req, nil
+}
+
+func newCallbackData(r *http.Request) callbackData {
+	raw := peekBody(r)
+	params, _ := r.Context().Value(pathParamsKey{}).(map[string]string)
+	data := callbackData{
+		Method:  r.Method,
+		Path:    r.URL.Path,
+		Params:  params,
+		Query:   make(map[string]string),
+		Headers: make(map[string]string),
+		RawBody: string(raw),
+	}
+	for k, v := range r.URL.Query() {
+		data.Query[k] = v[0]
+	}
+	for k, v := range r.Header {
+		data.Headers[k] = v[0]
+	}
+	_ = json.Unmarshal(raw, &data.Body)
+	return data
+}
+
+// Callback returns a middleware firing cb once the route has responded.
+// It panics if cb is invalid.
+func (s *Stub) Callback(cb Callback) Middleware {
+	c, err := compileCallback(cb)
+	if err != nil {
+		panic(err)
+	}
+	return s.callbackMiddleware(c)
+}
+
+func (s *Stub) callbackMiddleware(c *compiledCallback) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			data := newCallbackData(r)
+			next.ServeHTTP(w, r)
+
+			req, err := c.render(data)
+			if err != nil {
+				s.callbacks.record(Delivery{Method: c.method, Error: err.Error(), Time: time.Now()})
+				return
+			}
+			s.callbacks.enqueue(req, c.delay)
+		})
+	}
+}
+
+// Deliveries returns the outcome of every finished callback, oldest first.
+func (s *Stub) Deliveries() []Delivery {
+	return s.callbacks.all()
+}
+
+// controlDeliveries serves GET /_control/deliveries.
+func (s *Stub) controlDeliveries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.Deliveries())
+}
+
+// callbackPool delivers callbacks with a fixed number of workers, retrying
+// failed attempts with exponential backoff. The workers start with the
+// first callback, so stubs without callbacks run no goroutines.
+type callbackPool struct {
+	logger  *slog.Logger
+	client  *http.Client
+	queue   chan *http.Request
+	workers int
+	// ctx is canceled on close, aborting in-flight deliveries.
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu         sync.Mutex
+	deliveries []Delivery
+	started    bool
+	closed     bool
+}
+
+func newCallbackPool(logger *slog.Logger, workers int) *callbackPool {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &callbackPool{
+		logger:  logger,
+		client:  &http.Client{Timeout: callbackTimeout},
+		queue:   make(chan *http.Request, callbackQueueSize),
+		workers: cmp.Or(workers, defaultCallbackWorkers),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// start starts the workers unless they are running or the pool is closed.
+func (p *callbackPool) start() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.started || p.closed {
+		return
+	}
+	p.started = true
+	for range p.workers {
+		p.wg.Add(1)
+		go p.work()
+	}
+}
+
+func (p *callbackPool) enqueue(req *http.Request, delay time.Duration) {
+	p.start()
+
+	push := func() {
+		select {
+		case p.queue <- req:
+		case <-p.ctx.Done():
+		default:
+			p.record(Delivery{Method: req.Method, URL: req.URL.String(), Error: "callback queue full", Time: time.Now()})
+		}
+	}
+	if delay > 0 {
+		time.AfterFunc(delay, push)
+		return
+	}
+	push()
+}
+
+func (p *callbackPool) work() {
+	defer p.wg.Done()
+
+	for {
+		select {
+		case req := <-p.queue:
+			p.record(p.deliver(req))
+		case <-p.ctx.Done():
+			return
+		}
+	}
+}
+
+func (p *callbackPool) deliver(req *http.Request) Delivery {
+	d := Delivery{Method: req.Method, URL: req.URL.String()}
+
+	body, _ := io.ReadAll(req.Body)
+	backoff := callbackBackoff
+	for d.Attempts < callbackAttempts {
+		if d.Attempts > 0 {
+			select {
+			case <-time.After(backoff):
+				backoff *= 2
+			case <-p.ctx.Done():
+				d.Time = time.Now()
+				return d
+			}
+		}
+		d.Attempts++
+
+		attempt := req.Clone(p.ctx)
+		attempt.Body = io.NopCloser(bytes.NewReader(body))
+		resp, err := p.client.Do(attempt)
+		if err != nil {
+			d.Status, d.Error = 0, err.Error()
+			continue
+		}
+		_ = resp.Body.Close()
+
+		d.Status, d.Error = resp.StatusCode, ""
+		if resp.StatusCode < http.StatusInternalServerError {
+			break
+		}
+		d.Error = "upstream answered " + resp.Status
+	}
+
+	d.Time = time.Now()
+	p.logger.Debug("Callback delivered", slog.String("url", d.URL), slog.Int("status", d.Status), slog.Int("attempts", d.Attempts))
+	return d
+}
+
+func (p *callbackPool) record(d Delivery) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.deliveries = append(p.deliveries, d)
+	if len(p.deliveries) > callbackDeliveriesLimit {
+		p.deliveries = p.deliveries[1:]
+	}
+}
+
+func (p *callbackPool) all() []Delivery {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]Delivery(nil), p.deliveries...)
+}
+
+func (p *callbackPool) reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.deliveries = nil
+}
+
+// close stops the workers, abandoning queued callbacks and canceling
+// in-flight ones. It does not wait for the workers to return, see wait.
+func (p *callbackPool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+	p.cancel()
+}
+
+// wait blocks until the workers stopped by close have returned.
+func (p *callbackPool) wait() {
+	p.wg.Wait()
+}
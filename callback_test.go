@@ -0,0 +1,139 @@
+package stubsrv
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStub_Callback(t *testing.T) {
+	t.Parallel()
+
+	receiver := NewStub(noopLogger())
+	var failures atomic.Int32
+	failures.Store(1)
+	receiver.AddHandler(http.MethodPost, "/hooks/:order", func(w http.ResponseWriter, r *http.Request) {
+		if failures.Add(-1) >= 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	require.NoError(t, receiver.Start())
+	t.Cleanup(receiver.Close)
+
+	stub := NewStub(noopLogger())
+	stub.AddHandler(http.MethodPost, "/orders/:id", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}, stub.Callback(Callback{
+		URL:     "{{.Body.callback_url}}/{{.Params.id}}",
+		Headers: map[string]string{"X-Order": "{{.Params.id}}"},
+		Body:    `{"id":"{{.Params.id}}","status":"paid"}`,
+		DelayMS: 20,
+	}))
+	require.NoError(t, stub.Start())
+	t.Cleanup(stub.Close)
+
+	start := time.Now()
+	resp, err := http.Post(stub.URL()+"/orders/42", "application/json",
+		strings.NewReader(`{"callback_url":"`+receiver.URL()+`/hooks"}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	require.Eventually(t, func() bool { return len(stub.Deliveries()) == 1 }, 2*time.Second, 10*time.Millisecond)
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+
+	delivery := stub.Deliveries()[0]
+	assert.Equal(t, receiver.URL()+"/hooks/42", delivery.URL)
+	assert.Equal(t, 2, delivery.Attempts, "the 503 is retried")
+	assert.Equal(t, http.StatusNoContent, delivery.Status)
+	assert.Empty(t, delivery.Error)
+
+	calls := receiver.Requests()
+	require.Len(t, calls, 2)
+	assert.Equal(t, "42", calls[1].Header.Get("X-Order"))
+	assert.JSONEq(t, `{"id":"42","status":"paid"}`, string(calls[1].Body))
+}
+
+func TestStub_CallbackSpec(t *testing.T) {
+	t.Parallel()
+
+	receiver := NewStub(noopLogger())
+	receiver.AddHandler(http.MethodPut, "/notify", func(w http.ResponseWriter, r *http.Request) {})
+	require.NoError(t, receiver.Start())
+	t.Cleanup(receiver.Close)
+
+	stub := NewStub(noopLogger(), WithCallbackWorkers(1))
+	require.NoError(t, stub.Start())
+	t.Cleanup(stub.Close)
+
+	controlAdd(t, stub, `{"method":"post","path":"/pay","status":201,
+		"callback":{"url":"`+receiver.URL()+`/notify?ref={{.Query.ref}}","method":"put","body":"{{.RawBody}}"}}`)
+	controlDo(t, stub, http.MethodPost, "/_control/handlers",
+		`{"method":"post","path":"/bad","callback":{"body":"{{.Body"}}`, http.StatusBadRequest, nil)
+
+	resp, err := http.Post(stub.URL()+"/pay?ref=abc", "text/plain", strings.NewReader("amount=10"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	require.Eventually(t, func() bool { return len(receiver.Requests()) == 1 }, 2*time.Second, 10*time.Millisecond)
+	call := receiver.Requests()[0]
+	assert.Equal(t, "abc", call.Query.Get("ref"))
+	assert.Equal(t, "amount=10", string(call.Body))
+
+	require.Eventually(t, func() bool { return len(stub.Deliveries()) == 1 }, time.Second, 10*time.Millisecond)
+	resp, err = http.Get(stub.URL() + "/_control/deliveries")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), `"method":"PUT"`)
+	assert.Contains(t, string(body), `"status":200`)
+
+	stub.Reset()
+	assert.Empty(t, stub.Deliveries())
+}
+
+func TestStub_CallbackClose(t *testing.T) {
+	t.Parallel()
+
+	stub := NewStub(noopLogger())
+	assert.False(t, stub.callbacks.started, "workers start with the first callback")
+
+	entered := make(chan struct{})
+	stub.AddHandler(http.MethodPost, "/hook", func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		<-r.Context().Done()
+	})
+	stub.AddHandler(http.MethodPost, "/trigger", func(w http.ResponseWriter, r *http.Request) {},
+		stub.Callback(Callback{URL: "{{.Body.url}}/hook"}))
+	require.NoError(t, stub.Start())
+
+	resp, err := http.Post(stub.URL()+"/trigger", "application/json", strings.NewReader(`{"url":"`+stub.URL()+`"}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	<-entered
+	stub.callbacks.mu.Lock()
+	assert.True(t, stub.callbacks.started)
+	stub.callbacks.mu.Unlock()
+
+	// the callback to the stub itself is in flight
+	closed := make(chan struct{})
+	go func() {
+		stub.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Close waited for the in-flight callback")
+	}
+}
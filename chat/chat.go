@@ -0,0 +1,206 @@
+// Package chat emulates Slack and Discord incoming-webhook APIs, including
+// rate limiting and injected failures, and keeps a log of accepted messages.
+//
+// Routes:
+//
+//	POST /services/:team/:bot/:token      Slack incoming webhook
+//	POST /api/webhooks/:id/:token         Discord webhook (?wait=true returns the message)
+package chat
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/alesr/stubsrv"
+)
+
+type Platform string
+
+const (
+	Slack   Platform = "slack"
+	Discord Platform = "discord"
+)
+
+type Message struct {
+	Platform Platform
+	Path     string
+	// Text is Slack's "text" or Discord's "content".
+	Text    string
+	Payload map[string]any
+	Time    time.Time
+}
+
+type Config struct {
+	// RateLimit is the number of messages accepted per RateWindow.
+	// Zero disables rate limiting.
+	RateLimit  int
+	RateWindow time.Duration
+}
+
+type failure struct {
+	status     int
+	retryAfter time.Duration
+}
+
+type Server struct {
+	cfg Config
+	now func() time.Time
+
+	mu       sync.Mutex
+	messages []Message
+	recent   []time.Time
+	failures []failure
+}
+
+func New(stub *stubsrv.Stub, cfg Config) *Server {
+	if cfg.RateWindow == 0 {
+		cfg.RateWindow = time.Second
+	}
+	srv := Server{cfg: cfg, now: time.Now}
+
+	stub.AddHandler(http.MethodPost, "/services/:team/:bot/:token", srv.handleSlack)
+	stub.AddHandler(http.MethodPost, "/api/webhooks/:id/:token", srv.handleDiscord)
+	return &srv
+}
+
+func (srv *Server) Messages() []Message {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	return append([]Message(nil), srv.messages...)
+}
+
+// FailNext makes the next n deliveries fail with status. For 429 the
+// response carries retryAfter in the platform's rate-limit format.
+func (srv *Server) FailNext(n, status int, retryAfter time.Duration) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	for range n {
+		srv.failures = append(srv.failures, failure{status: status, retryAfter: retryAfter})
+	}
+}
+
+// admit applies injected failures and the rate limit, returning the failure
+// to serve if the message must be rejected.
+func (srv *Server) admit() (failure, bool) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	if len(srv.failures) > 0 {
+		f := srv.failures[0]
+		srv.failures = srv.failures[1:]
+		return f, false
+	}
+
+	if srv.cfg.RateLimit == 0 {
+		return failure{}, true
+	}
+
+	now := srv.now()
+	cutoff := now.Add(-srv.cfg.RateWindow)
+	for len(srv.recent) > 0 && !srv.recent[0].After(cutoff) {
+		srv.recent = srv.recent[1:]
+	}
+	if len(srv.recent) >= srv.cfg.RateLimit {
+		return failure{
+			status:     http.StatusTooManyRequests,
+			retryAfter: srv.recent[0].Add(srv.cfg.RateWindow).Sub(now),
+		}, false
+	}
+	srv.recent = append(srv.recent, now)
+	return failure{}, true
+}
+
+func (srv *Server) remaining() int {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	return max(srv.cfg.RateLimit-len(srv.recent), 0)
+}
+
+func (srv *Server) store(msg Message) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	msg.Time = srv.now()
+	srv.messages = append(srv.messages, msg)
+}
+
+func (srv *Server) handleSlack(w http.ResponseWriter, r *http.Request) {
+	var payload map[string]any
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "invalid_payload", http.StatusBadRequest)
+		return
+	}
+	text, _ := payload["text"].(string)
+	if text == "" && payload["blocks"] == nil && payload["attachments"] == nil {
+		http.Error(w, "no_text", http.StatusBadRequest)
+		return
+	}
+
+	if f, ok := srv.admit(); !ok {
+		if f.status == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(f.retryAfter.Seconds()))))
+			http.Error(w, "rate_limited", f.status)
+			return
+		}
+		http.Error(w, http.StatusText(f.status), f.status)
+		return
+	}
+
+	srv.store(Message{Platform: Slack, Path: r.URL.Path, Text: text, Payload: payload})
+	w.Header().Set("Content-Type", "text/plain")
+	_, _ = w.Write([]byte("ok"))
+}
+
+func (srv *Server) handleDiscord(w http.ResponseWriter, r *http.Request) {
+	var payload map[string]any
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"message": "400: Bad Request", "code": 50109})
+		return
+	}
+	content, _ := payload["content"].(string)
+	if content == "" && payload["embeds"] == nil {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"message": "Cannot send an empty message", "code": 50006})
+		return
+	}
+
+	if f, ok := srv.admit(); !ok {
+		if f.status == http.StatusTooManyRequests {
+			retry := f.retryAfter.Seconds()
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retry))))
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(srv.cfg.RateLimit))
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset-After", fmt.Sprintf("%.3f", retry))
+			writeJSON(w, f.status, map[string]any{"message": "You are being rate limited.", "retry_after": retry, "global": false})
+			return
+		}
+		writeJSON(w, f.status, map[string]any{"message": http.StatusText(f.status), "code": 0})
+		return
+	}
+
+	if srv.cfg.RateLimit > 0 {
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(srv.cfg.RateLimit))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(srv.remaining()))
+	}
+
+	srv.store(Message{Platform: Discord, Path: r.URL.Path, Text: content, Payload: payload})
+
+	if r.URL.Query().Get("wait") == "true" {
+		writeJSON(w, http.StatusOK, map[string]any{"id": strconv.Itoa(len(srv.Messages())), "content": content})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,122 @@
+package chat
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/alesr/stubsrv"
+	"github.com/alesr/stubsrv/internal/stubtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	slackPath   = "/services/T000/B000/XXXX"
+	discordPath = "/api/webhooks/123/token"
+)
+
+func TestServer_Slack(t *testing.T) {
+	t.Parallel()
+
+	stub, srv := newServer(t, Config{})
+
+	testCases := []struct {
+		name           string
+		givenBody      string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{name: "text message", givenBody: `{"text":"deploy finished"}`, expectedStatus: http.StatusOK, expectedBody: "ok"},
+		{name: "blocks message", givenBody: `{"blocks":[{"type":"section"}]}`, expectedStatus: http.StatusOK, expectedBody: "ok"},
+		{name: "empty message", givenBody: `{"channel":"#ops"}`, expectedStatus: http.StatusBadRequest, expectedBody: "no_text\n"},
+		{name: "invalid JSON", givenBody: `{`, expectedStatus: http.StatusBadRequest, expectedBody: "invalid_payload\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, body := stubtest.Do(t, http.MethodPost, stub.URL()+slackPath, tc.givenBody)
+			assert.Equal(t, tc.expectedStatus, resp.StatusCode)
+			assert.Equal(t, tc.expectedBody, body)
+		})
+	}
+
+	msgs := srv.Messages()
+	require.Len(t, msgs, 2)
+	assert.Equal(t, Slack, msgs[0].Platform)
+	assert.Equal(t, "deploy finished", msgs[0].Text)
+	assert.Equal(t, slackPath, msgs[0].Path)
+}
+
+func TestServer_Discord(t *testing.T) {
+	t.Parallel()
+
+	stub, srv := newServer(t, Config{})
+
+	resp, _ := stubtest.Do(t, http.MethodPost, stub.URL()+discordPath, `{"content":"hi"}`)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	resp, body := stubtest.Do(t, http.MethodPost, stub.URL()+discordPath+"?wait=true", `{"content":"again"}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.JSONEq(t, `{"id":"2","content":"again"}`, body)
+
+	resp, body = stubtest.Do(t, http.MethodPost, stub.URL()+discordPath, `{}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Contains(t, body, "50006")
+
+	assert.Len(t, srv.Messages(), 2)
+}
+
+func TestServer_RateLimit(t *testing.T) {
+	t.Parallel()
+
+	stub, srv := newServer(t, Config{RateLimit: 2, RateWindow: 10 * time.Second})
+	now := time.Now()
+	srv.now = func() time.Time { return now }
+
+	for range 2 {
+		resp, _ := stubtest.Do(t, http.MethodPost, stub.URL()+discordPath, `{"content":"x"}`)
+		require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	}
+
+	resp, body := stubtest.Do(t, http.MethodPost, stub.URL()+discordPath, `{"content":"x"}`)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "10", resp.Header.Get("Retry-After"))
+	assert.Equal(t, "0", resp.Header.Get("X-RateLimit-Remaining"))
+	assert.JSONEq(t, `{"message":"You are being rate limited.","retry_after":10,"global":false}`, body)
+
+	resp, _ = stubtest.Do(t, http.MethodPost, stub.URL()+slackPath, `{"text":"x"}`)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+
+	now = now.Add(11 * time.Second)
+	resp, _ = stubtest.Do(t, http.MethodPost, stub.URL()+slackPath, `{"text":"x"}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, srv.Messages(), 3)
+}
+
+func TestServer_FailNext(t *testing.T) {
+	t.Parallel()
+
+	stub, srv := newServer(t, Config{})
+	srv.FailNext(1, http.StatusServiceUnavailable, 0)
+	srv.FailNext(1, http.StatusTooManyRequests, 2*time.Second)
+
+	resp, _ := stubtest.Do(t, http.MethodPost, stub.URL()+slackPath, `{"text":"retry me"}`)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+	resp, _ = stubtest.Do(t, http.MethodPost, stub.URL()+slackPath, `{"text":"retry me"}`)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "2", resp.Header.Get("Retry-After"))
+
+	resp, _ = stubtest.Do(t, http.MethodPost, stub.URL()+slackPath, `{"text":"retry me"}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, srv.Messages(), 1)
+}
+
+func newServer(t *testing.T, cfg Config) (*stubsrv.Stub, *Server) {
+	t.Helper()
+
+	var srv *Server
+	stub := stubtest.New(t, func(stub *stubsrv.Stub) { srv = New(stub, cfg) })
+	return stub, srv
+}
@@ -0,0 +1,121 @@
+package stubsrv
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// Checksum is an integrity header computed from the response body.
+type Checksum string
+
+const (
+	// ChecksumContentMD5 sets Content-MD5 to the base64 MD5 of the body.
+	ChecksumContentMD5 Checksum = "content-md5"
+	// ChecksumDigest sets Digest to sha-256=<base64 SHA-256 of the body>,
+	// as in RFC 3230.
+	ChecksumDigest Checksum = "digest"
+	// ChecksumETag sets a strong ETag derived from the body's SHA-256.
+	ChecksumETag Checksum = "etag"
+)
+
+func (c Checksum) valid() bool {
+	switch c {
+	case ChecksumContentMD5, ChecksumDigest, ChecksumETag:
+		return true
+	}
+	return false
+}
+
+// WithChecksums returns a middleware setting the given integrity headers,
+// or all of them when none are given, from the body the route writes.
+// Headers the route sets itself are left alone, and HEAD and 304 responses,
+// which have no body, get none. The response is buffered, so streamed chunks
+// arrive at once. It panics on an unknown checksum.
+func WithChecksums(checksums ...Checksum) Middleware {
+	if len(checksums) == 0 {
+		checksums = []Checksum{ChecksumContentMD5, ChecksumDigest, ChecksumETag}
+	}
+	for _, c := range checksums {
+		if !c.valid() {
+			panic(fmt.Sprintf("unknown checksum: %s", c))
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			bw := &bufferedWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(bw, r)
+			if bw.hijacked {
+				return
+			}
+
+			body := bw.body.Bytes()
+			if r.Method != http.MethodHead && bw.status != http.StatusNotModified {
+				setChecksums(w.Header(), checksums, body)
+			}
+			w.WriteHeader(bw.status)
+			_, _ = w.Write(body)
+		})
+	}
+}
+
+func setChecksums(header http.Header, checksums []Checksum, body []byte) {
+	sum := sha256.Sum256(body)
+	for _, c := range checksums {
+		var key, value string
+		switch c {
+		case ChecksumContentMD5:
+			md5Sum := md5.Sum(body)
+			key, value = "Content-MD5", base64.StdEncoding.EncodeToString(md5Sum[:])
+		case ChecksumDigest:
+			key, value = "Digest", "sha-256="+base64.StdEncoding.EncodeToString(sum[:])
+		case ChecksumETag:
+			key, value = "ETag", `"`+hex.EncodeToString(sum[:16])+`"`
+		}
+		if header.Get(key) == "" {
+			header.Set(key, value)
+		}
+	}
+}
+
+// bufferedWriter holds back a route's status and body until it returns.
+// Headers go straight to the underlying writer, which sends none of them
+// before WriteHeader. Hijack passes through, so faults and raw responses
+// still reach the connection.
+type bufferedWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	hijacked    bool
+	body        bytes.Buffer
+}
+
+func (bw *bufferedWriter) WriteHeader(status int) {
+	if bw.wroteHeader {
+		return
+	}
+	bw.status, bw.wroteHeader = status, true
+}
+
+func (bw *bufferedWriter) Write(p []byte) (int, error) {
+	bw.wroteHeader = true
+	return bw.body.Write(p)
+}
+
+// Flush is a no-op: the body is sent once the route returns.
+func (bw *bufferedWriter) Flush() {}
+
+func (bw *bufferedWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, buf, err := http.NewResponseController(bw.ResponseWriter).Hijack()
+	if err == nil {
+		bw.hijacked = true
+	}
+	return conn, buf, err
+}
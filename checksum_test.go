@@ -0,0 +1,151 @@
+package stubsrv
+
+import (
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithChecksums(t *testing.T) {
+	t.Parallel()
+
+	stub := NewStub(noopLogger())
+	hello := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("hello"))
+	}
+	stub.AddHandler(http.MethodGet, "/all", hello, WithChecksums())
+	stub.AddHandler(http.MethodGet, "/md5", hello, WithChecksums(ChecksumContentMD5))
+	stub.AddHandler(http.MethodGet, "/etag", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write([]byte("hello"))
+	}, WithChecksums(ChecksumETag))
+	require.NoError(t, stub.Start())
+	t.Cleanup(stub.Close)
+
+	controlAdd(t, stub, `{"method":"GET","path":"/spec","body":"hello","checksums":["digest"]}`)
+	controlDo(t, stub, http.MethodPost, "/_control/handlers",
+		`{"method":"GET","path":"/bad","checksums":["crc32"]}`, http.StatusBadRequest, nil)
+
+	const (
+		md5Hello    = "XUFAKrxLKna5cZ2REBfFkg=="
+		digestHello = "sha-256=LPJNul+wow4m6DsqxbninhsWHlwfp0JecwQzYpOLmCQ="
+		etagHello   = `"2cf24dba5fb0a30e26e83b2ac5b9e29e"`
+	)
+
+	testCases := []struct {
+		name            string
+		givenPath       string
+		expectedStatus  int
+		expectedHeaders map[string]string
+	}{
+		{
+			name:           "all checksums",
+			givenPath:      "/all",
+			expectedStatus: http.StatusCreated,
+			expectedHeaders: map[string]string{
+				"Content-MD5": md5Hello,
+				"Digest":      digestHello,
+				"ETag":        etagHello,
+			},
+		},
+		{
+			name:            "selected checksum",
+			givenPath:       "/md5",
+			expectedStatus:  http.StatusCreated,
+			expectedHeaders: map[string]string{"Content-MD5": md5Hello, "Digest": "", "ETag": ""},
+		},
+		{
+			name:            "route header wins",
+			givenPath:       "/etag",
+			expectedStatus:  http.StatusOK,
+			expectedHeaders: map[string]string{"ETag": `"v1"`},
+		},
+		{
+			name:            "spec checksums",
+			givenPath:       "/spec",
+			expectedStatus:  http.StatusOK,
+			expectedHeaders: map[string]string{"Digest": digestHello, "Content-MD5": ""},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			resp, err := http.Get(stub.URL() + tc.givenPath)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, tc.expectedStatus, resp.StatusCode)
+			assert.Equal(t, "hello", readAll(t, resp))
+			for k, v := range tc.expectedHeaders {
+				assert.Equal(t, v, resp.Header.Get(k), k)
+			}
+		})
+	}
+
+	assert.Panics(t, func() { WithChecksums("crc32") })
+}
+
+func TestWithChecksums_NoBody(t *testing.T) {
+	t.Parallel()
+
+	stub := NewStub(noopLogger())
+	hello := func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("hello"))
+	}
+	stub.AddHandler(http.MethodHead, "/head", hello, WithChecksums())
+	stub.AddHandler(http.MethodGet, "/cached", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotModified)
+	}, WithChecksums())
+	require.NoError(t, stub.Start())
+	t.Cleanup(stub.Close)
+
+	testCases := []struct {
+		name           string
+		givenMethod    string
+		givenPath      string
+		expectedStatus int
+	}{
+		{name: "head", givenMethod: http.MethodHead, givenPath: "/head", expectedStatus: http.StatusOK},
+		{name: "not modified", givenMethod: http.MethodGet, givenPath: "/cached", expectedStatus: http.StatusNotModified},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			req, err := http.NewRequest(tc.givenMethod, stub.URL()+tc.givenPath, nil)
+			require.NoError(t, err)
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, tc.expectedStatus, resp.StatusCode)
+			for _, k := range []string{"Content-MD5", "Digest", "ETag"} {
+				assert.Empty(t, resp.Header.Get(k), k)
+			}
+		})
+	}
+}
+
+func TestWithChecksums_Hijack(t *testing.T) {
+	t.Parallel()
+
+	stub := NewStub(noopLogger())
+	stub.AddFault(http.MethodGet, "/fault", FaultMalformedChunk, WithChecksums())
+	require.NoError(t, stub.Start())
+	t.Cleanup(stub.Close)
+
+	resp, err := http.Get(stub.URL() + "/fault")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	_, err = io.ReadAll(resp.Body)
+	assert.Error(t, err, "the fault reaches the connection")
+}
@@ -0,0 +1,155 @@
+// Command stubsrv runs a stub server as a standalone process, for example as
+// a Docker sidecar for services not written in Go.
+//
+// Routes are read from a JSON or YAML config file, either a list of handler
+// specs as accepted by POST /_control/handlers or a config object as
+// accepted by POST /_control/config/apply:
+//
+//	routes:
+//	  - method: GET
+//	    path: /users/:id
+//	    status: 200
+//	    body: '{"name":"Ada"}'
+//	    headers:
+//	      Content-Type: application/json
+//
+// A config may instead declare several stubs, each served on its own port
+// with its own routes and journal, see stubsrv.LoadStubs. -port and
+// -control-port are then taken from the config:
+//
+//	stubs:
+//	  - {name: users, port: "8081", routes: [{method: GET, path: /users/1}]}
+//	  - {name: billing, port: "8082", routes: [{method: GET, path: /invoices}]}
+//
+// The control plane is served alongside the routes, or on -control-port, so
+// tests can add, inspect and reset routes over HTTP. Set -control-token, or
+// STUBSRV_CONTROL_TOKEN, to require a bearer token on it.
+//
+// Set -profile, or STUBSRV_PROFILE, to serve one of the config's profiles,
+// such as a degraded variant of the routes.
+//
+// stubsrv record proxies every request to -upstream and, on exit, writes the
+// exchanges to routes.json under -out, one route per distinct request, so a
+// session against a real API becomes a config stubsrv can serve:
+//
+//	stubsrv record -upstream https://api.example.com -out ./fixtures
+//	stubsrv -config ./fixtures/routes.json
+//
+// Usage:
+//
+//	stubsrv [-config routes.yaml] [-profile name] [-watch] [-port 8080]
+//	        [-control-port 8081] [-control-token secret] [-strict] [-tls]
+//	        [-log-level info]
+//	stubsrv record -upstream URL [-out fixtures] [-port 8080] [-log-level info]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/alesr/stubsrv"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, os.Args[1:], os.Stderr); err != nil {
+		fmt.Fprintln(os.Stderr, "stubsrv:", err)
+		os.Exit(1)
+	}
+}
+
+// run serves until ctx is done.
+func run(ctx context.Context, args []string, stderr io.Writer) error {
+	if len(args) > 0 && args[0] == "record" {
+		return record(ctx, args[1:], stderr)
+	}
+
+	fs := flag.NewFlagSet("stubsrv", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var (
+		configPath = fs.String("config", "", "JSON or YAML file of routes to serve")
+		profile    = fs.String("profile", os.Getenv("STUBSRV_PROFILE"), "profile of the config to serve")
+		port       = fs.String("port", "8080", "port to listen on, 0 for a random one")
+		strict     = fs.Bool("strict", false, "record requests no route answers as unexpected")
+		useTLS     = fs.Bool("tls", false, "serve HTTPS with a self-signed certificate")
+		watch      = fs.Bool("watch", false, "reload the config file when it changes")
+		ctrlPort   = fs.String("control-port", "", "serve the control endpoints on this port instead")
+		ctrlToken  = fs.String("control-token", os.Getenv("STUBSRV_CONTROL_TOKEN"), "bearer token required by the control endpoints")
+		logLevel   = fs.String("log-level", "info", "debug, info, warn or error")
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected argument: %s", fs.Arg(0))
+	}
+
+	logger, err := newLogger(*logLevel, stderr)
+	if err != nil {
+		return err
+	}
+
+	opts := []stubsrv.Option{stubsrv.WithPort(*port)}
+	if *strict {
+		opts = append(opts, stubsrv.WithStrictMode())
+	}
+	if *useTLS {
+		opts = append(opts, stubsrv.WithTLS())
+	}
+	if *watch {
+		opts = append(opts, stubsrv.WithWatchConfig())
+	}
+	if *profile != "" {
+		opts = append(opts, stubsrv.WithProfile(*profile))
+	}
+	if *ctrlPort != "" {
+		opts = append(opts, stubsrv.WithControlPort(*ctrlPort))
+	}
+	if *ctrlToken != "" {
+		opts = append(opts, stubsrv.WithControlAuth(*ctrlToken))
+	}
+	var stubs []*stubsrv.Stub
+	if *configPath == "" {
+		stubs = []*stubsrv.Stub{stubsrv.NewStub(logger, opts...)}
+	} else {
+		if stubs, err = stubsrv.LoadStubs(logger, *configPath, opts...); err != nil {
+			return err
+		}
+		var routes int
+		for _, stub := range stubs {
+			routes += stub.Usage().Routes
+		}
+		logger.Info("Loaded config", slog.String("path", *configPath), slog.Int("stubs", len(stubs)), slog.Int("routes", routes))
+	}
+
+	defer func() {
+		for _, stub := range stubs {
+			stub.Close()
+		}
+	}()
+	for _, stub := range stubs {
+		if err := stub.Start(); err != nil {
+			return err
+		}
+		logger.Info("Serving", slog.String("url", stub.URL()), slog.String("control_url", stub.ControlURL()))
+	}
+
+	<-ctx.Done()
+	return nil
+}
+
+func newLogger(logLevel string, stderr io.Writer) (*slog.Logger, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(logLevel)); err != nil {
+		return nil, fmt.Errorf("invalid -log-level: %w", err)
+	}
+	return slog.New(slog.NewTextHandler(stderr, &slog.HandlerOptions{Level: level})), nil
+}
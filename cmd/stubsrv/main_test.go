@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+
+	config := writeFile(t, "routes.json", `{
+		"routes": [{"method": "GET", "path": "/users/1", "body": "alice"}],
+		"profiles": {"outage": {"routes": [{"method": "GET", "path": "/users/1", "status": 503}]}}
+	}`)
+
+	t.Run("serves the config until the context is done", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		var stderr syncBuffer
+		errc := make(chan error, 1)
+		go func() { errc <- run(ctx, []string{"-port", "0", "-config", config}, &stderr) }()
+
+		url, _ := waitServing(t, &stderr)
+		status, body := get(t, url+"/users/1", "")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "alice", body)
+		assert.Contains(t, stderr.String(), "routes=1")
+
+		cancel()
+		select {
+		case err := <-errc:
+			require.NoError(t, err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("run did not return after the context was done")
+		}
+
+		_, err := http.Get(url + "/users/1")
+		assert.Error(t, err, "the stub is closed")
+	})
+
+	t.Run("profile", func(t *testing.T) {
+		t.Parallel()
+
+		url, _ := startRun(t, "-port", "0", "-config", config, "-profile", "outage")
+		status, _ := get(t, url+"/users/1", "")
+		assert.Equal(t, http.StatusServiceUnavailable, status)
+	})
+
+	t.Run("stubs", func(t *testing.T) {
+		t.Parallel()
+
+		config := writeFile(t, "stubs.json", `{"stubs": [
+			{"name": "users", "port": "0", "routes": [{"method": "GET", "path": "/users/1", "body": "alice"}]},
+			{"name": "billing", "port": "0", "routes": [{"method": "GET", "path": "/invoices", "body": "[]"}]}
+		]}`)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		var stderr syncBuffer
+		errc := make(chan error, 1)
+		go func() { errc <- run(ctx, []string{"-config", config}, &stderr) }()
+		defer func() {
+			cancel()
+			assert.NoError(t, <-errc)
+		}()
+
+		var m [][]string
+		require.Eventually(t, func() bool {
+			m = servingLine.FindAllStringSubmatch(stderr.String(), -1)
+			return len(m) == 2
+		}, 5*time.Second, 10*time.Millisecond, "stubsrv did not start: %s", stderr.String())
+		assert.Contains(t, stderr.String(), "stubs=2 routes=2")
+
+		status, body := get(t, m[0][1]+"/users/1", "")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "alice", body)
+		status, _ = get(t, m[0][1]+"/invoices", "")
+		assert.Equal(t, http.StatusNotFound, status)
+		status, body = get(t, m[1][1]+"/invoices", "")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "[]", body)
+	})
+
+	t.Run("control port and token", func(t *testing.T) {
+		t.Parallel()
+
+		url, controlURL := startRun(t, "-port", "0", "-control-port", "0", "-control-token", "secret")
+		assert.NotEqual(t, url, controlURL)
+
+		status, _ := get(t, controlURL+"/_control/handlers", "")
+		assert.Equal(t, http.StatusUnauthorized, status)
+		status, _ = get(t, controlURL+"/_control/handlers", "secret")
+		assert.Equal(t, http.StatusOK, status)
+		status, _ = get(t, url+"/_control/handlers", "secret")
+		assert.Equal(t, http.StatusNotFound, status)
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		t.Parallel()
+
+		url, controlURL := startRun(t, "-port", "0", "-strict")
+		status, _ := get(t, url+"/missing", "")
+		assert.Equal(t, http.StatusNotFound, status)
+
+		status, body := get(t, controlURL+"/_control/usage", "")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Contains(t, body, `"unexpected":1`)
+	})
+}
+
+func TestRun_Errors(t *testing.T) {
+	t.Parallel()
+
+	valid := writeFile(t, "valid.json", `{"profiles": {"outage": {}}}`)
+	invalid := writeFile(t, "invalid.json", `{"routes": [{"method": "GET", "path": "/", "stauts": 200}]}`)
+
+	testCases := []struct {
+		name            string
+		givenArgs       []string
+		expectedErrText string
+	}{
+		{
+			name:            "unknown flag",
+			givenArgs:       []string{"-nope"},
+			expectedErrText: "flag provided but not defined: -nope",
+		},
+		{
+			name:            "unexpected argument",
+			givenArgs:       []string{"-port", "0", "serve"},
+			expectedErrText: "unexpected argument: serve",
+		},
+		{
+			name:            "invalid log level",
+			givenArgs:       []string{"-log-level", "loud"},
+			expectedErrText: "invalid -log-level",
+		},
+		{
+			name:            "missing config",
+			givenArgs:       []string{"-port", "0", "-config", filepath.Join(t.TempDir(), "missing.json")},
+			expectedErrText: "could not read config",
+		},
+		{
+			name:            "invalid config",
+			givenArgs:       []string{"-port", "0", "-config", invalid},
+			expectedErrText: `unknown field "stauts"`,
+		},
+		{
+			name:            "unknown profile",
+			givenArgs:       []string{"-port", "0", "-config", valid, "-profile", "outgae"},
+			expectedErrText: "unknown profile: outgae",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			err := run(ctx, tc.givenArgs, io.Discard)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.expectedErrText)
+		})
+	}
+}
+
+// startRun runs stubsrv with args until the test ends and returns the URLs
+// it serves on.
+func startRun(t *testing.T, args ...string) (url, controlURL string) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var stderr syncBuffer
+	errc := make(chan error, 1)
+	go func() { errc <- run(ctx, args, &stderr) }()
+	t.Cleanup(func() {
+		cancel()
+		assert.NoError(t, <-errc)
+	})
+	return waitServing(t, &stderr)
+}
+
+var servingLine = regexp.MustCompile(`msg=Serving url=(\S+) control_url=(\S+)`)
+
+// waitServing waits for run to log the URLs it serves on.
+func waitServing(t *testing.T, stderr *syncBuffer) (url, controlURL string) {
+	t.Helper()
+
+	var m []string
+	require.Eventually(t, func() bool {
+		m = servingLine.FindStringSubmatch(stderr.String())
+		return m != nil
+	}, 5*time.Second, 10*time.Millisecond, "stubsrv did not start: %s", stderr.String())
+	return m[1], m[2]
+}
+
+func get(t *testing.T, url, token string) (int, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	require.NoError(t, err)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, string(body)
+}
+
+func writeFile(t *testing.T, name, data string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(data), 0o600))
+	return path
+}
+
+// syncBuffer is a bytes.Buffer safe to write from run's goroutine while the
+// test reads it.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
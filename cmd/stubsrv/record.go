@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/alesr/stubsrv"
+)
+
+// record proxies to the upstream until ctx is done, then writes what it saw
+// as fixtures.
+func record(ctx context.Context, args []string, stderr io.Writer) error {
+	fs := flag.NewFlagSet("stubsrv record", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var (
+		upstream = fs.String("upstream", "", "URL of the API to record")
+		out      = fs.String("out", "fixtures", "directory to write routes.json to")
+		port     = fs.String("port", "8080", "port to listen on, 0 for a random one")
+		logLevel = fs.String("log-level", "info", "debug, info, warn or error")
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected argument: %s", fs.Arg(0))
+	}
+	if *upstream == "" {
+		return errors.New("-upstream is required")
+	}
+
+	logger, err := newLogger(*logLevel, stderr)
+	if err != nil {
+		return err
+	}
+
+	stub := stubsrv.NewStub(logger, stubsrv.WithPort(*port))
+	if err := stub.ProxyTo(*upstream); err != nil {
+		return err
+	}
+	if err := stub.Start(); err != nil {
+		return err
+	}
+	logger.Info("Recording", slog.String("url", stub.URL()), slog.String("upstream", *upstream))
+
+	<-ctx.Done()
+	recordings := stub.Recordings()
+	stub.Close()
+
+	specs := dedupe(recordings)
+	path, err := writeFixtures(*out, specs)
+	if err != nil {
+		return err
+	}
+	logger.Info("Wrote fixtures", slog.String("path", path), slog.Int("routes", len(specs)))
+	return nil
+}
+
+// dedupe keeps the first recording of each distinct request: method, path,
+// query and body.
+func dedupe(recordings []stubsrv.DynamicHandlerSpec) []stubsrv.DynamicHandlerSpec {
+	seen := make(map[string]bool)
+	var out []stubsrv.DynamicHandlerSpec
+	for _, spec := range recordings {
+		key := requestKey(spec)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		out = append(out, spec)
+	}
+	return out
+}
+
+func requestKey(spec stubsrv.DynamicHandlerSpec) string {
+	var b strings.Builder
+	b.WriteString(spec.Method + " " + spec.Path)
+	for _, k := range slices.Sorted(maps.Keys(spec.Query)) {
+		b.WriteString("\x00" + k + "=" + spec.Query[k])
+	}
+	b.WriteString("\x00" + spec.MatchBody)
+	return b.String()
+}
+
+// writeFixtures writes specs as the routes of a config to dir/routes.json,
+// leaving out unset fields so the file stays readable, and returns its path.
+func writeFixtures(dir string, specs []stubsrv.DynamicHandlerSpec) (string, error) {
+	routes := make([]map[string]any, len(specs))
+	for i, spec := range specs {
+		data, err := json.Marshal(spec)
+		if err != nil {
+			return "", err
+		}
+		var fields map[string]any
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return "", err
+		}
+		for k, v := range fields {
+			if isZero(v) {
+				delete(fields, k)
+			}
+		}
+		routes[i] = fields
+	}
+
+	data, err := json.MarshalIndent(map[string]any{"routes": routes}, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("could not create fixtures directory: %w", err)
+	}
+	path := filepath.Join(dir, "routes.json")
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return "", fmt.Errorf("could not write fixtures: %w", err)
+	}
+	return path, nil
+}
+
+func isZero(v any) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case float64:
+		return v == 0
+	case bool:
+		return !v
+	case []any:
+		return len(v) == 0
+	case map[string]any:
+		return len(v) == 0
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alesr/stubsrv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecord(t *testing.T) {
+	t.Parallel()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		io.WriteString(w, `{"path":"`+r.URL.RequestURI()+`"}`)
+	}))
+	defer upstream.Close()
+
+	out := filepath.Join(t.TempDir(), "fixtures")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var stderr syncBuffer
+	errc := make(chan error, 1)
+	go func() {
+		errc <- run(ctx, []string{"record", "-port", "0", "-upstream", upstream.URL, "-out", out}, &stderr)
+	}()
+
+	var m []string
+	require.Eventually(t, func() bool {
+		m = regexp.MustCompile(`msg=Recording url=(\S+)`).FindStringSubmatch(stderr.String())
+		return m != nil
+	}, 5*time.Second, 10*time.Millisecond, "stubsrv record did not start: %s", stderr.String())
+	url := m[1]
+
+	for _, path := range []string{"/users/1", "/users/1", "/users/1?expand=orgs", "/users/2"} {
+		status, body := get(t, url+path, "")
+		assert.Equal(t, http.StatusAccepted, status)
+		assert.Equal(t, `{"path":"`+path+`"}`, body)
+	}
+	resp, err := http.Post(url+"/users", "application/json", strings.NewReader(`{"name":"alice"}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	cancel()
+	require.NoError(t, <-errc)
+	assert.Contains(t, stderr.String(), "routes=4", "repeated requests are recorded once")
+
+	data, err := os.ReadFile(filepath.Join(out, "routes.json"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), `"delay_ms"`, "unset fields are left out")
+
+	stub := stubsrv.NewStub(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	ids, err := stub.LoadConfig(filepath.Join(out, "routes.json"))
+	require.NoError(t, err)
+	assert.Len(t, ids, 4)
+	require.NoError(t, stub.Start())
+	defer stub.Close()
+
+	upstream.Close()
+	for _, path := range []string{"/users/1", "/users/1?expand=orgs", "/users/2"} {
+		status, body := get(t, stub.URL()+path, "")
+		assert.Equal(t, http.StatusAccepted, status, path)
+		assert.Equal(t, `{"path":"`+path+`"}`, body, path)
+	}
+	resp, err = http.Post(stub.URL()+"/users", "application/json", strings.NewReader(`{"name":"alice"}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+}
+
+func TestRecord_Errors(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name            string
+		givenArgs       []string
+		expectedErrText string
+	}{
+		{
+			name:            "missing upstream",
+			givenArgs:       []string{"record", "-port", "0"},
+			expectedErrText: "-upstream is required",
+		},
+		{
+			name:            "invalid upstream",
+			givenArgs:       []string{"record", "-port", "0", "-upstream", "api"},
+			expectedErrText: `invalid upstream URL "api"`,
+		},
+		{
+			name:            "unknown flag",
+			givenArgs:       []string{"record", "-config", "routes.json"},
+			expectedErrText: "flag provided but not defined: -config",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := run(context.Background(), tc.givenArgs, io.Discard)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.expectedErrText)
+		})
+	}
+}
@@ -0,0 +1,496 @@
+package stubsrv
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+)
+
+// Config declares a stub's whole setup. Applying it replaces every route,
+// so it can move a running stub from one test phase to the next.
+type Config struct {
+	Routes []DynamicHandlerSpec `json:"routes"`
+	// Behaviors are added to, or replace, the stub's behaviors before the
+	// routes are compiled, so routes may reference them.
+	Behaviors map[string]Behavior `json:"behaviors"`
+	// Strict, when set, switches strict mode on or off.
+	Strict *bool `json:"strict"`
+	// Profiles are named overlays, one of which a stub may select with
+	// WithProfile, see there.
+	Profiles map[string]Config `json:"profiles"`
+}
+
+// WithProfile selects the profile of every config the stub applies or
+// loads. A profile's behaviors are added to, or replace, the config's, its
+// strict setting wins when set, and each of its routes replaces the
+// config's route with the same method, path and query or is added after
+// them:
+//
+//	routes:
+//	  - {method: GET, path: /users/1, body: '{"name":"alice"}'}
+//	profiles:
+//	  outage:
+//	    routes:
+//	      - {method: GET, path: /users/1, status: 503}
+//
+// A config naming no profiles is applied as is; one that names others but
+// not this one is rejected, so a typo doesn't silently serve the defaults.
+func WithProfile(name string) Option {
+	return func(cfg *stubConfig) {
+		cfg.profile = name
+	}
+}
+
+// withProfile returns cfg overlaid with its profile named name, without
+// profiles.
+func (cfg Config) withProfile(name string) (Config, error) {
+	profiles := cfg.Profiles
+	cfg.Profiles = nil
+	if len(profiles) == 0 || name == "" {
+		return cfg, nil
+	}
+	profile, ok := profiles[name]
+	if !ok {
+		return cfg, fmt.Errorf("unknown profile: %s", name)
+	}
+	if len(profile.Profiles) > 0 {
+		return cfg, fmt.Errorf("profiles[%s]: profiles cannot be nested", name)
+	}
+
+	if len(profile.Behaviors) > 0 {
+		behaviors := maps.Clone(cfg.Behaviors)
+		if behaviors == nil {
+			behaviors = make(map[string]Behavior)
+		}
+		maps.Copy(behaviors, profile.Behaviors)
+		cfg.Behaviors = behaviors
+	}
+	if profile.Strict != nil {
+		cfg.Strict = profile.Strict
+	}
+
+	routes := slices.Clone(cfg.Routes)
+	for _, spec := range profile.Routes {
+		i := slices.IndexFunc(routes, func(r DynamicHandlerSpec) bool {
+			return r.Method == spec.Method && r.Path == spec.Path && maps.Equal(r.Query, spec.Query)
+		})
+		if i >= 0 {
+			routes[i] = spec
+		} else {
+			routes = append(routes, spec)
+		}
+	}
+	cfg.Routes = routes
+	return cfg, nil
+}
+
+// ParseConfig decodes a Config written in JSON or YAML. A document that is
+// a list is read as the routes of a Config. Unknown fields are rejected so
+// typos in hand-written files don't go unnoticed.
+//
+// A config may declare named specs under templates, which routes reuse with
+// extends: the route's fields replace the template's, and objects such as
+// headers are merged key by key. Templates may extend other templates:
+//
+//	templates:
+//	  json: {headers: {Content-Type: application/json}}
+//	  not_found: {extends: json, status: 404, body: '{"error":"not_found"}'}
+//	routes:
+//	  - {extends: not_found, method: GET, path: /users/0}
+//
+// Config files loaded with LoadConfig may also include other files, see
+// there. YAML anchors and merge keys work too.
+//
+// ${NAME} is replaced with the environment variable NAME, and
+// ${NAME:-default} with default when NAME is unset or empty, so one config
+// can serve local, CI and container setups. Referencing an unset variable
+// without a default is an error. $${ stands for a literal ${.
+func ParseConfig(data []byte) (Config, error) {
+	tree, err := parseConfigTree(data)
+	if err != nil {
+		return Config{}, err
+	}
+	if tree["include"] != nil {
+		return Config{}, errors.New("invalid config: include is only supported when loading config files")
+	}
+	return decodeConfig(tree)
+}
+
+// decodeConfig resolves the templates of tree and decodes it.
+func decodeConfig(tree map[string]any) (Config, error) {
+	var cfg Config
+	if tree["stubs"] != nil {
+		return cfg, errors.New("invalid config: stubs are only supported by LoadStubs")
+	}
+	err := decodeTree(tree, &cfg)
+	return cfg, err
+}
+
+// decodeTree resolves the templates of tree and decodes it to v, rejecting
+// unknown fields.
+func decodeTree(tree map[string]any, v any) error {
+	if err := applyTemplates(tree, nil); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	normalized, err := json.Marshal(tree)
+	if err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(normalized))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	return nil
+}
+
+// ApplyConfig validates cfg and, only if all of it is valid, replaces the
+// stub's routes with cfg's in one step. Requests never observe a partially
+// applied config, and an invalid one leaves the stub untouched. It returns
+// the IDs of the new routes.
+func (s *Stub) ApplyConfig(cfg Config) ([]string, error) {
+	defer s.beginLoad()()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cc, err := s.compileConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if s.closed {
+		panic("cannot add handlers on a closed stub server")
+	}
+
+	s.routers = make(routes)
+	s.templateRoutes = nil
+	s.routesChanged()
+	s.sources = []Source{{Kind: "config", Routes: len(cc.specs)}}
+	return s.installConfig(cc), nil
+}
+
+// LoadConfig reads a JSON or YAML Config from configPath, see ParseConfig,
+// and adds its routes to the stub's. Like ApplyConfig, nothing is
+// registered unless the whole file is valid. Relative body_file paths are
+// resolved against the directory of the file naming them. Response sequences are
+// expressed with scenarios: when_state selects a step and then_state
+// advances to the next. It returns the IDs of the new routes.
+//
+// A config file may include others, listed under include with paths
+// relative to it. Their templates, behaviors and routes come first, so the
+// including file can use and override them:
+//
+//	include: [common/errors.yaml, common/auth.yaml]
+//	routes:
+//	  - {extends: unauthorized, method: GET, path: /admin}
+//
+// With WithWatchConfig, the routes are swapped whenever the file or one of
+// its body files changes.
+func (s *Stub) LoadConfig(configPath string) ([]string, error) {
+	files := make(map[string][sha256.Size]byte)
+	ids, err := s.loadConfigFile(configPath, files, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	watch := s.watchConfig
+	s.mu.Unlock()
+
+	if watch {
+		go s.watchConfigFile(configPath, files, ids)
+	}
+	return ids, nil
+}
+
+// loadConfigFile loads configPath from disk in place of the routes in
+// replace, recording the hash of every file read in files.
+func (s *Stub) loadConfigFile(configPath string, files map[string][sha256.Size]byte, replace []string) ([]string, error) {
+	readFile := func(name string) ([]byte, error) {
+		data, err := os.ReadFile(name)
+		if err == nil {
+			files[name] = sha256.Sum256(data)
+		}
+		return data, err
+	}
+	return s.loadConfig(configPath, readFile, resolveFile, replace)
+}
+
+// StubConfig declares one of the stubs of a config file, see LoadStubs.
+type StubConfig struct {
+	// Name tells the stub apart in logs; it defaults to its port.
+	Name string `json:"name"`
+	Port string `json:"port"`
+	// ControlPort serves the stub's control endpoints on their own port,
+	// see WithControlPort.
+	ControlPort string `json:"control_port"`
+	Config
+}
+
+// stubsConfig is a config file declaring several stubs.
+type stubsConfig struct {
+	Config
+	Stubs []StubConfig `json:"stubs"`
+}
+
+// LoadStubs reads a config file declaring several stubs, each with its own
+// port, routes and journal, so one process can stand in for many upstreams:
+//
+//	behaviors: {down: {status: 503}}
+//	stubs:
+//	  - {name: users, port: "8081", routes: [{method: GET, path: /users/1, body: alice}]}
+//	  - {name: billing, port: "8082", routes: [{method: GET, path: /invoices, behavior: down}]}
+//
+// Templates and behaviors declared next to stubs are shared by all of them,
+// while routes and profiles are declared per stub. Includes, templates and
+// environment variables work as in LoadConfig.
+//
+// Each stub is created with opts and its own ports, and returned unstarted.
+// A file declaring no stubs gives a single stub loaded with LoadConfig. Only
+// single-stub files are watched with WithWatchConfig.
+func LoadStubs(logger *slog.Logger, configPath string, opts ...Option) ([]*Stub, error) {
+	tree, err := readConfigTree(configPath, os.ReadFile, resolveFile, nil)
+	if err != nil {
+		return nil, err
+	}
+	if tree["stubs"] == nil {
+		stub := NewStub(logger, opts...)
+		if _, err := stub.LoadConfig(configPath); err != nil {
+			return nil, err
+		}
+		return []*Stub{stub}, nil
+	}
+
+	var file stubsConfig
+	if err := decodeTree(tree, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", configPath, err)
+	}
+	if len(file.Routes) > 0 || len(file.Profiles) > 0 {
+		return nil, fmt.Errorf("%s: invalid config: routes and profiles must be declared per stub", configPath)
+	}
+
+	stubs := make([]*Stub, len(file.Stubs))
+	for i, sc := range file.Stubs {
+		if sc.Port == "" {
+			return nil, fmt.Errorf("%s: stubs[%d]: port is required", configPath, i)
+		}
+		name := cmp.Or(sc.Name, sc.Port)
+
+		cfg := sc.Config
+		cfg.Behaviors = maps.Clone(file.Behaviors)
+		if cfg.Behaviors == nil {
+			cfg.Behaviors = make(map[string]Behavior)
+		}
+		maps.Copy(cfg.Behaviors, sc.Behaviors)
+		if cfg.Strict == nil {
+			cfg.Strict = file.Strict
+		}
+
+		stub := NewStub(logger.With(slog.String("stub", name)), append(slices.Clip(opts), WithPort(sc.Port), WithControlPort(sc.ControlPort))...)
+		cfg, err := stub.readBodyFiles(cfg, os.ReadFile)
+		if err != nil {
+			return nil, fmt.Errorf("%s: stubs[%d]: %w", configPath, i, err)
+		}
+		stub.mu.Lock()
+		cc, err := stub.compileConfig(cfg)
+		if err == nil {
+			stub.sources = append(stub.sources, Source{Kind: "config", Name: configPath, Routes: len(cc.specs)})
+			stub.installConfig(cc)
+		}
+		stub.mu.Unlock()
+		if err != nil {
+			return nil, fmt.Errorf("%s: stubs[%d]: %w", configPath, i, err)
+		}
+		stubs[i] = stub
+	}
+	return stubs, nil
+}
+
+// resolveFile returns the path of the file name, named in the file at base.
+func resolveFile(base, name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(filepath.Dir(base), name)
+}
+
+// LoadConfigFS is like LoadConfig but reads configPath and body files from
+// fsys, such as an embed.FS of fixtures.
+func (s *Stub) LoadConfigFS(fsys fs.FS, configPath string) ([]string, error) {
+	readFile := func(name string) ([]byte, error) { return fs.ReadFile(fsys, name) }
+	return s.loadConfig(configPath, readFile, func(base, name string) string {
+		return path.Join(path.Dir(base), name)
+	}, nil)
+}
+
+// loadConfig reads and installs the config at configPath, removing the
+// routes in replace in the same step. resolve returns the path of a file
+// named in the file at base.
+func (s *Stub) loadConfig(configPath string, readFile func(string) ([]byte, error), resolve func(base, name string) string, replace []string) ([]string, error) {
+	defer s.beginLoad()()
+
+	tree, err := readConfigTree(configPath, readFile, resolve, nil)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := decodeConfig(tree)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", configPath, err)
+	}
+	if cfg, err = s.readBodyFiles(cfg, readFile); err != nil {
+		return nil, fmt.Errorf("%s: %w", configPath, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cc, err := s.compileConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", configPath, err)
+	}
+	if s.closed {
+		if replace != nil {
+			// a reload racing Close
+			return nil, errors.New("stub server is closed")
+		}
+		panic("cannot add handlers on a closed stub server")
+	}
+
+	for _, id := range replace {
+		s.removeRoute(id)
+	}
+	src := Source{Kind: "config", Name: configPath, Routes: len(cc.specs)}
+	if i := slices.IndexFunc(s.sources, func(s Source) bool { return s.Kind == src.Kind && s.Name == src.Name }); i >= 0 && replace != nil {
+		s.sources[i] = src
+	} else {
+		s.sources = append(s.sources, src)
+	}
+	return s.installConfig(cc), nil
+}
+
+// readBodyFiles selects the profile of a Config read from a file and
+// inlines its body files, read with readFile.
+func (s *Stub) readBodyFiles(cfg Config, readFile func(string) ([]byte, error)) (Config, error) {
+	cfg, err := cfg.withProfile(s.profile)
+	if err != nil {
+		return cfg, err
+	}
+
+	// body files are inlined so they are read from the same place as the
+	// config itself; their paths are already resolved
+	for i := range cfg.Routes {
+		spec := &cfg.Routes[i]
+		if spec.BodyFile == "" || spec.Body != "" || len(spec.Chunks) > 0 {
+			continue
+		}
+		name := spec.BodyFile
+		body, err := readFile(name)
+		if err != nil {
+			return cfg, fmt.Errorf("routes[%d]: could not read body file: %w", i, err)
+		}
+		spec.Body, spec.Headers, spec.BodyFile = string(body), withContentType(name, spec.Headers), ""
+	}
+	return cfg, nil
+}
+
+// compiledConfig is a validated Config ready to be installed.
+type compiledConfig struct {
+	behaviors map[string]Behavior
+	strict    *bool
+	specs     []DynamicHandlerSpec
+	infos     []routeInfo
+}
+
+// compileConfig validates cfg against the stub's behaviors. Callers must
+// hold s.mu until cc is installed, so behaviors defined meanwhile are
+// neither lost nor missed by cc's routes.
+func (s *Stub) compileConfig(cfg Config) (compiledConfig, error) {
+	cfg, err := cfg.withProfile(s.profile)
+	if err != nil {
+		return compiledConfig{}, err
+	}
+
+	behaviors := maps.Clone(s.behaviors)
+
+	for name, b := range cfg.Behaviors {
+		if b.Fault != "" && !b.Fault.valid() {
+			return compiledConfig{}, fmt.Errorf("behaviors[%s]: unknown fault: %s", name, b.Fault)
+		}
+		behaviors[name] = b
+	}
+
+	cc := compiledConfig{
+		behaviors: behaviors,
+		strict:    cfg.Strict,
+		specs:     make([]DynamicHandlerSpec, len(cfg.Routes)),
+		infos:     make([]routeInfo, len(cfg.Routes)),
+	}
+	for i, spec := range cfg.Routes {
+		info, err := s.compileSpec(&spec, behaviors)
+		if err != nil {
+			return compiledConfig{}, fmt.Errorf("routes[%d]: %w", i, err)
+		}
+		cc.specs[i], cc.infos[i] = spec, info
+	}
+	return cc, nil
+}
+
+// installConfig registers cc's routes and returns their IDs. Callers must
+// hold s.mu.
+func (s *Stub) installConfig(cc compiledConfig) []string {
+	s.behaviors = cc.behaviors
+	if cc.strict != nil {
+		s.strict = *cc.strict
+	}
+
+	ids := make([]string, len(cc.specs))
+	for i, spec := range cc.specs {
+		ids[i] = s.addRoute(spec.Method, spec.Path, spec.Query, cc.infos[i])
+	}
+	return ids
+}
+
+// controlConfigApply serves POST /_control/config/apply, applying the posted
+// Config and answering with the new route IDs.
+func (s *Stub) controlConfigApply(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	var cfg Config
+	if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+		http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	cfg, err := cfg.withProfile(s.profile)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for i := range cfg.Routes {
+		if err := s.inlineBodyFile(&cfg.Routes[i]); err != nil {
+			http.Error(w, fmt.Sprintf("routes[%d]: %v", i, err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	ids, err := s.ApplyConfig(cfg)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string][]string{"ids": ids})
+}
@@ -0,0 +1,603 @@
+package stubsrv
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStub_ControlConfigApply(t *testing.T) {
+	t.Parallel()
+
+	stub := NewStub(noopLogger())
+	stub.AddHandler(http.MethodGet, "/phase-one", func(w http.ResponseWriter, r *http.Request) {})
+	require.NoError(t, stub.Start())
+	defer stub.Close()
+
+	status := func(path string) int {
+		resp, err := http.Get(stub.URL() + path)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// the second route references a missing behavior, so nothing is applied
+	controlDo(t, stub, http.MethodPost, "/_control/config/apply", `{
+		"routes": [
+			{"method":"GET","path":"/phase-two"},
+			{"method":"GET","path":"/broken","behavior":"missing"}
+		]
+	}`, http.StatusBadRequest, nil)
+	assert.Equal(t, http.StatusOK, status("/phase-one"))
+	assert.Equal(t, http.StatusNotFound, status("/phase-two"))
+
+	var applied struct{ IDs []string }
+	controlDo(t, stub, http.MethodPost, "/_control/config/apply", `{
+		"strict": true,
+		"behaviors": {"gone": {"status": 410}},
+		"routes": [
+			{"method":"GET","path":"/phase-two"},
+			{"method":"GET","path":"/old","behavior":"gone"},
+			{"method":"GET","path":"/flaky","fault":"empty_response"}
+		]
+	}`, http.StatusOK, &applied)
+	assert.Len(t, applied.IDs, 3)
+
+	assert.Equal(t, http.StatusNotFound, status("/phase-one"))
+	assert.Equal(t, http.StatusOK, status("/phase-two"))
+	assert.Equal(t, http.StatusGone, status("/old"))
+	_, err := http.Get(stub.URL() + "/flaky")
+	assert.Error(t, err)
+
+	require.Len(t, stub.UnexpectedRequests(), 1)
+	assert.Equal(t, "/phase-one", stub.UnexpectedRequests()[0].Path)
+
+	controlDo(t, stub, http.MethodPost, "/_control/config/apply", `{"behaviors":{"x":{"fault":"nope"}}}`, http.StatusBadRequest, nil)
+	controlDo(t, stub, http.MethodPost, "/_control/config/apply", `{`, http.StatusBadRequest, nil)
+	controlDo(t, stub, http.MethodGet, "/_control/config/apply", "", http.StatusMethodNotAllowed, nil)
+}
+
+func TestStub_ApplyConfigConcurrentBehaviors(t *testing.T) {
+	t.Parallel()
+
+	stub := NewStub(noopLogger())
+	require.NoError(t, stub.Start())
+	defer stub.Close()
+
+	// enough routes that compiling a config takes a while
+	routes := make([]DynamicHandlerSpec, 200)
+	for i := range routes {
+		routes[i] = DynamicHandlerSpec{Method: http.MethodGet, Path: fmt.Sprintf("/r/%d/:id", i), MatchBody: "x"}
+	}
+
+	const n = 50
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			stub.DefineBehavior(fmt.Sprintf("defined%d", i), Behavior{Status: http.StatusTeapot})
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := stub.ApplyConfig(Config{Routes: routes, Behaviors: map[string]Behavior{
+				fmt.Sprintf("applied%d", i): {Status: http.StatusGone},
+			}})
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	var behaviors map[string]Behavior
+	controlDo(t, stub, http.MethodGet, "/_control/behaviors", "", http.StatusOK, &behaviors)
+	for i := range n {
+		assert.Contains(t, behaviors, fmt.Sprintf("defined%d", i), "behaviors defined during ApplyConfig are kept")
+		assert.Contains(t, behaviors, fmt.Sprintf("applied%d", i))
+	}
+}
+
+func TestParseConfig(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name            string
+		givenData       string
+		expectedRoutes  int
+		expectedStrict  bool
+		expectedErrText string
+	}{
+		{
+			name:           "json config",
+			givenData:      `{"strict":true,"behaviors":{"gone":{"status":410}},"routes":[{"method":"GET","path":"/old","behavior":"gone"}]}`,
+			expectedRoutes: 1,
+			expectedStrict: true,
+		},
+		{
+			name:           "json list of specs",
+			givenData:      `[{"method":"POST","path":"/orders","status":201}]`,
+			expectedRoutes: 1,
+		},
+		{
+			name:            "unknown field",
+			givenData:       `{"routes":[{"method":"GET","path":"/","stauts":200}]}`,
+			expectedErrText: "unknown field",
+		},
+		{
+			name: "templates",
+			givenData: `{
+				"templates": {
+					"json": {"headers": {"Content-Type": "application/json"}},
+					"missing": {"extends": "json", "status": 404}
+				},
+				"routes": [{"extends": "missing", "method": "GET", "path": "/a"}]
+			}`,
+			expectedRoutes: 1,
+		},
+		{
+			name:            "unknown template",
+			givenData:       `{"routes":[{"extends":"nope","method":"GET","path":"/a"}]}`,
+			expectedErrText: "routes[0]: unknown template: nope",
+		},
+		{
+			name:            "template cycle",
+			givenData:       `{"templates":{"a":{"extends":"b"},"b":{"extends":"a"}},"routes":[{"extends":"a"}]}`,
+			expectedErrText: "template cycle",
+		},
+		{
+			name:            "include without a file",
+			givenData:       `{"include":["other.json"]}`,
+			expectedErrText: "include is only supported when loading config files",
+		},
+		{
+			name:            "malformed",
+			givenData:       "routes: [",
+			expectedErrText: "invalid config",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg, err := ParseConfig([]byte(tc.givenData))
+			if tc.expectedErrText != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectedErrText)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, cfg.Routes, tc.expectedRoutes)
+			assert.Equal(t, tc.expectedStrict, cfg.Strict != nil && *cfg.Strict)
+		})
+	}
+}
+
+func TestParseConfig_Env(t *testing.T) {
+	t.Setenv("STUBSRV_TEST_HOST", "api.internal")
+	t.Setenv("STUBSRV_TEST_STATUS", "")
+
+	testCases := []struct {
+		name            string
+		givenData       string
+		expectedBody    string
+		expectedStatus  int
+		expectedErrText string
+	}{
+		{
+			name:         "variable",
+			givenData:    `[{"method":"GET","path":"/","body":"https://${STUBSRV_TEST_HOST}/v1"}]`,
+			expectedBody: "https://api.internal/v1",
+		},
+		{
+			name:           "default for unset and empty variables",
+			givenData:      `[{"method":"GET","path":"/","status":${STUBSRV_TEST_STATUS:-201},"body":"${STUBSRV_TEST_UNSET:-none}"}]`,
+			expectedBody:   "none",
+			expectedStatus: 201,
+		},
+		{
+			name:         "empty default",
+			givenData:    `[{"method":"GET","path":"/","body":"${STUBSRV_TEST_UNSET:-}"}]`,
+			expectedBody: "",
+		},
+		{
+			name:         "escaped and bare references are kept",
+			givenData:    `[{"method":"GET","path":"/","body":"$${HOME} costs $5"}]`,
+			expectedBody: "${HOME} costs $5",
+		},
+		{
+			name:            "unset variable",
+			givenData:       `[{"method":"GET","path":"/","body":"${STUBSRV_TEST_UNSET}"}]`,
+			expectedErrText: "environment variable STUBSRV_TEST_UNSET is not set",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := ParseConfig([]byte(tc.givenData))
+			if tc.expectedErrText != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectedErrText)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, cfg.Routes, 1)
+			assert.Equal(t, tc.expectedBody, cfg.Routes[0].Body)
+			assert.Equal(t, tc.expectedStatus, cfg.Routes[0].Status)
+		})
+	}
+}
+
+func TestStub_LoadConfig(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+		load func(stub *Stub) ([]string, error)
+	}{
+		{
+			name: "from disk",
+			load: func(stub *Stub) ([]string, error) { return stub.LoadConfig(configFixture) },
+		},
+		{
+			name: "from fs",
+			load: func(stub *Stub) ([]string, error) { return stub.LoadConfigFS(os.DirFS("."), configFixture) },
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			stub := NewStub(noopLogger())
+			stub.AddHandler(http.MethodGet, "/existing", func(w http.ResponseWriter, r *http.Request) {})
+			require.NoError(t, stub.Start())
+			defer stub.Close()
+
+			ids, err := tc.load(stub)
+			require.NoError(t, err)
+			assert.Len(t, ids, 5)
+
+			do := func(method, path string, header http.Header) (int, string) {
+				req, err := http.NewRequest(method, stub.URL()+path, nil)
+				require.NoError(t, err)
+				maps.Copy(req.Header, header)
+				resp, err := http.DefaultClient.Do(req)
+				require.NoError(t, err)
+				defer resp.Body.Close()
+				return resp.StatusCode, readAll(t, resp)
+			}
+
+			status, body := do(http.MethodGet, "/users/1", nil)
+			assert.Equal(t, http.StatusOK, status)
+			assert.JSONEq(t, `{"id": 1, "name": "alice"}`, body)
+
+			status, _ = do(http.MethodGet, "/existing", nil)
+			assert.Equal(t, http.StatusOK, status, "loading adds to the existing routes")
+			status, _ = do(http.MethodGet, "/legacy", nil)
+			assert.Equal(t, http.StatusGone, status)
+			status, _ = do(http.MethodPost, "/jobs", http.Header{"X-Tenant": {"acme"}})
+			assert.Equal(t, http.StatusAccepted, status)
+
+			_, body = do(http.MethodGet, "/jobs/1", nil)
+			assert.JSONEq(t, `{"status":"pending"}`, body)
+			_, body = do(http.MethodGet, "/jobs/1", nil)
+			assert.JSONEq(t, `{"status":"done"}`, body)
+
+			sources := stub.Info().Sources
+			require.Len(t, sources, 1)
+			assert.Equal(t, Source{Kind: "config", Name: configFixture, Routes: 5}, sources[0])
+		})
+	}
+}
+
+func TestStub_LoadConfigIncludes(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"common/errors.json": {Data: []byte(`{
+			"templates": {
+				"json": {"headers": {"Content-Type": "application/json", "X-Stub": "common"}},
+				"not_found": {"extends": "json", "status": 404, "body": "{\"error\":\"not_found\"}"}
+			},
+			"behaviors": {"gone": {"status": 410}},
+			"routes": [{"extends": "json", "method": "GET", "path": "/user", "body_file": "user.json"}]
+		}`)},
+		"common/user.json": {Data: []byte(`{"name":"alice"}`)},
+		"routes.json": {Data: []byte(`{
+			"include": ["common/errors.json"],
+			"templates": {"json": {"headers": {"Content-Type": "application/json", "X-Stub": "main"}}},
+			"routes": [
+				{"extends": "not_found", "method": "GET", "path": "/users/0"},
+				{"extends": "json", "method": "GET", "path": "/users/1", "status": 200, "headers": {"X-Extra": "1"}},
+				{"method": "GET", "path": "/old", "behavior": "gone"}
+			]
+		}`)},
+		"cycle.json": {Data: []byte(`{"include":["cycle.json"]}`)},
+	}
+
+	stub := NewStub(noopLogger())
+	require.NoError(t, stub.Start())
+	defer stub.Close()
+
+	ids, err := stub.LoadConfigFS(fsys, "routes.json")
+	require.NoError(t, err)
+	assert.Len(t, ids, 4)
+
+	get := func(path string) *http.Response {
+		resp, err := http.Get(stub.URL() + path)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	resp := get("/user")
+	assert.Equal(t, `{"name":"alice"}`, readAll(t, resp), "body files are resolved against the including file")
+	assert.Equal(t, "main", resp.Header.Get("X-Stub"), "templates overridden by the including file apply to included routes too")
+
+	resp = get("/users/0")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, `{"error":"not_found"}`, readAll(t, resp))
+
+	resp = get("/users/1")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "1", resp.Header.Get("X-Extra"), "headers are merged")
+
+	assert.Equal(t, http.StatusGone, get("/old").StatusCode)
+
+	_, err = stub.LoadConfigFS(fsys, "cycle.json")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "include cycle")
+}
+
+func TestStub_LoadConfigProfiles(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"common.json": {Data: []byte(`{
+			"profiles": {"outage": {"behaviors": {"down": {"status": 503}}}}
+		}`)},
+		"routes.json": {Data: []byte(`{
+			"include": ["common.json"],
+			"templates": {"json": {"headers": {"Content-Type": "application/json"}}},
+			"routes": [
+				{"method": "GET", "path": "/users/1", "body": "alice"},
+				{"method": "GET", "path": "/health", "body": "ok"}
+			],
+			"profiles": {
+				"outage": {"routes": [
+					{"method": "GET", "path": "/users/1", "behavior": "down"},
+					{"extends": "json", "method": "GET", "path": "/status", "body_file": "status.json"}
+				]},
+				"slow": {"strict": true}
+			}
+		}`)},
+		"status.json": {Data: []byte(`{"status":"down"}`)},
+	}
+
+	testCases := []struct {
+		name           string
+		givenProfile   string
+		expectedIDs    int
+		expectedStatus map[string]int
+		expectedErr    string
+	}{
+		{
+			name:           "no profile",
+			expectedIDs:    2,
+			expectedStatus: map[string]int{"/users/1": http.StatusOK, "/health": http.StatusOK, "/status": http.StatusNotFound},
+		},
+		{
+			name:           "profile replaces and adds routes",
+			givenProfile:   "outage",
+			expectedIDs:    3,
+			expectedStatus: map[string]int{"/users/1": http.StatusServiceUnavailable, "/health": http.StatusOK, "/status": http.StatusOK},
+		},
+		{
+			name:         "unknown profile",
+			givenProfile: "outgae",
+			expectedErr:  "unknown profile: outgae",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			stub := NewStub(noopLogger(), WithProfile(tc.givenProfile))
+			require.NoError(t, stub.Start())
+			defer stub.Close()
+
+			ids, err := stub.LoadConfigFS(fsys, "routes.json")
+			if tc.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, ids, tc.expectedIDs)
+
+			for path, status := range tc.expectedStatus {
+				resp, err := http.Get(stub.URL() + path)
+				require.NoError(t, err)
+				resp.Body.Close()
+				assert.Equal(t, status, resp.StatusCode, path)
+			}
+		})
+	}
+
+	t.Run("profile over the control plane", func(t *testing.T) {
+		t.Parallel()
+
+		stub := NewStub(noopLogger(), WithProfile("outage"))
+		require.NoError(t, stub.Start())
+		defer stub.Close()
+
+		controlDo(t, stub, http.MethodPost, "/_control/config/apply", `{
+			"routes": [{"method": "GET", "path": "/a", "body": "base"}],
+			"profiles": {"outage": {"routes": [{"method": "GET", "path": "/a", "status": 503}]}}
+		}`, http.StatusOK, nil)
+
+		resp, err := http.Get(stub.URL() + "/a")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	})
+}
+
+func TestLoadStubs(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	writeFile := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(data), 0o600))
+		return path
+	}
+	writeFile("invoices.json", `[{"id":1}]`)
+	stubsPath := writeFile("stubs.json", `{
+		"templates": {"json": {"headers": {"Content-Type": "application/json"}}},
+		"behaviors": {"down": {"status": 503}},
+		"stubs": [
+			{"name": "users", "port": "0", "routes": [{"extends": "json", "method": "GET", "path": "/users/1", "body": "{}"}]},
+			{"name": "billing", "port": "0", "routes": [
+				{"extends": "json", "method": "GET", "path": "/invoices", "body_file": "invoices.json"},
+				{"method": "POST", "path": "/invoices", "behavior": "down"}
+			]}
+		]
+	}`)
+
+	t.Run("one stub per entry", func(t *testing.T) {
+		t.Parallel()
+
+		stubs, err := LoadStubs(noopLogger(), stubsPath)
+		require.NoError(t, err)
+		require.Len(t, stubs, 2)
+		for _, stub := range stubs {
+			require.NoError(t, stub.Start())
+			defer stub.Close()
+		}
+		users, billing := stubs[0], stubs[1]
+		assert.NotEqual(t, users.URL(), billing.URL())
+
+		resp, err := http.Get(users.URL() + "/users/1")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+		resp, err = http.Get(billing.URL() + "/invoices")
+		require.NoError(t, err)
+		assert.Equal(t, `[{"id":1}]`, readAll(t, resp))
+		resp.Body.Close()
+
+		resp, err = http.Post(billing.URL()+"/invoices", "application/json", nil)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode, "behaviors are shared")
+
+		resp, err = http.Get(users.URL() + "/invoices")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+		assert.Len(t, users.Requests(), 2, "each stub has its own journal")
+		assert.Len(t, billing.Requests(), 2)
+	})
+
+	t.Run("single stub", func(t *testing.T) {
+		t.Parallel()
+
+		stubs, err := LoadStubs(noopLogger(), configFixture, WithPort("0"))
+		require.NoError(t, err)
+		require.Len(t, stubs, 1)
+		assert.Equal(t, 5, stubs[0].Usage().Routes)
+	})
+
+	t.Run("stubs are rejected by LoadConfig", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := NewStub(noopLogger()).LoadConfig(stubsPath)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "stubs are only supported by LoadStubs")
+	})
+
+	testCases := []struct {
+		name            string
+		givenConfig     string
+		expectedErrText string
+	}{
+		{
+			name:            "shared routes",
+			givenConfig:     `{"routes": [{"method": "GET", "path": "/"}], "stubs": [{"port": "0"}]}`,
+			expectedErrText: "routes and profiles must be declared per stub",
+		},
+		{
+			name:            "missing port",
+			givenConfig:     `{"stubs": [{"name": "users"}]}`,
+			expectedErrText: "stubs[0]: port is required",
+		},
+		{
+			name:            "invalid route",
+			givenConfig:     `{"stubs": [{"port": "0", "routes": [{"method": "GET", "path": "/", "behavior": "nope"}]}]}`,
+			expectedErrText: "stubs[0]: routes[0]",
+		},
+		{
+			name:            "nested stubs",
+			givenConfig:     `{"stubs": [{"port": "0", "stubs": []}]}`,
+			expectedErrText: `unknown field "stubs"`,
+		},
+	}
+
+	for i, tc := range testCases {
+		path := writeFile(fmt.Sprintf("invalid%d.json", i), tc.givenConfig)
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := LoadStubs(noopLogger(), path)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.expectedErrText)
+		})
+	}
+}
+
+func TestStub_LoadConfigInvalid(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"missing_body.json": {Data: []byte(`[{"method":"GET","path":"/a","body_file":"nope.json"}]`)},
+		"bad_route.json":    {Data: []byte(`[{"method":"GET","path":"/a"},{"method":"GET","path":"/b","fault":"nope"}]`)},
+	}
+
+	testCases := []struct {
+		name            string
+		givenPath       string
+		expectedErrText string
+	}{
+		{name: "missing config", givenPath: "nope.json", expectedErrText: "could not read config"},
+		{name: "missing body file", givenPath: "missing_body.json", expectedErrText: "routes[0]: could not read body file"},
+		{name: "invalid route", givenPath: "bad_route.json", expectedErrText: "bad_route.json: routes[1]: unknown fault"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			stub := NewStub(noopLogger())
+			defer stub.Close()
+
+			_, err := stub.LoadConfigFS(fsys, tc.givenPath)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.expectedErrText)
+			assert.Empty(t, stub.Info().Sources, "nothing is registered from an invalid config")
+		})
+	}
+}
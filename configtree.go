@@ -0,0 +1,272 @@
+package stubsrv
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+)
+
+// Config files are decoded to a generic tree first, so includes and
+// templates can be resolved before the tree is decoded to a Config.
+
+// parseConfigTree decodes a JSON or YAML config to an object, reading a list
+// as the routes of one, after expanding environment variables.
+func parseConfigTree(data []byte) (map[string]any, error) {
+	data, err := expandEnv(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	tree, err := decodeYAML(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	switch tree := tree.(type) {
+	case map[string]any:
+		return tree, nil
+	case []any:
+		return map[string]any{"routes": tree}, nil
+	case nil:
+		return map[string]any{}, nil
+	}
+	return nil, errors.New("invalid config: expected an object or a list of routes")
+}
+
+var envRef = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// expandEnv replaces ${NAME} with the value of the environment variable
+// NAME and ${NAME:-default} with default when NAME is unset or empty. $${
+// stands for a literal ${. Referencing an unset variable without a default
+// is an error, so a missing variable isn't silently served as "".
+func expandEnv(data []byte) ([]byte, error) {
+	var err error
+	out := envRef.ReplaceAllFunc(data, func(ref []byte) []byte {
+		if string(ref) == "$${" {
+			return []byte("${")
+		}
+		m := envRef.FindSubmatchIndex(ref)
+		name := string(ref[m[2]:m[3]])
+		if v, ok := os.LookupEnv(name); ok && v != "" {
+			return []byte(v)
+		}
+		if m[4] >= 0 {
+			return ref[m[4]:m[5]]
+		}
+		if err == nil {
+			err = fmt.Errorf("environment variable %s is not set", name)
+		}
+		return nil
+	})
+	return out, err
+}
+
+// readConfigTree reads the config at name and, first, the files it
+// includes, merged into one tree. Paths to include and body files are
+// resolved against the file naming them. stack holds the files being read,
+// to reject include cycles.
+func readConfigTree(name string, readFile func(string) ([]byte, error), resolve func(base, name string) string, stack []string) (map[string]any, error) {
+	if slices.Contains(stack, name) {
+		return nil, fmt.Errorf("include cycle: %s", name)
+	}
+	stack = append(stack, name)
+
+	data, err := readFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("could not read config: %w", err)
+	}
+	tree, err := parseConfigTree(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	eachSpec(tree, func(spec map[string]any) {
+		if file, ok := spec["body_file"].(string); ok && file != "" {
+			spec["body_file"] = resolve(name, file)
+		}
+	})
+
+	includes, ok := tree["include"].([]any)
+	if !ok && tree["include"] != nil {
+		return nil, fmt.Errorf("%s: invalid config: include must be a list of paths", name)
+	}
+	delete(tree, "include")
+
+	merged := map[string]any{}
+	for _, inc := range includes {
+		incName, ok := inc.(string)
+		if !ok || incName == "" {
+			return nil, fmt.Errorf("%s: invalid config: include must be a list of paths", name)
+		}
+		incTree, err := readConfigTree(resolve(name, incName), readFile, resolve, stack)
+		if err != nil {
+			return nil, err
+		}
+		merged = mergeConfigTrees(merged, incTree)
+	}
+	return mergeConfigTrees(merged, tree), nil
+}
+
+// mergeConfigTrees merges over into base: routes are appended, templates
+// and behaviors added or replaced by name, profiles merged by name, and
+// other fields replaced.
+func mergeConfigTrees(base, over map[string]any) map[string]any {
+	out := maps.Clone(base)
+	for k, v := range over {
+		switch prev := out[k].(type) {
+		case map[string]any:
+			obj, ok := v.(map[string]any)
+			if !ok {
+				break
+			}
+			merged := maps.Clone(prev)
+			for name, o := range obj {
+				// profiles are merged like whole configs
+				pp, okPrev := merged[name].(map[string]any)
+				po, okOver := o.(map[string]any)
+				if k == "profiles" && okPrev && okOver {
+					o = mergeConfigTrees(pp, po)
+				}
+				merged[name] = o
+			}
+			out[k] = merged
+			continue
+		case []any:
+			if list, ok := v.([]any); ok {
+				out[k] = append(slices.Clip(prev), list...)
+				continue
+			}
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// eachSpec calls fn with every spec object of tree: routes and templates,
+// including the ones of profiles and stubs.
+func eachSpec(tree map[string]any, fn func(map[string]any)) {
+	if profiles, ok := tree["profiles"].(map[string]any); ok {
+		for _, p := range profiles {
+			if profile, ok := p.(map[string]any); ok {
+				eachSpec(profile, fn)
+			}
+		}
+	}
+	if stubs, ok := tree["stubs"].([]any); ok {
+		for _, st := range stubs {
+			if stub, ok := st.(map[string]any); ok {
+				eachSpec(stub, fn)
+			}
+		}
+	}
+	if templates, ok := tree["templates"].(map[string]any); ok {
+		for _, tpl := range templates {
+			if spec, ok := tpl.(map[string]any); ok {
+				fn(spec)
+			}
+		}
+	}
+	if routes, ok := tree["routes"].([]any); ok {
+		for _, route := range routes {
+			if spec, ok := route.(map[string]any); ok {
+				fn(spec)
+			}
+		}
+	}
+}
+
+// applyTemplates replaces each route extending a template with the
+// template overridden by the route, and drops the templates from tree.
+// The routes of profiles and stubs may use tree's templates and their own.
+func applyTemplates(tree, inherited map[string]any) error {
+	own, ok := tree["templates"].(map[string]any)
+	if !ok && tree["templates"] != nil {
+		return errors.New("templates must be an object of specs")
+	}
+	delete(tree, "templates")
+	templates := maps.Clone(inherited)
+	if templates == nil {
+		templates = own
+	} else {
+		maps.Copy(templates, own)
+	}
+
+	if profiles, ok := tree["profiles"].(map[string]any); ok {
+		for name, p := range profiles {
+			profile, ok := p.(map[string]any)
+			if !ok {
+				continue
+			}
+			if err := applyTemplates(profile, templates); err != nil {
+				return fmt.Errorf("profiles[%s]: %w", name, err)
+			}
+		}
+	}
+	if stubs, ok := tree["stubs"].([]any); ok {
+		for i, st := range stubs {
+			stub, ok := st.(map[string]any)
+			if !ok {
+				continue
+			}
+			if err := applyTemplates(stub, templates); err != nil {
+				return fmt.Errorf("stubs[%d]: %w", i, err)
+			}
+		}
+	}
+
+	routes, _ := tree["routes"].([]any)
+	for i, route := range routes {
+		spec, ok := route.(map[string]any)
+		if !ok {
+			continue
+		}
+		extended, err := extendSpec(spec, templates, nil)
+		if err != nil {
+			return fmt.Errorf("routes[%d]: %w", i, err)
+		}
+		routes[i] = extended
+	}
+	return nil
+}
+
+// extendSpec resolves spec's extends chain. Objects such as headers are
+// merged key by key, other fields of spec replace the template's.
+func extendSpec(spec, templates map[string]any, chain []string) (map[string]any, error) {
+	name, ok := spec["extends"].(string)
+	if !ok {
+		if spec["extends"] != nil {
+			return nil, errors.New("extends must be a template name")
+		}
+		return spec, nil
+	}
+	if slices.Contains(chain, name) {
+		return nil, fmt.Errorf("template cycle: %s", name)
+	}
+	tpl, ok := templates[name].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("unknown template: %s", name)
+	}
+	base, err := extendSpec(tpl, templates, append(chain, name))
+	if err != nil {
+		return nil, err
+	}
+
+	out := deepMerge(base, spec)
+	delete(out, "extends")
+	return out, nil
+}
+
+// deepMerge returns base with over's fields, merging objects recursively.
+func deepMerge(base, over map[string]any) map[string]any {
+	out := maps.Clone(base)
+	for k, v := range over {
+		prev, okPrev := out[k].(map[string]any)
+		obj, okObj := v.(map[string]any)
+		if okPrev && okObj {
+			v = deepMerge(prev, obj)
+		}
+		out[k] = v
+	}
+	return out
+}
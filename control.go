@@ -0,0 +1,450 @@
+package stubsrv
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type DynamicHandlerSpec struct {
+	Method string            `json:"method"`
+	Path   string            `json:"path"`
+	Query  map[string]string `json:"query"`
+	Status int               `json:"status"`
+	Body   string            `json:"body"`
+	// BodyFile is read from disk, or from WithBodyFileFS in specs posted to
+	// the control plane.
+	BodyFile string            `json:"body_file"`
+	Headers  map[string]string `json:"headers"`
+	Chunks   []SpecChunk       `json:"chunks"`
+	// Checksums lists integrity headers computed from the response body,
+	// see WithChecksums.
+	Checksums []Checksum `json:"checksums"`
+	// RawHeaders replaces Headers when the exact case and order of the
+	// response headers matter, see RawResponse.
+	RawHeaders []RawHeader `json:"raw_headers"`
+
+	// Priority orders routes that could serve the same request, see
+	// RouteBuilder.WithPriority.
+	Priority int `json:"priority"`
+
+	// Variants replace the spec's own response: each request gets the
+	// variant its VaryBy attributes hash to, so the same request always
+	// gets the same answer. Attributes are method, path, body, or
+	// query.<name>, header.<name> and param.<name>.
+	Variants []SpecResponse `json:"variants"`
+	VaryBy   []string       `json:"vary_by"`
+
+	Behavior string       `json:"behavior"`
+	Branches []SpecBranch `json:"branches"`
+
+	MatchHeaders  map[string]string `json:"match_headers"`
+	MatchBody     string            `json:"match_body"`
+	MatchBodyMode BodyMatchMode     `json:"match_body_mode"`
+	MatchGraphQL  *GraphQLMatch     `json:"match_graphql"`
+	MatchXPath    map[string]string `json:"match_xpath"`
+	Schedule      string            `json:"schedule"`
+
+	Scenario  string `json:"scenario"`
+	WhenState string `json:"when_state"`
+	ThenState string `json:"then_state"`
+
+	DelayMS       int `json:"delay_ms"`
+	DelayJitterMS int `json:"delay_jitter_ms"`
+	// CPUBurnMS keeps a core busy for this long before responding, see
+	// WithCPUBurn.
+	CPUBurnMS int `json:"cpu_burn_ms"`
+
+	// RequireBearer answers 401 unless the request carries this bearer
+	// token, or any bearer token when it is "*".
+	RequireBearer string `json:"require_bearer"`
+	// RequireJWT, when set, answers 401 unless the request carries a JWT
+	// issued by the stub holding these claims.
+	RequireJWT map[string]any `json:"require_jwt"`
+
+	// ParamTypes answers with a validation error when a path parameter is
+	// not of its type, in the ParamErrorStyle framework's format. See
+	// ValidateParams.
+	ParamTypes      map[string]ParamType `json:"param_types"`
+	ParamErrorStyle ParamErrorStyle      `json:"param_error_style"`
+
+	Fault Fault `json:"fault"`
+
+	Callback *Callback `json:"callback"`
+}
+
+// HandlerInfo describes a registered route. Spec is only set for routes
+// created through the control plane.
+type HandlerInfo struct {
+	ID     string              `json:"id"`
+	Method string              `json:"method"`
+	Path   string              `json:"path"`
+	Query  map[string]string   `json:"query,omitempty"`
+	Spec   *DynamicHandlerSpec `json:"spec,omitempty"`
+}
+
+// controlHandlers serves the handler registry:
+//
+//	GET    /_control/handlers             list routes
+//	GET    /_control/handlers/{id}        describe one route
+//	POST   /_control/handlers             add a route from a spec
+//	PUT    /_control/handlers/{id}        replace a route's spec
+//	PUT    /_control/handlers             replace the routes on the spec's method and path
+//	DELETE /_control/handlers/{id}        remove a route
+//	DELETE /_control/handlers?method=&path=
+func (s *Stub) controlHandlers(w http.ResponseWriter, r *http.Request) {
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/_control/handlers"), "/")
+
+	switch r.Method {
+	case http.MethodGet:
+		s.controlListHandlers(w, id)
+	case http.MethodPost:
+		switch id {
+		case "":
+			s.controlAddHandler(w, r)
+		case "bulk":
+			s.controlAddHandlers(w, r)
+		default:
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		}
+	case http.MethodPut:
+		s.controlReplaceHandler(w, r, id)
+	case http.MethodDelete:
+		s.controlDeleteHandler(w, r, id)
+	default:
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Stub) controlListHandlers(w http.ResponseWriter, id string) {
+	s.mu.Lock()
+	handlers := s.handlerInfos()
+	s.mu.Unlock()
+
+	if id == "" {
+		writeJSON(w, http.StatusOK, handlers)
+		return
+	}
+
+	i := slices.IndexFunc(handlers, func(h HandlerInfo) bool { return h.ID == id })
+	if i < 0 {
+		http.Error(w, "handler not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, handlers[i])
+}
+
+func (s *Stub) controlAddHandler(w http.ResponseWriter, r *http.Request) {
+	spec, info, ok := s.decodeSpec(w, r)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	id := s.addRoute(spec.Method, spec.Path, spec.Query, info)
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusCreated, map[string]string{"id": id})
+}
+
+// controlAddHandlers serves POST /_control/handlers/bulk, registering an
+// array of specs all at once or, when one is invalid, not at all.
+func (s *Stub) controlAddHandlers(w http.ResponseWriter, r *http.Request) {
+	var specs []DynamicHandlerSpec
+	if err := json.NewDecoder(r.Body).Decode(&specs); err != nil {
+		http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	for i := range specs {
+		if err := s.inlineBodyFile(&specs[i]); err != nil {
+			http.Error(w, fmt.Sprintf("routes[%d]: %v", i, err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	ids, err := s.AddSpecs(specs...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string][]string{"ids": ids})
+}
+
+func (s *Stub) controlReplaceHandler(w http.ResponseWriter, r *http.Request, id string) {
+	spec, info, ok := s.decodeSpec(w, r)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if id != "" {
+		if !s.removeRoute(id) {
+			http.Error(w, "handler not found", http.StatusNotFound)
+			return
+		}
+		info.id = id
+	} else if s.removeRoutes(spec.Method, spec.Path) == 0 {
+		http.Error(w, "handler not found", http.StatusNotFound)
+		return
+	}
+
+	id = s.addRoute(spec.Method, spec.Path, spec.Query, info)
+	writeJSON(w, http.StatusOK, map[string]string{"id": id})
+}
+
+func (s *Stub) controlDeleteHandler(w http.ResponseWriter, r *http.Request, id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if id != "" {
+		if !s.removeRoute(id) {
+			http.Error(w, "handler not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	method, path := r.URL.Query().Get("method"), r.URL.Query().Get("path")
+	if method == "" || path == "" {
+		http.Error(w, "id or method and path are required", http.StatusBadRequest)
+		return
+	}
+	if s.removeRoutes(method, path) == 0 {
+		http.Error(w, "handler not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Stub) controlReset(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.Reset()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerInfos lists every route ordered by ID. Callers must hold s.mu.
+func (s *Stub) handlerInfos() []HandlerInfo {
+	handlers := make([]HandlerInfo, 0, len(s.routers)+len(s.templateRoutes))
+	for key, info := range s.routers {
+		method, path, _ := strings.Cut(key, " ")
+		handlers = append(handlers, HandlerInfo{ID: info.id, Method: method, Path: path, Spec: info.spec})
+	}
+	for _, tr := range s.templateRoutes {
+		handlers = append(handlers, HandlerInfo{
+			ID:     tr.info.id,
+			Method: tr.method,
+			Path:   "/" + strings.Join(tr.segments, "/"),
+			Query:  tr.queries,
+			Spec:   tr.info.spec,
+		})
+	}
+
+	slices.SortFunc(handlers, func(a, b HandlerInfo) int {
+		ai, _ := strconv.Atoi(a.ID)
+		bi, _ := strconv.Atoi(b.ID)
+		return ai - bi
+	})
+	return handlers
+}
+
+func (s *Stub) decodeSpec(w http.ResponseWriter, r *http.Request) (DynamicHandlerSpec, routeInfo, bool) {
+	var spec DynamicHandlerSpec
+
+	if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+		http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return spec, routeInfo{}, false
+	}
+	if err := s.inlineBodyFile(&spec); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return spec, routeInfo{}, false
+	}
+
+	info, err := s.specRoute(&spec)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return spec, routeInfo{}, false
+	}
+	return spec, info, true
+}
+
+// specRoute validates spec, fills in its defaults and builds the route
+// serving it.
+func (s *Stub) specRoute(spec *DynamicHandlerSpec) (routeInfo, error) {
+	s.mu.Lock()
+	behaviors := maps.Clone(s.behaviors)
+	s.mu.Unlock()
+
+	return s.compileSpec(spec, behaviors)
+}
+
+// compileSpec is specRoute resolving behaviors from the given table.
+func (s *Stub) compileSpec(spec *DynamicHandlerSpec, behaviors map[string]Behavior) (routeInfo, error) {
+	if spec.Method == "" || spec.Path == "" {
+		return routeInfo{}, errors.New("method and path are required")
+	}
+	if spec.Behavior != "" && !applyBehavior(spec, behaviors) {
+		return routeInfo{}, errors.New("unknown behavior: " + spec.Behavior)
+	}
+	if spec.Fault != "" && !spec.Fault.valid() {
+		return routeInfo{}, errors.New("unknown fault: " + string(spec.Fault))
+	}
+	if spec.DelayMS < 0 || spec.DelayJitterMS < 0 {
+		return routeInfo{}, errors.New("delay_ms and delay_jitter_ms must not be negative")
+	}
+	if spec.CPUBurnMS < 0 {
+		return routeInfo{}, errors.New("cpu_burn_ms must not be negative")
+	}
+	if spec.Scenario == "" && (spec.WhenState != "" || spec.ThenState != "") {
+		return routeInfo{}, errors.New("when_state and then_state require a scenario")
+	}
+	if spec.Status == 0 {
+		spec.Status = http.StatusOK
+	}
+
+	var middlewares []Middleware
+	switch spec.RequireBearer {
+	case "":
+	case "*":
+		middlewares = append(middlewares, RequireBearer(""))
+	default:
+		middlewares = append(middlewares, RequireBearer(spec.RequireBearer))
+	}
+	if spec.RequireJWT != nil {
+		middlewares = append(middlewares, RequireJWT(spec.RequireJWT))
+	}
+	if len(spec.ParamTypes) > 0 || spec.ParamErrorStyle != "" {
+		if err := validateParamTypes(spec); err != nil {
+			return routeInfo{}, err
+		}
+		middlewares = append(middlewares, ValidateParams(spec.ParamTypes, spec.ParamErrorStyle))
+	}
+	if spec.DelayMS > 0 || spec.DelayJitterMS > 0 {
+		middlewares = append(middlewares, WithDelayJitter(
+			time.Duration(spec.DelayMS)*time.Millisecond,
+			time.Duration(spec.DelayJitterMS)*time.Millisecond,
+		))
+	}
+	if spec.CPUBurnMS > 0 {
+		middlewares = append(middlewares, WithCPUBurn(time.Duration(spec.CPUBurnMS)*time.Millisecond))
+	}
+	if spec.ThenState != "" {
+		middlewares = append(middlewares, s.ThenState(spec.Scenario, spec.ThenState))
+	}
+	if spec.Callback != nil {
+		cb, err := compileCallback(*spec.Callback)
+		if err != nil {
+			return routeInfo{}, err
+		}
+		middlewares = append(middlewares, s.callbackMiddleware(cb))
+	}
+	if len(spec.Checksums) > 0 {
+		for _, c := range spec.Checksums {
+			if !c.valid() {
+				return routeInfo{}, errors.New("unknown checksum: " + string(c))
+			}
+		}
+		middlewares = append(middlewares, WithChecksums(spec.Checksums...))
+	}
+
+	var matchers []Matcher
+	if len(spec.MatchHeaders) > 0 {
+		matchers = append(matchers, MatchHeaders(spec.MatchHeaders))
+	}
+	if spec.MatchBody != "" || spec.MatchBodyMode != "" {
+		spec.MatchBodyMode = cmp.Or(spec.MatchBodyMode, BodyExact)
+		m, err := bodyMatcher(spec.MatchBodyMode, spec.MatchBody)
+		if err != nil {
+			return routeInfo{}, err
+		}
+		matchers = append(matchers, m)
+	}
+	for _, expr := range slices.Sorted(maps.Keys(spec.MatchXPath)) {
+		m, err := xpathMatcher(expr, spec.MatchXPath[expr])
+		if err != nil {
+			return routeInfo{}, err
+		}
+		matchers = append(matchers, m)
+	}
+	if spec.MatchGraphQL != nil {
+		matchers = append(matchers, MatchGraphQL(*spec.MatchGraphQL))
+	}
+	if spec.WhenState != "" {
+		matchers = append(matchers, s.WhenState(spec.Scenario, spec.WhenState))
+	}
+	if spec.Schedule != "" {
+		m, err := s.scheduleMatcher(spec.Schedule)
+		if err != nil {
+			return routeInfo{}, err
+		}
+		matchers = append(matchers, m)
+	}
+
+	otherwise := SpecResponse{Status: spec.Status, Body: spec.Body, Headers: spec.Headers, Chunks: spec.Chunks}
+	if err := otherwise.validate(); err != nil {
+		return routeInfo{}, err
+	}
+	if spec.BodyFile != "" {
+		if spec.Body != "" || len(spec.Chunks) > 0 {
+			return routeInfo{}, errors.New("body_file is mutually exclusive with body and chunks")
+		}
+		body, headers, err := fileResponse(spec.BodyFile, spec.Headers)
+		if err != nil {
+			return routeInfo{}, err
+		}
+		otherwise.Body, otherwise.Headers = body, headers
+	}
+
+	var responseHandler http.HandlerFunc
+	if len(spec.RawHeaders) > 0 {
+		if len(spec.Headers) > 0 || len(spec.Chunks) > 0 || len(spec.Branches) > 0 || spec.BodyFile != "" || len(spec.Checksums) > 0 || len(spec.Variants) > 0 {
+			return routeInfo{}, errors.New("raw_headers is mutually exclusive with headers, chunks, branches, body_file, checksums and variants")
+		}
+		if err := validateRawHeaders(spec.RawHeaders); err != nil {
+			return routeInfo{}, err
+		}
+		responseHandler = RawResponse(spec.Status, spec.RawHeaders, spec.Body)
+	} else {
+		fallback := http.HandlerFunc(otherwise.write)
+		if len(spec.Variants) > 0 || len(spec.VaryBy) > 0 {
+			h, err := specVariants(spec)
+			if err != nil {
+				return routeInfo{}, err
+			}
+			fallback = h
+		}
+		h, err := s.branchHandler(spec.Branches, fallback)
+		if err != nil {
+			return routeInfo{}, err
+		}
+		responseHandler = h
+	}
+
+	return routeInfo{
+		handler:     responseHandler,
+		middlewares: middlewares,
+		matchers:    matchers,
+		fault:       spec.Fault,
+		priority:    spec.Priority,
+		spec:        spec,
+	}, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,220 @@
+package stubsrv
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStub_ControlHandlers(t *testing.T) {
+	t.Parallel()
+
+	t.Run("lists Go and dynamic routes", func(t *testing.T) {
+		t.Parallel()
+
+		stub := NewStub(noopLogger())
+		stub.AddHandler(http.MethodGet, "/go", func(w http.ResponseWriter, r *http.Request) {})
+		require.NoError(t, stub.Start())
+		defer stub.Close()
+
+		id := controlAdd(t, stub, `{"method":"get","path":"/users/:id","query":{"v":"2"},"body":"u"}`)
+		assert.Equal(t, "2", id)
+
+		var got []HandlerInfo
+		controlDo(t, stub, http.MethodGet, "/_control/handlers", "", http.StatusOK, &got)
+
+		require.Len(t, got, 2)
+		assert.Equal(t, HandlerInfo{ID: "1", Method: http.MethodGet, Path: "/go"}, got[0])
+		assert.Equal(t, "2", got[1].ID)
+		assert.Equal(t, "/users/:id", got[1].Path)
+		assert.Equal(t, map[string]string{"v": "2"}, got[1].Query)
+		require.NotNil(t, got[1].Spec)
+		assert.Equal(t, "u", got[1].Spec.Body)
+
+		var single HandlerInfo
+		controlDo(t, stub, http.MethodGet, "/_control/handlers/2", "", http.StatusOK, &single)
+		assert.Equal(t, got[1], single)
+
+		controlDo(t, stub, http.MethodGet, "/_control/handlers/99", "", http.StatusNotFound, nil)
+	})
+
+	t.Run("replaces a route by ID", func(t *testing.T) {
+		t.Parallel()
+
+		stub := NewStub(noopLogger())
+		require.NoError(t, stub.Start())
+		defer stub.Close()
+
+		id := controlAdd(t, stub, `{"method":"GET","path":"/greet","body":"hello"}`)
+		controlDo(t, stub, http.MethodPut, "/_control/handlers/"+id, `{"method":"GET","path":"/greet","body":"bonjour"}`, http.StatusOK, nil)
+		assert.Equal(t, "bonjour", getBody(t, stub.URL()+"/greet"))
+
+		controlDo(t, stub, http.MethodPut, "/_control/handlers/42", `{"method":"GET","path":"/greet"}`, http.StatusNotFound, nil)
+
+		var got []HandlerInfo
+		controlDo(t, stub, http.MethodGet, "/_control/handlers", "", http.StatusOK, &got)
+		require.Len(t, got, 1)
+		assert.Equal(t, id, got[0].ID)
+	})
+
+	t.Run("replaces routes by method and path", func(t *testing.T) {
+		t.Parallel()
+
+		stub := NewStub(noopLogger())
+		require.NoError(t, stub.Start())
+		defer stub.Close()
+
+		controlAdd(t, stub, `{"method":"GET","path":"/items/:id","body":"old"}`)
+		controlDo(t, stub, http.MethodPut, "/_control/handlers", `{"method":"GET","path":"/items/:id","body":"new"}`, http.StatusOK, nil)
+		assert.Equal(t, "new", getBody(t, stub.URL()+"/items/1"))
+	})
+
+	t.Run("deletes routes by ID or by method and path", func(t *testing.T) {
+		t.Parallel()
+
+		stub := NewStub(noopLogger())
+		require.NoError(t, stub.Start())
+		defer stub.Close()
+
+		first := controlAdd(t, stub, `{"method":"GET","path":"/a"}`)
+		controlAdd(t, stub, `{"method":"GET","path":"/b/:id"}`)
+
+		controlDo(t, stub, http.MethodDelete, "/_control/handlers/"+first, "", http.StatusNoContent, nil)
+		controlDo(t, stub, http.MethodDelete, "/_control/handlers/"+first, "", http.StatusNotFound, nil)
+		controlDo(t, stub, http.MethodDelete, "/_control/handlers?method=get&path=/b/:id", "", http.StatusNoContent, nil)
+		controlDo(t, stub, http.MethodDelete, "/_control/handlers?method=GET", "", http.StatusBadRequest, nil)
+
+		var got []HandlerInfo
+		controlDo(t, stub, http.MethodGet, "/_control/handlers", "", http.StatusOK, &got)
+		assert.Empty(t, got)
+
+		resp, err := http.Get(stub.URL() + "/a")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("matches on request headers", func(t *testing.T) {
+		t.Parallel()
+
+		stub := NewStub(noopLogger())
+		require.NoError(t, stub.Start())
+		defer stub.Close()
+
+		controlAdd(t, stub, `{"method":"GET","path":"/accept","body":"text"}`)
+		controlAdd(t, stub, `{"method":"GET","path":"/accept","body":"json","match_headers":{"Accept":"application/json"}}`)
+
+		req, err := http.NewRequest(http.MethodGet, stub.URL()+"/accept", nil)
+		require.NoError(t, err)
+		req.Header.Set("Accept", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err)
+
+		assert.Equal(t, "json", string(body))
+		assert.Equal(t, "text", getBody(t, stub.URL()+"/accept"))
+	})
+
+	t.Run("matches on request body", func(t *testing.T) {
+		t.Parallel()
+
+		stub := NewStub(noopLogger())
+		require.NoError(t, stub.Start())
+		defer stub.Close()
+
+		controlAdd(t, stub, `{"method":"POST","path":"/orders","status":201,"match_body":"{\"sku\":\"a\",\"qty\":1}","match_body_mode":"json"}`)
+		controlAdd(t, stub, `{"method":"POST","path":"/orders","status":409,"match_body":"dup"}`)
+		controlAdd(t, stub, `{"method":"POST","path":"/orders","status":400}`)
+		controlDo(t, stub, http.MethodPost, "/_control/handlers", `{"method":"POST","path":"/x","match_body":"(","match_body_mode":"regex"}`, http.StatusBadRequest, nil)
+
+		controlDo(t, stub, http.MethodPost, "/orders", `{"qty":1,"sku":"a"}`, http.StatusCreated, nil)
+		controlDo(t, stub, http.MethodPost, "/orders", "dup", http.StatusConflict, nil)
+		controlDo(t, stub, http.MethodPost, "/orders", "other", http.StatusBadRequest, nil)
+	})
+
+	t.Run("rejects unsupported methods and invalid specs", func(t *testing.T) {
+		t.Parallel()
+
+		stub := NewStub(noopLogger())
+		require.NoError(t, stub.Start())
+		defer stub.Close()
+
+		controlDo(t, stub, http.MethodPatch, "/_control/handlers", "", http.StatusMethodNotAllowed, nil)
+		controlDo(t, stub, http.MethodPost, "/_control/handlers/1", `{}`, http.StatusMethodNotAllowed, nil)
+		controlDo(t, stub, http.MethodPost, "/_control/handlers", `{"path":"/x"}`, http.StatusBadRequest, nil)
+		controlDo(t, stub, http.MethodPost, "/_control/handlers", `{`, http.StatusBadRequest, nil)
+	})
+}
+
+func readAll(t *testing.T, resp *http.Response) string {
+	t.Helper()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func controlAdd(t *testing.T, stub *Stub, spec string) string {
+	t.Helper()
+
+	var created struct{ ID string }
+	controlDo(t, stub, http.MethodPost, "/_control/handlers", spec, http.StatusCreated, &created)
+	return created.ID
+}
+
+func controlDo(t *testing.T, stub *Stub, method, path, body string, expectedStatus int, out any) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, stub.URL()+path, strings.NewReader(body))
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, expectedStatus, resp.StatusCode)
+	if out != nil {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(out))
+	}
+}
+
+func TestStub_ControlAddHandlersBulk(t *testing.T) {
+	t.Parallel()
+
+	stub := NewStub(noopLogger())
+	require.NoError(t, stub.Start())
+	defer stub.Close()
+
+	// the second spec is invalid, so neither is registered
+	controlDo(t, stub, http.MethodPost, "/_control/handlers/bulk", `[
+		{"method":"GET","path":"/a"},
+		{"method":"GET","path":"/b","fault":"nope"}
+	]`, http.StatusBadRequest, nil)
+
+	var handlers []HandlerInfo
+	controlDo(t, stub, http.MethodGet, "/_control/handlers", "", http.StatusOK, &handlers)
+	assert.Empty(t, handlers)
+
+	var created struct{ IDs []string }
+	controlDo(t, stub, http.MethodPost, "/_control/handlers/bulk", `[
+		{"method":"GET","path":"/a","status":201},
+		{"method":"GET","path":"/b/:id","status":202}
+	]`, http.StatusCreated, &created)
+	require.Len(t, created.IDs, 2)
+
+	for path, status := range map[string]int{"/a": http.StatusCreated, "/b/1": http.StatusAccepted} {
+		resp, err := http.Get(stub.URL() + path)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, status, resp.StatusCode, path)
+	}
+
+	controlDo(t, stub, http.MethodPost, "/_control/handlers/bulk", `{"method":"GET"}`, http.StatusBadRequest, nil)
+	controlDo(t, stub, http.MethodPost, "/_control/handlers/other", `[]`, http.StatusMethodNotAllowed, nil)
+}
@@ -0,0 +1,89 @@
+package stubsrv
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+)
+
+// WithControlAuth requires "Authorization: Bearer <token>" on every
+// /_control/ endpoint, so a stub in a shared environment can't be
+// reconfigured by anyone who reaches it. Routes added under /_control/, as
+// sub-packages do for their control endpoints, require it too.
+func WithControlAuth(token string) Option {
+	return func(cfg *stubConfig) {
+		cfg.controlToken = token
+	}
+}
+
+// WithControlPort serves the /_control/ endpoints on a second listener bound
+// to port, or a random port when it is "0", instead of next to the routes.
+// The routes' port then only serves routes and /readyz, while routes added
+// under /_control/ move to the control port. See ControlURL.
+func WithControlPort(port string) Option {
+	return func(cfg *stubConfig) {
+		cfg.controlPort = port
+	}
+}
+
+// ControlURL returns the base URL of the control endpoints, which is URL
+// unless WithControlPort is set, or "" when the stub is not running.
+func (s *Stub) ControlURL() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Server == nil || s.closed {
+		return ""
+	}
+	if s.controlServer != nil {
+		return s.controlURL
+	}
+	return s.baseURL
+}
+
+func (s *Stub) controlAuth(token string, next http.Handler) http.Handler {
+	if token == "" {
+		return next
+	}
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := []byte(r.Header.Get("Authorization"))
+		if subtle.ConstantTimeCompare(got, want) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="stubsrv control"`)
+			http.Error(w, "control endpoints require a valid bearer token", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// startControl brings up the control listener, with the same TLS setup as
+// the routes' one. Callers must hold s.mu.
+func (s *Stub) startControl() error {
+	listenAddr := net.JoinHostPort("", s.controlPort)
+	ln, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		return fmt.Errorf("could not listen for control on %s: %w", listenAddr, err)
+	}
+
+	s.controlServer = &httptest.Server{
+		Listener: ln,
+		Config:   &http.Server{Handler: s.control},
+	}
+	if s.tls {
+		s.controlServer.TLS = s.Server.TLS.Clone()
+		s.controlServer.StartTLS()
+	} else {
+		s.controlServer.Start()
+	}
+	s.controlURL = s.controlServer.URL
+
+	if s.tls {
+		// the certificate only covers loopback addresses
+		_, port, _ := net.SplitHostPort(ln.Addr().String())
+		s.controlURL = "https://" + net.JoinHostPort("127.0.0.1", port)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package stubsrv
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStub_ControlAuth(t *testing.T) {
+	t.Parallel()
+
+	stub := NewStub(noopLogger(), WithControlAuth("s3cret"))
+	stub.AddHandler(http.MethodGet, "/open", func(w http.ResponseWriter, r *http.Request) {})
+	stub.AddHandler(http.MethodGet, "/_control/module/:key", func(w http.ResponseWriter, r *http.Request) {})
+	require.NoError(t, stub.Start())
+	t.Cleanup(stub.Close)
+	assert.Equal(t, stub.URL(), stub.ControlURL())
+
+	testCases := []struct {
+		name           string
+		givenPath      string
+		givenAuth      string
+		expectedStatus int
+	}{
+		{name: "no token", givenPath: "/_control/handlers", expectedStatus: http.StatusUnauthorized},
+		{name: "wrong token", givenPath: "/_control/handlers", givenAuth: "Bearer nope", expectedStatus: http.StatusUnauthorized},
+		{name: "wrong scheme", givenPath: "/_control/info", givenAuth: "Basic s3cret", expectedStatus: http.StatusUnauthorized},
+		{name: "valid token", givenPath: "/_control/handlers", givenAuth: "Bearer s3cret", expectedStatus: http.StatusOK},
+		{name: "routes under /_control/ need a token", givenPath: "/_control/module/x", expectedStatus: http.StatusUnauthorized},
+		{name: "routes under /_control/ with token", givenPath: "/_control/module/x", givenAuth: "Bearer s3cret", expectedStatus: http.StatusOK},
+		{name: "routes are open", givenPath: "/open", expectedStatus: http.StatusOK},
+		{name: "readiness is open", givenPath: "/readyz", expectedStatus: http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			req, err := http.NewRequest(http.MethodGet, stub.URL()+tc.givenPath, nil)
+			require.NoError(t, err)
+			if tc.givenAuth != "" {
+				req.Header.Set("Authorization", tc.givenAuth)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+
+			assert.Equal(t, tc.expectedStatus, resp.StatusCode)
+			if tc.expectedStatus == http.StatusUnauthorized {
+				assert.NotEmpty(t, resp.Header.Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestStub_ControlPort(t *testing.T) {
+	t.Parallel()
+
+	for _, useTLS := range []bool{false, true} {
+		opts := []Option{WithControlPort("0")}
+		if useTLS {
+			opts = append(opts, WithTLS())
+		}
+		stub := NewStub(noopLogger(), opts...)
+		stub.AddHandler(http.MethodGet, "/_control/module/:key", func(w http.ResponseWriter, r *http.Request) {})
+		require.NoError(t, stub.Start())
+
+		controlURL := stub.ControlURL()
+		require.NotEmpty(t, controlURL)
+		assert.NotEqual(t, stub.URL(), controlURL)
+
+		client := stub.Client()
+		resp, err := client.Post(controlURL+"/_control/handlers", "application/json",
+			http.NoBody)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "served on the control port")
+
+		resp, err = client.Get(stub.URL() + "/_control/handlers")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, "not served next to the routes")
+
+		resp, err = client.Get(controlURL + "/_control/module/x")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "routes under /_control/ are served on the control port")
+
+		resp, err = client.Get(stub.URL() + "/_control/module/x")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+		stub.Close()
+		assert.Empty(t, stub.ControlURL())
+		_, err = client.Get(controlURL + "/_control/handlers")
+		assert.Error(t, err)
+	}
+}
+
+func TestStub_HandleControl(t *testing.T) {
+	t.Parallel()
+
+	stub := NewStub(noopLogger(), WithControlAuth("s3cret"))
+	stub.HandleControl("/_control/module", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	})
+	require.NoError(t, stub.Start())
+	t.Cleanup(stub.Close)
+
+	get := func(path, auth string) (int, string) {
+		t.Helper()
+
+		req, err := http.NewRequest(http.MethodGet, stub.URL()+path, nil)
+		require.NoError(t, err)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return resp.StatusCode, readAll(t, resp)
+	}
+
+	status, _ := get("/_control/module", "")
+	assert.Equal(t, http.StatusUnauthorized, status)
+	status, _ = get("/_control/module", "Bearer s3cret")
+	assert.Equal(t, http.StatusAccepted, status)
+	_, body := get("/_control/handlers", "Bearer s3cret")
+	assert.JSONEq(t, `[]`, body, "not listed with the routes")
+	assert.Empty(t, stub.Requests(), "not journaled")
+
+	stub.Reset()
+	status, _ = get("/_control/module", "Bearer s3cret")
+	assert.Equal(t, http.StatusAccepted, status, "kept across Reset")
+	_, err := stub.ApplyConfig(Config{})
+	require.NoError(t, err)
+	status, _ = get("/_control/module", "Bearer s3cret")
+	assert.Equal(t, http.StatusAccepted, status, "kept across ApplyConfig")
+
+	assert.Panics(t, func() { stub.HandleControl("/module", func(http.ResponseWriter, *http.Request) {}) })
+	assert.Panics(t, func() { stub.HandleControl("/_control/module", func(http.ResponseWriter, *http.Request) {}) })
+}
@@ -0,0 +1,43 @@
+package stubsrv
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// burnSink keeps the compiler from optimizing the busy loop away.
+var burnSink atomic.Uint64
+
+// WithCPUBurn returns a middleware that keeps a core busy for d before
+// responding, so load tests see a computationally expensive upstream
+// rather than one that sleeps. Like WithDelay, the work is abandoned if
+// the client goes away.
+func WithCPUBurn(d time.Duration) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !burnCPU(r.Context(), d) {
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// burnCPU spins for d and reports whether it ran to completion before ctx
+// was done.
+func burnCPU(ctx context.Context, d time.Duration) bool {
+	deadline := time.Now().Add(d)
+	x := uint64(1)
+	for time.Now().Before(deadline) {
+		for range 10_000 {
+			x = x*6364136223846793005 + 1442695040888963407
+		}
+		if ctx.Err() != nil {
+			return false
+		}
+	}
+	burnSink.Store(x)
+	return true
+}
@@ -0,0 +1,62 @@
+package stubsrv
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithCPUBurn(t *testing.T) {
+	t.Parallel()
+
+	t.Run("burns before responding", func(t *testing.T) {
+		t.Parallel()
+
+		h := WithCPUBurn(30 * time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}))
+
+		w := httptest.NewRecorder()
+		start := time.Now()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.GreaterOrEqual(t, time.Since(start), 30*time.Millisecond)
+	})
+
+	t.Run("canceled request skips the handler", func(t *testing.T) {
+		t.Parallel()
+
+		var called bool
+		h := WithCPUBurn(time.Hour)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+		}))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+		assert.False(t, called)
+	})
+}
+
+func TestStub_ControlAddHandlerCPUBurn(t *testing.T) {
+	t.Parallel()
+
+	stub := NewStub(noopLogger())
+	require.NoError(t, stub.Start())
+	defer stub.Close()
+
+	controlAdd(t, stub, `{"method":"GET","path":"/busy","body":"done","cpu_burn_ms":20}`)
+
+	start := time.Now()
+	assert.Equal(t, "done", getBody(t, stub.URL()+"/busy"))
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+
+	controlDo(t, stub, http.MethodPost, "/_control/handlers", `{"method":"GET","path":"/x","cpu_burn_ms":-1}`, http.StatusBadRequest, nil)
+}
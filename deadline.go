@@ -0,0 +1,80 @@
+package stubsrv
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// TimeoutHeader carries the time a client is willing to wait, as a Go
+// duration such as "150ms". See WithClientDeadlines.
+const TimeoutHeader = "X-Stubsrv-Timeout"
+
+// WithClientDeadlines sets the context deadline of route handlers to the
+// timeout requests carry in TimeoutHeader or, failing that, in a gRPC
+// grpc-timeout header, so tests can see how handlers and middlewares such
+// as WithDelay behave under tight client deadlines. Requests with a
+// malformed timeout are answered 400.
+func WithClientDeadlines() Option {
+	return func(cfg *stubConfig) {
+		cfg.clientDeadlines = true
+	}
+}
+
+// withClientDeadline returns r with the deadline its headers ask for, and
+// the function releasing it.
+func withClientDeadline(r *http.Request) (*http.Request, context.CancelFunc, error) {
+	timeout, ok, err := requestTimeout(r.Header)
+	if err != nil || !ok {
+		return r, func() {}, err
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	return r.WithContext(ctx), cancel, nil
+}
+
+func requestTimeout(h http.Header) (time.Duration, bool, error) {
+	if v := h.Get(TimeoutHeader); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return 0, false, errors.New("invalid " + TimeoutHeader + " header: want a positive duration such as 150ms")
+		}
+		return d, true, nil
+	}
+	if v := h.Get("Grpc-Timeout"); v != "" {
+		d, err := parseGRPCTimeout(v)
+		if err != nil {
+			return 0, false, err
+		}
+		return d, true, nil
+	}
+	return 0, false, nil
+}
+
+// parseGRPCTimeout parses a grpc-timeout value: up to 8 digits followed by
+// one of the units H, M, S, m (milliseconds), u or n.
+func parseGRPCTimeout(v string) (time.Duration, error) {
+	errInvalid := errors.New("invalid grpc-timeout header: " + v)
+	if len(v) < 2 || len(v) > 9 {
+		return 0, errInvalid
+	}
+
+	n, err := strconv.ParseInt(v[:len(v)-1], 10, 64)
+	if err != nil || n < 0 {
+		return 0, errInvalid
+	}
+	units := map[byte]time.Duration{
+		'H': time.Hour,
+		'M': time.Minute,
+		'S': time.Second,
+		'm': time.Millisecond,
+		'u': time.Microsecond,
+		'n': time.Nanosecond,
+	}
+	unit, ok := units[v[len(v)-1]]
+	if !ok {
+		return 0, errInvalid
+	}
+	return time.Duration(n) * unit, nil
+}
@@ -0,0 +1,131 @@
+package stubsrv
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithClientDeadlines(t *testing.T) {
+	t.Parallel()
+
+	stub := NewStub(noopLogger(), WithClientDeadlines())
+	stub.AddHandler(http.MethodGet, "/deadline", func(w http.ResponseWriter, r *http.Request) {
+		deadline, ok := r.Context().Deadline()
+		if !ok {
+			_, _ = w.Write([]byte("none"))
+			return
+		}
+		_, _ = w.Write([]byte(time.Until(deadline).Round(time.Second).String()))
+	})
+	stub.AddHandler(http.MethodGet, "/slow", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("done"))
+	}, WithDelay(5*time.Second))
+	require.NoError(t, stub.Start())
+	defer stub.Close()
+
+	testCases := []struct {
+		name           string
+		givenPath      string
+		givenHeader    http.Header
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "no timeout",
+			givenPath:      "/deadline",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "none",
+		},
+		{
+			name:           "stubsrv header",
+			givenPath:      "/deadline",
+			givenHeader:    http.Header{TimeoutHeader: {"30s"}},
+			expectedStatus: http.StatusOK,
+			expectedBody:   "30s",
+		},
+		{
+			name:           "grpc-timeout header",
+			givenPath:      "/deadline",
+			givenHeader:    http.Header{"Grpc-Timeout": {"2M"}},
+			expectedStatus: http.StatusOK,
+			expectedBody:   "2m0s",
+		},
+		{
+			name:           "stubsrv header takes precedence",
+			givenPath:      "/deadline",
+			givenHeader:    http.Header{TimeoutHeader: {"10s"}, "Grpc-Timeout": {"1H"}},
+			expectedStatus: http.StatusOK,
+			expectedBody:   "10s",
+		},
+		{
+			name:           "deadline cuts a delay short",
+			givenPath:      "/slow",
+			givenHeader:    http.Header{TimeoutHeader: {"20ms"}},
+			expectedStatus: http.StatusOK,
+			expectedBody:   "",
+		},
+		{
+			name:           "malformed timeout",
+			givenPath:      "/deadline",
+			givenHeader:    http.Header{TimeoutHeader: {"soon"}},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "invalid X-Stubsrv-Timeout header: want a positive duration such as 150ms\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, stub.URL()+tc.givenPath, nil)
+			require.NoError(t, err)
+			req.Header = tc.givenHeader
+
+			start := time.Now()
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, tc.expectedStatus, resp.StatusCode)
+			assert.Equal(t, tc.expectedBody, readAll(t, resp))
+			assert.Less(t, time.Since(start), time.Second)
+		})
+	}
+}
+
+func TestParseGRPCTimeout(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		given         string
+		expected      time.Duration
+		expectedError bool
+	}{
+		{given: "1H", expected: time.Hour},
+		{given: "5M", expected: 5 * time.Minute},
+		{given: "3S", expected: 3 * time.Second},
+		{given: "250m", expected: 250 * time.Millisecond},
+		{given: "10u", expected: 10 * time.Microsecond},
+		{given: "99999999n", expected: 99999999 * time.Nanosecond},
+		{given: "123456789n", expectedError: true},
+		{given: "5", expectedError: true},
+		{given: "5s", expectedError: true},
+		{given: "-1S", expectedError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.given, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := parseGRPCTimeout(tc.given)
+			if tc.expectedError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, got)
+		})
+	}
+}
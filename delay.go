@@ -0,0 +1,35 @@
+package stubsrv
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"time"
+)
+
+// WithDelay returns a middleware that holds the response for d, simulating
+// a slow upstream. The wait is abandoned if the client goes away.
+func WithDelay(d time.Duration) Middleware {
+	return WithDelayJitter(d, 0)
+}
+
+// WithDelayJitter is like WithDelay but adds a random extra delay in
+// [0, jitter] to every request.
+func WithDelayJitter(d, jitter time.Duration) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			wait := d
+			if jitter > 0 {
+				wait += rand.N(jitter + 1)
+			}
+
+			timer := time.NewTimer(wait)
+			defer timer.Stop()
+
+			select {
+			case <-timer.C:
+				next.ServeHTTP(w, r)
+			case <-r.Context().Done():
+			}
+		})
+	}
+}
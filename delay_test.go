@@ -0,0 +1,96 @@
+package stubsrv
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithDelay(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name        string
+		givenMW     Middleware
+		expectedMin time.Duration
+		expectedMax time.Duration
+	}{
+		{
+			name:        "fixed delay",
+			givenMW:     WithDelay(30 * time.Millisecond),
+			expectedMin: 30 * time.Millisecond,
+			expectedMax: 200 * time.Millisecond,
+		},
+		{
+			name:        "delay with jitter stays within bounds",
+			givenMW:     WithDelayJitter(20*time.Millisecond, 20*time.Millisecond),
+			expectedMin: 20 * time.Millisecond,
+			expectedMax: 200 * time.Millisecond,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			h := chainMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			}), tc.givenMW)
+
+			w := httptest.NewRecorder()
+			start := time.Now()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+			elapsed := time.Since(start)
+
+			assert.Equal(t, http.StatusNoContent, w.Code)
+			assert.GreaterOrEqual(t, elapsed, tc.expectedMin)
+			assert.Less(t, elapsed, tc.expectedMax)
+		})
+	}
+
+	t.Run("canceled request skips the handler", func(t *testing.T) {
+		t.Parallel()
+
+		var called bool
+		h := WithDelay(time.Hour)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+		}))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+		assert.False(t, called)
+	})
+}
+
+func TestStub_ControlAddHandlerDelay(t *testing.T) {
+	t.Parallel()
+
+	stub := NewStub(noopLogger())
+	require.NoError(t, stub.Start())
+	defer stub.Close()
+
+	payload := `{"method":"GET","path":"/slow","body":"late","delay_ms":50}`
+	resp, err := http.Post(stub.URL()+"/_control/handlers", "application/json", strings.NewReader(payload))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	client := http.Client{Timeout: 10 * time.Millisecond}
+	_, err = client.Get(stub.URL() + "/slow")
+	assert.Error(t, err)
+
+	start := time.Now()
+	assert.Equal(t, "late", getBody(t, stub.URL()+"/slow"))
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+
+	resp, err = http.Post(stub.URL()+"/_control/handlers", "application/json", strings.NewReader(`{"method":"GET","path":"/x","delay_ms":-1}`))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
@@ -0,0 +1,191 @@
+// Package directory serves a configurable user/group directory over HTTP,
+// standing in for LDAP gateways and internal identity services.
+package directory
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/alesr/stubsrv"
+)
+
+type User struct {
+	ID          string            `json:"id"`
+	Username    string            `json:"username"`
+	Email       string            `json:"email,omitempty"`
+	DisplayName string            `json:"display_name,omitempty"`
+	Groups      []string          `json:"groups,omitempty"`
+	Attributes  map[string]string `json:"attributes,omitempty"`
+}
+
+type Group struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type Dataset struct {
+	Users  []User
+	Groups []Group
+}
+
+type Directory struct {
+	mu sync.Mutex
+	ds Dataset
+}
+
+// New serves ds under prefix (e.g. "/directory"):
+//
+//	GET <prefix>/users?username=&email=&group=
+//	GET <prefix>/users/:id
+//	GET <prefix>/users/:id/groups
+//	GET <prefix>/groups
+//	GET <prefix>/groups/:id
+//	GET <prefix>/groups/:id/members
+func New(stub *stubsrv.Stub, prefix string, ds Dataset) *Directory {
+	d := Directory{ds: ds}
+	prefix = strings.TrimSuffix(prefix, "/")
+
+	stub.AddHandler(http.MethodGet, prefix+"/users", d.handleUsers)
+	stub.AddHandler(http.MethodGet, prefix+"/users/:id", d.handleUser)
+	stub.AddHandler(http.MethodGet, prefix+"/users/:id/groups", d.handleUserGroups)
+	stub.AddHandler(http.MethodGet, prefix+"/groups", d.handleGroups)
+	stub.AddHandler(http.MethodGet, prefix+"/groups/:id", d.handleGroup)
+	stub.AddHandler(http.MethodGet, prefix+"/groups/:id/members", d.handleMembers)
+	return &d
+}
+
+// SetDataset replaces the served dataset.
+func (d *Directory) SetDataset(ds Dataset) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.ds = ds
+}
+
+func (d *Directory) handleUsers(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	d.mu.Lock()
+	users := make([]User, 0, len(d.ds.Users))
+	for _, u := range d.ds.Users {
+		if v := q.Get("username"); v != "" && !strings.EqualFold(u.Username, v) {
+			continue
+		}
+		if v := q.Get("email"); v != "" && !strings.EqualFold(u.Email, v) {
+			continue
+		}
+		if v := q.Get("group"); v != "" && !slices.Contains(u.Groups, v) {
+			continue
+		}
+		users = append(users, u)
+	}
+	d.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, users)
+}
+
+func (d *Directory) handleUser(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	u, ok := d.user(segment(r.URL.Path, 1))
+	d.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, "user not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, u)
+}
+
+func (d *Directory) handleUserGroups(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	u, ok := d.user(segment(r.URL.Path, 2))
+	if !ok {
+		writeError(w, http.StatusNotFound, "user not found")
+		return
+	}
+
+	groups := make([]Group, 0, len(u.Groups))
+	for _, g := range d.ds.Groups {
+		if slices.Contains(u.Groups, g.ID) {
+			groups = append(groups, g)
+		}
+	}
+	writeJSON(w, http.StatusOK, groups)
+}
+
+func (d *Directory) handleGroups(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	groups := append([]Group{}, d.ds.Groups...)
+	d.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, groups)
+}
+
+func (d *Directory) handleGroup(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	g, ok := d.group(segment(r.URL.Path, 1))
+	d.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, "group not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, g)
+}
+
+func (d *Directory) handleMembers(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	g, ok := d.group(segment(r.URL.Path, 2))
+	if !ok {
+		writeError(w, http.StatusNotFound, "group not found")
+		return
+	}
+
+	members := []User{}
+	for _, u := range d.ds.Users {
+		if slices.Contains(u.Groups, g.ID) {
+			members = append(members, u)
+		}
+	}
+	writeJSON(w, http.StatusOK, members)
+}
+
+func (d *Directory) user(id string) (User, bool) {
+	i := slices.IndexFunc(d.ds.Users, func(u User) bool { return u.ID == id })
+	if i < 0 {
+		return User{}, false
+	}
+	return d.ds.Users[i], true
+}
+
+func (d *Directory) group(id string) (Group, bool) {
+	i := slices.IndexFunc(d.ds.Groups, func(g Group) bool { return g.ID == id })
+	if i < 0 {
+		return Group{}, false
+	}
+	return d.ds.Groups[i], true
+}
+
+// segment returns the path segment at position n counting from the end,
+// where 1 is the last one.
+func segment(p string, n int) string {
+	segs := strings.Split(strings.Trim(p, "/"), "/")
+	return segs[len(segs)-n]
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
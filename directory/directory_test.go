@@ -0,0 +1,99 @@
+package directory
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"testing"
+
+	"github.com/alesr/stubsrv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var dataset = Dataset{
+	Users: []User{
+		{ID: "u1", Username: "alice", Email: "alice@example.com", Groups: []string{"g1", "g2"}},
+		{ID: "u2", Username: "bob", Email: "bob@example.com", Groups: []string{"g2"}},
+	},
+	Groups: []Group{
+		{ID: "g1", Name: "admins"},
+		{ID: "g2", Name: "engineering"},
+	},
+}
+
+func TestDirectory(t *testing.T) {
+	t.Parallel()
+
+	stub := stubsrv.NewStub(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	New(stub, "/directory", dataset)
+	require.NoError(t, stub.Start())
+	t.Cleanup(stub.Close)
+
+	testCases := []struct {
+		name           string
+		givenPath      string
+		expectedStatus int
+		expectedIDs    []string
+	}{
+		{name: "all users", givenPath: "/directory/users", expectedStatus: http.StatusOK, expectedIDs: []string{"u1", "u2"}},
+		{name: "users by username", givenPath: "/directory/users?username=Alice", expectedStatus: http.StatusOK, expectedIDs: []string{"u1"}},
+		{name: "users by group", givenPath: "/directory/users?group=g1", expectedStatus: http.StatusOK, expectedIDs: []string{"u1"}},
+		{name: "users with no match", givenPath: "/directory/users?email=carol@example.com", expectedStatus: http.StatusOK, expectedIDs: []string{}},
+		{name: "single user", givenPath: "/directory/users/u2", expectedStatus: http.StatusOK, expectedIDs: []string{"u2"}},
+		{name: "unknown user", givenPath: "/directory/users/u9", expectedStatus: http.StatusNotFound},
+		{name: "user groups", givenPath: "/directory/users/u1/groups", expectedStatus: http.StatusOK, expectedIDs: []string{"g1", "g2"}},
+		{name: "all groups", givenPath: "/directory/groups", expectedStatus: http.StatusOK, expectedIDs: []string{"g1", "g2"}},
+		{name: "single group", givenPath: "/directory/groups/g1", expectedStatus: http.StatusOK, expectedIDs: []string{"g1"}},
+		{name: "group members", givenPath: "/directory/groups/g2/members", expectedStatus: http.StatusOK, expectedIDs: []string{"u1", "u2"}},
+		{name: "unknown group members", givenPath: "/directory/groups/g9/members", expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			resp, err := http.Get(stub.URL() + tc.givenPath)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			require.Equal(t, tc.expectedStatus, resp.StatusCode)
+			if tc.expectedIDs == nil {
+				return
+			}
+
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			var items []struct{ ID string }
+			if err := json.Unmarshal(body, &items); err != nil {
+				var item struct{ ID string }
+				require.NoError(t, json.Unmarshal(body, &item))
+				items = append(items, item)
+			}
+
+			ids := []string{}
+			for _, it := range items {
+				ids = append(ids, it.ID)
+			}
+			assert.Equal(t, tc.expectedIDs, ids)
+		})
+	}
+}
+
+func TestDirectory_SetDataset(t *testing.T) {
+	t.Parallel()
+
+	stub := stubsrv.NewStub(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	d := New(stub, "/dir/", dataset)
+	require.NoError(t, stub.Start())
+	t.Cleanup(stub.Close)
+
+	d.SetDataset(Dataset{})
+
+	resp, err := http.Get(stub.URL() + "/dir/users/u1")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
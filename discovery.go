@@ -0,0 +1,158 @@
+package stubsrv
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const registrationTimeout = 5 * time.Second
+
+// Registration describes the stub to a service registry.
+type Registration struct {
+	// Name is the service name clients resolve.
+	Name string
+	// ID identifies this instance. Defaults to Name plus the port.
+	ID   string
+	URL  string
+	Host string
+	Port int
+}
+
+// Registrar announces the stub to a service registry. Register is called by
+// Start once the listener is up and Deregister by Close.
+type Registrar interface {
+	Register(ctx context.Context, reg Registration) error
+	Deregister(ctx context.Context, reg Registration) error
+}
+
+// WithRegistrar registers the stub under name with r when it starts, and
+// deregisters it when it closes. Start fails if registration fails.
+func WithRegistrar(name string, r Registrar) Option {
+	return func(cfg *stubConfig) {
+		cfg.registrars = append(cfg.registrars, namedRegistrar{name: name, registrar: r})
+	}
+}
+
+type namedRegistrar struct {
+	name      string
+	registrar Registrar
+}
+
+func newRegistration(name, baseURL string) (Registration, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return Registration{}, err
+	}
+	host, portStr, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		return Registration{}, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return Registration{}, err
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+		// listening on every interface, advertise loopback
+		host = "127.0.0.1"
+		u.Host = net.JoinHostPort(host, portStr)
+		baseURL = u.String()
+	}
+	return Registration{Name: name, ID: name + "-" + portStr, URL: baseURL, Host: host, Port: port}, nil
+}
+
+// register announces the stub to every registrar, undoing the ones that
+// succeeded if one fails.
+func (s *Stub) register(baseURL string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), registrationTimeout)
+	defer cancel()
+
+	for i, nr := range s.registrars {
+		reg, err := newRegistration(nr.name, baseURL)
+		if err == nil {
+			err = nr.registrar.Register(ctx, reg)
+		}
+		if err != nil {
+			s.deregister(s.registrars[:i], baseURL)
+			return fmt.Errorf("could not register %s: %w", nr.name, err)
+		}
+	}
+	return nil
+}
+
+func (s *Stub) deregister(registrars []namedRegistrar, baseURL string) {
+	ctx, cancel := context.WithTimeout(context.Background(), registrationTimeout)
+	defer cancel()
+
+	for _, nr := range registrars {
+		reg, err := newRegistration(nr.name, baseURL)
+		if err == nil {
+			err = nr.registrar.Deregister(ctx, reg)
+		}
+		if err != nil {
+			s.logger.Warn("Could not deregister", slog.String("name", nr.name), slog.String("error", err.Error()))
+		}
+	}
+}
+
+// ConsulRegistrar registers the stub with a Consul agent over its HTTP API.
+type ConsulRegistrar struct {
+	// Addr is the agent's base URL. Defaults to http://127.0.0.1:8500.
+	Addr string
+	// Client defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+func (c ConsulRegistrar) Register(ctx context.Context, reg Registration) error {
+	body, err := json.Marshal(map[string]any{
+		"ID":      reg.ID,
+		"Name":    reg.Name,
+		"Address": reg.Host,
+		"Port":    reg.Port,
+		"Check": map[string]any{
+			"HTTP":     reg.URL + "/readyz",
+			"Interval": "10s",
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return c.put(ctx, "/v1/agent/service/register", body)
+}
+
+func (c ConsulRegistrar) Deregister(ctx context.Context, reg Registration) error {
+	return c.put(ctx, "/v1/agent/service/deregister/"+url.PathEscape(reg.ID), nil)
+}
+
+func (c ConsulRegistrar) put(ctx context.Context, path string, body []byte) error {
+	addr := c.Addr
+	if addr == "" {
+		addr = "http://127.0.0.1:8500"
+	}
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, addr+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("consul answered %s", resp.Status)
+	}
+	return nil
+}
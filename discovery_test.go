@@ -0,0 +1,89 @@
+package stubsrv
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeRegistrar struct {
+	err    error
+	events []string
+}
+
+func (f *fakeRegistrar) Register(_ context.Context, reg Registration) error {
+	f.events = append(f.events, "register "+reg.ID+" "+reg.URL)
+	return f.err
+}
+
+func (f *fakeRegistrar) Deregister(_ context.Context, reg Registration) error {
+	f.events = append(f.events, "deregister "+reg.ID)
+	return nil
+}
+
+func TestStub_WithRegistrar(t *testing.T) {
+	t.Parallel()
+
+	t.Run("registers on start and deregisters on close", func(t *testing.T) {
+		t.Parallel()
+
+		r := &fakeRegistrar{}
+		stub := NewStub(noopLogger(), WithRegistrar("payments", r))
+		require.NoError(t, stub.Start())
+		u, err := url.Parse(stub.URL())
+		require.NoError(t, err)
+		stub.Close()
+
+		id := "payments-" + u.Port()
+		assert.Equal(t, []string{"register " + id + " http://127.0.0.1:" + u.Port(), "deregister " + id}, r.events)
+	})
+
+	t.Run("start fails and rolls back when registration fails", func(t *testing.T) {
+		t.Parallel()
+
+		ok, failing := &fakeRegistrar{}, &fakeRegistrar{err: errors.New("registry down")}
+		stub := NewStub(noopLogger(), WithRegistrar("a", ok), WithRegistrar("b", failing))
+
+		err := stub.Start()
+		require.ErrorContains(t, err, "registry down")
+		assert.Empty(t, stub.URL())
+		require.Len(t, ok.events, 2)
+		assert.Contains(t, ok.events[1], "deregister a-")
+	})
+
+	t.Run("consul agent API", func(t *testing.T) {
+		t.Parallel()
+
+		consul := NewStub(noopLogger())
+		consul.AddHandler(http.MethodPut, "/v1/agent/service/register", func(w http.ResponseWriter, r *http.Request) {})
+		consul.AddHandler(http.MethodPut, "/v1/agent/service/deregister/:id", func(w http.ResponseWriter, r *http.Request) {})
+		require.NoError(t, consul.Start())
+		defer consul.Close()
+
+		stub := NewStub(noopLogger(), WithRegistrar("payments", ConsulRegistrar{Addr: consul.URL()}))
+		require.NoError(t, stub.Start())
+		u, err := url.Parse(stub.URL())
+		require.NoError(t, err)
+		stub.Close()
+
+		regs := consul.RequestsFor(http.MethodPut, "/v1/agent/service/register")
+		require.Len(t, regs, 1)
+		var body struct {
+			ID, Name, Address string
+			Port              int
+			Check             struct{ HTTP string }
+		}
+		require.NoError(t, json.Unmarshal(regs[0].Body, &body))
+		assert.Equal(t, "payments-"+u.Port(), body.ID)
+		assert.Equal(t, "payments", body.Name)
+		assert.Equal(t, "127.0.0.1", body.Address)
+		assert.Equal(t, "http://127.0.0.1:"+u.Port()+"/readyz", body.Check.HTTP)
+		consul.AssertCalled(t, http.MethodPut, "/v1/agent/service/deregister/payments-"+u.Port())
+	})
+}
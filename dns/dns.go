@@ -0,0 +1,199 @@
+// Package dns serves a small UDP DNS server that resolves configured
+// hostnames, by default to the address of a stub, so clients with
+// hardcoded hostnames can be pointed at the stub without editing
+// /etc/hosts.
+//
+// Only A and AAAA questions are answered. Other question types on a known
+// name get an empty answer, and unknown names get NXDOMAIN.
+package dns
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/alesr/stubsrv"
+)
+
+const (
+	typeA    = 1
+	typeAAAA = 28
+	classIN  = 1
+
+	rcodeServFail = 2
+	rcodeNXDomain = 3
+
+	ttl = 5
+)
+
+type Server struct {
+	stub *stubsrv.Stub
+
+	mu    sync.Mutex
+	hosts map[string]netip.Addr // zero Addr resolves to the stub
+	conn  net.PacketConn
+}
+
+// New returns a server resolving hosts to the address stub listens on.
+func New(stub *stubsrv.Stub, hosts ...string) *Server {
+	srv := Server{stub: stub, hosts: make(map[string]netip.Addr)}
+	for _, h := range hosts {
+		srv.hosts[canonical(h)] = netip.Addr{}
+	}
+	return &srv
+}
+
+// Set resolves host to ip instead of the stub's address.
+func (srv *Server) Set(host string, ip netip.Addr) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	srv.hosts[canonical(host)] = ip
+}
+
+// Start listens on addr, such as 127.0.0.1:0, and serves until Close.
+func (srv *Server) Start(addr string) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+
+	srv.mu.Lock()
+	srv.conn = conn
+	srv.mu.Unlock()
+
+	go srv.serve(conn)
+	return nil
+}
+
+// Addr returns the address the server listens on, or "" before Start.
+func (srv *Server) Addr() string {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	if srv.conn == nil {
+		return ""
+	}
+	return srv.conn.LocalAddr().String()
+}
+
+func (srv *Server) Close() {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	if srv.conn != nil {
+		_ = srv.conn.Close()
+	}
+}
+
+func (srv *Server) serve(conn net.PacketConn) {
+	buf := make([]byte, 512)
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if resp, err := srv.answer(buf[:n]); err == nil {
+			_, _ = conn.WriteTo(resp, from)
+		}
+	}
+}
+
+// answer builds the response to a single-question query.
+func (srv *Server) answer(query []byte) ([]byte, error) {
+	if len(query) < 12 || binary.BigEndian.Uint16(query[4:]) != 1 {
+		return nil, errors.New("expected exactly one question")
+	}
+	name, end, err := readName(query, 12)
+	if err != nil || end+4 > len(query) {
+		return nil, errors.New("malformed question")
+	}
+	qtype := binary.BigEndian.Uint16(query[end:])
+	question := query[12 : end+4]
+
+	// QR and AA set, opcode and RD copied from the query
+	flags := 0x8400 | binary.BigEndian.Uint16(query[2:])&0x7900
+
+	var rdata []byte
+	ip, known := srv.resolve(name)
+	switch {
+	case !known:
+		flags |= rcodeNXDomain
+	case !ip.IsValid():
+		flags |= rcodeServFail
+	case qtype == typeA && ip.Is4():
+		rdata = ip.AsSlice()
+	case qtype == typeAAAA && ip.Is6():
+		rdata = ip.AsSlice()
+	}
+
+	resp := binary.BigEndian.AppendUint16(nil, binary.BigEndian.Uint16(query))
+	resp = binary.BigEndian.AppendUint16(resp, flags)
+	resp = binary.BigEndian.AppendUint16(resp, 1)
+	resp = binary.BigEndian.AppendUint16(resp, uint16(min(len(rdata), 1)))
+	resp = append(resp, 0, 0, 0, 0)
+	resp = append(resp, question...)
+	if rdata != nil {
+		// name is a pointer to the question at offset 12
+		resp = append(resp, 0xC0, 12)
+		resp = binary.BigEndian.AppendUint16(resp, qtype)
+		resp = binary.BigEndian.AppendUint16(resp, classIN)
+		resp = binary.BigEndian.AppendUint32(resp, ttl)
+		resp = binary.BigEndian.AppendUint16(resp, uint16(len(rdata)))
+		resp = append(resp, rdata...)
+	}
+	return resp, nil
+}
+
+// resolve returns the address for name and whether name is configured. The
+// address is invalid when it belongs to a stub that is not running.
+func (srv *Server) resolve(name string) (netip.Addr, bool) {
+	srv.mu.Lock()
+	ip, ok := srv.hosts[name]
+	srv.mu.Unlock()
+
+	if !ok || ip.IsValid() {
+		return ip, ok
+	}
+
+	u, err := url.Parse(srv.stub.URL())
+	if err != nil {
+		return netip.Addr{}, true
+	}
+	ip, err = netip.ParseAddr(u.Hostname())
+	if err != nil {
+		return netip.Addr{}, true
+	}
+	if ip.IsUnspecified() {
+		// listening on every interface, resolve to loopback
+		return netip.AddrFrom4([4]byte{127, 0, 0, 1}), true
+	}
+	return ip.Unmap(), true
+}
+
+func readName(msg []byte, off int) (string, int, error) {
+	var labels []string
+	for {
+		if off >= len(msg) {
+			return "", 0, errors.New("name overflows message")
+		}
+		n := int(msg[off])
+		off++
+		if n == 0 {
+			return canonical(strings.Join(labels, ".")), off, nil
+		}
+		if n&0xC0 != 0 || off+n > len(msg) {
+			return "", 0, errors.New("unsupported label")
+		}
+		labels = append(labels, string(msg[off:off+n]))
+		off += n
+	}
+}
+
+func canonical(host string) string {
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
@@ -0,0 +1,87 @@
+package dns
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"testing"
+
+	"github.com/alesr/stubsrv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_Resolve(t *testing.T) {
+	t.Parallel()
+
+	stub := stubsrv.NewStub(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	stub.AddHandler(http.MethodGet, "/ping", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("pong"))
+	})
+	require.NoError(t, stub.Start())
+	t.Cleanup(stub.Close)
+
+	srv := New(stub, "api.payments.example.com")
+	srv.Set("db.internal", netip.MustParseAddr("10.1.2.3"))
+	srv.Set("v6.internal", netip.MustParseAddr("fd00::1"))
+	require.NoError(t, srv.Start("127.0.0.1:0"))
+	t.Cleanup(srv.Close)
+
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "udp", srv.Addr())
+		},
+	}
+
+	testCases := []struct {
+		name          string
+		givenHost     string
+		expectedAddrs []string
+		expectedErr   bool
+	}{
+		{name: "stub host", givenHost: "api.payments.example.com", expectedAddrs: []string{"127.0.0.1"}},
+		{name: "case and trailing dot", givenHost: "API.Payments.Example.com.", expectedAddrs: []string{"127.0.0.1"}},
+		{name: "explicit IPv4", givenHost: "db.internal", expectedAddrs: []string{"10.1.2.3"}},
+		{name: "explicit IPv6", givenHost: "v6.internal", expectedAddrs: []string{"fd00::1"}},
+		{name: "unknown host", givenHost: "other.example.com", expectedErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			addrs, err := resolver.LookupHost(context.Background(), tc.givenHost)
+			if tc.expectedErr {
+				var dnsErr *net.DNSError
+				require.ErrorAs(t, err, &dnsErr)
+				assert.True(t, dnsErr.IsNotFound)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedAddrs, addrs)
+		})
+	}
+
+	t.Run("client reaches the stub by name", func(t *testing.T) {
+		t.Parallel()
+
+		u, err := url.Parse(stub.URL())
+		require.NoError(t, err)
+
+		client := &http.Client{Transport: &http.Transport{
+			DialContext: (&net.Dialer{Resolver: resolver}).DialContext,
+		}}
+		resp, err := client.Get("http://api.payments.example.com:" + u.Port() + "/ping")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, "pong", string(body))
+	})
+}
@@ -0,0 +1,134 @@
+package stubsrv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const handlerErrorsLimit = 1000
+
+// HandlerError is a failure on the stub's side while answering a request: an
+// error a handler reported with ReportError, or a recovered panic.
+type HandlerError struct {
+	Method  string    `json:"method"`
+	Path    string    `json:"path"`
+	Message string    `json:"message"`
+	Panic   bool      `json:"panic"`
+	Stack   string    `json:"stack,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+type errorReporterKey struct{}
+
+// ReportError records err in the error journal of the stub serving r, see
+// HandlerErrors. Handlers call it when they answer with an error of their
+// own making, so the failure isn't mistaken for a client bug. It does
+// nothing when r was not served by a stub.
+func ReportError(r *http.Request, err error) {
+	if s, ok := r.Context().Value(errorReporterKey{}).(*Stub); ok && err != nil {
+		s.recordError(r, err.Error(), false, "")
+	}
+}
+
+func (s *Stub) recordError(r *http.Request, message string, panicked bool, stack string) {
+	s.errs.add(HandlerError{
+		Method:  r.Method,
+		Path:    r.URL.Path,
+		Message: message,
+		Panic:   panicked,
+		Stack:   stack,
+		Time:    time.Now(),
+	})
+	s.logger.Warn("Handler error", slog.String("method_path", r.Method+" "+r.URL.Path), slog.String("error", message))
+}
+
+// serveRecovering serves r with h, answering 500 and recording the panic
+// when h panics.
+func (s *Stub) serveRecovering(h http.Handler, w http.ResponseWriter, r *http.Request) {
+	defer func() {
+		v := recover()
+		if v == nil {
+			return
+		}
+		if err, ok := v.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+			panic(v)
+		}
+		s.recordError(r, fmt.Sprint(v), true, string(debug.Stack()))
+		http.Error(w, "stub handler panicked", http.StatusInternalServerError)
+	}()
+
+	h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), errorReporterKey{}, s)))
+}
+
+// HandlerErrors returns the errors handlers reported and the panics they
+// raised, oldest first.
+func (s *Stub) HandlerErrors() []HandlerError {
+	return s.errs.all()
+}
+
+// AssertNoHandlerErrors fails t listing every handler error and panic.
+func (s *Stub) AssertNoHandlerErrors(t testing.TB) bool {
+	t.Helper()
+
+	errs := s.HandlerErrors()
+	if len(errs) == 0 {
+		return true
+	}
+
+	var b strings.Builder
+	for _, e := range errs {
+		kind := "error"
+		if e.Panic {
+			kind = "panic"
+		}
+		fmt.Fprintf(&b, "\n\t%s %s: %s: %s", e.Method, e.Path, kind, e.Message)
+	}
+	t.Errorf("expected no handler errors, but got %d:%s", len(errs), b.String())
+	return false
+}
+
+// controlErrors serves GET /_control/errors.
+func (s *Stub) controlErrors(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.HandlerErrors())
+}
+
+type errorJournal struct {
+	mu      sync.Mutex
+	entries []HandlerError
+}
+
+func (j *errorJournal) add(e HandlerError) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.entries = append(j.entries, e)
+	if len(j.entries) > handlerErrorsLimit {
+		j.entries = j.entries[1:]
+	}
+}
+
+func (j *errorJournal) all() []HandlerError {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return append([]HandlerError(nil), j.entries...)
+}
+
+func (j *errorJournal) reset() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.entries = nil
+}
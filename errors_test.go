@@ -0,0 +1,69 @@
+package stubsrv
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStub_HandlerErrors(t *testing.T) {
+	t.Parallel()
+
+	stub := NewStub(noopLogger())
+	stub.AddHandler(http.MethodGet, "/panics", func(w http.ResponseWriter, r *http.Request) {
+		panic("nil map write")
+	})
+	stub.AddHandler(http.MethodGet, "/generated", GeneratedHandler(func(r *http.Request) (any, error) {
+		return nil, errors.New("out of fixtures")
+	}))
+	stub.AddHandler(http.MethodGet, "/ok", func(w http.ResponseWriter, r *http.Request) {})
+	require.NoError(t, stub.Start())
+	defer stub.Close()
+
+	get := func(path string) int {
+		resp, err := http.Get(stub.URL() + path)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusOK, get("/ok"))
+	assert.True(t, stub.AssertNoHandlerErrors(t))
+
+	assert.Equal(t, http.StatusInternalServerError, get("/panics"))
+	assert.Equal(t, http.StatusInternalServerError, get("/generated"))
+
+	errs := stub.HandlerErrors()
+	require.Len(t, errs, 2)
+	assert.Equal(t, "/panics", errs[0].Path)
+	assert.True(t, errs[0].Panic)
+	assert.Equal(t, "nil map write", errs[0].Message)
+	assert.Contains(t, errs[0].Stack, "errors_test.go")
+	assert.Equal(t, "/generated", errs[1].Path)
+	assert.False(t, errs[1].Panic)
+	assert.Equal(t, "out of fixtures", errs[1].Message)
+
+	ft := &fakeT{}
+	assert.False(t, stub.AssertNoHandlerErrors(ft))
+	require.Len(t, ft.errors, 1)
+	assert.Contains(t, ft.errors[0], "GET /panics: panic: nil map write")
+
+	var listed []HandlerError
+	controlDo(t, stub, http.MethodGet, "/_control/errors", "", http.StatusOK, &listed)
+	assert.Len(t, listed, 2)
+	controlDo(t, stub, http.MethodDelete, "/_control/errors", "", http.StatusMethodNotAllowed, nil)
+
+	stub.Reset()
+	assert.Empty(t, stub.HandlerErrors())
+}
+
+func TestReportError_OutsideStub(t *testing.T) {
+	t.Parallel()
+
+	r, err := http.NewRequest(http.MethodGet, "/", nil)
+	require.NoError(t, err)
+	assert.NotPanics(t, func() { ReportError(r, errors.New("boom")) })
+}
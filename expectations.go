@@ -0,0 +1,188 @@
+package stubsrv
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type expectedCall struct {
+	method   string
+	path     string
+	segments []string
+}
+
+func newExpectedCall(method, path string) expectedCall {
+	return expectedCall{
+		method:   strings.ToUpper(method),
+		path:     path,
+		segments: strings.Split(strings.Trim(path, "/"), "/"),
+	}
+}
+
+func (c expectedCall) match(rec RecordedRequest) bool {
+	return rec.Method == c.method && pathMatch(c.segments, rec.Path)
+}
+
+func (c expectedCall) String() string {
+	return c.method + " " + c.path
+}
+
+// Sequence is a chain of calls expected to arrive in order, built with
+// Expect and Then and checked by VerifyOrder.
+type Sequence struct {
+	mu    sync.Mutex
+	calls []expectedCall
+}
+
+// Expect starts a sequence of ordered calls. path may be a template such as
+// /users/:id.
+func (s *Stub) Expect(method, path string) *Sequence {
+	seq := &Sequence{calls: []expectedCall{newExpectedCall(method, path)}}
+
+	s.mu.Lock()
+	s.sequences = append(s.sequences, seq)
+	s.mu.Unlock()
+	return seq
+}
+
+// Then expects method and path to be called after the previous call.
+func (seq *Sequence) Then(method, path string) *Sequence {
+	seq.mu.Lock()
+	defer seq.mu.Unlock()
+
+	seq.calls = append(seq.calls, newExpectedCall(method, path))
+	return seq
+}
+
+// VerifyOrder fails t if a call of any sequence registered with Expect is
+// missing or arrived before the call it should follow.
+func (s *Stub) VerifyOrder(t testing.TB) bool {
+	t.Helper()
+
+	s.mu.Lock()
+	sequences := append([]*Sequence(nil), s.sequences...)
+	s.mu.Unlock()
+
+	recs := s.journal.all()
+	ok := true
+	for _, seq := range sequences {
+		if msg := seq.check(recs); msg != "" {
+			t.Errorf("%s%s", msg, s.receivedSummary())
+			ok = false
+		}
+	}
+	return ok
+}
+
+// check walks recs and returns a description of the first ordering
+// violation, or "" when the sequence was followed.
+func (seq *Sequence) check(recs []RecordedRequest) string {
+	seq.mu.Lock()
+	calls := seq.calls
+	seq.mu.Unlock()
+
+	next := 0
+	for _, rec := range recs {
+		if next == len(calls) {
+			break
+		}
+		if calls[next].match(rec) {
+			next++
+			continue
+		}
+		for _, later := range calls[next+1:] {
+			if later.match(rec) {
+				return "expected " + calls[next].String() + " before " + later.String() + ", but " + later.String() + " was called first"
+			}
+		}
+	}
+	if next < len(calls) {
+		return "expected " + calls[next].String() + " to be called in order, but it was not"
+	}
+	return ""
+}
+
+// Expectation is a call-count expectation created with On and checked by
+// VerifyExpectations. Without Times, at least one call is expected.
+type Expectation struct {
+	call  expectedCall
+	mu    sync.Mutex
+	times int
+}
+
+// On expects method and path to be called. path may be a template such as
+// /users/:id.
+func (s *Stub) On(method, path string) *Expectation {
+	exp := &Expectation{call: newExpectedCall(method, path), times: -1}
+
+	s.mu.Lock()
+	s.expectations = append(s.expectations, exp)
+	s.mu.Unlock()
+	return exp
+}
+
+// Times expects exactly n calls.
+func (exp *Expectation) Times(n int) *Expectation {
+	exp.mu.Lock()
+	defer exp.mu.Unlock()
+
+	exp.times = n
+	return exp
+}
+
+// expected returns the expected call count, or -1 for at least one.
+func (exp *Expectation) expected() int {
+	exp.mu.Lock()
+	defer exp.mu.Unlock()
+
+	return exp.times
+}
+
+// VerifyExpectations fails t listing every expectation registered with On
+// whose call count is off, with the expected and actual counts side by side.
+func (s *Stub) VerifyExpectations(t testing.TB) bool {
+	t.Helper()
+
+	s.mu.Lock()
+	expectations := append([]*Expectation(nil), s.expectations...)
+	s.mu.Unlock()
+
+	recs := s.journal.all()
+
+	var (
+		lines []string
+		width int
+	)
+	for _, exp := range expectations {
+		width = max(width, len(exp.call.String()))
+	}
+	for _, exp := range expectations {
+		var got int
+		for _, rec := range recs {
+			if exp.call.match(rec) {
+				got++
+			}
+		}
+		times := exp.expected()
+		if times < 0 && got > 0 || got == times {
+			continue
+		}
+
+		want := "at least 1"
+		diff := "missing"
+		if times >= 0 {
+			want = strconv.Itoa(times)
+			diff = fmt.Sprintf("%+d", got-times)
+		}
+		lines = append(lines, fmt.Sprintf("\n\t%-*s  expected %s, got %d (%s)", width, exp.call, want, got, diff))
+	}
+
+	if len(lines) == 0 {
+		return true
+	}
+	t.Errorf("call count expectations not met:%s", strings.Join(lines, ""))
+	return false
+}
@@ -0,0 +1,156 @@
+package stubsrv
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStub_VerifyOrder(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name          string
+		givenCalls    []string
+		expectedError string
+	}{
+		{
+			name:       "in order",
+			givenCalls: []string{"POST /login", "GET /profile", "GET /orders/1"},
+		},
+		{
+			name:       "unrelated calls in between",
+			givenCalls: []string{"GET /health", "POST /login", "GET /health", "GET /profile", "GET /orders/2"},
+		},
+		{
+			name:          "out of order",
+			givenCalls:    []string{"GET /profile", "POST /login", "GET /orders/1"},
+			expectedError: "expected POST /login before GET /profile, but GET /profile was called first",
+		},
+		{
+			name:          "missing step",
+			givenCalls:    []string{"POST /login", "GET /orders/1"},
+			expectedError: "expected GET /profile before GET /orders/:id, but GET /orders/:id was called first",
+		},
+		{
+			name:          "never called",
+			givenCalls:    []string{"POST /login"},
+			expectedError: "expected GET /profile to be called in order, but it was not",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			stub := NewStub(noopLogger())
+			stub.Expect(http.MethodPost, "/login").Then(http.MethodGet, "/profile").Then(http.MethodGet, "/orders/:id")
+			require.NoError(t, stub.Start())
+			defer stub.Close()
+
+			for _, call := range tc.givenCalls {
+				method, path, _ := strings.Cut(call, " ")
+				req, err := http.NewRequest(method, stub.URL()+path, nil)
+				require.NoError(t, err)
+				resp, err := http.DefaultClient.Do(req)
+				require.NoError(t, err)
+				resp.Body.Close()
+			}
+
+			ft := &fakeT{}
+			ok := stub.VerifyOrder(ft)
+			if tc.expectedError == "" {
+				assert.True(t, ok)
+				assert.Empty(t, ft.errors)
+				return
+			}
+			assert.False(t, ok)
+			require.Len(t, ft.errors, 1)
+			assert.Contains(t, ft.errors[0], tc.expectedError)
+		})
+	}
+}
+
+func TestStub_VerifyExpectations(t *testing.T) {
+	t.Parallel()
+
+	stub := NewStub(noopLogger())
+	stub.On(http.MethodGet, "/quota").Times(3)
+	stub.On(http.MethodGet, "/users/:id").Times(1)
+	stub.On(http.MethodPost, "/reports")
+	stub.On(http.MethodGet, "/health")
+	stub.On(http.MethodDelete, "/cache").Times(0)
+	require.NoError(t, stub.Start())
+	defer stub.Close()
+
+	for _, path := range []string{"/quota", "/quota", "/quota", "/quota", "/quota", "/health"} {
+		resp, err := http.Get(stub.URL() + path)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	ft := &fakeT{}
+	assert.False(t, stub.VerifyExpectations(ft))
+	require.Len(t, ft.errors, 1)
+	assert.Equal(t, "call count expectations not met:"+
+		"\n\tGET /quota      expected 3, got 5 (+2)"+
+		"\n\tGET /users/:id  expected 1, got 0 (-1)"+
+		"\n\tPOST /reports   expected at least 1, got 0 (missing)", ft.errors[0])
+
+	stub.Reset()
+	assert.True(t, stub.VerifyExpectations(&fakeT{}))
+}
+
+func TestStub_SequenceConcurrent(t *testing.T) {
+	t.Parallel()
+
+	stub := NewStub(noopLogger())
+	seq := stub.Expect(http.MethodGet, "/a")
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			seq.Then(http.MethodGet, "/b")
+		}()
+		go func() {
+			defer wg.Done()
+			stub.VerifyOrder(&fakeT{})
+		}()
+	}
+	wg.Wait()
+
+	ft := &fakeT{}
+	assert.False(t, stub.VerifyOrder(ft))
+	assert.Len(t, ft.errors, 1)
+}
+
+func TestStub_ExpectationsConcurrent(t *testing.T) {
+	t.Parallel()
+
+	stub := NewStub(noopLogger())
+	exp := stub.On(http.MethodGet, "/a")
+
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			exp.Times(i + 1)
+		}()
+		go func() {
+			defer wg.Done()
+			stub.VerifyExpectations(&fakeT{})
+		}()
+	}
+	wg.Wait()
+
+	ft := &fakeT{}
+	assert.False(t, stub.VerifyExpectations(ft))
+	assert.Len(t, ft.errors, 1)
+}
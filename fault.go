@@ -0,0 +1,79 @@
+package stubsrv
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+)
+
+// Fault is an abnormal transport failure served instead of a response.
+type Fault string
+
+const (
+	// FaultConnectionReset aborts the connection with a TCP RST.
+	FaultConnectionReset Fault = "connection_reset"
+	// FaultEmptyResponse closes the connection without writing anything.
+	FaultEmptyResponse Fault = "empty_response"
+	// FaultMalformedChunk starts a chunked response and sends a corrupt chunk.
+	FaultMalformedChunk Fault = "malformed_chunk"
+)
+
+func (f Fault) valid() bool {
+	switch f {
+	case FaultConnectionReset, FaultEmptyResponse, FaultMalformedChunk:
+		return true
+	}
+	return false
+}
+
+// AddFault registers a route that answers with fault instead of a response.
+// Middlewares still run first, so a fault can be combined with WithDelay.
+func (s *Stub) AddFault(method, path string, fault Fault, middlewares ...Middleware) {
+	if !fault.valid() {
+		panic("unknown fault: " + string(fault))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		panic("cannot add handlers on a closed stub server")
+	}
+
+	s.addRoute(method, path, nil, routeInfo{
+		middlewares: middlewares,
+		fault:       fault,
+	})
+}
+
+func faultHandler(fault Fault) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		conn, buf, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			ReportError(r, err)
+			http.Error(w, "fault injection requires a hijackable HTTP/1.x connection", http.StatusInternalServerError)
+			return
+		}
+		defer conn.Close()
+
+		switch fault {
+		case FaultConnectionReset:
+			if tcp, ok := underlyingConn(conn).(*net.TCPConn); ok {
+				// discard unsent data and send RST on close
+				_ = tcp.SetLinger(0)
+			}
+		case FaultEmptyResponse:
+		case FaultMalformedChunk:
+			_, _ = buf.WriteString("HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\nContent-Type: text/plain\r\n\r\n")
+			_, _ = buf.WriteString("5\r\nhello\r\nzz\r\nnot a chunk\r\n")
+			_ = buf.Flush()
+		}
+	}
+}
+
+func underlyingConn(c net.Conn) net.Conn {
+	if tlsConn, ok := c.(*tls.Conn); ok {
+		return tlsConn.NetConn()
+	}
+	return c
+}
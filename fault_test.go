@@ -0,0 +1,79 @@
+package stubsrv
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStub_AddFault(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name          string
+		givenFault    Fault
+		expectedError string
+	}{
+		{name: "connection reset", givenFault: FaultConnectionReset, expectedError: "connection reset"},
+		{name: "empty response", givenFault: FaultEmptyResponse, expectedError: "EOF"},
+		{name: "malformed chunk", givenFault: FaultMalformedChunk, expectedError: "invalid byte in chunk length"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			stub := NewStub(noopLogger())
+			stub.AddFault(http.MethodGet, "/broken", tc.givenFault)
+			require.NoError(t, stub.Start())
+			defer stub.Close()
+
+			client := http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+			resp, err := client.Get(stub.URL() + "/broken")
+			if err == nil {
+				_, err = io.ReadAll(resp.Body)
+				resp.Body.Close()
+			}
+
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.expectedError)
+		})
+	}
+
+	t.Run("unknown fault panics", func(t *testing.T) {
+		t.Parallel()
+
+		stub := NewStub(noopLogger())
+		assert.Panics(t, func() {
+			stub.AddFault(http.MethodGet, "/x", Fault("meteor_strike"))
+		})
+	})
+}
+
+func TestStub_ControlAddHandlerFault(t *testing.T) {
+	t.Parallel()
+
+	stub := NewStub(noopLogger())
+	require.NoError(t, stub.Start())
+	defer stub.Close()
+
+	resp, err := http.Post(stub.URL()+"/_control/handlers", "application/json",
+		strings.NewReader(`{"method":"GET","path":"/users/:id","fault":"connection_reset"}`))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	client := http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	_, err = client.Get(stub.URL() + "/users/1")
+	require.Error(t, err)
+	assert.ErrorIs(t, err, syscall.ECONNRESET)
+
+	resp, err = http.Post(stub.URL()+"/_control/handlers", "application/json",
+		strings.NewReader(`{"method":"GET","path":"/x","fault":"nope"}`))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
@@ -0,0 +1,102 @@
+package stubsrv
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// AddFile registers a route answering with the contents of filePath, read
+// once now, with a Content-Type inferred from its extension. It panics if
+// the file cannot be read.
+func (s *Stub) AddFile(method, path, filePath string, middlewares ...Middleware) {
+	body, headers, err := fileResponse(filePath, nil)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	s.AddHandler(method, path, func(w http.ResponseWriter, r *http.Request) {
+		SpecResponse{Status: http.StatusOK, Body: body, Headers: headers}.write(w, r)
+	}, middlewares...)
+}
+
+// WithBodyFileFS lets specs posted to the control plane use body_file, read
+// from fsys. Without it such specs are rejected, since anyone reaching the
+// control plane could otherwise read any file the process can. Specs added
+// from Go or loaded from config files read body files from disk as usual.
+func WithBodyFileFS(fsys fs.FS) Option {
+	return func(cfg *stubConfig) {
+		cfg.bodyFiles = fsys
+	}
+}
+
+// inlineBodyFile replaces the body_file of a spec posted to the control
+// plane with the file's contents, read from s.bodyFiles.
+func (s *Stub) inlineBodyFile(spec *DynamicHandlerSpec) error {
+	if spec.BodyFile == "" || spec.Body != "" || len(spec.Chunks) > 0 {
+		// compileSpec rejects a body_file next to a body before reading it
+		return nil
+	}
+	if s.bodyFiles == nil {
+		return errors.New("body_file is not accepted over the control plane without WithBodyFileFS")
+	}
+	body, err := fs.ReadFile(s.bodyFiles, spec.BodyFile)
+	if err != nil {
+		return fmt.Errorf("could not read body file: %w", err)
+	}
+	spec.Body, spec.Headers, spec.BodyFile = string(body), withContentType(spec.BodyFile, spec.Headers), ""
+	return nil
+}
+
+// ServeFS serves the files of fsys under prefix, so /static/a.json is
+// answered with a.json when prefix is /static. Files are read on every
+// request, which makes it suitable for an embed.FS of fixtures.
+func (s *Stub) ServeFS(prefix string, fsys fs.FS, middlewares ...Middleware) {
+	prefix = "/" + strings.Trim(prefix, "/")
+	path := strings.TrimSuffix(prefix, "/") + "/..."
+
+	h := http.StripPrefix(strings.TrimSuffix(prefix, "/"), http.FileServerFS(fsys)).ServeHTTP
+	s.AddHandler(http.MethodGet, path, h, middlewares...)
+	s.AddHandler(http.MethodHead, path, h, middlewares...)
+	s.addSource(Source{Kind: "fs", Name: prefix, Routes: 2})
+}
+
+// fileResponse reads filePath and returns it with headers extended by a
+// Content-Type inferred from the extension, unless headers already set one.
+func fileResponse(filePath string, headers map[string]string) (string, map[string]string, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", nil, fmt.Errorf("could not read body file: %w", err)
+	}
+	return string(data), withContentType(filePath, headers), nil
+}
+
+// withContentType returns a copy of headers with a Content-Type inferred
+// from name's extension, unless headers already set one.
+func withContentType(name string, headers map[string]string) map[string]string {
+	out := maps.Clone(headers)
+	if out == nil {
+		out = make(map[string]string)
+	}
+	if !hasHeader(out, "Content-Type") {
+		if ct := mime.TypeByExtension(filepath.Ext(name)); ct != "" {
+			out["Content-Type"] = ct
+		}
+	}
+	return out
+}
+
+func hasHeader(headers map[string]string, key string) bool {
+	for k := range headers {
+		if http.CanonicalHeaderKey(k) == http.CanonicalHeaderKey(key) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+package stubsrv
+
+import (
+	"net/http"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStub_AddFile(t *testing.T) {
+	t.Parallel()
+
+	stub := NewStub(noopLogger(), WithBodyFileFS(os.DirFS("testdata")))
+	stub.AddFile(http.MethodGet, "/users/1", "testdata/user.json")
+	require.NoError(t, stub.Start())
+	defer stub.Close()
+
+	controlAdd(t, stub, `{"method":"GET","path":"/export","body_file":"users.xml"}`)
+	controlAdd(t, stub, `{"method":"GET","path":"/raw","body_file":"user.json","headers":{"content-type":"text/plain"}}`)
+	controlDo(t, stub, http.MethodPost, "/_control/handlers", `{"method":"GET","path":"/x","body_file":"missing.json"}`, http.StatusBadRequest, nil)
+	controlDo(t, stub, http.MethodPost, "/_control/handlers", `{"method":"GET","path":"/x","body":"a","body_file":"user.json"}`, http.StatusBadRequest, nil)
+	controlDo(t, stub, http.MethodPost, "/_control/handlers", `{"method":"GET","path":"/x","body_file":"../go.mod"}`, http.StatusBadRequest, nil)
+
+	testCases := []struct {
+		name                string
+		givenPath           string
+		expectedBody        string
+		expectedContentType string
+	}{
+		{name: "Go API", givenPath: "/users/1", expectedBody: "{\"id\": 1, \"name\": \"alice\"}\n", expectedContentType: "application/json"},
+		{name: "spec", givenPath: "/export", expectedBody: "<users><user id=\"1\">alice</user></users>\n", expectedContentType: "text/xml; charset=utf-8"},
+		{name: "explicit Content-Type wins", givenPath: "/raw", expectedBody: "{\"id\": 1, \"name\": \"alice\"}\n", expectedContentType: "text/plain"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := http.Get(stub.URL() + tc.givenPath)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, tc.expectedContentType, resp.Header.Get("Content-Type"))
+			assert.Equal(t, tc.expectedBody, readAll(t, resp))
+		})
+	}
+
+	assert.Panics(t, func() { stub.AddFile(http.MethodGet, "/missing", "testdata/missing.json") })
+}
+
+func TestStub_ServeFS(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"users/1.json": {Data: []byte(`{"id":1}`)},
+		"export.xml":   {Data: []byte(`<users/>`)},
+	}
+
+	stub := NewStub(noopLogger())
+	stub.ServeFS("/fixtures/", fsys)
+	require.NoError(t, stub.Start())
+	defer stub.Close()
+
+	testCases := []struct {
+		name                string
+		givenPath           string
+		expectedStatus      int
+		expectedBody        string
+		expectedContentType string
+	}{
+		{name: "nested file", givenPath: "/fixtures/users/1.json", expectedStatus: http.StatusOK, expectedBody: `{"id":1}`, expectedContentType: "application/json"},
+		{name: "top-level file", givenPath: "/fixtures/export.xml", expectedStatus: http.StatusOK, expectedBody: `<users/>`, expectedContentType: "text/xml; charset=utf-8"},
+		{name: "missing file", givenPath: "/fixtures/users/2.json", expectedStatus: http.StatusNotFound},
+		{name: "outside prefix", givenPath: "/users/1.json", expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := http.Get(stub.URL() + tc.givenPath)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, tc.expectedStatus, resp.StatusCode)
+			if tc.expectedStatus == http.StatusOK {
+				assert.Equal(t, tc.expectedContentType, resp.Header.Get("Content-Type"))
+				assert.Equal(t, tc.expectedBody, readAll(t, resp))
+			}
+		})
+	}
+}
+
+func TestStub_ControlBodyFile(t *testing.T) {
+	t.Parallel()
+
+	stub := NewStub(noopLogger())
+	require.NoError(t, stub.Start())
+	defer stub.Close()
+
+	// without WithBodyFileFS the control plane can't read files
+	spec := `{"method":"GET","path":"/x","body_file":"testdata/user.json"}`
+	controlDo(t, stub, http.MethodPost, "/_control/handlers", spec, http.StatusBadRequest, nil)
+	controlDo(t, stub, http.MethodPost, "/_control/handlers/bulk", "["+spec+"]", http.StatusBadRequest, nil)
+	controlDo(t, stub, http.MethodPost, "/_control/config/apply", `{"routes":[`+spec+`]}`, http.StatusBadRequest, nil)
+
+	_, err := stub.AddSpec(DynamicHandlerSpec{Method: http.MethodGet, Path: "/x", BodyFile: "testdata/user.json"})
+	assert.NoError(t, err, "specs added from Go read from disk")
+}
@@ -0,0 +1,99 @@
+package stubsrv
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// FixtureResponse is the response TestFixture expects. Status is checked
+// when set and only the listed headers are compared. JSON bodies are
+// compared semantically.
+type FixtureResponse struct {
+	Status  int
+	Headers map[string]string
+	Body    string
+}
+
+// TestFixture loads the route spec stored in fixturePath, as JSON or YAML,
+// serves req with it and fails t if the response differs from want.
+func TestFixture(t testing.TB, fixturePath string, req *http.Request, want FixtureResponse) bool {
+	t.Helper()
+
+	data, err := os.ReadFile(fixturePath)
+	if err != nil {
+		t.Errorf("could not read fixture: %s", err)
+		return false
+	}
+	spec, err := decodeFixture(data)
+	if err != nil {
+		t.Errorf("fixture %s: %s", fixturePath, err)
+		return false
+	}
+
+	stub := NewStub(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if _, err := stub.AddSpec(spec); err != nil {
+		t.Errorf("fixture %s: %s", fixturePath, err)
+		return false
+	}
+
+	rec := httptest.NewRecorder()
+	stub.mux.ServeHTTP(rec, req)
+
+	ok := true
+	if want.Status != 0 && rec.Code != want.Status {
+		t.Errorf("fixture %s: expected status %d, got %d", fixturePath, want.Status, rec.Code)
+		ok = false
+	}
+	for k, v := range want.Headers {
+		if got := rec.Header().Get(k); got != v {
+			t.Errorf("fixture %s: expected header %s %q, got %q", fixturePath, k, v, got)
+			ok = false
+		}
+	}
+	if got := rec.Body.String(); !bodiesEqual(got, want.Body) {
+		t.Errorf("fixture %s: expected body %q, got %q", fixturePath, want.Body, got)
+		ok = false
+	}
+	return ok
+}
+
+// decodeFixture decodes a spec written in JSON or YAML.
+func decodeFixture(data []byte) (DynamicHandlerSpec, error) {
+	var spec DynamicHandlerSpec
+
+	tree, err := decodeYAML(data)
+	if err != nil {
+		return spec, fmt.Errorf("invalid fixture: %w", err)
+	}
+	normalized, err := json.Marshal(tree)
+	if err != nil {
+		return spec, fmt.Errorf("invalid fixture: %w", err)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(normalized))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&spec); err != nil {
+		return spec, fmt.Errorf("invalid fixture: %w", err)
+	}
+	return spec, nil
+}
+
+func bodiesEqual(got, want string) bool {
+	if got == want {
+		return true
+	}
+
+	var gotJSON, wantJSON any
+	if json.Unmarshal([]byte(got), &gotJSON) != nil || json.Unmarshal([]byte(want), &wantJSON) != nil {
+		return false
+	}
+	return reflect.DeepEqual(gotJSON, wantJSON)
+}
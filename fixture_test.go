@@ -0,0 +1,79 @@
+package stubsrv
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTestFixture(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name           string
+		givenFixture   string
+		givenPath      string
+		givenWant      FixtureResponse
+		expectedOK     bool
+		expectedErrors []string
+	}{
+		{
+			name:         "matching response",
+			givenFixture: userFixture,
+			givenPath:    "/users/1",
+			givenWant: FixtureResponse{
+				Status:  http.StatusOK,
+				Headers: map[string]string{"Content-Type": "application/json"},
+				Body:    `{"name":"alice","id":1}`,
+			},
+			expectedOK: true,
+		},
+		{
+			name:         "branch response",
+			givenFixture: userFixture,
+			givenPath:    "/users/404",
+			givenWant:    FixtureResponse{Status: http.StatusNotFound, Body: `{"error":"not_found"}`},
+			expectedOK:   true,
+		},
+		{
+			name:         "mismatching response",
+			givenFixture: userFixture,
+			givenPath:    "/users/1",
+			givenWant:    FixtureResponse{Status: http.StatusCreated, Body: `{"id":2}`},
+			expectedErrors: []string{
+				"fixture " + userFixture + ": expected status 201, got 200",
+				"fixture " + userFixture + `: expected body "{\"id\":2}", got "{\"id\": 1, \"name\": \"alice\"}"`,
+			},
+		},
+		{
+			name:           "unknown field",
+			givenFixture:   "testdata/fixture_typo.json",
+			givenPath:      "/x",
+			expectedErrors: []string{`fixture testdata/fixture_typo.json: invalid fixture: json: unknown field "staus"`},
+		},
+		{
+			name:           "missing file",
+			givenFixture:   "testdata/missing.json",
+			givenPath:      "/x",
+			expectedErrors: []string{"could not read fixture: open testdata/missing.json: no such file or directory"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ft := &fakeT{}
+			ok := TestFixture(ft, tc.givenFixture, httptest.NewRequest(http.MethodGet, tc.givenPath, nil), tc.givenWant)
+
+			assert.Equal(t, tc.expectedOK, ok)
+			require.Len(t, ft.errors, len(tc.expectedErrors))
+			for i, want := range tc.expectedErrors {
+				assert.Equal(t, want, ft.errors[i])
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+// Package flags emulates a feature-flag provider: OpenFeature remote
+// evaluation (OFREP) endpoints, an SSE stream of flag updates, and
+// control-plane toggles so flagged code paths can be tested deterministically.
+//
+// Routes:
+//
+//	POST /ofrep/v1/evaluate/flags/:key   evaluate one flag
+//	POST /ofrep/v1/evaluate/flags        evaluate every flag
+//	GET  /flags/stream                   SSE: "put" with all flags, then "patch" per change
+//	PUT  /_control/flags/:key            set a flag from a JSON Flag body
+//	DELETE /_control/flags/:key
+package flags
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/alesr/stubsrv"
+)
+
+type Flag struct {
+	Value   any    `json:"value"`
+	Variant string `json:"variant,omitempty"`
+	// Targets overrides Value for specific targeting keys.
+	Targets map[string]any `json:"targets,omitempty"`
+}
+
+type evaluation struct {
+	Key       string `json:"key"`
+	Value     any    `json:"value,omitempty"`
+	Variant   string `json:"variant,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+	ErrorCode string `json:"errorCode,omitempty"`
+}
+
+type evaluationRequest struct {
+	Context struct {
+		TargetingKey string `json:"targetingKey"`
+	} `json:"context"`
+}
+
+type Provider struct {
+	mu          sync.Mutex
+	flags       map[string]Flag
+	subscribers map[chan []byte]struct{}
+}
+
+func New(stub *stubsrv.Stub, initial map[string]Flag) *Provider {
+	p := Provider{
+		flags:       make(map[string]Flag),
+		subscribers: make(map[chan []byte]struct{}),
+	}
+	for k, f := range initial {
+		p.flags[k] = f
+	}
+
+	stub.AddHandler(http.MethodPost, "/ofrep/v1/evaluate/flags/:key", p.handleEvaluate)
+	stub.AddHandler(http.MethodPost, "/ofrep/v1/evaluate/flags", p.handleEvaluateAll)
+	stub.AddHandler(http.MethodGet, "/flags/stream", p.handleStream)
+	stub.AddHandler(http.MethodPut, "/_control/flags/:key", p.handleSet)
+	stub.AddHandler(http.MethodDelete, "/_control/flags/:key", p.handleDelete)
+	return &p
+}
+
+// Set creates or replaces a flag and notifies stream subscribers.
+func (p *Provider) Set(key string, f Flag) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.flags[key] = f
+	p.broadcast("patch", map[string]any{"key": key, "flag": f})
+}
+
+func (p *Provider) Delete(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.flags, key)
+	p.broadcast("delete", map[string]any{"key": key})
+}
+
+func (p *Provider) evaluate(key, targetingKey string) evaluation {
+	f, ok := p.flags[key]
+	if !ok {
+		return evaluation{Key: key, ErrorCode: "FLAG_NOT_FOUND"}
+	}
+	if v, ok := f.Targets[targetingKey]; ok && targetingKey != "" {
+		return evaluation{Key: key, Value: v, Reason: "TARGETING_MATCH"}
+	}
+	return evaluation{Key: key, Value: f.Value, Variant: f.Variant, Reason: "STATIC"}
+}
+
+func (p *Provider) handleEvaluate(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeRequest(w, r)
+	if !ok {
+		return
+	}
+
+	p.mu.Lock()
+	ev := p.evaluate(lastSegment(r.URL.Path), req.Context.TargetingKey)
+	p.mu.Unlock()
+
+	if ev.ErrorCode != "" {
+		writeJSON(w, http.StatusNotFound, ev)
+		return
+	}
+	writeJSON(w, http.StatusOK, ev)
+}
+
+func (p *Provider) handleEvaluateAll(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeRequest(w, r)
+	if !ok {
+		return
+	}
+
+	p.mu.Lock()
+	keys := make([]string, 0, len(p.flags))
+	for k := range p.flags {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	evals := make([]evaluation, 0, len(keys))
+	for _, k := range keys {
+		evals = append(evals, p.evaluate(k, req.Context.TargetingKey))
+	}
+	p.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]any{"flags": evals})
+}
+
+func (p *Provider) handleStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	ch := make(chan []byte, 16)
+
+	p.mu.Lock()
+	initial := sseEvent("put", p.flags)
+	p.subscribers[ch] = struct{}{}
+	p.mu.Unlock()
+
+	defer func() {
+		p.mu.Lock()
+		delete(p.subscribers, ch)
+		p.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(initial)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case msg := <-ch:
+			if _, err := w.Write(msg); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func (p *Provider) handleSet(w http.ResponseWriter, r *http.Request) {
+	var f Flag
+	if err := json.NewDecoder(r.Body).Decode(&f); err != nil {
+		http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	p.Set(lastSegment(r.URL.Path), f)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (p *Provider) handleDelete(w http.ResponseWriter, r *http.Request) {
+	key := lastSegment(r.URL.Path)
+
+	p.mu.Lock()
+	_, ok := p.flags[key]
+	p.mu.Unlock()
+
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	p.Delete(key)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// broadcast must be called with p.mu held.
+func (p *Provider) broadcast(event string, data any) {
+	msg := sseEvent(event, data)
+	for ch := range p.subscribers {
+		select {
+		case ch <- msg:
+		default:
+		}
+	}
+}
+
+func sseEvent(event string, data any) []byte {
+	payload, _ := json.Marshal(data)
+	return []byte(fmt.Sprintf("event: %s\ndata: %s\n\n", event, payload))
+}
+
+func decodeRequest(w http.ResponseWriter, r *http.Request) (evaluationRequest, bool) {
+	var req evaluationRequest
+	if r.ContentLength == 0 {
+		return req, true
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"errorCode": "PARSE_ERROR", "errorDetails": err.Error()})
+		return req, false
+	}
+	return req, true
+}
+
+func lastSegment(p string) string {
+	return p[strings.LastIndex(p, "/")+1:]
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,124 @@
+package flags
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/alesr/stubsrv"
+	"github.com/alesr/stubsrv/internal/stubtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProvider_Evaluate(t *testing.T) {
+	t.Parallel()
+
+	stub, _ := newProvider(t, map[string]Flag{
+		"new-checkout": {Value: true, Variant: "on", Targets: map[string]any{"user-42": false}},
+		"theme":        {Value: "dark"},
+	})
+
+	testCases := []struct {
+		name           string
+		givenPath      string
+		givenBody      string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "static value",
+			givenPath:      "/ofrep/v1/evaluate/flags/theme",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"key":"theme","value":"dark","reason":"STATIC"}`,
+		},
+		{
+			name:           "targeting override",
+			givenPath:      "/ofrep/v1/evaluate/flags/new-checkout",
+			givenBody:      `{"context":{"targetingKey":"user-42"}}`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"key":"new-checkout","value":false,"reason":"TARGETING_MATCH"}`,
+		},
+		{
+			name:           "unknown flag",
+			givenPath:      "/ofrep/v1/evaluate/flags/missing",
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   `{"key":"missing","errorCode":"FLAG_NOT_FOUND"}`,
+		},
+		{
+			name:           "bulk evaluation",
+			givenPath:      "/ofrep/v1/evaluate/flags",
+			givenBody:      `{"context":{"targetingKey":"user-1"}}`,
+			expectedStatus: http.StatusOK,
+			expectedBody: `{"flags":[
+				{"key":"new-checkout","value":true,"variant":"on","reason":"STATIC"},
+				{"key":"theme","value":"dark","reason":"STATIC"}
+			]}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			resp, body := stubtest.Do(t, http.MethodPost, stub.URL()+tc.givenPath, tc.givenBody)
+			assert.Equal(t, tc.expectedStatus, resp.StatusCode)
+			assert.JSONEq(t, tc.expectedBody, body)
+		})
+	}
+}
+
+func TestProvider_StreamAndToggle(t *testing.T) {
+	t.Parallel()
+
+	stub, p := newProvider(t, map[string]Flag{"beta": {Value: false}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, stub.URL()+"/flags/stream", nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	reader := bufio.NewReader(resp.Body)
+	assert.Equal(t, "event: put", readLine(t, reader))
+	assert.Equal(t, `data: {"beta":{"value":false}}`, readLine(t, reader))
+	readLine(t, reader)
+
+	toggle, _ := stubtest.Do(t, http.MethodPut, stub.URL()+"/_control/flags/beta", `{"value":true}`)
+	require.Equal(t, http.StatusNoContent, toggle.StatusCode)
+
+	assert.Equal(t, "event: patch", readLine(t, reader))
+	assert.Equal(t, `data: {"flag":{"value":true},"key":"beta"}`, readLine(t, reader))
+	readLine(t, reader)
+
+	p.Delete("beta")
+	assert.Equal(t, "event: delete", readLine(t, reader))
+
+	_, body := stubtest.Do(t, http.MethodPost, stub.URL()+"/ofrep/v1/evaluate/flags/beta", "")
+	assert.Contains(t, body, "FLAG_NOT_FOUND")
+
+	gone, _ := stubtest.Do(t, http.MethodDelete, stub.URL()+"/_control/flags/beta", "")
+	assert.Equal(t, http.StatusNotFound, gone.StatusCode)
+}
+
+func newProvider(t *testing.T, initial map[string]Flag) (*stubsrv.Stub, *Provider) {
+	t.Helper()
+
+	var p *Provider
+	stub := stubtest.New(t, func(stub *stubsrv.Stub) { p = New(stub, initial) })
+	return stub, p
+}
+
+func readLine(t *testing.T, r *bufio.Reader) string {
+	t.Helper()
+
+	line, err := r.ReadString('\n')
+	require.NoError(t, err)
+	return strings.TrimSuffix(line, "\n")
+}
@@ -0,0 +1,271 @@
+// Package fuzz serves systematically mutated responses on a stub route and
+// reports which mutations a client failed to handle.
+package fuzz
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/alesr/stubsrv"
+)
+
+// Response is the well-formed response that mutations are derived from.
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// Mutation rewrites the base response before it is served.
+type Mutation struct {
+	Name   string
+	Mutate func(base Response) Response
+}
+
+// Result is the outcome of probing the client with one mutation.
+type Result struct {
+	Mutation string
+	Err      error
+	Panicked bool
+}
+
+func (r Result) Failed() bool { return r.Err != nil || r.Panicked }
+
+type Report struct{ Results []Result }
+
+func (r Report) Failures() []Result {
+	var failures []Result
+	for _, res := range r.Results {
+		if res.Failed() {
+			failures = append(failures, res)
+		}
+	}
+	return failures
+}
+
+func (r Report) String() string {
+	var b strings.Builder
+	failures := r.Failures()
+	fmt.Fprintf(&b, "%d/%d mutations handled\n", len(r.Results)-len(failures), len(r.Results))
+	for _, res := range failures {
+		switch {
+		case res.Panicked:
+			fmt.Fprintf(&b, "  %s: panic: %v\n", res.Mutation, res.Err)
+		default:
+			fmt.Fprintf(&b, "  %s: %v\n", res.Mutation, res.Err)
+		}
+	}
+	return b.String()
+}
+
+type config struct {
+	seed      int64
+	mutations []Mutation
+}
+
+type Option func(*config)
+
+// WithSeed makes randomized mutations reproducible across runs.
+func WithSeed(seed int64) Option {
+	return func(cfg *config) {
+		cfg.seed = seed
+	}
+}
+
+// WithMutations replaces the default mutation set.
+func WithMutations(mutations ...Mutation) Option {
+	return func(cfg *config) {
+		cfg.mutations = mutations
+	}
+}
+
+type Harness struct {
+	stub      *stubsrv.Stub
+	path      string
+	base      Response
+	mutations []Mutation
+
+	mu      sync.Mutex
+	current Mutation
+}
+
+// New registers method and path on the stub. The path must be literal so
+// that Run can build the request URL from it.
+func New(stub *stubsrv.Stub, method, path string, base Response, opts ...Option) *Harness {
+	cfg := config{seed: 1}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.mutations == nil {
+		cfg.mutations = DefaultMutations(rand.New(rand.NewSource(cfg.seed)))
+	}
+	if base.Status == 0 {
+		base.Status = http.StatusOK
+	}
+
+	h := Harness{
+		stub:      stub,
+		path:      path,
+		base:      base,
+		mutations: cfg.mutations,
+	}
+	stub.AddHandler(method, path, h.serve)
+	return &h
+}
+
+// Run calls probe once per mutation with the URL of the fuzzed route.
+// probe should drive the client and return an error when the client
+// mishandled the response, e.g. accepted a corrupt payload.
+func (h *Harness) Run(probe func(url string) error) Report {
+	var report Report
+	url := h.stub.URL() + h.path
+
+	for _, m := range h.mutations {
+		h.mu.Lock()
+		h.current = m
+		h.mu.Unlock()
+
+		report.Results = append(report.Results, runProbe(m.Name, url, probe))
+	}
+	return report
+}
+
+func runProbe(name, url string, probe func(string) error) (res Result) {
+	res.Mutation = name
+	defer func() {
+		if p := recover(); p != nil {
+			res.Panicked = true
+			res.Err = fmt.Errorf("%v", p)
+		}
+	}()
+	res.Err = probe(url)
+	return res
+}
+
+func (h *Harness) serve(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	m := h.current
+	h.mu.Unlock()
+
+	resp := h.base
+	if m.Mutate != nil {
+		resp = m.Mutate(cloneResponse(h.base))
+	}
+
+	for k, vals := range resp.Header {
+		if vals == nil {
+			// a nil entry keeps net/http from filling the header in, e.g.
+			// sniffing a Content-Type
+			w.Header()[k] = nil
+			continue
+		}
+		for _, v := range vals {
+			w.Header().Add(k, v)
+		}
+	}
+	w.WriteHeader(resp.Status)
+	_, _ = w.Write(resp.Body)
+}
+
+func cloneResponse(r Response) Response {
+	return Response{
+		Status: r.Status,
+		Header: r.Header.Clone(),
+		Body:   append([]byte(nil), r.Body...),
+	}
+}
+
+// DefaultMutations returns status, header, truncation and JSON corruption
+// mutations. rng drives the randomized status codes.
+func DefaultMutations(rng *rand.Rand) []Mutation {
+	statuses := []int{
+		http.StatusNoContent,
+		http.StatusMovedPermanently,
+		http.StatusBadRequest,
+		http.StatusUnauthorized,
+		http.StatusNotFound,
+		http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+	}
+	rng.Shuffle(len(statuses), func(i, j int) { statuses[i], statuses[j] = statuses[j], statuses[i] })
+
+	var mutations []Mutation
+	for _, status := range statuses[:3] {
+		mutations = append(mutations, Mutation{
+			Name: fmt.Sprintf("status %d", status),
+			Mutate: func(r Response) Response {
+				r.Status = status
+				return r
+			},
+		})
+	}
+
+	mutations = append(mutations,
+		Mutation{
+			Name: "missing content-type",
+			Mutate: func(r Response) Response {
+				if r.Header == nil {
+					r.Header = http.Header{}
+				}
+				r.Header["Content-Type"] = nil
+				return r
+			},
+		},
+		Mutation{
+			Name: "wrong content-type",
+			Mutate: func(r Response) Response {
+				if r.Header == nil {
+					r.Header = http.Header{}
+				}
+				r.Header.Set("Content-Type", "text/html; charset=utf-8")
+				return r
+			},
+		},
+		Mutation{
+			Name: "duplicated headers",
+			Mutate: func(r Response) Response {
+				if r.Header == nil {
+					r.Header = http.Header{}
+				}
+				for k, vals := range r.Header {
+					r.Header[k] = append(vals, vals...)
+				}
+				return r
+			},
+		},
+		Mutation{
+			Name: "empty body",
+			Mutate: func(r Response) Response {
+				r.Body = nil
+				return r
+			},
+		},
+		Mutation{
+			Name: "truncated body",
+			Mutate: func(r Response) Response {
+				r.Body = r.Body[:len(r.Body)/2]
+				return r
+			},
+		},
+		Mutation{
+			Name: "invalid json",
+			Mutate: func(r Response) Response {
+				r.Body = append(r.Body, []byte(`,}"`)...)
+				return r
+			},
+		},
+		Mutation{
+			Name: "json type mismatch",
+			Mutate: func(r Response) Response {
+				r.Body = []byte(`[null, 1, "x", {}]`)
+				return r
+			},
+		},
+	)
+	return mutations
+}
@@ -0,0 +1,153 @@
+package fuzz
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"testing"
+
+	"github.com/alesr/stubsrv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHarness_Run(t *testing.T) {
+	t.Parallel()
+
+	t.Run("reports mutations the client failed to handle", func(t *testing.T) {
+		t.Parallel()
+
+		stub := stubsrv.NewStub(noopLogger())
+		require.NoError(t, stub.Start())
+		defer stub.Close()
+
+		base := Response{
+			Status: http.StatusOK,
+			Header: http.Header{"Content-Type": []string{"application/json"}},
+			Body:   []byte(`{"name":"foo"}`),
+		}
+
+		h := New(stub, http.MethodGet, "/user", base, WithMutations(
+			Mutation{Name: "identity"},
+			Mutation{Name: "invalid json", Mutate: func(r Response) Response {
+				r.Body = []byte("{")
+				return r
+			}},
+			Mutation{Name: "server error", Mutate: func(r Response) Response {
+				r.Status = http.StatusInternalServerError
+				return r
+			}},
+		))
+
+		// naive client: ignores status codes and panics on decode errors
+		report := h.Run(func(url string) error {
+			resp, err := http.Get(url)
+			if err != nil {
+				return err
+			}
+			defer resp.Body.Close()
+
+			var user struct{ Name string }
+			if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
+				panic(err)
+			}
+			if user.Name != "foo" {
+				return errors.New("unexpected user")
+			}
+			return nil
+		})
+
+		require.Len(t, report.Results, 3)
+		assert.False(t, report.Results[0].Failed())
+		assert.True(t, report.Results[1].Panicked)
+		assert.False(t, report.Results[2].Failed())
+
+		failures := report.Failures()
+		require.Len(t, failures, 1)
+		assert.Equal(t, "invalid json", failures[0].Mutation)
+		assert.Contains(t, report.String(), "2/3 mutations handled")
+	})
+
+	t.Run("default mutations alter the served response", func(t *testing.T) {
+		t.Parallel()
+
+		stub := stubsrv.NewStub(noopLogger())
+		require.NoError(t, stub.Start())
+		defer stub.Close()
+
+		base := Response{Body: []byte(`{"ok":true}`)}
+		h := New(stub, http.MethodGet, "/ok", base, WithSeed(42))
+
+		var served []string
+		report := h.Run(func(url string) error {
+			resp, err := http.Get(url)
+			if err != nil {
+				return err
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			served = append(served, fmt.Sprintf("%d %s", resp.StatusCode, body))
+			return nil
+		})
+
+		assert.Len(t, report.Results, len(DefaultMutations(rand.New(rand.NewSource(42)))))
+		assert.Empty(t, report.Failures())
+		assert.Contains(t, served, "200 ")
+		assert.Contains(t, served, `200 {"ok":true},}"`)
+	})
+
+	t.Run("missing content-type is absent on the wire", func(t *testing.T) {
+		t.Parallel()
+
+		stub := stubsrv.NewStub(noopLogger())
+		require.NoError(t, stub.Start())
+		defer stub.Close()
+
+		var missing Mutation
+		for _, m := range DefaultMutations(rand.New(rand.NewSource(1))) {
+			if m.Name == "missing content-type" {
+				missing = m
+			}
+		}
+		require.NotNil(t, missing.Mutate)
+
+		base := Response{
+			Header: http.Header{"Content-Type": []string{"application/json"}},
+			Body:   []byte(`{"ok":true}`),
+		}
+		h := New(stub, http.MethodGet, "/ok", base, WithMutations(missing))
+
+		report := h.Run(func(url string) error {
+			resp, err := http.Get(url)
+			if err != nil {
+				return err
+			}
+			defer resp.Body.Close()
+			if ct, ok := resp.Header["Content-Type"]; ok {
+				return fmt.Errorf("Content-Type was sent: %q", ct)
+			}
+			return nil
+		})
+		assert.Empty(t, report.Failures())
+	})
+}
+
+func TestDefaultMutations(t *testing.T) {
+	t.Parallel()
+
+	first := DefaultMutations(rand.New(rand.NewSource(7)))
+	second := DefaultMutations(rand.New(rand.NewSource(7)))
+
+	require.Equal(t, len(first), len(second))
+	for i := range first {
+		assert.Equal(t, first[i].Name, second[i].Name)
+	}
+}
+
+func noopLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{}))
+}
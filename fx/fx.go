@@ -0,0 +1,247 @@
+// Package fx emulates a Frankfurter-style exchange-rate API serving
+// deterministic rates, with cross rates derived from a single rate table.
+//
+// Routes, relative to the configured prefix:
+//
+//	GET <prefix>/latest?base=USD&symbols=EUR,GBP&amount=10
+//	GET <prefix>/2024-01-31?base=USD                  historical rates
+//	GET <prefix>/2024-01-01..2024-01-31?symbols=GBP   time series
+package fx
+
+import (
+	"cmp"
+	"encoding/json"
+	"maps"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alesr/stubsrv"
+)
+
+const dateLayout = time.DateOnly
+
+type Config struct {
+	// Base is the currency Rates are quoted against. Defaults to EUR.
+	Base string
+	// Rates maps currency codes to units per one Base, used for every date
+	// without rates of its own.
+	Rates map[string]float64
+	// Today is the date served by /latest; later dates are not found.
+	// Defaults to the current date.
+	Today time.Time
+}
+
+type Server struct {
+	base  string
+	today time.Time
+
+	mu     sync.Mutex
+	rates  map[string]float64
+	byDate map[string]map[string]float64
+}
+
+func New(stub *stubsrv.Stub, prefix string, cfg Config) *Server {
+	srv := Server{
+		base:   cmp.Or(cfg.Base, "EUR"),
+		today:  cfg.Today,
+		rates:  cfg.Rates,
+		byDate: make(map[string]map[string]float64),
+	}
+	if srv.today.IsZero() {
+		srv.today = time.Now()
+	}
+	srv.today = srv.today.UTC().Truncate(24 * time.Hour)
+
+	prefix = strings.TrimSuffix(prefix, "/")
+	stub.AddHandler(http.MethodGet, prefix+"/latest", srv.handleLatest)
+	stub.AddHandler(http.MethodGet, prefix+"/:date", srv.handleDate)
+	return &srv
+}
+
+// SetRates overrides the rate table for date, formatted as 2006-01-02.
+func (srv *Server) SetRates(date string, rates map[string]float64) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	srv.byDate[date] = rates
+}
+
+type response struct {
+	Amount    float64 `json:"amount"`
+	Base      string  `json:"base"`
+	Date      string  `json:"date,omitempty"`
+	StartDate string  `json:"start_date,omitempty"`
+	EndDate   string  `json:"end_date,omitempty"`
+	Rates     any     `json:"rates"`
+}
+
+func (srv *Server) handleLatest(w http.ResponseWriter, r *http.Request) {
+	srv.serveDay(w, r, srv.today)
+}
+
+func (srv *Server) handleDate(w http.ResponseWriter, r *http.Request) {
+	segment := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+
+	if from, to, ok := strings.Cut(segment, ".."); ok {
+		srv.serveSeries(w, r, from, to)
+		return
+	}
+
+	day, err := time.Parse(dateLayout, segment)
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, "invalid date")
+		return
+	}
+	srv.serveDay(w, r, day)
+}
+
+func (srv *Server) serveDay(w http.ResponseWriter, r *http.Request, day time.Time) {
+	q, ok := parseQuery(w, r, srv.base)
+	if !ok {
+		return
+	}
+	if day.After(srv.today) {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	rates, ok := srv.convert(day, q)
+	if !ok {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	writeJSON(w, response{Amount: q.amount, Base: q.base, Date: day.Format(dateLayout), Rates: rates})
+}
+
+func (srv *Server) serveSeries(w http.ResponseWriter, r *http.Request, from, to string) {
+	q, ok := parseQuery(w, r, srv.base)
+	if !ok {
+		return
+	}
+
+	start, err := time.Parse(dateLayout, from)
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, "invalid date")
+		return
+	}
+	end := srv.today
+	if to != "" {
+		if end, err = time.Parse(dateLayout, to); err != nil {
+			writeError(w, http.StatusUnprocessableEntity, "invalid date")
+			return
+		}
+	}
+	if end.After(srv.today) {
+		end = srv.today
+	}
+	if end.Before(start) {
+		writeError(w, http.StatusUnprocessableEntity, "invalid date range")
+		return
+	}
+
+	series := make(map[string]map[string]float64)
+	for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+		rates, ok := srv.convert(day, q)
+		if !ok {
+			writeError(w, http.StatusNotFound, "not found")
+			return
+		}
+		series[day.Format(dateLayout)] = rates
+	}
+
+	writeJSON(w, response{
+		Amount:    q.amount,
+		Base:      q.base,
+		StartDate: start.Format(dateLayout),
+		EndDate:   end.Format(dateLayout),
+		Rates:     series,
+	})
+}
+
+type query struct {
+	base    string
+	symbols []string
+	amount  float64
+}
+
+func parseQuery(w http.ResponseWriter, r *http.Request, defaultBase string) (query, bool) {
+	vals := r.URL.Query()
+	q := query{
+		base:   strings.ToUpper(cmp.Or(vals.Get("base"), defaultBase)),
+		amount: 1,
+	}
+	if s := vals.Get("symbols"); s != "" {
+		q.symbols = strings.Split(strings.ToUpper(s), ",")
+	}
+	if s := vals.Get("amount"); s != "" {
+		amount, err := strconv.ParseFloat(s, 64)
+		if err != nil || amount <= 0 {
+			writeError(w, http.StatusUnprocessableEntity, "invalid amount")
+			return q, false
+		}
+		q.amount = amount
+	}
+	return q, true
+}
+
+// convert returns the rates for day quoted against q.base, restricted to
+// q.symbols. It reports false when a requested currency is unknown.
+func (srv *Server) convert(day time.Time, q query) (map[string]float64, bool) {
+	srv.mu.Lock()
+	table, ok := srv.byDate[day.Format(dateLayout)]
+	if !ok {
+		table = srv.rates
+	}
+	srv.mu.Unlock()
+
+	rate := func(code string) (float64, bool) {
+		if code == srv.base {
+			return 1, true
+		}
+		v, ok := table[code]
+		return v, ok
+	}
+
+	baseRate, ok := rate(q.base)
+	if !ok {
+		return nil, false
+	}
+
+	symbols := q.symbols
+	if symbols == nil {
+		symbols = append([]string{srv.base}, slices.Sorted(maps.Keys(table))...)
+	}
+
+	out := make(map[string]float64, len(symbols))
+	for _, code := range symbols {
+		if code == q.base {
+			continue
+		}
+		v, ok := rate(code)
+		if !ok {
+			return nil, false
+		}
+		out[code] = round(q.amount * v / baseRate)
+	}
+	return out, true
+}
+
+func round(v float64) float64 {
+	return math.Round(v*1e5) / 1e5
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"message": msg})
+}
@@ -0,0 +1,99 @@
+package fx
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/alesr/stubsrv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer(t *testing.T) {
+	t.Parallel()
+
+	stub := stubsrv.NewStub(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	srv := New(stub, "/fx", Config{
+		Rates: map[string]float64{"USD": 1.1, "GBP": 0.85},
+		Today: time.Date(2024, 1, 3, 15, 0, 0, 0, time.UTC),
+	})
+	srv.SetRates("2024-01-02", map[string]float64{"USD": 1.2, "GBP": 0.9})
+	require.NoError(t, stub.Start())
+	t.Cleanup(stub.Close)
+
+	testCases := []struct {
+		name           string
+		givenPath      string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "latest against the default base",
+			givenPath:      "/fx/latest",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"amount":1,"base":"EUR","date":"2024-01-03","rates":{"GBP":0.85,"USD":1.1}}`,
+		},
+		{
+			name:           "cross rates with symbols and amount",
+			givenPath:      "/fx/latest?base=usd&symbols=EUR,GBP&amount=11",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"amount":11,"base":"USD","date":"2024-01-03","rates":{"EUR":10,"GBP":8.5}}`,
+		},
+		{
+			name:           "historical date uses its own rates",
+			givenPath:      "/fx/2024-01-02?symbols=USD",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"amount":1,"base":"EUR","date":"2024-01-02","rates":{"USD":1.2}}`,
+		},
+		{
+			name:           "time series",
+			givenPath:      "/fx/2024-01-01..2024-01-05?symbols=USD",
+			expectedStatus: http.StatusOK,
+			expectedBody: `{"amount":1,"base":"EUR","start_date":"2024-01-01","end_date":"2024-01-03",
+				"rates":{"2024-01-01":{"USD":1.1},"2024-01-02":{"USD":1.2},"2024-01-03":{"USD":1.1}}}`,
+		},
+		{
+			name:           "future date",
+			givenPath:      "/fx/2024-02-01",
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   `{"message":"not found"}`,
+		},
+		{
+			name:           "unknown currency",
+			givenPath:      "/fx/latest?symbols=XYZ",
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   `{"message":"not found"}`,
+		},
+		{
+			name:           "invalid date",
+			givenPath:      "/fx/yesterday",
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedBody:   `{"message":"invalid date"}`,
+		},
+		{
+			name:           "invalid amount",
+			givenPath:      "/fx/latest?amount=-1",
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedBody:   `{"message":"invalid amount"}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			resp, err := http.Get(stub.URL() + tc.givenPath)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.expectedStatus, resp.StatusCode)
+			assert.JSONEq(t, tc.expectedBody, string(body))
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package stubsrv
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// GatewayStyle selects the headers and error envelopes of the emulated
+// API gateway.
+type GatewayStyle string
+
+const (
+	GatewayKong GatewayStyle = "kong"
+	GatewayAWS  GatewayStyle = "aws"
+)
+
+type GatewayConfig struct {
+	// Style defaults to GatewayKong.
+	Style GatewayStyle
+	// APIKeyHeader carries the API key. Defaults to apikey for Kong and
+	// x-api-key for AWS.
+	APIKeyHeader string
+	// RequireAPIKey rejects requests without a key, or with a key outside
+	// APIKeys when it is set: 401 for Kong, 403 Forbidden for AWS.
+	RequireAPIKey bool
+	APIKeys       []string
+	// Quota is the number of requests allowed per key in each QuotaWindow.
+	// Zero disables quotas.
+	Quota       int
+	QuotaWindow time.Duration
+	// MaxBodyBytes rejects larger requests with a 413. Zero disables it.
+	MaxBodyBytes int64
+}
+
+// WithGateway puts every user route behind an emulated API gateway that
+// authenticates API keys, enforces quotas and payload limits, injects a
+// request ID and answers errors with the gateway's envelope.
+func WithGateway(cfg GatewayConfig) Option {
+	return func(c *stubConfig) {
+		c.gateway = &cfg
+	}
+}
+
+type gateway struct {
+	cfg GatewayConfig
+	now func() time.Time
+
+	mu      sync.Mutex
+	windows map[string]quotaWindow
+}
+
+type quotaWindow struct {
+	start time.Time
+	count int
+}
+
+func newGateway(cfg GatewayConfig, now func() time.Time) *gateway {
+	if cfg.Style == "" {
+		cfg.Style = GatewayKong
+	}
+	if cfg.APIKeyHeader == "" {
+		cfg.APIKeyHeader = "apikey"
+		if cfg.Style == GatewayAWS {
+			cfg.APIKeyHeader = "x-api-key"
+		}
+	}
+	if cfg.QuotaWindow == 0 {
+		cfg.QuotaWindow = time.Minute
+	}
+	return &gateway{cfg: cfg, now: now, windows: make(map[string]quotaWindow)}
+}
+
+func (g *gateway) requestIDHeader() string {
+	if g.cfg.Style == GatewayAWS {
+		return "x-amzn-RequestId"
+	}
+	return "X-Kong-Request-Id"
+}
+
+// wrap applies the gateway policies before next.
+func (g *gateway) wrap(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		idHeader := g.requestIDHeader()
+		id := r.Header.Get(idHeader)
+		if id == "" {
+			b := make([]byte, 16)
+			_, _ = rand.Read(b)
+			id = hex.EncodeToString(b)
+			r.Header.Set(idHeader, id)
+		}
+		w.Header().Set(idHeader, id)
+
+		key := r.Header.Get(g.cfg.APIKeyHeader)
+		if g.cfg.RequireAPIKey {
+			switch {
+			case key != "" && (len(g.cfg.APIKeys) == 0 || slices.Contains(g.cfg.APIKeys, key)):
+			case g.cfg.Style == GatewayAWS:
+				// API Gateway doesn't tell a missing key from a wrong one.
+				g.writeError(w, r, http.StatusForbidden, "ForbiddenException", "Forbidden")
+				return
+			case key == "":
+				g.writeError(w, r, http.StatusUnauthorized, "", "No API key found in request")
+				return
+			default:
+				g.writeError(w, r, http.StatusUnauthorized, "", "Invalid authentication credentials")
+				return
+			}
+		}
+
+		if g.cfg.Quota > 0 {
+			remaining := g.consume(key)
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(g.cfg.Quota))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(max(remaining, 0)))
+			if remaining < 0 {
+				g.writeError(w, r, http.StatusTooManyRequests, "TooManyRequestsException", "API rate limit exceeded")
+				return
+			}
+		}
+
+		if g.cfg.MaxBodyBytes > 0 && r.ContentLength > g.cfg.MaxBodyBytes {
+			g.writeError(w, r, http.StatusRequestEntityTooLarge, "RequestTooLongException", "Request size limit exceeded")
+			return
+		}
+		if g.cfg.MaxBodyBytes > 0 && r.Body != nil {
+			// chunked bodies declare no length, so the limit is enforced
+			// while reading, before the journal and handlers see them
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, g.cfg.MaxBodyBytes))
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				g.writeError(w, r, http.StatusRequestEntityTooLarge, "RequestTooLongException", "Request size limit exceeded")
+				return
+			}
+			if err != nil {
+				g.writeError(w, r, http.StatusBadRequest, "BadRequestException", "Could not read request body")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		next(w, r)
+	}
+}
+
+// consume counts a request against key's quota window and returns how many
+// requests are left, negative once the quota is exceeded.
+func (g *gateway) consume(key string) int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	win := g.windows[key]
+	if now.Sub(win.start) >= g.cfg.QuotaWindow {
+		win = quotaWindow{start: now}
+	}
+	win.count++
+	g.windows[key] = win
+	return g.cfg.Quota - win.count
+}
+
+// notFound answers requests matching no route the way the gateway does.
+func (g *gateway) notFound(w http.ResponseWriter, r *http.Request) {
+	if g.cfg.Style == GatewayAWS {
+		g.writeError(w, r, http.StatusForbidden, "MissingAuthenticationTokenException", "Missing Authentication Token")
+		return
+	}
+	g.writeError(w, r, http.StatusNotFound, "", "no Route matched with those values")
+}
+
+func (g *gateway) writeError(w http.ResponseWriter, r *http.Request, status int, awsType, msg string) {
+	body := map[string]string{"message": msg}
+	if g.cfg.Style == GatewayAWS {
+		if awsType != "" {
+			w.Header().Set("x-amzn-ErrorType", awsType)
+		}
+	} else {
+		body["request_id"] = r.Header.Get(g.requestIDHeader())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
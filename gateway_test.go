@@ -0,0 +1,155 @@
+package stubsrv
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStub_WithGateway(t *testing.T) {
+	t.Parallel()
+
+	do := func(t *testing.T, stub *Stub, method, path, key, body string) (*http.Response, map[string]string) {
+		t.Helper()
+
+		req, err := http.NewRequest(method, stub.URL()+path, strings.NewReader(body))
+		require.NoError(t, err)
+		if key != "" {
+			req.Header.Set("apikey", key)
+			req.Header.Set("x-api-key", key)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		var envelope map[string]string
+		_ = json.NewDecoder(resp.Body).Decode(&envelope)
+		return resp, envelope
+	}
+
+	t.Run("kong", func(t *testing.T) {
+		t.Parallel()
+
+		stub := NewStub(noopLogger(), WithGateway(GatewayConfig{
+			RequireAPIKey: true,
+			APIKeys:       []string{"k1"},
+			Quota:         2,
+			QuotaWindow:   time.Hour,
+			MaxBodyBytes:  4,
+		}))
+		var gotRequestID string
+		stub.AddHandler(http.MethodPost, "/orders", func(w http.ResponseWriter, r *http.Request) {
+			gotRequestID = r.Header.Get("X-Kong-Request-Id")
+		})
+		require.NoError(t, stub.Start())
+		defer stub.Close()
+
+		resp, envelope := do(t, stub, http.MethodPost, "/orders", "", "")
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+		assert.Equal(t, "No API key found in request", envelope["message"])
+		assert.Equal(t, resp.Header.Get("X-Kong-Request-Id"), envelope["request_id"])
+
+		resp, _ = do(t, stub, http.MethodPost, "/orders", "nope", "")
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+		resp, _ = do(t, stub, http.MethodPost, "/orders", "k1", "ok")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "2", resp.Header.Get("RateLimit-Limit"))
+		assert.Equal(t, "1", resp.Header.Get("RateLimit-Remaining"))
+		assert.NotEmpty(t, gotRequestID)
+		assert.Equal(t, gotRequestID, resp.Header.Get("X-Kong-Request-Id"))
+
+		resp, envelope = do(t, stub, http.MethodPost, "/orders", "k1", "too large")
+		assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+		assert.Equal(t, "Request size limit exceeded", envelope["message"])
+
+		resp, envelope = do(t, stub, http.MethodPost, "/orders", "k1", "")
+		assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+		assert.Equal(t, "0", resp.Header.Get("RateLimit-Remaining"))
+		assert.Equal(t, "API rate limit exceeded", envelope["message"])
+	})
+
+	t.Run("chunked body over the limit", func(t *testing.T) {
+		t.Parallel()
+
+		stub := NewStub(noopLogger(), WithGateway(GatewayConfig{MaxBodyBytes: 10}))
+		var called bool
+		stub.AddHandler(http.MethodPost, "/upload", func(w http.ResponseWriter, r *http.Request) {
+			called = true
+		})
+		require.NoError(t, stub.Start())
+		defer stub.Close()
+
+		// a reader of unknown length is sent chunked, without Content-Length
+		body := io.MultiReader(strings.NewReader(strings.Repeat("a", 100)))
+		req, err := http.NewRequest(http.MethodPost, stub.URL()+"/upload", body)
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		var envelope map[string]string
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&envelope))
+		assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+		assert.Equal(t, "Request size limit exceeded", envelope["message"])
+		assert.False(t, called)
+		assert.Empty(t, stub.Requests())
+
+		req, err = http.NewRequest(http.MethodPost, stub.URL()+"/upload", io.MultiReader(strings.NewReader("small")))
+		require.NoError(t, err)
+		resp, err = http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Len(t, stub.Requests(), 1)
+		assert.Equal(t, "small", string(stub.Requests()[0].Body))
+	})
+
+	t.Run("aws", func(t *testing.T) {
+		t.Parallel()
+
+		stub := NewStub(noopLogger(), WithGateway(GatewayConfig{Style: GatewayAWS, RequireAPIKey: true}))
+		stub.AddHandler(http.MethodGet, "/items", func(w http.ResponseWriter, r *http.Request) {})
+		require.NoError(t, stub.Start())
+		defer stub.Close()
+
+		resp, envelope := do(t, stub, http.MethodGet, "/items", "", "")
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+		assert.Equal(t, "ForbiddenException", resp.Header.Get("x-amzn-ErrorType"))
+		assert.Equal(t, map[string]string{"message": "Forbidden"}, envelope)
+
+		resp, _ = do(t, stub, http.MethodGet, "/items", "any", "")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.NotEmpty(t, resp.Header.Get("x-amzn-RequestId"))
+
+		resp, envelope = do(t, stub, http.MethodGet, "/missing", "any", "")
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+		assert.Equal(t, "Missing Authentication Token", envelope["message"])
+
+		resp, _ = do(t, stub, http.MethodGet, "/readyz", "", "")
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "control endpoints bypass the gateway")
+	})
+
+	t.Run("aws invalid key", func(t *testing.T) {
+		t.Parallel()
+
+		stub := NewStub(noopLogger(), WithGateway(GatewayConfig{Style: GatewayAWS, RequireAPIKey: true, APIKeys: []string{"k1"}}))
+		stub.AddHandler(http.MethodGet, "/items", func(w http.ResponseWriter, r *http.Request) {})
+		require.NoError(t, stub.Start())
+		defer stub.Close()
+
+		resp, envelope := do(t, stub, http.MethodGet, "/items", "nope", "")
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+		assert.Equal(t, "ForbiddenException", resp.Header.Get("x-amzn-ErrorType"))
+		assert.Equal(t, map[string]string{"message": "Forbidden"}, envelope)
+
+		resp, _ = do(t, stub, http.MethodGet, "/items", "k1", "")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+}
@@ -0,0 +1,40 @@
+package stubsrv
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Generator produces the payload for a single request. It is the hook for
+// property-based generators (rapid, gopter, ...): each call should draw a
+// fresh schema-valid value.
+type Generator func(r *http.Request) (any, error)
+
+// GeneratedHandler serves a freshly generated payload on every request.
+// []byte and string payloads are written as-is, anything else is JSON encoded.
+func GeneratedHandler(gen Generator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		payload, err := gen(r)
+		if err != nil {
+			ReportError(r, err)
+			http.Error(w, "generator failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		switch p := payload.(type) {
+		case []byte:
+			_, _ = w.Write(p)
+		case string:
+			_, _ = w.Write([]byte(p))
+		default:
+			body, err := json.Marshal(p)
+			if err != nil {
+				ReportError(r, err)
+				http.Error(w, "could not encode generated payload: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write(body)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package stubsrv
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGeneratedHandler(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name                string
+		givenGenerator      Generator
+		expectedStatus      int
+		expectedBody        string
+		expectedContentType string
+	}{
+		{
+			name: "struct payload is JSON encoded",
+			givenGenerator: func(r *http.Request) (any, error) {
+				return struct {
+					ID int `json:"id"`
+				}{ID: 7}, nil
+			},
+			expectedStatus:      http.StatusOK,
+			expectedBody:        `{"id":7}`,
+			expectedContentType: "application/json",
+		},
+		{
+			name: "raw bytes are written as-is",
+			givenGenerator: func(r *http.Request) (any, error) {
+				return []byte("raw"), nil
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   "raw",
+		},
+		{
+			name: "generator error returns 500",
+			givenGenerator: func(r *http.Request) (any, error) {
+				return nil, errors.New("boom")
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   "generator failed: boom\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			GeneratedHandler(tc.givenGenerator).ServeHTTP(w, r)
+
+			assert.Equal(t, tc.expectedStatus, w.Code)
+			assert.Equal(t, tc.expectedBody, w.Body.String())
+			if tc.expectedContentType != "" {
+				assert.Equal(t, tc.expectedContentType, w.Header().Get("Content-Type"))
+			}
+		})
+	}
+
+	t.Run("generator is invoked per request", func(t *testing.T) {
+		t.Parallel()
+
+		var calls int
+		h := GeneratedHandler(func(r *http.Request) (any, error) {
+			calls++
+			return calls, nil
+		})
+
+		for i := 1; i <= 3; i++ {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+			assert.Equal(t, string(rune('0'+i)), w.Body.String())
+		}
+	})
+}
@@ -0,0 +1,121 @@
+// Package geoip emulates a geo-IP lookup API in the style of ip-api.com,
+// serving configured locations keyed by IP address.
+//
+// Routes, relative to the configured prefix:
+//
+//	GET <prefix>/:ip     location for ip
+//
+// Like ip-api.com, lookups always answer 200 and report failures through
+// "status":"fail" and a message: "invalid query", "private range",
+// "reserved range", or "unknown address" when no location is configured.
+package geoip
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alesr/stubsrv"
+)
+
+type Location struct {
+	Country     string  `json:"country,omitempty"`
+	CountryCode string  `json:"countryCode,omitempty"`
+	Region      string  `json:"region,omitempty"`
+	RegionName  string  `json:"regionName,omitempty"`
+	City        string  `json:"city,omitempty"`
+	Zip         string  `json:"zip,omitempty"`
+	Lat         float64 `json:"lat,omitempty"`
+	Lon         float64 `json:"lon,omitempty"`
+	Timezone    string  `json:"timezone,omitempty"`
+	ISP         string  `json:"isp,omitempty"`
+	Org         string  `json:"org,omitempty"`
+	AS          string  `json:"as,omitempty"`
+}
+
+type Config struct {
+	// Latency and Jitter delay every lookup, see stubsrv.WithDelayJitter.
+	Latency time.Duration
+	Jitter  time.Duration
+	// Default answers lookups for public addresses without a configured
+	// location. When nil those lookups fail with "unknown address".
+	Default *Location
+}
+
+type response struct {
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+	*Location
+	Query string `json:"query"`
+}
+
+type Server struct {
+	cfg Config
+
+	mu        sync.Mutex
+	locations map[netip.Addr]Location
+}
+
+func New(stub *stubsrv.Stub, prefix string, cfg Config) *Server {
+	srv := Server{
+		cfg:       cfg,
+		locations: make(map[netip.Addr]Location),
+	}
+
+	var mws []stubsrv.Middleware
+	if cfg.Latency > 0 || cfg.Jitter > 0 {
+		mws = append(mws, stubsrv.WithDelayJitter(cfg.Latency, cfg.Jitter))
+	}
+	stub.AddHandler(http.MethodGet, strings.TrimSuffix(prefix, "/")+"/:ip", srv.handleLookup, mws...)
+	return &srv
+}
+
+// Set configures the location returned for ip. It panics if ip is not a
+// valid address.
+func (srv *Server) Set(ip string, loc Location) {
+	addr := netip.MustParseAddr(ip)
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	srv.locations[addr.Unmap()] = loc
+}
+
+func (srv *Server) lookup(addr netip.Addr) (Location, bool) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	loc, ok := srv.locations[addr.Unmap()]
+	if !ok && srv.cfg.Default != nil {
+		return *srv.cfg.Default, true
+	}
+	return loc, ok
+}
+
+func (srv *Server) handleLookup(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	resp := response{Status: "fail", Query: query}
+
+	addr, err := netip.ParseAddr(query)
+	switch {
+	case err != nil:
+		resp.Message = "invalid query"
+	case addr.IsPrivate() || addr.IsLoopback():
+		resp.Message = "private range"
+	case !addr.IsGlobalUnicast():
+		resp.Message = "reserved range"
+	default:
+		if loc, ok := srv.lookup(addr); ok {
+			resp.Status = "success"
+			resp.Location = &loc
+		} else {
+			resp.Message = "unknown address"
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,97 @@
+package geoip
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/alesr/stubsrv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_Lookup(t *testing.T) {
+	t.Parallel()
+
+	stub := stubsrv.NewStub(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	srv := New(stub, "/json", Config{})
+	srv.Set("8.8.8.8", Location{Country: "United States", CountryCode: "US", City: "Mountain View", Lat: 37.4, Lon: -122.1})
+	srv.Set("2001:4860:4860::8888", Location{CountryCode: "US"})
+	require.NoError(t, stub.Start())
+	t.Cleanup(stub.Close)
+
+	testCases := []struct {
+		name         string
+		givenIP      string
+		expectedBody string
+	}{
+		{
+			name:         "known IPv4",
+			givenIP:      "8.8.8.8",
+			expectedBody: `{"status":"success","country":"United States","countryCode":"US","city":"Mountain View","lat":37.4,"lon":-122.1,"query":"8.8.8.8"}`,
+		},
+		{
+			name:         "known IPv6",
+			givenIP:      "2001:4860:4860::8888",
+			expectedBody: `{"status":"success","countryCode":"US","query":"2001:4860:4860::8888"}`,
+		},
+		{
+			name:         "unknown address",
+			givenIP:      "1.1.1.1",
+			expectedBody: `{"status":"fail","message":"unknown address","query":"1.1.1.1"}`,
+		},
+		{
+			name:         "private range",
+			givenIP:      "10.0.0.1",
+			expectedBody: `{"status":"fail","message":"private range","query":"10.0.0.1"}`,
+		},
+		{
+			name:         "reserved range",
+			givenIP:      "224.0.0.1",
+			expectedBody: `{"status":"fail","message":"reserved range","query":"224.0.0.1"}`,
+		},
+		{
+			name:         "invalid query",
+			givenIP:      "not-an-ip",
+			expectedBody: `{"status":"fail","message":"invalid query","query":"not-an-ip"}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			resp, err := http.Get(stub.URL() + "/json/" + tc.givenIP)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.JSONEq(t, tc.expectedBody, string(body))
+		})
+	}
+}
+
+func TestServer_DefaultAndLatency(t *testing.T) {
+	t.Parallel()
+
+	stub := stubsrv.NewStub(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	New(stub, "/geo/", Config{Latency: 50 * time.Millisecond, Default: &Location{CountryCode: "DE"}})
+	require.NoError(t, stub.Start())
+	t.Cleanup(stub.Close)
+
+	start := time.Now()
+	resp, err := http.Get(stub.URL() + "/geo/1.1.1.1")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	assert.JSONEq(t, `{"status":"success","countryCode":"DE","query":"1.1.1.1"}`, string(body))
+}
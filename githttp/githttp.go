@@ -0,0 +1,93 @@
+// Package githttp stubs git's smart-HTTP protocol with fixture refs and
+// packfiles, so tooling that clones or fetches over HTTP can be tested
+// hermetically.
+package githttp
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/alesr/stubsrv"
+)
+
+const uploadPack = "git-upload-pack"
+
+type Repo struct {
+	// Refs maps ref names (refs/heads/main, refs/tags/v1) to object ids.
+	Refs map[string]string
+	// HEAD is the ref HEAD points to. Defaults to refs/heads/main.
+	HEAD string
+	// Pack is served to every fetch, e.g. the output of
+	// `git rev-list --objects --all | git pack-objects --stdout`.
+	Pack []byte
+}
+
+// Add serves repo under path (e.g. "/org/repo.git") on the stub.
+func Add(stub *stubsrv.Stub, path string, repo Repo) {
+	if repo.HEAD == "" {
+		repo.HEAD = "refs/heads/main"
+	}
+	path = strings.TrimSuffix(path, "/")
+
+	stub.AddHandler(http.MethodGet, path+"/info/refs", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("service") != uploadPack {
+			http.Error(w, "only smart HTTP "+uploadPack+" is supported", http.StatusForbidden)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/x-"+uploadPack+"-advertisement")
+		w.Header().Set("Cache-Control", "no-cache")
+		_, _ = io.WriteString(w, advertisement(repo))
+	})
+
+	stub.AddHandler(http.MethodPost, path+"/"+uploadPack, func(w http.ResponseWriter, r *http.Request) {
+		// wants and haves are not negotiated, the fixture pack is always sent
+		_, _ = io.Copy(io.Discard, r.Body)
+
+		w.Header().Set("Content-Type", "application/x-"+uploadPack+"-result")
+		w.Header().Set("Cache-Control", "no-cache")
+		_, _ = io.WriteString(w, pktLine("NAK\n"))
+		_, _ = w.Write(repo.Pack)
+	})
+}
+
+func advertisement(repo Repo) string {
+	var b strings.Builder
+	b.WriteString(pktLine("# service=" + uploadPack + "\n"))
+	b.WriteString(flushPkt)
+
+	names := make([]string, 0, len(repo.Refs))
+	for name := range repo.Refs {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	caps := "symref=HEAD:" + repo.HEAD + " agent=stubsrv"
+	if head, ok := repo.Refs[repo.HEAD]; ok {
+		b.WriteString(pktLine(fmt.Sprintf("%s HEAD\x00%s\n", head, caps)))
+		caps = ""
+	}
+	for _, name := range names {
+		line := repo.Refs[name] + " " + name
+		if caps != "" {
+			line += "\x00" + caps
+			caps = ""
+		}
+		b.WriteString(pktLine(line + "\n"))
+	}
+	if caps != "" {
+		// empty repository
+		b.WriteString(pktLine(strings.Repeat("0", 40) + " capabilities^{}\x00" + caps + "\n"))
+	}
+	b.WriteString(flushPkt)
+	return b.String()
+}
+
+const flushPkt = "0000"
+
+func pktLine(s string) string {
+	return fmt.Sprintf("%04x%s", len(s)+4, s)
+}
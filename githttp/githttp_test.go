@@ -0,0 +1,102 @@
+package githttp
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alesr/stubsrv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPktLine(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "0008NAK\n", pktLine("NAK\n"))
+	assert.Equal(t, "0004", pktLine(""))
+}
+
+func TestAdd_InfoRefs(t *testing.T) {
+	t.Parallel()
+
+	stub := newStub(t)
+	oid := strings.Repeat("a", 40)
+	Add(stub, "/org/repo.git", Repo{Refs: map[string]string{"refs/heads/main": oid, "refs/tags/v1": oid}})
+	require.NoError(t, stub.Start())
+
+	resp, err := http.Get(stub.URL() + "/org/repo.git/info/refs?service=git-upload-pack")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	assert.Equal(t, "application/x-git-upload-pack-advertisement", resp.Header.Get("Content-Type"))
+	expected := "001e# service=git-upload-pack\n0000" +
+		pktLine(oid+" HEAD\x00symref=HEAD:refs/heads/main agent=stubsrv\n") +
+		pktLine(oid+" refs/heads/main\n") +
+		pktLine(oid+" refs/tags/v1\n") +
+		"0000"
+	assert.Equal(t, expected, string(body))
+
+	dumb, err := http.Get(stub.URL() + "/org/repo.git/info/refs")
+	require.NoError(t, err)
+	dumb.Body.Close()
+	assert.Equal(t, http.StatusForbidden, dumb.StatusCode)
+}
+
+func TestAdd_Clone(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git binary not available")
+	}
+
+	src := t.TempDir()
+	gitCmd(t, src, nil, "init", "-q", "-b", "main")
+	require.NoError(t, os.WriteFile(filepath.Join(src, "README"), []byte("fixture\n"), 0o644))
+	gitCmd(t, src, nil, "add", "README")
+	gitCmd(t, src, nil, "-c", "user.name=stub", "-c", "user.email=stub@example.com", "commit", "-q", "-m", "init")
+
+	head := strings.TrimSpace(gitCmd(t, src, nil, "rev-parse", "HEAD"))
+	objects := gitCmd(t, src, nil, "rev-list", "--objects", "--all")
+	pack := gitCmd(t, src, strings.NewReader(objects), "pack-objects", "--stdout")
+
+	stub := newStub(t)
+	Add(stub, "/fixture.git", Repo{Refs: map[string]string{"refs/heads/main": head}, Pack: []byte(pack)})
+	require.NoError(t, stub.Start())
+
+	dst := filepath.Join(t.TempDir(), "clone")
+	gitCmd(t, "", nil, "clone", "-q", stub.URL()+"/fixture.git", dst)
+
+	got, err := os.ReadFile(filepath.Join(dst, "README"))
+	require.NoError(t, err)
+	assert.Equal(t, "fixture\n", string(got))
+}
+
+func newStub(t *testing.T) *stubsrv.Stub {
+	t.Helper()
+
+	stub := stubsrv.NewStub(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	t.Cleanup(stub.Close)
+	return stub
+}
+
+func gitCmd(t *testing.T, dir string, stdin io.Reader, args ...string) string {
+	t.Helper()
+
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Stdin = stdin
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	var out, stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	require.NoError(t, cmd.Run(), stderr.String())
+	return out.String()
+}
@@ -0,0 +1,160 @@
+package stubsrv
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// GraphQLMatch selects GraphQL operations. Empty fields always hold.
+type GraphQLMatch struct {
+	// OperationName is compared with the request's operationName, or with the
+	// name of the first operation in the document when the request has none.
+	OperationName string `json:"operation_name"`
+	// Query is compared with the request's document after both are
+	// normalized, so formatting, commas and comments don't matter.
+	Query string `json:"query"`
+	// Variables must all be present in the request with equal JSON values.
+	// Other request variables are ignored.
+	Variables map[string]any `json:"variables"`
+}
+
+// GraphQLError is an entry of a GraphQL response's errors list.
+type GraphQLError struct {
+	Message    string         `json:"message"`
+	Path       []any          `json:"path,omitempty"`
+	Extensions map[string]any `json:"extensions,omitempty"`
+}
+
+type graphQLRequest struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+// MatchGraphQL matches GraphQL requests, sent as a JSON POST body or as GET
+// query parameters, selected by m.
+func MatchGraphQL(m GraphQLMatch) Matcher {
+	query := normalizeGraphQL(m.Query)
+
+	// round-trip so Go values compare equal to decoded JSON
+	var variables map[string]any
+	if raw, err := json.Marshal(m.Variables); err == nil {
+		_ = json.Unmarshal(raw, &variables)
+	}
+
+	return func(r *http.Request) bool {
+		req, ok := readGraphQLRequest(r)
+		if !ok {
+			return false
+		}
+		if m.OperationName != "" && req.operationName() != m.OperationName {
+			return false
+		}
+		if query != "" && normalizeGraphQL(req.Query) != query {
+			return false
+		}
+		for k, want := range variables {
+			got, ok := req.Variables[k]
+			if !ok || !reflect.DeepEqual(want, got) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func readGraphQLRequest(r *http.Request) (graphQLRequest, bool) {
+	var req graphQLRequest
+	if r.Method == http.MethodGet {
+		q := r.URL.Query()
+		req.Query, req.OperationName = q.Get("query"), q.Get("operationName")
+		if v := q.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				return req, false
+			}
+		}
+		return req, req.Query != ""
+	}
+
+	if err := json.Unmarshal(peekBody(r), &req); err != nil {
+		return req, false
+	}
+	return req, req.Query != ""
+}
+
+var graphQLOperationRE = regexp.MustCompile(`^(?:query|mutation|subscription)\s+([_A-Za-z][_0-9A-Za-z]*)`)
+
+func (req graphQLRequest) operationName() string {
+	if req.OperationName != "" {
+		return req.OperationName
+	}
+	if m := graphQLOperationRE.FindStringSubmatch(normalizeGraphQL(req.Query)); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// normalizeGraphQL drops comments, commas and whitespace that doesn't
+// separate two names, keeping string literals intact.
+func normalizeGraphQL(doc string) string {
+	var (
+		b       strings.Builder
+		pending bool // whitespace seen since the last token
+		prev    byte
+	)
+	isName := func(c byte) bool {
+		return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+	}
+
+	for i := 0; i < len(doc); i++ {
+		c := doc[i]
+		switch {
+		case c == '#':
+			for i < len(doc) && doc[i] != '\n' {
+				i++
+			}
+			pending = true
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			pending = true
+		case c == '"':
+			j := i + 1
+			for j < len(doc) && doc[j] != '"' {
+				if doc[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			j = min(j, len(doc)-1)
+			if pending && isName(prev) {
+				b.WriteByte(' ')
+			}
+			b.WriteString(doc[i : j+1])
+			i, prev, pending = j, '"', false
+		default:
+			if pending && isName(prev) && (isName(c) || c == '$') {
+				b.WriteByte(' ')
+			}
+			b.WriteByte(c)
+			prev, pending = c, false
+		}
+	}
+	return b.String()
+}
+
+// GraphQLResponse returns a handler answering 200 with a GraphQL response
+// carrying data and errs. data is omitted when nil.
+func GraphQLResponse(data any, errs ...GraphQLError) http.HandlerFunc {
+	resp := make(map[string]any)
+	if data != nil {
+		resp["data"] = data
+	}
+	if len(errs) > 0 {
+		resp["errors"] = errs
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, resp)
+	}
+}
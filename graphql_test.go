@@ -0,0 +1,137 @@
+package stubsrv
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeGraphQL(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		given    string
+		expected string
+	}{
+		{
+			name: "whitespace, commas and comments",
+			given: `
+				# fetch a user
+				query GetUser($id: ID!, $full: Boolean) {
+					user(id: $id) { id, name }
+				}`,
+			expected: `query GetUser($id:ID!$full:Boolean){user(id:$id){id name}}`,
+		},
+		{
+			name:     "string literals are kept",
+			given:    `{ search(text: "a,  b # c \" d") { id } }`,
+			expected: `{search(text:"a,  b # c \" d"){id}}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tc.expected, normalizeGraphQL(tc.given))
+		})
+	}
+}
+
+func TestStub_MatchGraphQL(t *testing.T) {
+	t.Parallel()
+
+	stub := NewStub(noopLogger())
+	stub.When(Post("/graphql")).
+		WithGraphQL(GraphQLMatch{OperationName: "GetUser", Variables: map[string]any{"id": 1}}).
+		Reply(http.StatusOK).JSON(map[string]any{"data": map[string]any{"user": map[string]any{"name": "alice"}}})
+	stub.AddMatchedHandler(http.MethodPost, "/graphql",
+		[]Matcher{MatchGraphQL(GraphQLMatch{Query: "mutation { deleteUser(id: 1) { id } }"})},
+		GraphQLResponse(nil, GraphQLError{Message: "forbidden", Path: []any{"deleteUser"}}))
+	stub.AddMatchedHandler(http.MethodGet, "/graphql",
+		[]Matcher{MatchGraphQL(GraphQLMatch{OperationName: "Ping"})},
+		GraphQLResponse(map[string]any{"ping": "pong"}))
+	require.NoError(t, stub.Start())
+	t.Cleanup(stub.Close)
+
+	controlAdd(t, stub, `{"method":"POST","path":"/graphql","match_graphql":{"operation_name":"ListUsers"},"body":"{\"data\":{\"users\":[]}}"}`)
+
+	testCases := []struct {
+		name           string
+		givenMethod    string
+		givenBody      string
+		givenQuery     url.Values
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "operation name and variables",
+			givenMethod:    http.MethodPost,
+			givenBody:      `{"operationName":"GetUser","query":"query GetUser($id: Int) { user(id: $id) { name } }","variables":{"id":1,"extra":true}}`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"data":{"user":{"name":"alice"}}}`,
+		},
+		{
+			name:           "operation name from the document",
+			givenMethod:    http.MethodPost,
+			givenBody:      `{"query":"query GetUser($id: Int) { user(id: $id) { name } }","variables":{"id":1}}`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"data":{"user":{"name":"alice"}}}`,
+		},
+		{
+			name:           "variables differ",
+			givenMethod:    http.MethodPost,
+			givenBody:      `{"operationName":"GetUser","query":"query GetUser { user { name } }","variables":{"id":2}}`,
+			expectedStatus: http.StatusMethodNotAllowed, // the GET route matches the path
+		},
+		{
+			name:           "normalized query with errors",
+			givenMethod:    http.MethodPost,
+			givenBody:      `{"query":"mutation {\n  deleteUser(id: 1) {\n    id\n  }\n}"}`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"errors":[{"message":"forbidden","path":["deleteUser"]}]}`,
+		},
+		{
+			name:           "spec",
+			givenMethod:    http.MethodPost,
+			givenBody:      `{"query":"query ListUsers { users { id } }"}`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"data":{"users":[]}}`,
+		},
+		{
+			name:           "GET",
+			givenMethod:    http.MethodGet,
+			givenQuery:     url.Values{"query": {"query Ping { ping }"}},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"data":{"ping":"pong"}}`,
+		},
+		{
+			name:           "not GraphQL",
+			givenMethod:    http.MethodPost,
+			givenBody:      `{"operationName":"GetUser"}`,
+			expectedStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			req, err := http.NewRequest(tc.givenMethod, stub.URL()+"/graphql?"+tc.givenQuery.Encode(), strings.NewReader(tc.givenBody))
+			require.NoError(t, err)
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, tc.expectedStatus, resp.StatusCode)
+			if tc.expectedBody != "" {
+				assert.JSONEq(t, tc.expectedBody, readAll(t, resp))
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package stubsrv
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// gRPC status codes, see https://grpc.github.io/grpc/core/md_doc_statuscodes.html.
+const (
+	GRPCOK                 = 0
+	GRPCInvalidArgument    = 3
+	GRPCNotFound           = 5
+	GRPCAlreadyExists      = 6
+	GRPCPermissionDenied   = 7
+	GRPCResourceExhausted  = 8
+	GRPCFailedPrecondition = 9
+	GRPCUnimplemented      = 12
+	GRPCInternal           = 13
+	GRPCUnavailable        = 14
+	GRPCUnauthenticated    = 16
+)
+
+// grpcMaxMessageSize caps a request message, as grpc-go servers do by
+// default.
+const grpcMaxMessageSize = 4 << 20
+
+var errGRPCMessageTooLarge = errors.New("message too large")
+
+// GRPCStatus is a non-OK gRPC status. Return it from a GRPCHandler to fail
+// the call.
+type GRPCStatus struct {
+	Code    int
+	Message string
+}
+
+func (st *GRPCStatus) Error() string {
+	return fmt.Sprintf("grpc status %d: %s", st.Code, st.Message)
+}
+
+// GRPCHandler answers a unary call. req and the returned message are the
+// encoded messages, protobuf or JSON depending on the content subtype the
+// client chose. A *GRPCStatus error sets the call's status; any other error
+// answers with GRPCInternal.
+type GRPCHandler func(req []byte) ([]byte, error)
+
+// WithGRPC serves gRPC routes over unencrypted HTTP/2 on a second listener
+// bound to port, or a random port when it is empty. See GRPCAddr.
+func WithGRPC(port string) Option {
+	return func(cfg *stubConfig) {
+		cfg.grpc = true
+		cfg.grpcPort = port
+	}
+}
+
+// AddGRPC registers a unary gRPC method, named as in /package.Service/Method,
+// answered by fn. Calls are recorded in the journal as POST requests on that
+// path. It requires WithGRPC.
+func (s *Stub) AddGRPC(fullMethod string, fn GRPCHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		panic("cannot add handlers on a closed stub server")
+	}
+	if !s.grpc {
+		panic("gRPC routes require WithGRPC")
+	}
+	s.grpcMethods["/"+strings.TrimPrefix(fullMethod, "/")] = fn
+}
+
+// AddGRPCResponse registers a unary gRPC method answering every call with
+// the encoded message msg.
+func (s *Stub) AddGRPCResponse(fullMethod string, msg []byte) {
+	s.AddGRPC(fullMethod, func([]byte) ([]byte, error) { return msg, nil })
+}
+
+// AddGRPCError registers a unary gRPC method failing every call with code
+// and message.
+func (s *Stub) AddGRPCError(fullMethod string, code int, message string) {
+	s.AddGRPC(fullMethod, func([]byte) ([]byte, error) {
+		return nil, &GRPCStatus{Code: code, Message: message}
+	})
+}
+
+// GRPCAddr returns the host:port gRPC clients dial, or "" when the stub is
+// not running or WithGRPC was not set.
+func (s *Stub) GRPCAddr() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.grpcServer == nil || s.closed {
+		return ""
+	}
+	return s.grpcAddr
+}
+
+// startGRPC brings up the gRPC listener. Callers must hold s.mu.
+func (s *Stub) startGRPC() error {
+	listenAddr := net.JoinHostPort("", s.grpcPort)
+	ln, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		return fmt.Errorf("could not listen for gRPC on %s: %w", listenAddr, err)
+	}
+
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	s.grpcServer = &http.Server{Handler: http.HandlerFunc(s.serveGRPC), Protocols: &protocols}
+
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	s.grpcAddr = net.JoinHostPort("127.0.0.1", port)
+
+	go func() { _ = s.grpcServer.Serve(ln) }()
+	return nil
+}
+
+func (s *Stub) serveGRPC(w http.ResponseWriter, r *http.Request) {
+	contentType := r.Header.Get("Content-Type")
+	if r.Method != http.MethodPost || !strings.HasPrefix(contentType, "application/grpc") {
+		http.Error(w, "gRPC requests must be POSTs with an application/grpc content type", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+
+	// the journal reads the whole body, so bound it by the largest message
+	// and its prefix first
+	r.Body = http.MaxBytesReader(w, r.Body, grpcMaxMessageSize+5)
+	s.journal.record(r)
+
+	s.mu.RLock()
+	fn, ok := s.grpcMethods[r.URL.Path]
+	s.mu.RUnlock()
+
+	if !ok {
+		writeGRPCStatus(w, GRPCUnimplemented, "unknown method "+r.URL.Path)
+		return
+	}
+
+	req, err := readGRPCMessage(r.Body)
+	if errors.Is(err, errGRPCMessageTooLarge) {
+		writeGRPCStatus(w, GRPCResourceExhausted, err.Error())
+		return
+	}
+	if err != nil {
+		writeGRPCStatus(w, GRPCInternal, err.Error())
+		return
+	}
+
+	resp, err := fn(req)
+	if err != nil {
+		var st *GRPCStatus
+		if !errors.As(err, &st) {
+			st = &GRPCStatus{Code: GRPCInternal, Message: err.Error()}
+		}
+		writeGRPCStatus(w, st.Code, st.Message)
+		return
+	}
+
+	frame := binary.BigEndian.AppendUint32([]byte{0}, uint32(len(resp)))
+	_, _ = w.Write(append(frame, resp...))
+	writeGRPCStatus(w, GRPCOK, "")
+}
+
+// readGRPCMessage reads the single length-prefixed message of a unary call.
+func readGRPCMessage(body io.Reader) ([]byte, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(body, prefix[:]); err != nil {
+		return nil, fmt.Errorf("could not read message: %w", err)
+	}
+	if prefix[0] != 0 {
+		return nil, errors.New("compressed messages are not supported")
+	}
+
+	n := binary.BigEndian.Uint32(prefix[1:])
+	if n > grpcMaxMessageSize {
+		return nil, errGRPCMessageTooLarge
+	}
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(body, msg); err != nil {
+		return nil, fmt.Errorf("could not read message: %w", err)
+	}
+	return msg, nil
+}
+
+func writeGRPCStatus(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	if message != "" {
+		// grpc-message is percent-encoded
+		w.Header().Set("Grpc-Message", url.PathEscape(message))
+	}
+}
@@ -0,0 +1,137 @@
+package stubsrv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStub_AddGRPC(t *testing.T) {
+	t.Parallel()
+
+	stub := NewStub(noopLogger(), WithGRPC(""))
+	stub.AddGRPCResponse("/users.v1.Users/Get", []byte(`{"id":"1","name":"alice"}`))
+	stub.AddGRPCError("users.v1.Users/Delete", GRPCPermissionDenied, "admins only")
+	stub.AddGRPC("/users.v1.Users/Echo", func(req []byte) ([]byte, error) {
+		if len(req) == 0 {
+			return nil, errors.New("empty request")
+		}
+		return req, nil
+	})
+	require.NoError(t, stub.Start())
+	t.Cleanup(stub.Close)
+
+	testCases := []struct {
+		name            string
+		givenMethod     string
+		givenMessage    string
+		expectedMessage string
+		expectedStatus  string
+		expectedError   string
+	}{
+		{name: "canned response", givenMethod: "/users.v1.Users/Get", givenMessage: `{"id":"1"}`, expectedMessage: `{"id":"1","name":"alice"}`, expectedStatus: "0"},
+		{name: "handler", givenMethod: "/users.v1.Users/Echo", givenMessage: "ping", expectedMessage: "ping", expectedStatus: "0"},
+		{name: "canned error", givenMethod: "/users.v1.Users/Delete", givenMessage: "{}", expectedStatus: "7", expectedError: "admins%20only"},
+		{name: "handler error", givenMethod: "/users.v1.Users/Echo", expectedStatus: "13", expectedError: "empty%20request"},
+		{name: "unknown method", givenMethod: "/users.v1.Users/List", givenMessage: "{}", expectedStatus: "12", expectedError: "unknown%20method%20%2Fusers.v1.Users%2FList"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			msg, trailer := grpcCall(t, stub.GRPCAddr(), tc.givenMethod, tc.givenMessage)
+			assert.Equal(t, tc.expectedMessage, msg)
+			assert.Equal(t, tc.expectedStatus, trailer.Get("Grpc-Status"))
+			assert.Equal(t, tc.expectedError, trailer.Get("Grpc-Message"))
+		})
+	}
+
+	t.Run("calls are journaled", func(t *testing.T) {
+		t.Parallel()
+
+		grpcCall(t, stub.GRPCAddr(), "/users.v1.Users/Get", "{}")
+		stub.AssertCalled(t, http.MethodPost, "/users.v1.Users/Get")
+	})
+
+	t.Run("oversized message", func(t *testing.T) {
+		t.Parallel()
+
+		stub := NewStub(noopLogger(), WithGRPC(""))
+		stub.AddGRPCResponse("/files.v1.Files/Upload", nil)
+		require.NoError(t, stub.Start())
+		defer stub.Close()
+
+		_, trailer := grpcCall(t, stub.GRPCAddr(), "/files.v1.Files/Upload", strings.Repeat("a", grpcMaxMessageSize+1))
+		assert.Equal(t, "8", trailer.Get("Grpc-Status"))
+		assert.Equal(t, "message%20too%20large", trailer.Get("Grpc-Message"))
+
+		requests := stub.Requests()
+		require.Len(t, requests, 1)
+		assert.Len(t, requests[0].Body, grpcMaxMessageSize+5, "the journal reads no further than the limit")
+	})
+
+	t.Run("requires WithGRPC", func(t *testing.T) {
+		t.Parallel()
+
+		plain := NewStub(noopLogger())
+		assert.Panics(t, func() { plain.AddGRPCResponse("/a.B/C", nil) })
+		assert.Empty(t, plain.GRPCAddr())
+	})
+}
+
+// grpcCall makes a unary call over h2c with the JSON content subtype.
+func grpcCall(t *testing.T, addr, method, msg string) (string, http.Header) {
+	t.Helper()
+
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	client := &http.Client{Transport: &http.Transport{Protocols: &protocols}}
+
+	body := binary.BigEndian.AppendUint32([]byte{0}, uint32(len(msg)))
+	req, err := http.NewRequest(http.MethodPost, "http://"+addr+method, bytes.NewReader(append(body, msg...)))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/grpc+json")
+	req.Header.Set("TE", "trailers")
+
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, 2, resp.ProtoMajor)
+	assert.Equal(t, "application/grpc+json", resp.Header.Get("Content-Type"))
+
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	if len(data) == 0 {
+		return "", resp.Trailer
+	}
+	require.GreaterOrEqual(t, len(data), 5)
+	require.Equal(t, int(binary.BigEndian.Uint32(data[1:5])), len(data)-5)
+	return string(data[5:]), resp.Trailer
+}
+
+func TestReadGRPCMessage(t *testing.T) {
+	t.Parallel()
+
+	frame := func(n uint32, msg []byte) io.Reader {
+		prefix := binary.BigEndian.AppendUint32([]byte{0}, n)
+		return bytes.NewReader(append(prefix, msg...))
+	}
+
+	msg, err := readGRPCMessage(frame(3, []byte("abc")))
+	require.NoError(t, err)
+	assert.Equal(t, "abc", string(msg))
+
+	_, err = readGRPCMessage(frame(grpcMaxMessageSize+1, nil))
+	require.Error(t, err)
+	assert.ErrorIs(t, err, errGRPCMessageTooLarge)
+}
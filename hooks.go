@@ -0,0 +1,41 @@
+package stubsrv
+
+type hooks struct {
+	start []func(url string)
+	stop  []func()
+	route []func(HandlerInfo)
+}
+
+func (h hooks) routeRegistered(info HandlerInfo) {
+	for _, fn := range h.route {
+		fn(info)
+	}
+}
+
+// OnStart registers fn to be called with the stub's URL once Start has
+// brought the listener up, e.g. to seed state or announce the URL.
+func (s *Stub) OnStart(fn func(url string)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.hooks.start = append(s.hooks.start, fn)
+}
+
+// OnStop registers fn to be called by Close before the listener goes down,
+// so it can still reach the stub. It is not called if the stub never started.
+func (s *Stub) OnStop(fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.hooks.stop = append(s.hooks.stop, fn)
+}
+
+// OnRouteRegistered registers fn to be called for every route added from
+// then on, through the Go API or the control plane. fn runs while the stub
+// is locked, so it must not call back into the stub.
+func (s *Stub) OnRouteRegistered(fn func(HandlerInfo)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.hooks.route = append(s.hooks.route, fn)
+}
@@ -0,0 +1,48 @@
+package stubsrv
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStub_LifecycleHooks(t *testing.T) {
+	t.Parallel()
+
+	stub := NewStub(noopLogger())
+
+	var (
+		events []string
+		routes []HandlerInfo
+	)
+	stub.OnStart(func(url string) {
+		events = append(events, "start "+url)
+		stub.AddHandler(http.MethodGet, "/seeded", func(w http.ResponseWriter, r *http.Request) {})
+	})
+	stub.OnStop(func() {
+		resp, err := http.Get(stub.URL() + "/readyz")
+		if assert.NoError(t, err, "the stub still serves during OnStop") {
+			resp.Body.Close()
+		}
+		events = append(events, "stop")
+	})
+	stub.OnRouteRegistered(func(info HandlerInfo) {
+		routes = append(routes, info)
+	})
+
+	require.NoError(t, stub.Start())
+	url := stub.URL()
+	controlAdd(t, stub, `{"method":"get","path":"/users/:id"}`)
+
+	stub.Close()
+	stub.Close()
+
+	assert.Equal(t, []string{"start " + url, "stop"}, events)
+	require.Len(t, routes, 2)
+	assert.Equal(t, "/seeded", routes[0].Path)
+	assert.Equal(t, "GET", routes[1].Method)
+	assert.Equal(t, "/users/:id", routes[1].Path)
+	require.NotNil(t, routes[1].Spec)
+}
@@ -0,0 +1,101 @@
+package stubsrv
+
+import (
+	"net/http"
+	"runtime/debug"
+	"time"
+)
+
+const modulePath = "github.com/alesr/stubsrv"
+
+// Source describes where a batch of routes was loaded from.
+type Source struct {
+	Kind   string `json:"kind"`
+	Name   string `json:"name,omitempty"`
+	Routes int    `json:"routes"`
+}
+
+// Info is the stub's self-description served on GET /_control/info.
+type Info struct {
+	Version  string         `json:"version"`
+	Features []string       `json:"features"`
+	Sources  []Source       `json:"sources"`
+	Uptime   string         `json:"uptime"`
+	Routes   map[string]int `json:"routes"`
+}
+
+// addSource records a loaded batch of routes for /_control/info.
+func (s *Stub) addSource(src Source) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sources = append(s.sources, src)
+}
+
+// Info describes the stub's version, configuration and routes.
+func (s *Stub) Info() Info {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info := Info{
+		Version:  moduleVersion(),
+		Features: []string{},
+		Sources:  append([]Source{}, s.sources...),
+		Routes: map[string]int{
+			"exact":    len(s.routers),
+			"template": len(s.templateRoutes),
+			"total":    len(s.routers) + len(s.templateRoutes),
+		},
+	}
+	if !s.started.IsZero() {
+		info.Uptime = time.Since(s.started).Round(time.Millisecond).String()
+	}
+
+	for _, f := range []struct {
+		name    string
+		enabled bool
+	}{
+		{"tls", s.tls},
+		{"gateway", s.gateway != nil},
+		{"strict", s.strict},
+		{"proxy", s.proxy != nil},
+		{"global_middleware", len(s.middlewares) > 0},
+		{"dependencies", len(s.dependencies) > 0},
+		{"discovery", len(s.registrars) > 0},
+		{"grpc", s.grpc},
+		{"limits", s.journal.limits.Policy != ""},
+		{"watch_config", s.watchConfig},
+		{"custom_router", s.router != nil},
+		{"not_found_diagnostics", s.diagnostics},
+		{"client_deadlines", s.deadlines},
+	} {
+		if f.enabled {
+			info.Features = append(info.Features, f.name)
+		}
+	}
+	return info
+}
+
+func moduleVersion() string {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	if bi.Main.Path == modulePath {
+		return bi.Main.Version
+	}
+	for _, dep := range bi.Deps {
+		if dep.Path == modulePath {
+			return dep.Version
+		}
+	}
+	return "(devel)"
+}
+
+func (s *Stub) controlInfo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.Info())
+}
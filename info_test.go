@@ -0,0 +1,44 @@
+package stubsrv
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStub_ControlInfo(t *testing.T) {
+	t.Parallel()
+
+	stub := NewStub(noopLogger(), WithStrictMode())
+	require.NoError(t, stub.Start())
+	defer stub.Close()
+
+	stub.AddHandler(http.MethodGet, "/health", func(w http.ResponseWriter, r *http.Request) {})
+	_, err := stub.LoadSpecs("generated", "pets", func() ([]DynamicHandlerSpec, error) {
+		return []DynamicHandlerSpec{
+			{Method: http.MethodGet, Path: "/pets", Status: http.StatusOK},
+			{Method: http.MethodGet, Path: "/pets/:id", Status: http.StatusOK},
+		}, nil
+	})
+	require.NoError(t, err)
+
+	var info Info
+	controlDo(t, stub, http.MethodGet, "/_control/info", "", http.StatusOK, &info)
+
+	assert.NotEmpty(t, info.Version)
+	assert.NotEmpty(t, info.Uptime)
+	assert.Equal(t, []string{"strict"}, info.Features)
+	require.Len(t, info.Sources, 1)
+	assert.Equal(t, Source{Kind: "generated", Name: "pets", Routes: 2}, info.Sources[0])
+	assert.Equal(t, info.Sources[0].Routes+1, info.Routes["total"])
+	assert.Equal(t, info.Routes["exact"]+info.Routes["template"], info.Routes["total"])
+
+	stub.Reset()
+	controlDo(t, stub, http.MethodGet, "/_control/info", "", http.StatusOK, &info)
+	assert.Empty(t, info.Sources)
+	assert.Equal(t, 0, info.Routes["total"])
+
+	controlDo(t, stub, http.MethodPost, "/_control/info", "", http.StatusMethodNotAllowed, nil)
+}
@@ -0,0 +1,44 @@
+// Package stubtest holds the test helpers shared by the packages that build
+// on stubsrv.
+package stubtest
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/alesr/stubsrv"
+	"github.com/stretchr/testify/require"
+)
+
+// New returns a started stub that is closed when the test ends. register,
+// when not nil, runs before the stub starts, e.g. to mount a package on it.
+func New(t *testing.T, register func(*stubsrv.Stub)) *stubsrv.Stub {
+	t.Helper()
+
+	stub := stubsrv.NewStub(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if register != nil {
+		register(stub)
+	}
+	require.NoError(t, stub.Start())
+	t.Cleanup(stub.Close)
+	return stub
+}
+
+// Do sends a request with body and returns the response along with its
+// body, already read and closed.
+func Do(t *testing.T, method, url, body string) (*http.Response, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	got, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, string(got)
+}
@@ -0,0 +1,184 @@
+package stubsrv
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+type RecordedRequest struct {
+	Method string      `json:"method"`
+	Path   string      `json:"path"`
+	Query  url.Values  `json:"query"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+	// Truncated reports whether Body was cut to Limits.MaxBodyCapture.
+	Truncated bool      `json:"truncated"`
+	Time      time.Time `json:"time"`
+}
+
+type journal struct {
+	mu              sync.Mutex
+	entries         []RecordedRequest
+	unexpected      []RecordedRequest
+	limits          Limits
+	bytes           int64
+	unexpectedBytes int64
+	evicted         int
+	rejected        int
+}
+
+// record captures r and rewinds its body so handlers can still read it. It
+// reports false when the limits reject the request, which is then served
+// without being journaled.
+func (j *journal) record(r *http.Request) (RecordedRequest, bool) {
+	body := peekBody(r)
+
+	rec := RecordedRequest{
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Query:  r.URL.Query(),
+		Header: r.Header.Clone(),
+		Body:   body,
+		Time:   time.Now(),
+	}
+	if limit := j.limits.MaxBodyCapture; limit > 0 && int64(len(body)) > limit {
+		rec.Body, rec.Truncated = bytes.Clone(body[:limit]), true
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var evicted int
+	var ok bool
+	j.entries, j.bytes, evicted, ok = appendLimited(j.limits, j.entries, j.bytes, rec, recordedSize)
+	j.evicted += evicted
+	if !ok {
+		j.rejected++
+	}
+	return rec, ok
+}
+
+func (j *journal) recordUnexpected(rec RecordedRequest) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.unexpected, j.unexpectedBytes, _, _ = appendLimited(j.limits, j.unexpected, j.unexpectedBytes, rec, recordedSize)
+}
+
+func recordedSize(rec RecordedRequest) int64 {
+	return int64(len(rec.Body))
+}
+
+func (j *journal) usage() JournalUsage {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return JournalUsage{Entries: len(j.entries), Bytes: j.bytes, Evicted: j.evicted, Rejected: j.rejected}
+}
+
+func (j *journal) allUnexpected() []RecordedRequest {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return append([]RecordedRequest(nil), j.unexpected...)
+}
+
+// peekBody reads r's body and rewinds it so it can be read again.
+func peekBody(r *http.Request) []byte {
+	if r.Body == nil {
+		return nil
+	}
+	body, _ := io.ReadAll(r.Body)
+	_ = r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return body
+}
+
+func (j *journal) reset() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.entries = nil
+	j.unexpected = nil
+	j.bytes, j.unexpectedBytes, j.evicted, j.rejected = 0, 0, 0, 0
+}
+
+func (j *journal) all() []RecordedRequest {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return append([]RecordedRequest(nil), j.entries...)
+}
+
+// Requests returns every request received by user routes, in arrival order.
+func (s *Stub) Requests() []RecordedRequest {
+	return s.journal.all()
+}
+
+// ClearRequests empties the request journal, keeping routes and other state.
+func (s *Stub) ClearRequests() {
+	s.journal.reset()
+}
+
+// controlRequests serves /_control/requests. GET lists the journal, filtered
+// by the optional method, path (possibly a template) and since (RFC 3339)
+// query parameters. DELETE clears it.
+func (s *Stub) controlRequests(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodDelete:
+		s.ClearRequests()
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	var since time.Time
+	if v := q.Get("since"); v != "" {
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			http.Error(w, "since must be an RFC 3339 timestamp", http.StatusBadRequest)
+			return
+		}
+		since = t
+	}
+	method := strings.ToUpper(q.Get("method"))
+	var segments []string
+	if path := q.Get("path"); path != "" {
+		segments = strings.Split(strings.Trim(path, "/"), "/")
+	}
+
+	recs := []RecordedRequest{}
+	for _, rec := range s.journal.all() {
+		if method != "" && rec.Method != method ||
+			segments != nil && !pathMatch(segments, rec.Path) ||
+			rec.Time.Before(since) {
+			continue
+		}
+		recs = append(recs, rec)
+	}
+	writeJSON(w, http.StatusOK, recs)
+}
+
+// RequestsFor returns the recorded requests matching method and path.
+// path may be a template such as /users/:id.
+func (s *Stub) RequestsFor(method, path string) []RecordedRequest {
+	upperMethod := strings.ToUpper(method)
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+
+	var matched []RecordedRequest
+	for _, rec := range s.journal.all() {
+		if rec.Method == upperMethod && pathMatch(segments, rec.Path) {
+			matched = append(matched, rec)
+		}
+	}
+	return matched
+}
@@ -0,0 +1,164 @@
+package stubsrv
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStub_Requests(t *testing.T) {
+	t.Parallel()
+
+	t.Run("records requests and keeps the body readable by handlers", func(t *testing.T) {
+		t.Parallel()
+
+		stub := NewStub(noopLogger())
+
+		var handlerBody string
+		stub.AddHandler(http.MethodPost, "/orders", func(w http.ResponseWriter, r *http.Request) {
+			b, _ := io.ReadAll(r.Body)
+			handlerBody = string(b)
+			w.WriteHeader(http.StatusCreated)
+		})
+		require.NoError(t, stub.Start())
+		defer stub.Close()
+
+		req, err := http.NewRequest(http.MethodPost, stub.URL()+"/orders?dry_run=1", strings.NewReader(`{"qty":2}`))
+		require.NoError(t, err)
+		req.Header.Set("X-Request-Id", "abc")
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		assert.Equal(t, `{"qty":2}`, handlerBody)
+
+		got := stub.Requests()
+		require.Len(t, got, 1)
+		assert.Equal(t, http.MethodPost, got[0].Method)
+		assert.Equal(t, "/orders", got[0].Path)
+		assert.Equal(t, "1", got[0].Query.Get("dry_run"))
+		assert.Equal(t, "abc", got[0].Header.Get("X-Request-Id"))
+		assert.Equal(t, `{"qty":2}`, string(got[0].Body))
+		assert.False(t, got[0].Time.IsZero())
+	})
+
+	t.Run("records unmatched requests but not control-plane calls", func(t *testing.T) {
+		t.Parallel()
+
+		stub := NewStub(noopLogger())
+		require.NoError(t, stub.Start())
+		defer stub.Close()
+
+		resp, err := http.Get(stub.URL() + "/missing")
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		resp, err = http.Get(stub.URL() + "/readyz")
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		got := stub.Requests()
+		require.Len(t, got, 1)
+		assert.Equal(t, "/missing", got[0].Path)
+	})
+}
+
+func TestStub_RequestsFor(t *testing.T) {
+	t.Parallel()
+
+	stub := NewStub(noopLogger())
+	stub.AddHandler(http.MethodGet, "/users/:id", func(w http.ResponseWriter, r *http.Request) {})
+	stub.AddHandler(http.MethodGet, "/health", func(w http.ResponseWriter, r *http.Request) {})
+	require.NoError(t, stub.Start())
+	defer stub.Close()
+
+	for _, p := range []string{"/users/1", "/users/2", "/health"} {
+		resp, err := http.Get(stub.URL() + p)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	testCases := []struct {
+		name          string
+		givenMethod   string
+		givenPath     string
+		expectedPaths []string
+	}{
+		{name: "exact path", givenMethod: http.MethodGet, givenPath: "/users/2", expectedPaths: []string{"/users/2"}},
+		{name: "template path", givenMethod: http.MethodGet, givenPath: "/users/:id", expectedPaths: []string{"/users/1", "/users/2"}},
+		{name: "method is case-insensitive", givenMethod: "get", givenPath: "/health", expectedPaths: []string{"/health"}},
+		{name: "method mismatch", givenMethod: http.MethodPost, givenPath: "/health", expectedPaths: nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var got []string
+			for _, rec := range stub.RequestsFor(tc.givenMethod, tc.givenPath) {
+				got = append(got, rec.Path)
+			}
+			assert.Equal(t, tc.expectedPaths, got)
+		})
+	}
+}
+
+func TestStub_ControlRequests(t *testing.T) {
+	t.Parallel()
+
+	stub := NewStub(noopLogger())
+	require.NoError(t, stub.Start())
+	defer stub.Close()
+
+	send := func(method, path string) {
+		req, err := http.NewRequest(method, stub.URL()+path, nil)
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	send(http.MethodGet, "/users/1")
+	since := time.Now()
+	send(http.MethodPost, "/users/2")
+	send(http.MethodGet, "/orders/3")
+
+	testCases := []struct {
+		name          string
+		givenQuery    string
+		expectedPaths []string
+	}{
+		{name: "no filter", givenQuery: "", expectedPaths: []string{"/users/1", "/users/2", "/orders/3"}},
+		{name: "method", givenQuery: "?method=get", expectedPaths: []string{"/users/1", "/orders/3"}},
+		{name: "path template", givenQuery: "?path=/users/:id", expectedPaths: []string{"/users/1", "/users/2"}},
+		{name: "since", givenQuery: "?since=" + url.QueryEscape(since.Format(time.RFC3339Nano)), expectedPaths: []string{"/users/2", "/orders/3"}},
+		{name: "combined", givenQuery: "?method=GET&path=/users/:id", expectedPaths: []string{"/users/1"}},
+		{name: "no match", givenQuery: "?method=PUT", expectedPaths: []string{}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []RecordedRequest
+			controlDo(t, stub, http.MethodGet, "/_control/requests"+tc.givenQuery, "", http.StatusOK, &got)
+
+			paths := []string{}
+			for _, rec := range got {
+				paths = append(paths, rec.Path)
+			}
+			assert.Equal(t, tc.expectedPaths, paths)
+		})
+	}
+
+	controlDo(t, stub, http.MethodGet, "/_control/requests?since=yesterday", "", http.StatusBadRequest, nil)
+	controlDo(t, stub, http.MethodPut, "/_control/requests", "", http.StatusMethodNotAllowed, nil)
+
+	controlDo(t, stub, http.MethodDelete, "/_control/requests", "", http.StatusNoContent, nil)
+	assert.Empty(t, stub.Requests())
+}
@@ -0,0 +1,577 @@
+// Package kube emulates the core Kubernetes API conventions on top of a stub:
+// group/version discovery, CRUD on unstructured objects, and list/watch with
+// resourceVersion semantics including 410 Gone for compacted history.
+package kube
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/alesr/stubsrv"
+)
+
+type Resource struct {
+	// Group is empty for the core API group.
+	Group      string
+	Version    string
+	Kind       string
+	Plural     string
+	Namespaced bool
+}
+
+func (r Resource) groupVersion() string {
+	if r.Group == "" {
+		return r.Version
+	}
+	return r.Group + "/" + r.Version
+}
+
+func (r Resource) basePath() string {
+	if r.Group == "" {
+		return "/api/" + r.Version
+	}
+	return "/apis/" + r.Group + "/" + r.Version
+}
+
+func (r Resource) key() string { return r.Plural + "." + r.groupVersion() }
+
+type EventType string
+
+const (
+	Added    EventType = "ADDED"
+	Modified EventType = "MODIFIED"
+	Deleted  EventType = "DELETED"
+)
+
+type Event struct {
+	Type   EventType      `json:"type"`
+	Object map[string]any `json:"object"`
+}
+
+type event struct {
+	Event
+	rv       int64
+	resource string
+	ns       string
+}
+
+type Server struct {
+	stub        *stubsrv.Stub
+	mu          sync.Mutex
+	resources   []Resource
+	objects     map[string]map[string]map[string]any
+	rv          int64
+	history     []event
+	compactedRV int64
+	watchers    map[chan event]struct{}
+}
+
+// New registers the discovery endpoints on the stub. Resources are served
+// once added with AddResource.
+func New(stub *stubsrv.Stub) *Server {
+	s := Server{
+		stub:     stub,
+		objects:  make(map[string]map[string]map[string]any),
+		watchers: make(map[chan event]struct{}),
+	}
+
+	stub.AddHandler(http.MethodGet, "/api", s.handleCoreVersions)
+	stub.AddHandler(http.MethodGet, "/apis", s.handleGroups)
+	return &s
+}
+
+// AddResource registers list/watch/create and get/update/delete routes for res.
+func (s *Server) AddResource(res Resource) {
+	s.mu.Lock()
+	s.resources = append(s.resources, res)
+	s.objects[res.key()] = make(map[string]map[string]any)
+	s.mu.Unlock()
+
+	stub := s.stub
+	base := res.basePath()
+	stub.AddHandler(http.MethodGet, base, s.handleResourceList(res.groupVersion()))
+
+	collection := base + "/" + res.Plural
+	if res.Namespaced {
+		// list and watch across all namespaces
+		stub.AddHandler(http.MethodGet, collection, s.handleCollection(res))
+		collection = base + "/namespaces/:namespace/" + res.Plural
+	}
+	item := collection + "/:name"
+
+	stub.AddHandler(http.MethodGet, collection, s.handleCollection(res))
+	stub.AddHandler(http.MethodPost, collection, s.handleCreate(res))
+	stub.AddHandler(http.MethodGet, item, s.handleGet(res))
+	stub.AddHandler(http.MethodPut, item, s.handleUpdate(res))
+	stub.AddHandler(http.MethodDelete, item, s.handleDelete(res))
+}
+
+// Create stores obj as if it had been POSTed, emitting an ADDED event.
+func (s *Server) Create(res Resource, obj map[string]any) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.create(res, objectNamespace(obj), obj); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Compact drops the event history, so watches from any resourceVersion older
+// than the current one answer 410 Gone and clients must relist.
+func (s *Server) Compact() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.history = nil
+	s.compactedRV = s.rv
+}
+
+func (s *Server) create(res Resource, ns string, obj map[string]any) (map[string]any, *apiError) {
+	name := objectName(obj)
+	if name == "" {
+		return nil, &apiError{http.StatusUnprocessableEntity, "Invalid", "metadata.name is required"}
+	}
+
+	store := s.objects[res.key()]
+	key := ns + "/" + name
+	if _, ok := store[key]; ok {
+		return nil, &apiError{http.StatusConflict, "AlreadyExists", fmt.Sprintf("%s %q already exists", res.Plural, name)}
+	}
+
+	obj = s.stamp(res, ns, obj)
+	store[key] = obj
+	s.emit(res, ns, Added, obj)
+	return obj, nil
+}
+
+// stamp returns a copy of obj with the next resourceVersion. Stored objects
+// are shared with the event history and encoded outside s.mu, so they are
+// never modified once stamped.
+func (s *Server) stamp(res Resource, ns string, obj map[string]any) map[string]any {
+	s.rv++
+	obj = deepCopy(obj).(map[string]any)
+	meta := objectMeta(obj)
+	meta["resourceVersion"] = strconv.FormatInt(s.rv, 10)
+	if res.Namespaced {
+		meta["namespace"] = ns
+	}
+	obj["metadata"] = meta
+	obj["apiVersion"] = res.groupVersion()
+	obj["kind"] = res.Kind
+	return obj
+}
+
+func (s *Server) emit(res Resource, ns string, typ EventType, obj map[string]any) {
+	ev := event{
+		Event:    Event{Type: typ, Object: obj},
+		rv:       s.rv,
+		resource: res.key(),
+		ns:       ns,
+	}
+	s.history = append(s.history, ev)
+	for ch := range s.watchers {
+		select {
+		case ch <- ev:
+		default:
+			// slow watcher, drop it like the apiserver would
+			delete(s.watchers, ch)
+			close(ch)
+		}
+	}
+}
+
+func (s *Server) handleCoreVersions(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	var versions []string
+	for _, res := range s.resources {
+		if res.Group == "" && !slices.Contains(versions, res.Version) {
+			versions = append(versions, res.Version)
+		}
+	}
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"kind":     "APIVersions",
+		"versions": versions,
+	})
+}
+
+func (s *Server) handleGroups(w http.ResponseWriter, r *http.Request) {
+	type groupVersion struct {
+		GroupVersion string `json:"groupVersion"`
+		Version      string `json:"version"`
+	}
+	type group struct {
+		Name             string         `json:"name"`
+		Versions         []groupVersion `json:"versions"`
+		PreferredVersion groupVersion   `json:"preferredVersion"`
+	}
+
+	s.mu.Lock()
+	var groups []group
+	for _, res := range s.resources {
+		if res.Group == "" {
+			continue
+		}
+		gv := groupVersion{GroupVersion: res.groupVersion(), Version: res.Version}
+		i := slices.IndexFunc(groups, func(g group) bool { return g.Name == res.Group })
+		if i < 0 {
+			groups = append(groups, group{Name: res.Group, PreferredVersion: gv})
+			i = len(groups) - 1
+		}
+		if !slices.Contains(groups[i].Versions, gv) {
+			groups[i].Versions = append(groups[i].Versions, gv)
+		}
+	}
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"kind":       "APIGroupList",
+		"apiVersion": "v1",
+		"groups":     groups,
+	})
+}
+
+func (s *Server) handleResourceList(gv string) http.HandlerFunc {
+	type apiResource struct {
+		Name       string   `json:"name"`
+		Namespaced bool     `json:"namespaced"`
+		Kind       string   `json:"kind"`
+		Verbs      []string `json:"verbs"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		var list []apiResource
+		for _, res := range s.resources {
+			if res.groupVersion() != gv {
+				continue
+			}
+			list = append(list, apiResource{
+				Name:       res.Plural,
+				Namespaced: res.Namespaced,
+				Kind:       res.Kind,
+				Verbs:      []string{"create", "delete", "get", "list", "update", "watch"},
+			})
+		}
+		s.mu.Unlock()
+
+		writeJSON(w, http.StatusOK, map[string]any{
+			"kind":         "APIResourceList",
+			"apiVersion":   "v1",
+			"groupVersion": gv,
+			"resources":    list,
+		})
+	}
+}
+
+func (s *Server) handleCollection(res Resource) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ns := pathNamespace(r.URL.Path)
+
+		if watch := r.URL.Query().Get("watch"); watch == "true" || watch == "1" {
+			s.watch(w, r, res, ns)
+			return
+		}
+
+		s.mu.Lock()
+		items := s.list(res, ns)
+		rv := s.rv
+		s.mu.Unlock()
+
+		writeJSON(w, http.StatusOK, map[string]any{
+			"kind":       res.Kind + "List",
+			"apiVersion": res.groupVersion(),
+			"metadata":   map[string]any{"resourceVersion": strconv.FormatInt(rv, 10)},
+			"items":      items,
+		})
+	}
+}
+
+func (s *Server) list(res Resource, ns string) []map[string]any {
+	store := s.objects[res.key()]
+	keys := make([]string, 0, len(store))
+	for k := range store {
+		if ns == "" || strings.HasPrefix(k, ns+"/") {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+
+	items := make([]map[string]any, 0, len(keys))
+	for _, k := range keys {
+		items = append(items, store[k])
+	}
+	return items
+}
+
+func (s *Server) watch(w http.ResponseWriter, r *http.Request, res Resource, ns string) {
+	var fromRV int64
+	if v := r.URL.Query().Get("resourceVersion"); v != "" {
+		parsed, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			writeStatus(w, &apiError{http.StatusBadRequest, "BadRequest", "invalid resourceVersion " + v})
+			return
+		}
+		fromRV = parsed
+	}
+
+	s.mu.Lock()
+	if fromRV != 0 && fromRV < s.compactedRV {
+		s.mu.Unlock()
+		writeStatus(w, &apiError{http.StatusGone, "Expired", fmt.Sprintf("too old resource version: %d (%d)", fromRV, s.compactedRV)})
+		return
+	}
+
+	var backlog []Event
+	if fromRV == 0 {
+		// no resourceVersion: synthetic ADDED events for the current state
+		for _, obj := range s.list(res, ns) {
+			backlog = append(backlog, Event{Type: Added, Object: obj})
+		}
+	} else {
+		for _, ev := range s.history {
+			if ev.rv > fromRV && matches(ev, res, ns) {
+				backlog = append(backlog, ev.Event)
+			}
+		}
+	}
+
+	ch := make(chan event, 64)
+	s.watchers[ch] = struct{}{}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		if _, ok := s.watchers[ch]; ok {
+			delete(s.watchers, ch)
+			close(ch)
+		}
+		s.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+
+	for _, ev := range backlog {
+		_ = enc.Encode(ev)
+	}
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev, ok := <-ch:
+			if !ok {
+				return
+			}
+			if !matches(ev, res, ns) {
+				continue
+			}
+			if err := enc.Encode(ev.Event); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+func matches(ev event, res Resource, ns string) bool {
+	return ev.resource == res.key() && (ns == "" || ev.ns == ns)
+}
+
+func (s *Server) handleCreate(res Resource) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		obj, ok := decodeObject(w, r)
+		if !ok {
+			return
+		}
+
+		s.mu.Lock()
+		created, apiErr := s.create(res, pathNamespace(r.URL.Path), obj)
+		s.mu.Unlock()
+
+		if apiErr != nil {
+			writeStatus(w, apiErr)
+			return
+		}
+		writeJSON(w, http.StatusCreated, created)
+	}
+}
+
+func (s *Server) handleGet(res Resource) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ns, name := pathNamespace(r.URL.Path), pathName(r.URL.Path)
+
+		s.mu.Lock()
+		obj, ok := s.objects[res.key()][ns+"/"+name]
+		s.mu.Unlock()
+
+		if !ok {
+			writeStatus(w, notFound(res, name))
+			return
+		}
+		writeJSON(w, http.StatusOK, obj)
+	}
+}
+
+func (s *Server) handleUpdate(res Resource) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		obj, ok := decodeObject(w, r)
+		if !ok {
+			return
+		}
+		ns, name := pathNamespace(r.URL.Path), pathName(r.URL.Path)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		store := s.objects[res.key()]
+		current, ok := store[ns+"/"+name]
+		if !ok {
+			writeStatus(w, notFound(res, name))
+			return
+		}
+		if rv, _ := objectMeta(obj)["resourceVersion"].(string); rv != "" && rv != objectMeta(current)["resourceVersion"] {
+			writeStatus(w, &apiError{http.StatusConflict, "Conflict", fmt.Sprintf("the object %q has been modified; please apply your changes to the latest version and try again", name)})
+			return
+		}
+
+		objectMeta(obj)["name"] = name
+		obj = s.stamp(res, ns, obj)
+		store[ns+"/"+name] = obj
+		s.emit(res, ns, Modified, obj)
+		writeJSON(w, http.StatusOK, obj)
+	}
+}
+
+func (s *Server) handleDelete(res Resource) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ns, name := pathNamespace(r.URL.Path), pathName(r.URL.Path)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		store := s.objects[res.key()]
+		obj, ok := store[ns+"/"+name]
+		if !ok {
+			writeStatus(w, notFound(res, name))
+			return
+		}
+		delete(store, ns+"/"+name)
+
+		s.rv++
+		obj = deepCopy(obj).(map[string]any)
+		objectMeta(obj)["resourceVersion"] = strconv.FormatInt(s.rv, 10)
+		s.emit(res, ns, Deleted, obj)
+		writeJSON(w, http.StatusOK, obj)
+	}
+}
+
+type apiError struct {
+	code    int
+	reason  string
+	message string
+}
+
+func (e *apiError) Error() string { return e.message }
+
+func notFound(res Resource, name string) *apiError {
+	return &apiError{http.StatusNotFound, "NotFound", fmt.Sprintf("%s %q not found", res.Plural, name)}
+}
+
+func writeStatus(w http.ResponseWriter, e *apiError) {
+	writeJSON(w, e.code, map[string]any{
+		"kind":       "Status",
+		"apiVersion": "v1",
+		"metadata":   map[string]any{},
+		"status":     "Failure",
+		"message":    e.message,
+		"reason":     e.reason,
+		"code":       e.code,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func decodeObject(w http.ResponseWriter, r *http.Request) (map[string]any, bool) {
+	var obj map[string]any
+	if err := json.NewDecoder(r.Body).Decode(&obj); err != nil {
+		writeStatus(w, &apiError{http.StatusBadRequest, "BadRequest", "invalid object: " + err.Error()})
+		return nil, false
+	}
+	return obj, true
+}
+
+func objectMeta(obj map[string]any) map[string]any {
+	meta, _ := obj["metadata"].(map[string]any)
+	if meta == nil {
+		meta = make(map[string]any)
+		obj["metadata"] = meta
+	}
+	return meta
+}
+
+// deepCopy copies the maps and slices of a decoded JSON value.
+func deepCopy(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		c := make(map[string]any, len(v))
+		for k, e := range v {
+			c[k] = deepCopy(e)
+		}
+		return c
+	case []any:
+		c := make([]any, len(v))
+		for i, e := range v {
+			c[i] = deepCopy(e)
+		}
+		return c
+	default:
+		return v
+	}
+}
+
+func objectName(obj map[string]any) string {
+	meta, _ := obj["metadata"].(map[string]any)
+	name, _ := meta["name"].(string)
+	return name
+}
+
+func objectNamespace(obj map[string]any) string {
+	meta, _ := obj["metadata"].(map[string]any)
+	ns, _ := meta["namespace"].(string)
+	return ns
+}
+
+// pathNamespace extracts the namespace from .../namespaces/<ns>/... paths.
+func pathNamespace(p string) string {
+	segs := strings.Split(strings.Trim(p, "/"), "/")
+	for i := 0; i+2 < len(segs); i++ {
+		if segs[i] == "namespaces" {
+			return segs[i+1]
+		}
+	}
+	return ""
+}
+
+func pathName(p string) string {
+	return p[strings.LastIndex(p, "/")+1:]
+}
@@ -0,0 +1,208 @@
+package kube
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/alesr/stubsrv"
+	"github.com/alesr/stubsrv/internal/stubtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	pods        = Resource{Version: "v1", Kind: "Pod", Plural: "pods", Namespaced: true}
+	deployments = Resource{Group: "apps", Version: "v1", Kind: "Deployment", Plural: "deployments", Namespaced: true}
+)
+
+func TestServer_Discovery(t *testing.T) {
+	t.Parallel()
+
+	stub, _ := newServer(t, pods, deployments)
+
+	var versions struct{ Versions []string }
+	getJSON(t, stub.URL()+"/api", &versions)
+	assert.Equal(t, []string{"v1"}, versions.Versions)
+
+	var groups struct {
+		Groups []struct{ Name string }
+	}
+	getJSON(t, stub.URL()+"/apis", &groups)
+	require.Len(t, groups.Groups, 1)
+	assert.Equal(t, "apps", groups.Groups[0].Name)
+
+	var resources struct {
+		GroupVersion string
+		Resources    []struct{ Name, Kind string }
+	}
+	getJSON(t, stub.URL()+"/apis/apps/v1", &resources)
+	assert.Equal(t, "apps/v1", resources.GroupVersion)
+	require.Len(t, resources.Resources, 1)
+	assert.Equal(t, "Deployment", resources.Resources[0].Kind)
+}
+
+func TestServer_CRUD(t *testing.T) {
+	t.Parallel()
+
+	stub, _ := newServer(t, pods)
+	collection := stub.URL() + "/api/v1/namespaces/default/pods"
+
+	resp, _ := stubtest.Do(t, http.MethodPost, collection, `{"metadata":{"name":"web"}}`)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	resp, _ = stubtest.Do(t, http.MethodPost, collection, `{"metadata":{"name":"web"}}`)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	var pod map[string]any
+	getJSON(t, collection+"/web", &pod)
+	assert.Equal(t, "Pod", pod["kind"])
+	assert.Equal(t, "default", objectNamespace(pod))
+	assert.Equal(t, "1", objectMeta(pod)["resourceVersion"])
+
+	resp, _ = stubtest.Do(t, http.MethodPut, collection+"/web", `{"metadata":{"resourceVersion":"0"}}`)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	resp, _ = stubtest.Do(t, http.MethodPut, collection+"/web", `{"metadata":{"resourceVersion":"1"},"spec":{"x":1}}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var list struct {
+		Kind     string
+		Metadata struct{ ResourceVersion string }
+		Items    []map[string]any
+	}
+	getJSON(t, stub.URL()+"/api/v1/pods", &list)
+	assert.Equal(t, "PodList", list.Kind)
+	assert.Equal(t, "2", list.Metadata.ResourceVersion)
+	assert.Len(t, list.Items, 1)
+
+	resp, _ = stubtest.Do(t, http.MethodDelete, collection+"/web", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, _ = stubtest.Do(t, http.MethodGet, collection+"/web", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestServer_Watch(t *testing.T) {
+	t.Parallel()
+
+	t.Run("streams events after the given resourceVersion", func(t *testing.T) {
+		t.Parallel()
+
+		stub, srv := newServer(t, pods)
+		require.NoError(t, srv.Create(pods, map[string]any{"metadata": map[string]any{"name": "a", "namespace": "default"}}))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, stub.URL()+"/api/v1/namespaces/default/pods?watch=true&resourceVersion=1", nil)
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		require.NoError(t, srv.Create(pods, map[string]any{"metadata": map[string]any{"name": "b", "namespace": "default"}}))
+		require.NoError(t, srv.Create(pods, map[string]any{"metadata": map[string]any{"name": "c", "namespace": "other"}}))
+		stubtest.Do(t, http.MethodDelete, stub.URL()+"/api/v1/namespaces/default/pods/a", "")
+
+		scanner := bufio.NewScanner(resp.Body)
+		var got []string
+		for len(got) < 2 && scanner.Scan() {
+			var ev Event
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &ev))
+			got = append(got, string(ev.Type)+" "+objectName(ev.Object))
+		}
+		assert.Equal(t, []string{"ADDED b", "DELETED a"}, got)
+	})
+
+	t.Run("replays history as it was", func(t *testing.T) {
+		t.Parallel()
+
+		stub, srv := newServer(t, pods)
+		b := map[string]any{"metadata": map[string]any{"name": "b", "namespace": "default"}}
+		require.NoError(t, srv.Create(pods, map[string]any{"metadata": map[string]any{"name": "a", "namespace": "default"}}))
+		require.NoError(t, srv.Create(pods, b))
+		assert.Equal(t, map[string]any{"name": "b", "namespace": "default"}, b["metadata"], "Create keeps the caller's object")
+		stubtest.Do(t, http.MethodDelete, stub.URL()+"/api/v1/namespaces/default/pods/b", "")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, stub.URL()+"/api/v1/pods?watch=true&resourceVersion=1", nil)
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		scanner := bufio.NewScanner(resp.Body)
+		var got []string
+		for len(got) < 2 && scanner.Scan() {
+			var ev Event
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &ev))
+			got = append(got, fmt.Sprint(ev.Type, " ", objectName(ev.Object), " ", objectMeta(ev.Object)["resourceVersion"]))
+		}
+		assert.Equal(t, []string{"ADDED b 2", "DELETED b 3"}, got)
+	})
+
+	t.Run("stale resourceVersion after compaction returns 410", func(t *testing.T) {
+		t.Parallel()
+
+		stub, srv := newServer(t, pods)
+		require.NoError(t, srv.Create(pods, map[string]any{"metadata": map[string]any{"name": "a"}}))
+		require.NoError(t, srv.Create(pods, map[string]any{"metadata": map[string]any{"name": "b"}}))
+		srv.Compact()
+
+		resp, _ := stubtest.Do(t, http.MethodGet, stub.URL()+"/api/v1/pods?watch=1&resourceVersion=1", "")
+		assert.Equal(t, http.StatusGone, resp.StatusCode)
+	})
+}
+
+func TestPathNamespace(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name      string
+		givenPath string
+		expected  string
+	}{
+		{name: "namespaced collection", givenPath: "/api/v1/namespaces/default/pods", expected: "default"},
+		{name: "namespaced item", givenPath: "/apis/apps/v1/namespaces/kube-system/deployments/dns", expected: "kube-system"},
+		{name: "cluster-wide list", givenPath: "/api/v1/pods", expected: ""},
+		{name: "namespace object itself", givenPath: "/api/v1/namespaces/default", expected: ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tc.expected, pathNamespace(tc.givenPath))
+		})
+	}
+}
+
+func newServer(t *testing.T, resources ...Resource) (*stubsrv.Stub, *Server) {
+	t.Helper()
+
+	var srv *Server
+	stub := stubtest.New(t, func(stub *stubsrv.Stub) {
+		srv = New(stub)
+		for _, res := range resources {
+			srv.AddResource(res)
+		}
+	})
+	return stub, srv
+}
+
+func getJSON(t *testing.T, url string, v any) {
+	t.Helper()
+
+	resp, err := http.Get(url)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+}
@@ -0,0 +1,153 @@
+// Package kv serves a key-value store over HTTP with per-key TTLs, standing
+// in for services like Upstash or internal config stores.
+//
+// Routes, relative to the configured prefix:
+//
+//	GET    <prefix>/:key            value, or 404 when missing or expired
+//	PUT    <prefix>/:key?ttl=30s    store the request body as the value
+//	DELETE <prefix>/:key
+package kv
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alesr/stubsrv"
+)
+
+type entry struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+func (e entry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && !now.Before(e.expiresAt)
+}
+
+type Store struct {
+	mu      sync.Mutex
+	entries map[string]entry
+	now     func() time.Time
+}
+
+func New(stub *stubsrv.Stub, prefix string) *Store {
+	st := Store{
+		entries: make(map[string]entry),
+		now:     time.Now,
+	}
+
+	route := strings.TrimSuffix(prefix, "/") + "/:key"
+	stub.AddHandler(http.MethodGet, route, st.handleGet)
+	stub.AddHandler(http.MethodPut, route, st.handlePut)
+	stub.AddHandler(http.MethodDelete, route, st.handleDelete)
+	return &st
+}
+
+// Set stores value under key. A zero ttl never expires.
+func (st *Store) Set(key string, value []byte, ttl time.Duration) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.set(key, value, ttl)
+}
+
+func (st *Store) Get(key string) ([]byte, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	return st.get(key)
+}
+
+func (st *Store) set(key string, value []byte, ttl time.Duration) {
+	e := entry{value: value}
+	if ttl > 0 {
+		e.expiresAt = st.now().Add(ttl)
+	}
+	st.entries[key] = e
+}
+
+func (st *Store) get(key string) ([]byte, bool) {
+	e, ok := st.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if e.expired(st.now()) {
+		delete(st.entries, key)
+		return nil, false
+	}
+	return e.value, true
+}
+
+func (st *Store) handleGet(w http.ResponseWriter, r *http.Request) {
+	key := routeKey(r)
+
+	st.mu.Lock()
+	value, ok := st.get(key)
+	var ttl time.Duration
+	if ok && !st.entries[key].expiresAt.IsZero() {
+		ttl = st.entries[key].expiresAt.Sub(st.now())
+	}
+	st.mu.Unlock()
+
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if ttl > 0 {
+		w.Header().Set("X-TTL", strconv.Itoa(int(ttl.Round(time.Second).Seconds())))
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	_, _ = w.Write(value)
+}
+
+func (st *Store) handlePut(w http.ResponseWriter, r *http.Request) {
+	var ttl time.Duration
+	if v := r.URL.Query().Get("ttl"); v != "" {
+		parsed, err := parseTTL(v)
+		if err != nil {
+			http.Error(w, "invalid ttl: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		ttl = parsed
+	}
+
+	value, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "could not read value: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	st.Set(routeKey(r), value, ttl)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (st *Store) handleDelete(w http.ResponseWriter, r *http.Request) {
+	key := routeKey(r)
+
+	st.mu.Lock()
+	_, ok := st.get(key)
+	delete(st.entries, key)
+	st.mu.Unlock()
+
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// parseTTL accepts Go durations ("1m30s") or plain seconds ("90").
+func parseTTL(v string) (time.Duration, error) {
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second, nil
+	}
+	return time.ParseDuration(v)
+}
+
+func routeKey(r *http.Request) string {
+	return r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+}
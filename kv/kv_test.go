@@ -0,0 +1,96 @@
+package kv
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/alesr/stubsrv"
+	"github.com/alesr/stubsrv/internal/stubtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore_HTTP(t *testing.T) {
+	t.Parallel()
+
+	stub, st := newStore(t)
+	now := time.Now()
+	st.now = func() time.Time { return now }
+
+	resp, _ := stubtest.Do(t, http.MethodPut, stub.URL()+"/kv/greeting?ttl=30", "hello")
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	resp, body := stubtest.Do(t, http.MethodGet, stub.URL()+"/kv/greeting", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "hello", body)
+	assert.Equal(t, "30", resp.Header.Get("X-TTL"))
+
+	now = now.Add(31 * time.Second)
+	resp, _ = stubtest.Do(t, http.MethodGet, stub.URL()+"/kv/greeting", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, _ = stubtest.Do(t, http.MethodPut, stub.URL()+"/kv/flag", "on")
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	resp, _ = stubtest.Do(t, http.MethodDelete, stub.URL()+"/kv/flag", "")
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	resp, _ = stubtest.Do(t, http.MethodDelete, stub.URL()+"/kv/flag", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, _ = stubtest.Do(t, http.MethodPut, stub.URL()+"/kv/bad?ttl=soon", "x")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestStore_GoAPI(t *testing.T) {
+	t.Parallel()
+
+	stub, st := newStore(t)
+	st.Set("seeded", []byte("v1"), 0)
+
+	_, body := stubtest.Do(t, http.MethodGet, stub.URL()+"/kv/seeded", "")
+	assert.Equal(t, "v1", body)
+
+	stubtest.Do(t, http.MethodPut, stub.URL()+"/kv/written", "v2")
+	got, ok := st.Get("written")
+	require.True(t, ok)
+	assert.Equal(t, "v2", string(got))
+}
+
+func TestParseTTL(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name        string
+		given       string
+		expected    time.Duration
+		expectedErr bool
+	}{
+		{name: "plain seconds", given: "90", expected: 90 * time.Second},
+		{name: "go duration", given: "1m30s", expected: 90 * time.Second},
+		{name: "invalid", given: "soon", expectedErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := parseTTL(tc.given)
+			if tc.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, got)
+		})
+	}
+}
+
+func newStore(t *testing.T) (*stubsrv.Stub, *Store) {
+	t.Helper()
+
+	var st *Store
+	stub := stubtest.New(t, func(stub *stubsrv.Stub) { st = New(stub, "/kv") })
+	return stub, st
+}
@@ -0,0 +1,113 @@
+package stubsrv
+
+import (
+	"net/http"
+	"slices"
+)
+
+// LimitPolicy decides what happens when a Limits cap is reached.
+type LimitPolicy string
+
+const (
+	// LimitEvict drops the oldest entries to make room. It is the default.
+	LimitEvict LimitPolicy = "evict"
+	// LimitReject keeps existing entries and drops new ones: requests are
+	// still served but not recorded, and scenario changes are dropped.
+	LimitReject LimitPolicy = "reject"
+)
+
+// Limits caps the memory a long-running stub holds on to. Zero fields are
+// unlimited. Assertions and expectations only see requests still in the
+// journal, so evicting ones they depend on makes them fail.
+type Limits struct {
+	// MaxJournalEntries caps the recorded requests, and separately the
+	// unexpected ones and the exchanges recorded while proxying.
+	MaxJournalEntries int `json:"max_journal_entries"`
+	// MaxJournalBytes caps the captured bodies held by the journal, and
+	// separately by the unexpected requests and the proxy recordings.
+	MaxJournalBytes int64 `json:"max_journal_bytes"`
+	// MaxBodyCapture truncates each captured body. Handlers still read the
+	// whole body.
+	MaxBodyCapture int64 `json:"max_body_capture"`
+	// MaxScenarios caps the scenarios that left ScenarioStarted.
+	MaxScenarios int `json:"max_scenarios"`
+	// Policy defaults to LimitEvict.
+	Policy LimitPolicy `json:"policy"`
+}
+
+func WithLimits(l Limits) Option {
+	return func(cfg *stubConfig) {
+		if l.Policy == "" {
+			l.Policy = LimitEvict
+		}
+		cfg.limits = l
+	}
+}
+
+// appendLimited appends item, of size bytes, to list, whose items hold total
+// bytes. Under LimitReject item is dropped when it doesn't fit, otherwise the
+// oldest items are evicted to make room for it. It returns the new list and
+// total, how many items were evicted and whether item was kept.
+func appendLimited[T any](l Limits, list []T, total int64, item T, size func(T) int64) ([]T, int64, int, bool) {
+	full := func(n int, bytes int64) bool {
+		return l.MaxJournalEntries > 0 && n > l.MaxJournalEntries ||
+			l.MaxJournalBytes > 0 && bytes > l.MaxJournalBytes
+	}
+
+	n := size(item)
+	if l.Policy == LimitReject && full(len(list)+1, total+n) {
+		return list, total, 0, false
+	}
+
+	list, total = append(list, item), total+n
+	var evicted int
+	for len(list) > 1 && full(len(list), total) {
+		total -= size(list[0])
+		list = slices.Delete(list, 0, 1)
+		evicted++
+	}
+	return list, total, evicted, true
+}
+
+// Usage reports what the stub currently holds, see GET /_control/usage.
+type Usage struct {
+	Journal    JournalUsage `json:"journal"`
+	Unexpected int          `json:"unexpected"`
+	Recordings int          `json:"recordings"`
+	Scenarios  int          `json:"scenarios"`
+	Routes     int          `json:"routes"`
+	Limits     Limits       `json:"limits"`
+}
+
+type JournalUsage struct {
+	Entries int   `json:"entries"`
+	Bytes   int64 `json:"bytes"`
+	// Evicted and Rejected count requests dropped by the limits since the
+	// last reset.
+	Evicted  int `json:"evicted"`
+	Rejected int `json:"rejected"`
+}
+
+func (s *Stub) Usage() Usage {
+	u := Usage{
+		Journal:   s.journal.usage(),
+		Scenarios: len(s.scenarios.all()),
+	}
+	u.Unexpected = len(s.journal.allUnexpected())
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u.Recordings = len(s.recordings)
+	u.Routes = len(s.routers) + len(s.templateRoutes)
+	u.Limits = s.journal.limits
+	return u
+}
+
+func (s *Stub) controlUsage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.Usage())
+}
@@ -0,0 +1,138 @@
+package stubsrv
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStub_WithLimits(t *testing.T) {
+	t.Parallel()
+
+	post := func(t *testing.T, stub *Stub, path, body string) int {
+		t.Helper()
+
+		resp, err := http.Post(stub.URL()+path, "text/plain", strings.NewReader(body))
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	t.Run("evicts the oldest requests", func(t *testing.T) {
+		t.Parallel()
+
+		stub := NewStub(noopLogger(), WithLimits(Limits{MaxJournalEntries: 2, MaxBodyCapture: 4}))
+		var seen string
+		stub.AddHandler(http.MethodPost, "/echo", func(w http.ResponseWriter, r *http.Request) {
+			seen = string(peekBody(r))
+		})
+		require.NoError(t, stub.Start())
+		defer stub.Close()
+
+		for _, body := range []string{"one", "two", "three-long"} {
+			assert.Equal(t, http.StatusOK, post(t, stub, "/echo", body))
+		}
+		assert.Equal(t, "three-long", seen, "handlers see the whole body")
+
+		recs := stub.Requests()
+		require.Len(t, recs, 2)
+		assert.Equal(t, "two", string(recs[0].Body))
+		assert.False(t, recs[0].Truncated)
+		assert.Equal(t, "thre", string(recs[1].Body))
+		assert.True(t, recs[1].Truncated)
+
+		var usage Usage
+		controlDo(t, stub, http.MethodGet, "/_control/usage", "", http.StatusOK, &usage)
+		assert.Equal(t, JournalUsage{Entries: 2, Bytes: 7, Evicted: 1}, usage.Journal)
+		assert.Equal(t, 1, usage.Routes)
+		assert.Equal(t, LimitEvict, usage.Limits.Policy)
+	})
+
+	t.Run("evicts by captured bytes", func(t *testing.T) {
+		t.Parallel()
+
+		stub := NewStub(noopLogger(), WithLimits(Limits{MaxJournalBytes: 10}))
+		stub.AddHandler(http.MethodPost, "/echo", func(w http.ResponseWriter, r *http.Request) {})
+		require.NoError(t, stub.Start())
+		defer stub.Close()
+
+		for _, body := range []string{"aaaa", "bbbb", "cccc"} {
+			post(t, stub, "/echo", body)
+		}
+		assert.Len(t, stub.Requests(), 2)
+		assert.Equal(t, int64(8), stub.Usage().Journal.Bytes)
+	})
+
+	t.Run("rejects once full", func(t *testing.T) {
+		t.Parallel()
+
+		stub := NewStub(noopLogger(), WithLimits(Limits{MaxJournalEntries: 1, MaxScenarios: 1, Policy: LimitReject}))
+		stub.AddHandler(http.MethodPost, "/echo", func(w http.ResponseWriter, r *http.Request) {})
+		require.NoError(t, stub.Start())
+		defer stub.Close()
+
+		assert.Equal(t, http.StatusOK, post(t, stub, "/echo", "first"))
+		assert.Equal(t, http.StatusOK, post(t, stub, "/echo", "second"), "rejected requests are still served")
+		assert.Equal(t, 1, stub.Usage().Journal.Rejected)
+		require.Len(t, stub.Requests(), 1)
+		assert.Equal(t, "first", string(stub.Requests()[0].Body))
+
+		controlDo(t, stub, http.MethodPut, "/_control/scenarios/a", `{"state":"x"}`, http.StatusNoContent, nil)
+		controlDo(t, stub, http.MethodPut, "/_control/scenarios/a", `{"state":"y"}`, http.StatusNoContent, nil)
+		controlDo(t, stub, http.MethodPut, "/_control/scenarios/b", `{"state":"x"}`, http.StatusInsufficientStorage, nil)
+
+		stub.Reset()
+		stub.AddHandler(http.MethodPost, "/echo", func(w http.ResponseWriter, r *http.Request) {})
+		assert.Equal(t, http.StatusOK, post(t, stub, "/echo", "again"))
+		assert.Equal(t, JournalUsage{Entries: 1, Bytes: 5}, stub.Usage().Journal)
+	})
+
+	t.Run("caps unexpected requests and recordings", func(t *testing.T) {
+		t.Parallel()
+
+		upstream := NewStub(noopLogger())
+		upstream.AddHandler(http.MethodPost, "/...", func(w http.ResponseWriter, r *http.Request) {
+			w.Write(peekBody(r))
+		})
+		require.NoError(t, upstream.Start())
+		defer upstream.Close()
+
+		stub := NewStub(noopLogger(), WithStrictMode(), WithLimits(Limits{MaxJournalEntries: 2, MaxJournalBytes: 8}))
+		require.NoError(t, stub.Start())
+		defer stub.Close()
+
+		for _, body := range []string{"aa", "bb", "cc"} {
+			assert.Equal(t, http.StatusNotFound, post(t, stub, "/missing", body))
+		}
+		unexpected := stub.journal.allUnexpected()
+		require.Len(t, unexpected, 2)
+		assert.Equal(t, "bb", string(unexpected[0].Body))
+
+		require.NoError(t, stub.ProxyTo(upstream.URL()))
+		for _, body := range []string{"one", "two", "three"} {
+			assert.Equal(t, http.StatusOK, post(t, stub, "/"+body, body))
+		}
+		recordings := stub.Recordings()
+		require.Len(t, recordings, 1, "each recording holds its body twice, so two exceed 8 bytes")
+		assert.Equal(t, "/three", recordings[0].Path)
+		assert.Equal(t, 1, stub.Usage().Recordings)
+	})
+
+	t.Run("evicts the oldest scenario", func(t *testing.T) {
+		t.Parallel()
+
+		stub := NewStub(noopLogger(), WithLimits(Limits{MaxScenarios: 2}))
+		stub.SetScenarioState("a", "x")
+		stub.SetScenarioState("b", "x")
+		stub.SetScenarioState("a", "y")
+		stub.SetScenarioState("c", "x")
+
+		assert.Equal(t, ScenarioStarted, stub.ScenarioState("a"))
+		assert.Equal(t, "x", stub.ScenarioState("b"))
+		assert.Equal(t, "x", stub.ScenarioState("c"))
+		assert.Equal(t, 2, stub.Usage().Scenarios)
+	})
+}
@@ -1,24 +1,71 @@
 package stubsrv
 
 import (
+	"encoding/json"
+	"fmt"
+	"net/http"
 	"net/url"
+	"reflect"
+	"regexp"
+	"slices"
 	"strings"
 )
 
+// pathMatch reports whether rawPath matches the template segments. A
+// ":param" or "*" segment matches any single segment; a final "..." or
+// ":param*" segment matches whatever remains of the path, including nothing.
 func pathMatch(tplSegs []string, rawPath string) bool {
 	reqSegs := strings.Split(strings.Trim(rawPath, "/"), "/")
-	if len(reqSegs) != len(tplSegs) {
-		return false
-	}
 	for i, seg := range tplSegs {
-		if strings.HasPrefix(seg, ":") {
+		if isCatchAll(seg) && i == len(tplSegs)-1 {
+			return true
+		}
+		if i >= len(reqSegs) {
+			return false
+		}
+		if seg == "*" || strings.HasPrefix(seg, ":") {
 			continue
 		}
 		if seg != reqSegs[i] {
 			return false
 		}
 	}
-	return true
+	return len(reqSegs) == len(tplSegs)
+}
+
+func isCatchAll(seg string) bool {
+	return seg == "..." || (strings.HasPrefix(seg, ":") && strings.HasSuffix(seg, "*"))
+}
+
+// pathParams extracts the values of tplSegs' :param segments from rawPath,
+// which must match them.
+func pathParams(tplSegs []string, rawPath string) map[string]string {
+	var params map[string]string
+	reqSegs := strings.Split(strings.Trim(rawPath, "/"), "/")
+	for i, seg := range tplSegs {
+		name, ok := strings.CutPrefix(seg, ":")
+		if !ok {
+			continue
+		}
+		if params == nil {
+			params = make(map[string]string)
+		}
+		if rest, ok := strings.CutSuffix(name, "*"); ok {
+			params[rest] = strings.Join(reqSegs[min(i, len(reqSegs)):], "/")
+			break
+		}
+		params[name] = reqSegs[i]
+	}
+	return params
+}
+
+type pathParamsKey struct{}
+
+// PathParam returns the value captured for the :name segment of the
+// template route serving r, or "" when there is none.
+func PathParam(r *http.Request, name string) string {
+	params, _ := r.Context().Value(pathParamsKey{}).(map[string]string)
+	return params[name]
 }
 
 func queryMatch(tpl map[string]string, urlVals url.Values) bool {
@@ -32,3 +79,92 @@ func queryMatch(tpl map[string]string, urlVals url.Values) bool {
 	}
 	return true
 }
+
+// Matcher reports whether a request satisfies a route constraint. Routes
+// whose matchers reject a request are skipped, so dispatch falls through to
+// the next candidate.
+type Matcher func(r *http.Request) bool
+
+// MatchHeader matches requests carrying header key with the given value.
+func MatchHeader(key, value string) Matcher {
+	return func(r *http.Request) bool {
+		return slices.Contains(r.Header.Values(key), value)
+	}
+}
+
+// MatchHeaders matches requests carrying every header in headers.
+func MatchHeaders(headers map[string]string) Matcher {
+	return func(r *http.Request) bool {
+		for k, v := range headers {
+			if !slices.Contains(r.Header.Values(k), v) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// BodyMatchMode selects how MatchBody compares the request body.
+type BodyMatchMode string
+
+const (
+	BodyExact    BodyMatchMode = "exact"
+	BodyContains BodyMatchMode = "contains"
+	BodyRegexp   BodyMatchMode = "regex"
+	// BodyJSON compares semantically, ignoring key order and whitespace.
+	BodyJSON BodyMatchMode = "json"
+)
+
+// MatchBody matches requests whose body satisfies value under mode. It
+// panics if mode is unknown, or value is not a valid regexp or JSON
+// document for the regex and json modes.
+func MatchBody(mode BodyMatchMode, value string) Matcher {
+	m, err := bodyMatcher(mode, value)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+func bodyMatcher(mode BodyMatchMode, value string) (Matcher, error) {
+	switch mode {
+	case BodyExact:
+		return func(r *http.Request) bool {
+			return string(peekBody(r)) == value
+		}, nil
+	case BodyContains:
+		return func(r *http.Request) bool {
+			return strings.Contains(string(peekBody(r)), value)
+		}, nil
+	case BodyRegexp:
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid body regexp: %w", err)
+		}
+		return func(r *http.Request) bool {
+			return re.Match(peekBody(r))
+		}, nil
+	case BodyJSON:
+		var want any
+		if err := json.Unmarshal([]byte(value), &want); err != nil {
+			return nil, fmt.Errorf("invalid body JSON: %w", err)
+		}
+		return func(r *http.Request) bool {
+			var got any
+			if err := json.Unmarshal(peekBody(r), &got); err != nil {
+				return false
+			}
+			return reflect.DeepEqual(want, got)
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown body match mode: %s", mode)
+}
+
+func matchersMatch(matchers []Matcher, r *http.Request) bool {
+	for _, m := range matchers {
+		if !m(r) {
+			return false
+		}
+	}
+	return true
+}
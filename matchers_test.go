@@ -1,7 +1,11 @@
 package stubsrv
 
 import (
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -41,6 +45,48 @@ func TestPathMatch(t *testing.T) {
 			givenRawPath: "/foo/bar/baz",
 			expected:     false,
 		},
+		{
+			name:         "wildcard matches a single segment",
+			givenTplSegs: []string{"api", "*", "health"},
+			givenRawPath: "/api/v2/health",
+			expected:     true,
+		},
+		{
+			name:         "wildcard does not span segments",
+			givenTplSegs: []string{"api", "*", "health"},
+			givenRawPath: "/api/v2/beta/health",
+			expected:     false,
+		},
+		{
+			name:         "trailing ellipsis matches the rest",
+			givenTplSegs: []string{"static", "..."},
+			givenRawPath: "/static/css/site.css",
+			expected:     true,
+		},
+		{
+			name:         "trailing ellipsis matches nothing left",
+			givenTplSegs: []string{"static", "..."},
+			givenRawPath: "/static",
+			expected:     true,
+		},
+		{
+			name:         "catch-all param matches the rest",
+			givenTplSegs: []string{"files", ":rest*"},
+			givenRawPath: "/files/a/b/c.txt",
+			expected:     true,
+		},
+		{
+			name:         "catch-all requires its prefix",
+			givenTplSegs: []string{"static", "..."},
+			givenRawPath: "/assets/site.css",
+			expected:     false,
+		},
+		{
+			name:         "ellipsis before the last segment is literal",
+			givenTplSegs: []string{"...", "x"},
+			givenRawPath: "/a/x",
+			expected:     false,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -98,6 +144,94 @@ func TestQueryMatch(t *testing.T) {
 	}
 }
 
+func TestMatchHeaders(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name         string
+		givenHeaders map[string]string
+		givenReqHdr  http.Header
+		expected     bool
+	}{
+		{
+			name:         "no headers always match",
+			givenHeaders: nil,
+			givenReqHdr:  http.Header{},
+			expected:     true,
+		},
+		{
+			name:         "all headers present",
+			givenHeaders: map[string]string{"authorization": "Bearer x", "Accept": "application/json"},
+			givenReqHdr:  http.Header{"Authorization": {"Bearer x"}, "Accept": {"text/plain", "application/json"}},
+			expected:     true,
+		},
+		{
+			name:         "value mismatch returns false",
+			givenHeaders: map[string]string{"Authorization": "Bearer x"},
+			givenReqHdr:  http.Header{"Authorization": {"Bearer y"}},
+			expected:     false,
+		},
+		{
+			name:         "missing header returns false",
+			givenHeaders: map[string]string{"Authorization": "Bearer x"},
+			givenReqHdr:  http.Header{},
+			expected:     false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := &http.Request{Header: tc.givenReqHdr}
+			assert.Equal(t, tc.expected, MatchHeaders(tc.givenHeaders)(r))
+		})
+	}
+}
+
+func TestMatchBody(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name      string
+		givenMode BodyMatchMode
+		givenVal  string
+		givenBody string
+		expected  bool
+	}{
+		{name: "exact match", givenMode: BodyExact, givenVal: "ping", givenBody: "ping", expected: true},
+		{name: "exact mismatch", givenMode: BodyExact, givenVal: "ping", givenBody: "ping ", expected: false},
+		{name: "contains", givenMode: BodyContains, givenVal: "sku-1", givenBody: `{"sku":"sku-1"}`, expected: true},
+		{name: "contains mismatch", givenMode: BodyContains, givenVal: "sku-2", givenBody: `{"sku":"sku-1"}`, expected: false},
+		{name: "regexp", givenMode: BodyRegexp, givenVal: `"qty":\s*[0-9]+`, givenBody: `{"qty": 3}`, expected: true},
+		{name: "regexp mismatch", givenMode: BodyRegexp, givenVal: `^\d+$`, givenBody: "12a", expected: false},
+		{name: "JSON ignores key order and whitespace", givenMode: BodyJSON, givenVal: `{"a":1,"b":[true]}`, givenBody: `{ "b": [true], "a": 1 }`, expected: true},
+		{name: "JSON value mismatch", givenMode: BodyJSON, givenVal: `{"a":1}`, givenBody: `{"a":2}`, expected: false},
+		{name: "JSON with invalid body", givenMode: BodyJSON, givenVal: `{}`, givenBody: `{`, expected: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tc.givenBody))
+			assert.Equal(t, tc.expected, MatchBody(tc.givenMode, tc.givenVal)(r))
+
+			body, err := io.ReadAll(r.Body)
+			require.NoError(t, err)
+			assert.Equal(t, tc.givenBody, string(body), "body must stay readable")
+		})
+	}
+
+	t.Run("panics on invalid arguments", func(t *testing.T) {
+		t.Parallel()
+
+		assert.Panics(t, func() { MatchBody(BodyRegexp, "(") })
+		assert.Panics(t, func() { MatchBody(BodyJSON, "{") })
+		assert.Panics(t, func() { MatchBody("xml", "") })
+	})
+}
+
 func mustParseQuery(t *testing.T, q string) url.Values {
 	t.Helper()
 	v, err := url.ParseQuery(q)
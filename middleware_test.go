@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestChainMiddleware(t *testing.T) {
@@ -146,3 +147,35 @@ func TestChainMiddleware(t *testing.T) {
 		assert.Equal(t, http.StatusUnauthorized, w.Code)
 	})
 }
+
+func TestStub_Use(t *testing.T) {
+	t.Parallel()
+
+	stub := NewStub(noopLogger())
+
+	var order []string
+	trace := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	stub.Use(trace("global"))
+	stub.AddHandler(http.MethodGet, "/exact", func(w http.ResponseWriter, r *http.Request) {}, trace("route"))
+	stub.AddHandler(http.MethodGet, "/tpl/:id", func(w http.ResponseWriter, r *http.Request) {})
+	require.NoError(t, stub.Start())
+	defer stub.Close()
+
+	controlAdd(t, stub, `{"method":"GET","path":"/dynamic"}`)
+
+	for _, path := range []string{"/exact", "/tpl/1", "/dynamic", "/missing"} {
+		resp, err := http.Get(stub.URL() + path)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	assert.Equal(t, []string{"global", "route", "global", "global"}, order)
+}
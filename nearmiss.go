@@ -0,0 +1,126 @@
+package stubsrv
+
+import (
+	"cmp"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// maxRouteMisses caps the routes listed for an unmatched request.
+const maxRouteMisses = 3
+
+// RouteMiss is a registered route that almost served a request, with the
+// reasons it did not.
+type RouteMiss struct {
+	ID      string   `json:"id"`
+	Method  string   `json:"method"`
+	Path    string   `json:"path"`
+	Reasons []string `json:"reasons"`
+}
+
+func (m RouteMiss) String() string {
+	return m.Method + " " + m.Path + " (" + strings.Join(m.Reasons, ", ") + ")"
+}
+
+// WithNotFoundDiagnostics answers requests no route matches with a JSON
+// body listing the closest routes and why they did not match, instead of a
+// plain 404. The closest routes are logged either way.
+func WithNotFoundDiagnostics() Option {
+	return func(cfg *stubConfig) {
+		cfg.notFoundDiagnostics = true
+	}
+}
+
+// routeMisses returns the routes closest to matching r, closest first. A
+// route is close when its path matches, or when its method does and its
+// path differs from r's in a single literal segment. Callers must hold s.mu
+// for reading.
+func (s *Stub) routeMisses(r *http.Request) []RouteMiss {
+	reqSegs := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	var misses []RouteMiss
+	for _, rt := range s.routeTable() {
+		segments := rt.segments
+		if segments == nil {
+			segments = strings.Split(strings.Trim(rt.Path, "/"), "/")
+		}
+
+		var reasons []string
+		if rt.Method != r.Method {
+			reasons = append(reasons, "method is "+rt.Method)
+		}
+		if !pathMatch(segments, r.URL.Path) {
+			if len(reasons) > 0 || !oneSegmentOff(segments, reqSegs) {
+				continue
+			}
+			reasons = append(reasons, "path is "+rt.Path)
+		}
+		reasons = append(reasons, matcherReasons(rt, r)...)
+		if len(reasons) == 0 {
+			// the route matches; another one must have been picked
+			continue
+		}
+		misses = append(misses, RouteMiss{ID: rt.ID, Method: rt.Method, Path: rt.Path, Reasons: reasons})
+	}
+
+	slices.SortStableFunc(misses, func(a, b RouteMiss) int {
+		return cmp.Compare(len(a.Reasons), len(b.Reasons))
+	})
+	return misses[:min(len(misses), maxRouteMisses)]
+}
+
+// oneSegmentOff reports whether the template segments and the request's
+// differ in exactly one literal segment.
+func oneSegmentOff(segments, reqSegs []string) bool {
+	if len(segments) != len(reqSegs) {
+		return false
+	}
+	var off int
+	for i, seg := range segments {
+		if seg != reqSegs[i] && seg != "*" && !strings.HasPrefix(seg, ":") {
+			off++
+		}
+	}
+	return off == 1
+}
+
+// matcherReasons explains why rt's query constraints and matchers reject r.
+// Matchers of routes added from a spec are explained one by one; others
+// can only be reported as a whole.
+func matcherReasons(rt Route, r *http.Request) []string {
+	var reasons []string
+	query := r.URL.Query()
+	for _, k := range slices.Sorted(maps.Keys(rt.Query)) {
+		if !query.Has(k) {
+			reasons = append(reasons, "query parameter "+k+" is missing")
+		} else if got := query.Get(k); got != rt.Query[k] {
+			reasons = append(reasons, "query parameter "+k+" is "+got+", not "+rt.Query[k])
+		}
+	}
+
+	if matchersMatch(rt.info.matchers, r) {
+		return reasons
+	}
+	var explained bool
+	if spec := rt.info.spec; spec != nil {
+		for _, k := range slices.Sorted(maps.Keys(spec.MatchHeaders)) {
+			if !MatchHeader(k, spec.MatchHeaders[k])(r) {
+				reasons = append(reasons, "header "+k+" is not "+spec.MatchHeaders[k])
+				explained = true
+			}
+		}
+		if spec.MatchBody != "" || spec.MatchBodyMode != "" {
+			mode := cmp.Or(spec.MatchBodyMode, BodyExact)
+			if m, err := bodyMatcher(mode, spec.MatchBody); err == nil && !m(r) {
+				reasons = append(reasons, "body matcher ("+string(mode)+") failed")
+				explained = true
+			}
+		}
+	}
+	if !explained {
+		reasons = append(reasons, "a matcher rejected the request")
+	}
+	return reasons
+}
@@ -0,0 +1,133 @@
+package stubsrv
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStub_NotFoundDiagnostics(t *testing.T) {
+	t.Parallel()
+
+	stub := NewStub(noopLogger(), WithNotFoundDiagnostics())
+	require.NoError(t, stub.Start())
+	defer stub.Close()
+
+	controlAdd(t, stub, `{"method":"GET","path":"/users/:id","query":{"expand":"orders"}}`)
+	controlAdd(t, stub, `{"method":"POST","path":"/orders","match_headers":{"X-Tenant":"acme"},"match_body":"{\"qty\":1}","match_body_mode":"json"}`)
+	controlAdd(t, stub, `{"method":"GET","path":"/health"}`)
+	stub.AddMatchedHandler(http.MethodGet, "/items", []Matcher{func(*http.Request) bool { return false }},
+		func(w http.ResponseWriter, r *http.Request) {})
+
+	testCases := []struct {
+		name           string
+		givenMethod    string
+		givenPath      string
+		givenBody      string
+		expectedMisses []RouteMiss
+	}{
+		{
+			name:        "missing query parameter",
+			givenMethod: http.MethodGet,
+			givenPath:   "/users/1",
+			expectedMisses: []RouteMiss{
+				{ID: "1", Method: http.MethodGet, Path: "/users/:id", Reasons: []string{"query parameter expand is missing"}},
+			},
+		},
+		{
+			name:        "wrong query parameter value",
+			givenMethod: http.MethodGet,
+			givenPath:   "/users/1?expand=cart",
+			expectedMisses: []RouteMiss{
+				{ID: "1", Method: http.MethodGet, Path: "/users/:id", Reasons: []string{"query parameter expand is cart, not orders"}},
+			},
+		},
+		{
+			name:        "header and body matchers",
+			givenMethod: http.MethodPost,
+			givenPath:   "/orders",
+			givenBody:   `{"qty":2}`,
+			expectedMisses: []RouteMiss{
+				{ID: "2", Method: http.MethodPost, Path: "/orders", Reasons: []string{"header X-Tenant is not acme", "body matcher (json) failed"}},
+			},
+		},
+		{
+			name:        "typo in a path segment",
+			givenMethod: http.MethodGet,
+			givenPath:   "/helth",
+			expectedMisses: []RouteMiss{
+				{ID: "3", Method: http.MethodGet, Path: "/health", Reasons: []string{"path is /health"}},
+				{ID: "4", Method: http.MethodGet, Path: "/items", Reasons: []string{"path is /items", "a matcher rejected the request"}},
+			},
+		},
+		{
+			name:           "nothing close",
+			givenMethod:    http.MethodDelete,
+			givenPath:      "/a/b/c",
+			expectedMisses: []RouteMiss{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(tc.givenMethod, stub.URL()+tc.givenPath, strings.NewReader(tc.givenBody))
+			require.NoError(t, err)
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+			var got struct {
+				Error      string      `json:"error"`
+				NearMisses []RouteMiss `json:"near_misses"`
+			}
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+			assert.Equal(t, "no route matched "+tc.givenMethod+" "+strings.Split(tc.givenPath, "?")[0], got.Error)
+			assert.Equal(t, tc.expectedMisses, got.NearMisses)
+		})
+	}
+}
+
+func TestStub_NotFoundLogsNearMisses(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu  sync.Mutex
+		buf bytes.Buffer
+	)
+	logger := slog.New(slog.NewTextHandler(writerFunc(func(p []byte) (int, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return buf.Write(p)
+	}), nil))
+
+	stub := NewStub(logger)
+	stub.AddHandler(http.MethodGet, "/health", func(w http.ResponseWriter, r *http.Request) {})
+	require.NoError(t, stub.Start())
+	defer stub.Close()
+
+	resp, err := http.Get(stub.URL() + "/helth")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, "404 page not found\n", readAll(t, resp), "the body is unchanged without WithNotFoundDiagnostics")
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Contains(t, buf.String(), `near_misses="GET /health (path is /health)"`)
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
@@ -0,0 +1,304 @@
+// Package openapi registers stub routes for the operations of OpenAPI 3
+// documents, in JSON or YAML. Each route answers with its operation's
+// lowest 2xx response, using its example when present and a placeholder
+// generated from its schema otherwise.
+//
+// It lives outside the stubsrv package so the core builds without YAML, see
+// the stubsrv_stdlib build tag.
+//
+// Routes, with Register:
+//
+//	POST /_control/openapi   register the routes of the posted document
+package openapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/alesr/stubsrv"
+	"gopkg.in/yaml.v3"
+)
+
+var methods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// maxSchemaDepth bounds placeholder generation for recursive schemas.
+const maxSchemaDepth = 8
+
+// Load registers a route for every operation of doc. Nothing is registered
+// unless every operation is valid.
+func Load(stub *stubsrv.Stub, doc []byte) error {
+	_, err := stub.LoadSpecs("openapi", "", func() ([]stubsrv.DynamicHandlerSpec, error) {
+		return Specs(doc)
+	})
+	return err
+}
+
+// Register serves POST /_control/openapi on stub's control plane,
+// registering the routes of the posted document and answering with their
+// IDs.
+func Register(stub *stubsrv.Stub) {
+	stub.HandleControl("/_control/openapi", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		ids, err := stub.LoadSpecs("openapi", "/_control/openapi", func() ([]stubsrv.DynamicHandlerSpec, error) {
+			doc, err := io.ReadAll(r.Body)
+			if err != nil {
+				return nil, err
+			}
+			return Specs(doc)
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, http.StatusCreated, map[string][]string{"ids": ids})
+	})
+}
+
+type document struct {
+	OpenAPI    string                               `json:"openapi"`
+	Paths      map[string]map[string]map[string]any `json:"paths"`
+	Components struct {
+		Schemas map[string]map[string]any `json:"schemas"`
+	} `json:"components"`
+}
+
+// Specs returns the route specs Load registers for doc.
+func Specs(doc []byte) ([]stubsrv.DynamicHandlerSpec, error) {
+	// YAML is a superset of JSON; the document goes through JSON so keys
+	// such as unquoted status codes become strings.
+	var tree any
+	if err := yaml.Unmarshal(doc, &tree); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI document: %w", err)
+	}
+	normalized, err := json.Marshal(stringKeys(tree))
+	if err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI document: %w", err)
+	}
+
+	var parsed document
+	if err := json.Unmarshal(normalized, &parsed); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI document: %w", err)
+	}
+	if !strings.HasPrefix(parsed.OpenAPI, "3.") {
+		return nil, errors.New("only OpenAPI 3 documents are supported")
+	}
+
+	var specs []stubsrv.DynamicHandlerSpec
+	for _, path := range slices.Sorted(maps.Keys(parsed.Paths)) {
+		item := parsed.Paths[path]
+		for _, method := range methods {
+			op, ok := item[method]
+			if !ok {
+				continue
+			}
+			spec, err := parsed.operationSpec(method, path, op)
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: %w", strings.ToUpper(method), path, err)
+			}
+			specs = append(specs, spec)
+		}
+	}
+	return specs, nil
+}
+
+func (doc *document) operationSpec(method, path string, op map[string]any) (stubsrv.DynamicHandlerSpec, error) {
+	spec := stubsrv.DynamicHandlerSpec{
+		Method: strings.ToUpper(method),
+		Path:   routePath(path),
+		Status: http.StatusOK,
+	}
+
+	responses, _ := op["responses"].(map[string]any)
+	code, resp := pickResponse(responses)
+	if code != 0 {
+		spec.Status = code
+	}
+
+	content, _ := resp["content"].(map[string]any)
+	if len(content) == 0 {
+		return spec, nil
+	}
+
+	mediaType := "application/json"
+	if _, ok := content[mediaType]; !ok {
+		mediaType = slices.Sorted(maps.Keys(content))[0]
+	}
+	media, _ := content[mediaType].(map[string]any)
+
+	example, ok := mediaExample(media)
+	if !ok {
+		schema, _ := media["schema"].(map[string]any)
+		example = doc.placeholder(schema, 0)
+	}
+
+	spec.Headers = map[string]string{"Content-Type": mediaType}
+	if str, ok := example.(string); ok && !strings.Contains(mediaType, "json") {
+		spec.Body = str
+		return spec, nil
+	}
+	body, err := json.Marshal(example)
+	if err != nil {
+		return spec, fmt.Errorf("could not encode example: %w", err)
+	}
+	spec.Body = string(body)
+	return spec, nil
+}
+
+// routePath converts {param} segments to the stub's :param syntax.
+func routePath(path string) string {
+	segs := strings.Split(path, "/")
+	for i, seg := range segs {
+		if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+			segs[i] = ":" + strings.Trim(seg, "{}")
+		}
+	}
+	return strings.Join(segs, "/")
+}
+
+// pickResponse returns the lowest 2xx response, falling back to "default".
+func pickResponse(responses map[string]any) (int, map[string]any) {
+	best := 0
+	for key := range responses {
+		code, err := strconv.Atoi(key)
+		if err != nil || code < 200 || code > 299 {
+			continue
+		}
+		if best == 0 || code < best {
+			best = code
+		}
+	}
+	if best != 0 {
+		resp, _ := responses[strconv.Itoa(best)].(map[string]any)
+		return best, resp
+	}
+	resp, _ := responses["default"].(map[string]any)
+	return 0, resp
+}
+
+func mediaExample(media map[string]any) (any, bool) {
+	if ex, ok := media["example"]; ok {
+		return ex, true
+	}
+	examples, _ := media["examples"].(map[string]any)
+	for _, name := range slices.Sorted(maps.Keys(examples)) {
+		if ex, ok := examples[name].(map[string]any); ok {
+			if v, ok := ex["value"]; ok {
+				return v, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// placeholder builds a value satisfying schema, preferring its example,
+// default and enum values.
+func (doc *document) placeholder(schema map[string]any, depth int) any {
+	if schema == nil || depth > maxSchemaDepth {
+		return nil
+	}
+	if ref, ok := schema["$ref"].(string); ok {
+		name := strings.TrimPrefix(ref, "#/components/schemas/")
+		return doc.placeholder(doc.Components.Schemas[name], depth+1)
+	}
+	for _, key := range []string{"example", "default"} {
+		if v, ok := schema[key]; ok {
+			return v
+		}
+	}
+	if enum, ok := schema["enum"].([]any); ok && len(enum) > 0 {
+		return enum[0]
+	}
+	if allOf, ok := schema["allOf"].([]any); ok {
+		merged := make(map[string]any)
+		for _, sub := range allOf {
+			subSchema, _ := sub.(map[string]any)
+			if obj, ok := doc.placeholder(subSchema, depth+1).(map[string]any); ok {
+				maps.Copy(merged, obj)
+			}
+		}
+		return merged
+	}
+	for _, key := range []string{"oneOf", "anyOf"} {
+		if alts, ok := schema[key].([]any); ok && len(alts) > 0 {
+			alt, _ := alts[0].(map[string]any)
+			return doc.placeholder(alt, depth+1)
+		}
+	}
+
+	typ := schema["type"]
+	if typ == nil && schema["properties"] != nil {
+		typ = "object"
+	}
+
+	switch typ {
+	case "object":
+		obj := make(map[string]any)
+		props, _ := schema["properties"].(map[string]any)
+		for name, prop := range props {
+			propSchema, _ := prop.(map[string]any)
+			obj[name] = doc.placeholder(propSchema, depth+1)
+		}
+		return obj
+	case "array":
+		items, _ := schema["items"].(map[string]any)
+		return []any{doc.placeholder(items, depth+1)}
+	case "integer", "number":
+		return 0
+	case "boolean":
+		return false
+	case "string":
+		switch schema["format"] {
+		case "date-time":
+			return "1970-01-01T00:00:00Z"
+		case "date":
+			return "1970-01-01"
+		case "uuid":
+			return "00000000-0000-0000-0000-000000000000"
+		case "email":
+			return "user@example.com"
+		case "uri", "url":
+			return "https://example.com"
+		}
+		return "string"
+	}
+	return nil
+}
+
+func stringKeys(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, val := range v {
+			v[k] = stringKeys(val)
+		}
+		return v
+	case map[any]any:
+		out := make(map[string]any, len(v))
+		for k, val := range v {
+			out[fmt.Sprint(k)] = stringKeys(val)
+		}
+		return out
+	case []any:
+		for i, val := range v {
+			v[i] = stringKeys(val)
+		}
+		return v
+	}
+	return v
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,163 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/alesr/stubsrv"
+	"github.com/alesr/stubsrv/internal/stubtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const petstoreYAML = `
+openapi: 3.0.3
+info: {title: Petstore, version: "1"}
+paths:
+  /pets:
+    get:
+      responses:
+        200:
+          description: pets
+          content:
+            application/json:
+              schema:
+                type: array
+                items: {$ref: '#/components/schemas/Pet'}
+    post:
+      responses:
+        201:
+          description: created
+          content:
+            application/json:
+              example: {id: 7, name: rex}
+        400: {description: bad}
+  /pets/{petId}:
+    get:
+      responses:
+        "200":
+          description: pet
+          content:
+            application/json:
+              examples:
+                cat: {value: {id: 1, name: tom}}
+    delete:
+      responses:
+        "204": {description: deleted}
+components:
+  schemas:
+    Pet:
+      required: [id]
+      properties:
+        id: {type: integer, format: int64}
+        name: {type: string}
+        tag: {type: string, enum: [dog, cat]}
+        born: {type: string, format: date-time}
+        owner: {$ref: '#/components/schemas/Owner'}
+    Owner:
+      allOf:
+        - properties: {email: {type: string, format: email}}
+        - properties: {verified: {type: boolean}}
+`
+
+func TestLoad(t *testing.T) {
+	t.Parallel()
+
+	stub := stubtest.New(t, nil)
+	require.NoError(t, Load(stub, []byte(petstoreYAML)))
+
+	info := stub.Info()
+	require.Len(t, info.Sources, 1)
+	assert.Equal(t, stubsrv.Source{Kind: "openapi", Routes: 4}, info.Sources[0])
+
+	testCases := []struct {
+		name           string
+		givenMethod    string
+		givenPath      string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "schema placeholder",
+			givenMethod:    http.MethodGet,
+			givenPath:      "/pets",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `[{"id":0,"name":"string","tag":"dog","born":"1970-01-01T00:00:00Z","owner":{"email":"user@example.com","verified":false}}]`,
+		},
+		{
+			name:           "lowest 2xx response with example",
+			givenMethod:    http.MethodPost,
+			givenPath:      "/pets",
+			expectedStatus: http.StatusCreated,
+			expectedBody:   `{"id":7,"name":"rex"}`,
+		},
+		{
+			name:           "named examples and path parameters",
+			givenMethod:    http.MethodGet,
+			givenPath:      "/pets/42",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"id":1,"name":"tom"}`,
+		},
+		{
+			name:           "response without content",
+			givenMethod:    http.MethodDelete,
+			givenPath:      "/pets/42",
+			expectedStatus: http.StatusNoContent,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, body := stubtest.Do(t, tc.givenMethod, stub.URL()+tc.givenPath, "")
+
+			assert.Equal(t, tc.expectedStatus, resp.StatusCode)
+			if tc.expectedBody != "" {
+				assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+				assert.JSONEq(t, tc.expectedBody, body)
+			}
+		})
+	}
+}
+
+func TestRegister(t *testing.T) {
+	t.Parallel()
+
+	stub := stubtest.New(t, Register)
+
+	doc := `{"openapi":"3.1.0","paths":{"/health":{"get":{"responses":{"200":{"content":{"text/plain":{"example":"up"}}}}}}}}`
+
+	resp, body := stubtest.Do(t, http.MethodPost, stub.URL()+"/_control/openapi", doc)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	var created struct{ IDs []string }
+	require.NoError(t, json.Unmarshal([]byte(body), &created))
+	assert.Len(t, created.IDs, 1)
+
+	_, body = stubtest.Do(t, http.MethodGet, stub.URL()+"/health", "")
+	assert.Equal(t, "up", body)
+
+	resp, _ = stubtest.Do(t, http.MethodPost, stub.URL()+"/_control/openapi", `swagger: "2.0"`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp, _ = stubtest.Do(t, http.MethodPost, stub.URL()+"/_control/openapi", `{`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// one invalid operation rejects the whole document
+	doc = `{"openapi":"3.1.0","paths":{"/ok":{"get":{"responses":{"200":{}}}},"":{"get":{"responses":{"200":{}}}}}}`
+	resp, _ = stubtest.Do(t, http.MethodPost, stub.URL()+"/_control/openapi", doc)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp, _ = stubtest.Do(t, http.MethodGet, stub.URL()+"/ok", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, _ = stubtest.Do(t, http.MethodGet, stub.URL()+"/_control/openapi", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+
+	// the endpoint is part of the control plane, not a route
+	_, body = stubtest.Do(t, http.MethodGet, stub.URL()+"/_control/handlers", "")
+	var handlers []stubsrv.HandlerInfo
+	require.NoError(t, json.Unmarshal([]byte(body), &handlers))
+	assert.Len(t, handlers, 1, "only the route of /health")
+
+	stub.Reset()
+	resp, _ = stubtest.Do(t, http.MethodPost, stub.URL()+"/_control/openapi", doc)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "still served after Reset")
+}
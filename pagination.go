@@ -0,0 +1,135 @@
+package stubsrv
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursors issues opaque continuation cursors signed with HMAC-SHA256, so a
+// client that tampers with a cursor or reuses one on another endpoint is
+// rejected the way real APIs reject it.
+type Cursors struct {
+	key []byte
+}
+
+// NewCursors returns a cursor codec signing with key, or with a random key
+// when key is empty.
+func NewCursors(key []byte) *Cursors {
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		_, _ = rand.Read(key)
+	}
+	return &Cursors{key: key}
+}
+
+// Encode returns a cursor pointing at offset within scope, typically the
+// route path.
+func (c *Cursors) Encode(scope string, offset int) string {
+	payload := scope + "\x00" + strconv.Itoa(offset)
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString([]byte(payload)) + "." + enc.EncodeToString(c.sign(payload))
+}
+
+// Decode validates cursor against scope and returns its offset.
+func (c *Cursors) Decode(scope, cursor string) (int, error) {
+	enc := base64.RawURLEncoding
+
+	rawPayload, rawSig, ok := strings.Cut(cursor, ".")
+	if !ok {
+		return 0, ErrInvalidCursor
+	}
+	payload, err := enc.DecodeString(rawPayload)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+	sig, err := enc.DecodeString(rawSig)
+	if err != nil || !hmac.Equal(sig, c.sign(string(payload))) {
+		return 0, ErrInvalidCursor
+	}
+
+	gotScope, rawOffset, _ := strings.Cut(string(payload), "\x00")
+	offset, err := strconv.Atoi(rawOffset)
+	if gotScope != scope || err != nil || offset < 0 {
+		return 0, ErrInvalidCursor
+	}
+	return offset, nil
+}
+
+func (c *Cursors) sign(payload string) []byte {
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+type PaginationConfig struct {
+	Items []any
+	// PageSize defaults to 10 and can be lowered per request with ?limit=.
+	PageSize int
+	// CursorParam is the query parameter carrying the cursor. Defaults to "cursor".
+	CursorParam string
+	// Cursors signs the cursors. Defaults to a codec with a random key.
+	Cursors *Cursors
+}
+
+type pageResponse struct {
+	Items      []any  `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	HasMore    bool   `json:"has_more"`
+}
+
+// AddPaginated registers a route serving cfg.Items a page at a time. Each
+// page carries a signed next_cursor; unknown or tampered cursors get a 400.
+func (s *Stub) AddPaginated(method, path string, cfg PaginationConfig, middlewares ...Middleware) {
+	if cfg.PageSize <= 0 {
+		cfg.PageSize = 10
+	}
+	if cfg.CursorParam == "" {
+		cfg.CursorParam = "cursor"
+	}
+	if cfg.Cursors == nil {
+		cfg.Cursors = NewCursors(nil)
+	}
+	s.AddHandler(method, path, paginatedHandler(cfg), middlewares...)
+}
+
+func paginatedHandler(cfg PaginationConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		size := cfg.PageSize
+		if raw := r.URL.Query().Get("limit"); raw != "" {
+			limit, err := strconv.Atoi(raw)
+			if err != nil || limit <= 0 {
+				http.Error(w, "invalid limit", http.StatusBadRequest)
+				return
+			}
+			size = min(size, limit)
+		}
+
+		var offset int
+		if cursor := r.URL.Query().Get(cfg.CursorParam); cursor != "" {
+			var err error
+			if offset, err = cfg.Cursors.Decode(r.URL.Path, cursor); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		start := min(offset, len(cfg.Items))
+		end := min(start+size, len(cfg.Items))
+		resp := pageResponse{Items: cfg.Items[start:end], HasMore: end < len(cfg.Items)}
+		if resp.HasMore {
+			resp.NextCursor = cfg.Cursors.Encode(r.URL.Path, end)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
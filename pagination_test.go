@@ -0,0 +1,90 @@
+package stubsrv
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCursors(t *testing.T) {
+	t.Parallel()
+
+	c := NewCursors([]byte("secret"))
+	cursor := c.Encode("/items", 20)
+
+	testCases := []struct {
+		name           string
+		givenScope     string
+		givenCursor    string
+		expectedOffset int
+		expectedErr    error
+	}{
+		{name: "round trip", givenScope: "/items", givenCursor: cursor, expectedOffset: 20},
+		{name: "other scope", givenScope: "/users", givenCursor: cursor, expectedErr: ErrInvalidCursor},
+		{name: "tampered", givenScope: "/items", givenCursor: "x" + cursor, expectedErr: ErrInvalidCursor},
+		{name: "foreign key", givenScope: "/items", givenCursor: NewCursors(nil).Encode("/items", 20), expectedErr: ErrInvalidCursor},
+		{name: "garbage", givenScope: "/items", givenCursor: "abc", expectedErr: ErrInvalidCursor},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			offset, err := c.Decode(tc.givenScope, tc.givenCursor)
+			assert.ErrorIs(t, err, tc.expectedErr)
+			assert.Equal(t, tc.expectedOffset, offset)
+		})
+	}
+}
+
+func TestStub_AddPaginated(t *testing.T) {
+	t.Parallel()
+
+	stub := NewStub(noopLogger())
+	stub.AddPaginated(http.MethodGet, "/items", PaginationConfig{
+		Items:    []any{1, 2, 3, 4, 5},
+		PageSize: 2,
+	})
+	require.NoError(t, stub.Start())
+	defer stub.Close()
+
+	var (
+		got    []any
+		pages  int
+		cursor string
+	)
+	for {
+		resp, err := http.Get(stub.URL() + "/items?cursor=" + url.QueryEscape(cursor))
+		require.NoError(t, err)
+
+		var page pageResponse
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&page))
+		resp.Body.Close()
+
+		got = append(got, page.Items...)
+		pages++
+		if !page.HasMore {
+			assert.Empty(t, page.NextCursor)
+			break
+		}
+		cursor = page.NextCursor
+	}
+	assert.Equal(t, []any{1.0, 2.0, 3.0, 4.0, 5.0}, got)
+	assert.Equal(t, 3, pages)
+
+	resp, err := http.Get(stub.URL() + "/items?cursor=bogus")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, err = http.Get(stub.URL() + "/items?limit=1")
+	require.NoError(t, err)
+	var page pageResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&page))
+	resp.Body.Close()
+	assert.Equal(t, []any{1.0}, page.Items)
+}
@@ -0,0 +1,192 @@
+package stubsrv
+
+import (
+	"encoding/json"
+	"errors"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParamType is the type a path parameter must have, see ValidateParams.
+type ParamType string
+
+const (
+	ParamUUID   ParamType = "uuid"
+	ParamInt    ParamType = "int"
+	ParamNumber ParamType = "number"
+	ParamBool   ParamType = "bool"
+)
+
+func (t ParamType) valid() bool {
+	switch t {
+	case ParamUUID, ParamInt, ParamNumber, ParamBool:
+		return true
+	}
+	return false
+}
+
+// check returns why v is not of type t, or "".
+func (t ParamType) check(v string) string {
+	switch t {
+	case ParamUUID:
+		if !isUUID(v) {
+			return "must be a valid UUID"
+		}
+	case ParamInt:
+		if _, err := strconv.ParseInt(v, 10, 64); err != nil {
+			return "must be an integer"
+		}
+	case ParamNumber:
+		if _, err := strconv.ParseFloat(v, 64); err != nil {
+			return "must be a number"
+		}
+	case ParamBool:
+		if _, err := strconv.ParseBool(v); err != nil {
+			return "must be a boolean"
+		}
+	}
+	return ""
+}
+
+// isUUID reports whether v is a UUID in its canonical 8-4-4-4-12 form.
+func isUUID(v string) bool {
+	if len(v) != 36 {
+		return false
+	}
+	for i, c := range v {
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// ParamErrorStyle selects the framework whose validation errors
+// ValidateParams imitates.
+type ParamErrorStyle string
+
+const (
+	// ParamErrorProblem answers 400 with an RFC 9457 problem document
+	// listing the invalid parameters under "invalid-params".
+	ParamErrorProblem ParamErrorStyle = "problem"
+	// ParamErrorFastAPI answers 422 with FastAPI's "detail" list.
+	ParamErrorFastAPI ParamErrorStyle = "fastapi"
+	// ParamErrorSpring answers 400 with Spring Boot's default error body.
+	ParamErrorSpring ParamErrorStyle = "spring"
+)
+
+func (st ParamErrorStyle) valid() bool {
+	switch st {
+	case ParamErrorProblem, ParamErrorFastAPI, ParamErrorSpring:
+		return true
+	}
+	return false
+}
+
+// ValidateParams returns a middleware answering with a validation error in
+// style, or ParamErrorProblem when it is empty, when a path parameter of
+// the route is not of its type in types. It panics if a type or the style
+// is unknown.
+func ValidateParams(types map[string]ParamType, style ParamErrorStyle) Middleware {
+	if style == "" {
+		style = ParamErrorProblem
+	}
+	if !style.valid() {
+		panic("unknown param error style: " + string(style))
+	}
+	for _, t := range types {
+		if !t.valid() {
+			panic("unknown param type: " + string(t))
+		}
+	}
+	names := slices.Sorted(maps.Keys(types))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var invalid []paramError
+			for _, name := range names {
+				if reason := types[name].check(PathParam(r, name)); reason != "" {
+					invalid = append(invalid, paramError{name: name, typ: types[name], reason: reason})
+				}
+			}
+			if len(invalid) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			writeParamErrors(w, r, style, invalid)
+		})
+	}
+}
+
+// validateParamTypes checks that spec's param types and error style are
+// known and only name parameters of its path.
+func validateParamTypes(spec *DynamicHandlerSpec) error {
+	if spec.ParamErrorStyle != "" && !spec.ParamErrorStyle.valid() {
+		return errors.New("unknown param_error_style: " + string(spec.ParamErrorStyle))
+	}
+	segments := strings.Split(strings.Trim(spec.Path, "/"), "/")
+	for _, name := range slices.Sorted(maps.Keys(spec.ParamTypes)) {
+		if !spec.ParamTypes[name].valid() {
+			return errors.New("unknown param type: " + string(spec.ParamTypes[name]))
+		}
+		if !slices.Contains(segments, ":"+name) {
+			return errors.New("param_types names a parameter not in the path: " + name)
+		}
+	}
+	return nil
+}
+
+type paramError struct {
+	name   string
+	typ    ParamType
+	reason string
+}
+
+func writeParamErrors(w http.ResponseWriter, r *http.Request, style ParamErrorStyle, invalid []paramError) {
+	switch style {
+	case ParamErrorFastAPI:
+		detail := make([]map[string]any, len(invalid))
+		for i, e := range invalid {
+			detail[i] = map[string]any{
+				"type":  string(e.typ) + "_parsing",
+				"loc":   []string{"path", e.name},
+				"msg":   "Input " + e.reason,
+				"input": PathParam(r, e.name),
+			}
+		}
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]any{"detail": detail})
+	case ParamErrorSpring:
+		writeJSON(w, http.StatusBadRequest, map[string]any{
+			"timestamp": time.Now().UTC().Format(time.RFC3339Nano),
+			"status":    http.StatusBadRequest,
+			"error":     http.StatusText(http.StatusBadRequest),
+			"path":      r.URL.Path,
+		})
+	default:
+		params := make([]map[string]string, len(invalid))
+		for i, e := range invalid {
+			params[i] = map[string]string{"name": e.name, "reason": e.reason}
+		}
+		body, _ := json.Marshal(map[string]any{
+			"type":           "about:blank",
+			"title":          http.StatusText(http.StatusBadRequest),
+			"status":         http.StatusBadRequest,
+			"detail":         "path parameter " + invalid[0].name + " " + invalid[0].reason,
+			"invalid-params": params,
+		})
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write(body)
+	}
+}
@@ -0,0 +1,107 @@
+package stubsrv
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateParams(t *testing.T) {
+	t.Parallel()
+
+	stub := NewStub(noopLogger())
+	require.NoError(t, stub.Start())
+	defer stub.Close()
+
+	controlAdd(t, stub, `{"method":"GET","path":"/users/:id/orders/:n","body":"ok","param_types":{"id":"uuid","n":"int"}}`)
+	controlAdd(t, stub, `{"method":"GET","path":"/fastapi/:id","body":"ok","param_types":{"id":"uuid"},"param_error_style":"fastapi"}`)
+	controlAdd(t, stub, `{"method":"GET","path":"/spring/:flag","body":"ok","param_types":{"flag":"bool"},"param_error_style":"spring"}`)
+
+	testCases := []struct {
+		name                string
+		givenPath           string
+		expectedStatus      int
+		expectedContentType string
+		expectedBody        map[string]any
+	}{
+		{
+			name:           "valid params",
+			givenPath:      "/users/3F2504E0-4F89-11D3-9A0C-0305E82C3301/orders/7",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:                "problem details",
+			givenPath:           "/users/42/orders/x",
+			expectedStatus:      http.StatusBadRequest,
+			expectedContentType: "application/problem+json",
+			expectedBody: map[string]any{
+				"type":   "about:blank",
+				"title":  "Bad Request",
+				"status": float64(400),
+				"detail": "path parameter id must be a valid UUID",
+				"invalid-params": []any{
+					map[string]any{"name": "id", "reason": "must be a valid UUID"},
+					map[string]any{"name": "n", "reason": "must be an integer"},
+				},
+			},
+		},
+		{
+			name:                "fastapi",
+			givenPath:           "/fastapi/42",
+			expectedStatus:      http.StatusUnprocessableEntity,
+			expectedContentType: "application/json",
+			expectedBody: map[string]any{
+				"detail": []any{map[string]any{
+					"type":  "uuid_parsing",
+					"loc":   []any{"path", "id"},
+					"msg":   "Input must be a valid UUID",
+					"input": "42",
+				}},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := http.Get(stub.URL() + tc.givenPath)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, tc.expectedStatus, resp.StatusCode)
+			if tc.expectedBody == nil {
+				assert.Equal(t, "ok", readAll(t, resp))
+				return
+			}
+			assert.Equal(t, tc.expectedContentType, resp.Header.Get("Content-Type"))
+			var got map[string]any
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+			assert.Equal(t, tc.expectedBody, got)
+		})
+	}
+
+	t.Run("spring", func(t *testing.T) {
+		resp, err := http.Get(stub.URL() + "/spring/maybe")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		var got map[string]any
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+		assert.Equal(t, "Bad Request", got["error"])
+		assert.Equal(t, "/spring/maybe", got["path"])
+		assert.NotEmpty(t, got["timestamp"])
+	})
+
+	for _, spec := range []string{
+		`{"method":"GET","path":"/x/:id","param_types":{"id":"date"}}`,
+		`{"method":"GET","path":"/x/:id","param_types":{"other":"uuid"}}`,
+		`{"method":"GET","path":"/x/:id","param_types":{"id":"uuid"},"param_error_style":"rails"}`,
+	} {
+		controlDo(t, stub, http.MethodPost, "/_control/handlers", spec, http.StatusBadRequest, nil)
+	}
+
+	assert.Panics(t, func() { ValidateParams(map[string]ParamType{"id": "date"}, "") })
+}
@@ -0,0 +1,182 @@
+package stubsrv
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type ConditionalConfig struct {
+	Body        []byte
+	ContentType string
+	// Optional lets writes without If-Match or If-Unmodified-Since through
+	// instead of answering 428 Precondition Required.
+	Optional bool
+}
+
+// ConditionalResource is a single document served with ETag and
+// Last-Modified validators, whose writes follow precondition semantics:
+// 428 without a precondition, 412 when it fails.
+type ConditionalResource struct {
+	cfg ConditionalConfig
+	now func() time.Time
+
+	mu       sync.Mutex
+	body     []byte
+	version  int
+	modified time.Time
+	deleted  bool
+}
+
+// AddConditional registers GET, HEAD, PUT and DELETE on path, serving a
+// document that clients must update with If-Match or If-Unmodified-Since.
+// PUT with "If-None-Match: *" recreates a deleted document.
+func (s *Stub) AddConditional(path string, cfg ConditionalConfig, middlewares ...Middleware) *ConditionalResource {
+	cr := ConditionalResource{
+		cfg:      cfg,
+		now:      s.now,
+		body:     cfg.Body,
+		version:  1,
+		modified: s.now(),
+	}
+
+	s.AddHandler(http.MethodGet, path, cr.handleGet, middlewares...)
+	s.AddHandler(http.MethodHead, path, cr.handleGet, middlewares...)
+	s.AddHandler(http.MethodPut, path, cr.handleWrite, middlewares...)
+	s.AddHandler(http.MethodDelete, path, cr.handleWrite, middlewares...)
+	return &cr
+}
+
+// Set replaces the document as a concurrent writer would, invalidating
+// validators held by clients.
+func (cr *ConditionalResource) Set(body []byte) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	cr.update(body)
+}
+
+func (cr *ConditionalResource) Body() []byte {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	return cr.body
+}
+
+// ETag returns the current entity tag, quotes included.
+func (cr *ConditionalResource) ETag() string {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	return cr.etag()
+}
+
+func (cr *ConditionalResource) etag() string {
+	return `"v` + strconv.Itoa(cr.version) + `"`
+}
+
+func (cr *ConditionalResource) update(body []byte) {
+	cr.body = body
+	cr.version++
+	cr.modified = cr.now()
+	cr.deleted = false
+}
+
+func (cr *ConditionalResource) writeValidators(w http.ResponseWriter) {
+	w.Header().Set("ETag", cr.etag())
+	w.Header().Set("Last-Modified", cr.modified.UTC().Format(http.TimeFormat))
+}
+
+func (cr *ConditionalResource) handleGet(w http.ResponseWriter, r *http.Request) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	if cr.deleted {
+		http.NotFound(w, r)
+		return
+	}
+
+	cr.writeValidators(w)
+	if etagListMatch(r.Header.Get("If-None-Match"), cr.etag()) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if cr.cfg.ContentType != "" {
+		w.Header().Set("Content-Type", cr.cfg.ContentType)
+	}
+	if r.Method == http.MethodGet {
+		_, _ = w.Write(cr.body)
+	}
+}
+
+func (cr *ConditionalResource) handleWrite(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "could not read body", http.StatusBadRequest)
+		return
+	}
+
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	ifMatch := r.Header.Get("If-Match")
+	ifUnmodified := r.Header.Get("If-Unmodified-Since")
+	ifNoneMatch := r.Header.Get("If-None-Match")
+
+	switch {
+	case r.Method == http.MethodPut && ifNoneMatch == "*":
+		if !cr.deleted {
+			http.Error(w, http.StatusText(http.StatusPreconditionFailed), http.StatusPreconditionFailed)
+			return
+		}
+		cr.update(body)
+		cr.writeValidators(w)
+		w.WriteHeader(http.StatusCreated)
+		return
+	case ifMatch != "":
+		if cr.deleted || !etagListMatch(ifMatch, cr.etag()) {
+			http.Error(w, http.StatusText(http.StatusPreconditionFailed), http.StatusPreconditionFailed)
+			return
+		}
+	case ifUnmodified != "":
+		since, err := http.ParseTime(ifUnmodified)
+		if err != nil || cr.deleted || cr.modified.Truncate(time.Second).After(since) {
+			http.Error(w, http.StatusText(http.StatusPreconditionFailed), http.StatusPreconditionFailed)
+			return
+		}
+	case !cr.cfg.Optional:
+		http.Error(w, http.StatusText(http.StatusPreconditionRequired), http.StatusPreconditionRequired)
+		return
+	case cr.deleted:
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		cr.deleted = true
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	cr.update(body)
+	cr.writeValidators(w)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// etagListMatch reports whether an If-Match or If-None-Match header value
+// lists etag, comparing weakly.
+func etagListMatch(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	for candidate := range strings.SplitSeq(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package stubsrv
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStub_AddConditional(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	stub := NewStub(noopLogger(), WithClock(func() time.Time { return now }))
+	doc := stub.AddConditional("/doc", ConditionalConfig{Body: []byte("v1"), ContentType: "text/plain"})
+	require.NoError(t, stub.Start())
+	defer stub.Close()
+
+	do := func(method string, headers map[string]string, body string) *http.Response {
+		t.Helper()
+
+		req, err := http.NewRequest(method, stub.URL()+"/doc", strings.NewReader(body))
+		require.NoError(t, err)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+
+	resp := do(http.MethodGet, nil, "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	etag := resp.Header.Get("ETag")
+	assert.Equal(t, `"v1"`, etag)
+	assert.Equal(t, "Fri, 01 Mar 2024 12:00:00 GMT", resp.Header.Get("Last-Modified"))
+
+	assert.Equal(t, http.StatusNotModified, do(http.MethodGet, map[string]string{"If-None-Match": etag}, "").StatusCode)
+	assert.Equal(t, http.StatusPreconditionRequired, do(http.MethodPut, nil, "v2").StatusCode)
+	assert.Equal(t, http.StatusPreconditionFailed, do(http.MethodPut, map[string]string{"If-Match": `"v0"`}, "v2").StatusCode)
+
+	resp = do(http.MethodPut, map[string]string{"If-Match": etag}, "v2")
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Equal(t, `"v2"`, resp.Header.Get("ETag"))
+	assert.Equal(t, "v2", string(doc.Body()))
+
+	doc.Set([]byte("concurrent"))
+	assert.Equal(t, http.StatusPreconditionFailed, do(http.MethodPut, map[string]string{"If-Match": `"v2"`}, "v3").StatusCode)
+
+	stale := now.Add(-time.Hour).Format(http.TimeFormat)
+	assert.Equal(t, http.StatusPreconditionFailed, do(http.MethodDelete, map[string]string{"If-Unmodified-Since": stale}, "").StatusCode)
+	fresh := now.Format(http.TimeFormat)
+	assert.Equal(t, http.StatusNoContent, do(http.MethodDelete, map[string]string{"If-Unmodified-Since": fresh}, "").StatusCode)
+
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, nil, "").StatusCode)
+	assert.Equal(t, http.StatusPreconditionFailed, do(http.MethodPut, map[string]string{"If-Match": "*"}, "v4").StatusCode)
+	assert.Equal(t, http.StatusCreated, do(http.MethodPut, map[string]string{"If-None-Match": "*"}, "v4").StatusCode)
+	assert.Equal(t, http.StatusPreconditionFailed, do(http.MethodPut, map[string]string{"If-None-Match": "*"}, "v5").StatusCode)
+	assert.Equal(t, "v4", string(doc.Body()))
+	assert.Equal(t, `"v4"`, doc.ETag())
+}
+
+func TestEtagListMatch(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name        string
+		givenHeader string
+		expected    bool
+	}{
+		{name: "empty", givenHeader: "", expected: false},
+		{name: "exact", givenHeader: `"v1"`, expected: true},
+		{name: "weak", givenHeader: `W/"v1"`, expected: true},
+		{name: "list", givenHeader: `"v0", "v1"`, expected: true},
+		{name: "wildcard", givenHeader: "*", expected: true},
+		{name: "mismatch", givenHeader: `"v2"`, expected: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tc.expected, etagListMatch(tc.givenHeader, `"v1"`))
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package stubsrv
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestURLSigner(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	signer := NewURLSigner([]byte("secret")).WithClock(func() time.Time { return now })
+
+	stub := NewStub(noopLogger())
+	stub.AddHandler(http.MethodGet, "/bucket/:key", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("object"))
+	}, RequirePresigned(signer))
+	require.NoError(t, stub.Start())
+	t.Cleanup(stub.Close)
+
+	signed, err := signer.Sign(http.MethodGet, stub.URL()+"/bucket/a.txt?versionId=3", time.Minute)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name           string
+		givenURL       string
+		givenAdvance   time.Duration
+		expectedStatus int
+		expectedCode   string
+	}{
+		{name: "valid", givenURL: signed, expectedStatus: http.StatusOK},
+		{name: "tampered path", givenURL: strings.Replace(signed, "a.txt", "b.txt", 1), expectedStatus: http.StatusForbidden, expectedCode: "SignatureDoesNotMatch"},
+		{name: "tampered query", givenURL: strings.Replace(signed, "versionId=3", "versionId=4", 1), expectedStatus: http.StatusForbidden, expectedCode: "SignatureDoesNotMatch"},
+		{name: "unsigned", givenURL: stub.URL() + "/bucket/a.txt", expectedStatus: http.StatusForbidden, expectedCode: "SignatureDoesNotMatch"},
+		{name: "expired", givenURL: signed, givenAdvance: 2 * time.Minute, expectedStatus: http.StatusForbidden, expectedCode: "AccessDenied"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			signer.now = func() time.Time { return now.Add(tc.givenAdvance) }
+
+			resp, err := http.Get(tc.givenURL)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.expectedStatus, resp.StatusCode)
+			if tc.expectedCode != "" {
+				assert.Contains(t, string(body), "<Code>"+tc.expectedCode+"</Code>")
+			}
+		})
+	}
+
+	t.Run("method is part of the signature", func(t *testing.T) {
+		signer.now = func() time.Time { return now }
+
+		req, err := http.NewRequest(http.MethodPut, signed, nil)
+		require.NoError(t, err)
+		assert.ErrorIs(t, signer.Verify(req), ErrSignatureMismatch)
+	})
+}
+
+func TestURLSigner_StubClock(t *testing.T) {
+	t.Parallel()
+
+	var advance atomic.Int64
+	stub := NewStub(noopLogger(), WithClock(func() time.Time {
+		return time.Now().Add(time.Duration(advance.Load()))
+	}))
+	signer := NewURLSigner([]byte("secret"))
+	stub.AddHandler(http.MethodGet, "/bucket/:key", func(w http.ResponseWriter, r *http.Request) {}, RequirePresigned(signer))
+	require.NoError(t, stub.Start())
+	t.Cleanup(stub.Close)
+
+	signed, err := signer.Sign(http.MethodGet, stub.URL()+"/bucket/a.txt", time.Minute)
+	require.NoError(t, err)
+
+	resp, err := http.Get(signed)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	advance.Store(int64(2 * time.Minute))
+	resp, err = http.Get(signed)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode, "URLs expire on the stub's clock")
+}
@@ -0,0 +1,163 @@
+package stubsrv
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+)
+
+// ProxyTo forwards requests that match no route to upstream and records
+// each exchange. Pass an empty string to stop proxying.
+//
+// Recordings returns the exchanges as specs, which AddSpec or the control
+// plane turn into stubbed routes for playback without the upstream.
+func (s *Stub) ProxyTo(upstream string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if upstream == "" {
+		s.proxy = nil
+		return nil
+	}
+
+	target, err := url.Parse(upstream)
+	if err != nil || target.Scheme == "" || target.Host == "" {
+		return fmt.Errorf("invalid upstream URL %q", upstream)
+	}
+
+	s.proxy = &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(target)
+			pr.SetXForwarded()
+		},
+	}
+
+	s.logger.Debug("Proxying unmatched requests", slog.String("upstream", upstream))
+	return nil
+}
+
+// Recordings returns the exchanges captured while proxying, oldest first.
+// Repeated requests are recorded each time; stubsrv record keeps the first
+// of each when writing fixtures.
+func (s *Stub) Recordings() []DynamicHandlerSpec {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]DynamicHandlerSpec(nil), s.recordings...)
+}
+
+// AddSpec registers a route serving spec, as POST /_control/handlers does,
+// and returns its ID.
+func (s *Stub) AddSpec(spec DynamicHandlerSpec) (string, error) {
+	info, err := s.specRoute(&spec)
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		panic("cannot add handlers on a closed stub server")
+	}
+	return s.addRoute(spec.Method, spec.Path, spec.Query, info), nil
+}
+
+// AddSpecs registers a route for each spec, as POST /_control/handlers/bulk
+// does, and returns their IDs. Either every spec is valid and registered or
+// none is.
+func (s *Stub) AddSpecs(specs ...DynamicHandlerSpec) ([]string, error) {
+	defer s.beginLoad()()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cc, err := s.compileConfig(Config{Routes: specs})
+	if err != nil {
+		return nil, err
+	}
+	if s.closed {
+		panic("cannot add handlers on a closed stub server")
+	}
+
+	ids := make([]string, len(cc.specs))
+	for i, spec := range cc.specs {
+		ids[i] = s.addRoute(spec.Method, spec.Path, spec.Query, cc.infos[i])
+	}
+	return ids, nil
+}
+
+// LoadSpecs registers the routes returned by load in one step, as AddSpecs
+// does, and records them as a source of the given kind and name in Info.
+// /readyz reports the stub as loading until load returns, so packages
+// generating routes, such as openapi, gate readiness like LoadConfig.
+func (s *Stub) LoadSpecs(kind, name string, load func() ([]DynamicHandlerSpec, error)) ([]string, error) {
+	defer s.beginLoad()()
+
+	specs, err := load()
+	if err != nil {
+		return nil, err
+	}
+	ids, err := s.AddSpecs(specs...)
+	if err != nil {
+		return nil, err
+	}
+	s.addSource(Source{Kind: kind, Name: name, Routes: len(ids)})
+	return ids, nil
+}
+
+// proxyAndRecord serves r through proxy and records the exchange. The
+// response is buffered so it can be captured.
+func (s *Stub) proxyAndRecord(proxy http.Handler, w http.ResponseWriter, r *http.Request) {
+	reqBody := peekBody(r)
+
+	rec := httptest.NewRecorder()
+	proxy.ServeHTTP(rec, r)
+
+	for k, v := range rec.Header() {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(rec.Code)
+	_, _ = w.Write(rec.Body.Bytes())
+
+	spec := DynamicHandlerSpec{
+		Method:  r.Method,
+		Path:    r.URL.Path,
+		Status:  rec.Code,
+		Body:    rec.Body.String(),
+		Headers: make(map[string]string),
+	}
+	for k, v := range r.URL.Query() {
+		if spec.Query == nil {
+			spec.Query = make(map[string]string)
+		}
+		spec.Query[k] = v[0]
+	}
+	if len(reqBody) > 0 {
+		spec.MatchBody = string(reqBody)
+		spec.MatchBodyMode = BodyExact
+	}
+	for k := range rec.Header() {
+		if k == "Content-Length" || k == "Date" {
+			continue
+		}
+		spec.Headers[k] = rec.Header().Get(k)
+	}
+
+	s.mu.Lock()
+	s.recordings, s.recordingBytes, _, _ = appendLimited(s.journal.limits, s.recordings, s.recordingBytes, spec, func(spec DynamicHandlerSpec) int64 {
+		return int64(len(spec.Body) + len(spec.MatchBody))
+	})
+	s.mu.Unlock()
+}
+
+func (s *Stub) controlRecordings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.Recordings())
+}
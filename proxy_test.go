@@ -0,0 +1,93 @@
+package stubsrv
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStub_ProxyTo(t *testing.T) {
+	t.Parallel()
+
+	var upstreamCalls int
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamCalls++
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Upstream", "yes")
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte(r.Method + " " + r.URL.RequestURI() + " " + string(body)))
+	}))
+	defer upstream.Close()
+
+	recorder := NewStub(noopLogger())
+	recorder.AddHandler(http.MethodGet, "/local", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("local"))
+	})
+	require.NoError(t, recorder.ProxyTo(upstream.URL))
+	require.NoError(t, recorder.Start())
+	defer recorder.Close()
+
+	assert.Equal(t, "local", getBody(t, recorder.URL()+"/local"))
+
+	resp, err := http.Post(recorder.URL()+"/orders?v=2", "text/plain", strings.NewReader("sku-1"))
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	assert.Equal(t, "yes", resp.Header.Get("X-Upstream"))
+	assert.Equal(t, "POST /orders?v=2 sku-1", string(body))
+	assert.Equal(t, 1, upstreamCalls)
+
+	recs := recorder.Recordings()
+	require.Len(t, recs, 1)
+	assert.Equal(t, DynamicHandlerSpec{
+		Method:        http.MethodPost,
+		Path:          "/orders",
+		Query:         map[string]string{"v": "2"},
+		Status:        http.StatusAccepted,
+		Body:          "POST /orders?v=2 sku-1",
+		Headers:       map[string]string{"X-Upstream": "yes", "Content-Type": "text/plain; charset=utf-8"},
+		MatchBody:     "sku-1",
+		MatchBodyMode: BodyExact,
+	}, recs[0])
+
+	t.Run("replays recordings without the upstream", func(t *testing.T) {
+		player := NewStub(noopLogger())
+		for _, spec := range recs {
+			_, err := player.AddSpec(spec)
+			require.NoError(t, err)
+		}
+		require.NoError(t, player.Start())
+		defer player.Close()
+
+		resp, err := http.Post(player.URL()+"/orders?v=2", "text/plain", strings.NewReader("sku-1"))
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+		assert.Equal(t, "POST /orders?v=2 sku-1", string(body))
+		assert.Equal(t, 1, upstreamCalls)
+	})
+
+	t.Run("stops proxying", func(t *testing.T) {
+		require.NoError(t, recorder.ProxyTo(""))
+
+		resp, err := http.Get(recorder.URL() + "/orders")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("rejects invalid upstream", func(t *testing.T) {
+		assert.Error(t, NewStub(noopLogger()).ProxyTo("not a url"))
+	})
+}
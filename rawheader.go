@@ -0,0 +1,71 @@
+package stubsrv
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// RawHeader is a response header written exactly as given, without
+// canonicalizing its name.
+type RawHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// RawResponse returns a handler writing status, headers and body straight
+// to the connection, keeping the headers' case, order and duplicates, for
+// clients that depend on them. Content-Length and Connection: close are
+// added unless headers set them, since the connection is closed after the
+// response. It needs a hijackable HTTP/1.x connection, so it fails with 500
+// over HTTP/2. It panics if a header name is invalid or a header holds a
+// line break.
+func RawResponse(status int, headers []RawHeader, body string) http.HandlerFunc {
+	if err := validateRawHeaders(headers); err != nil {
+		panic(err)
+	}
+
+	var hasLength, hasConnection bool
+	for _, h := range headers {
+		hasLength = hasLength || strings.EqualFold(h.Name, "Content-Length")
+		hasConnection = hasConnection || strings.EqualFold(h.Name, "Connection")
+	}
+
+	var b strings.Builder
+	b.WriteString("HTTP/1.1 " + strconv.Itoa(status) + " " + http.StatusText(status) + "\r\n")
+	for _, h := range headers {
+		b.WriteString(h.Name + ": " + h.Value + "\r\n")
+	}
+	if !hasLength {
+		b.WriteString("Content-Length: " + strconv.Itoa(len(body)) + "\r\n")
+	}
+	if !hasConnection {
+		b.WriteString("Connection: close\r\n")
+	}
+	b.WriteString("\r\n")
+	b.WriteString(body)
+	raw := b.String()
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		conn, buf, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			ReportError(r, err)
+			http.Error(w, "raw headers require a hijackable HTTP/1.x connection", http.StatusInternalServerError)
+			return
+		}
+		defer conn.Close()
+
+		_, _ = buf.WriteString(raw)
+		_ = buf.Flush()
+	}
+}
+
+func validateRawHeaders(headers []RawHeader) error {
+	for _, h := range headers {
+		if h.Name == "" || strings.ContainsAny(h.Name, ": \r\n") || strings.ContainsAny(h.Value, "\r\n") {
+			return errors.New("invalid raw header: " + strconv.Quote(h.Name+": "+h.Value))
+		}
+	}
+	return nil
+}
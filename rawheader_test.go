@@ -0,0 +1,93 @@
+package stubsrv
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRawResponse(t *testing.T) {
+	t.Parallel()
+
+	stub := NewStub(noopLogger())
+	stub.AddHandler(http.MethodGet, "/raw", RawResponse(http.StatusOK, []RawHeader{
+		{Name: "x-request-id", Value: "abc"},
+		{Name: "Set-Cookie", Value: "a=1"},
+		{Name: "SET-COOKIE", Value: "b=2"},
+		{Name: "content-type", Value: "text/plain"},
+	}, "hello"))
+	require.NoError(t, stub.Start())
+	t.Cleanup(stub.Close)
+
+	controlAdd(t, stub, `{"method":"GET","path":"/spec","status":201,"body":"{}",
+		"raw_headers":[{"name":"X-lower","value":"1"},{"name":"content-length","value":"2"}]}`)
+	controlDo(t, stub, http.MethodPost, "/_control/handlers",
+		`{"method":"GET","path":"/bad","headers":{"A":"1"},"raw_headers":[{"name":"B","value":"2"}]}`, http.StatusBadRequest, nil)
+	controlDo(t, stub, http.MethodPost, "/_control/handlers",
+		`{"method":"GET","path":"/bad","raw_headers":[{"name":"B","value":"2\r\nInjected: 1"}]}`, http.StatusBadRequest, nil)
+
+	testCases := []struct {
+		name          string
+		givenPath     string
+		expectedLines []string
+		expectedBody  string
+	}{
+		{
+			name:      "go api",
+			givenPath: "/raw",
+			expectedLines: []string{
+				"HTTP/1.1 200 OK",
+				"x-request-id: abc",
+				"Set-Cookie: a=1",
+				"SET-COOKIE: b=2",
+				"content-type: text/plain",
+				"Content-Length: 5",
+				"Connection: close",
+			},
+			expectedBody: "hello",
+		},
+		{
+			name:      "spec",
+			givenPath: "/spec",
+			expectedLines: []string{
+				"HTTP/1.1 201 Created",
+				"X-lower: 1",
+				"content-length: 2",
+				"Connection: close",
+			},
+			expectedBody: "{}",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			u, err := url.Parse(stub.URL())
+			require.NoError(t, err)
+			conn, err := net.Dial("tcp", u.Host)
+			require.NoError(t, err)
+			defer conn.Close()
+
+			_, err = fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: stub\r\n\r\n", tc.givenPath)
+			require.NoError(t, err)
+
+			raw, err := io.ReadAll(bufio.NewReader(conn))
+			require.NoError(t, err)
+			head, body, ok := strings.Cut(string(raw), "\r\n\r\n")
+			require.True(t, ok)
+			assert.Equal(t, tc.expectedLines, strings.Split(head, "\r\n"))
+			assert.Equal(t, tc.expectedBody, body)
+		})
+	}
+
+	assert.Panics(t, func() { RawResponse(http.StatusOK, []RawHeader{{Name: "Bad Name", Value: "x"}}, "") })
+}
@@ -0,0 +1,108 @@
+package stubsrv
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+const dependencyTimeout = 2 * time.Second
+
+// WithReadinessGate keeps /readyz answering 503 until MarkReady is called or
+// POST /_control/ready is received, so orchestrators can wait for fixtures
+// registered after Start.
+func WithReadinessGate() Option {
+	return func(cfg *stubConfig) {
+		cfg.gated = true
+	}
+}
+
+// WithDependencies makes /readyz answer 503 until every url responds to a
+// GET with a status below 500.
+func WithDependencies(urls ...string) Option {
+	return func(cfg *stubConfig) {
+		cfg.dependencies = append(cfg.dependencies, urls...)
+	}
+}
+
+// MarkReady opens the readiness gate set by WithReadinessGate.
+func (s *Stub) MarkReady() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.ready = true
+}
+
+// beginLoad marks a fixture load in progress until the returned func is
+// called. /readyz answers 503 meanwhile.
+func (s *Stub) beginLoad() func() {
+	s.mu.Lock()
+	s.loading++
+	s.mu.Unlock()
+
+	return func() {
+		s.mu.Lock()
+		s.loading--
+		s.mu.Unlock()
+	}
+}
+
+// notReady returns why the stub isn't ready yet, or "" when it is.
+func (s *Stub) notReady(ctx context.Context) string {
+	s.mu.Lock()
+	gated, loading, deps := !s.ready, s.loading, s.dependencies
+	s.mu.Unlock()
+
+	switch {
+	case loading > 0:
+		return "loading fixtures"
+	case gated:
+		return "waiting for ready signal"
+	}
+
+	for _, url := range deps {
+		if !dependencyUp(ctx, url) {
+			return "waiting for dependency " + url
+		}
+	}
+	return ""
+}
+
+func dependencyUp(ctx context.Context, url string) bool {
+	ctx, cancel := context.WithTimeout(ctx, dependencyTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false
+	}
+	_ = resp.Body.Close()
+	return resp.StatusCode < http.StatusInternalServerError
+}
+
+func (s *Stub) readyz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if reason := s.notReady(r.Context()); reason != "" {
+		http.Error(w, reason, http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("ok"))
+}
+
+func (s *Stub) controlReady(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.MarkReady()
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,120 @@
+package stubsrv
+
+import (
+	"io/fs"
+	"net/http"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStub_Readyz(t *testing.T) {
+	t.Parallel()
+
+	readyz := func(t *testing.T, stub *Stub) int {
+		t.Helper()
+
+		resp, err := http.Get(stub.URL() + "/readyz")
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	t.Run("ready by default", func(t *testing.T) {
+		t.Parallel()
+
+		stub := NewStub(noopLogger())
+		require.NoError(t, stub.Start())
+		defer stub.Close()
+
+		assert.Equal(t, http.StatusOK, readyz(t, stub))
+	})
+
+	t.Run("gate opens on MarkReady", func(t *testing.T) {
+		t.Parallel()
+
+		stub := NewStub(noopLogger(), WithReadinessGate())
+		require.NoError(t, stub.Start())
+		defer stub.Close()
+
+		assert.Equal(t, http.StatusServiceUnavailable, readyz(t, stub))
+		stub.MarkReady()
+		assert.Equal(t, http.StatusOK, readyz(t, stub))
+	})
+
+	t.Run("gate opens on control request", func(t *testing.T) {
+		t.Parallel()
+
+		stub := NewStub(noopLogger(), WithReadinessGate())
+		require.NoError(t, stub.Start())
+		defer stub.Close()
+
+		controlDo(t, stub, http.MethodGet, "/_control/ready", "", http.StatusMethodNotAllowed, nil)
+		controlDo(t, stub, http.MethodPost, "/_control/ready", "", http.StatusNoContent, nil)
+		assert.Equal(t, http.StatusOK, readyz(t, stub))
+	})
+
+	t.Run("not ready while loading", func(t *testing.T) {
+		t.Parallel()
+
+		stub := NewStub(noopLogger())
+		require.NoError(t, stub.Start())
+		defer stub.Close()
+
+		done := stub.beginLoad()
+		assert.Equal(t, http.StatusServiceUnavailable, readyz(t, stub))
+		done()
+		assert.Equal(t, http.StatusOK, readyz(t, stub))
+	})
+
+	t.Run("not ready while loading a config", func(t *testing.T) {
+		t.Parallel()
+
+		stub := NewStub(noopLogger())
+		require.NoError(t, stub.Start())
+		defer stub.Close()
+
+		release := make(chan struct{})
+		fsys := blockingFS{fsys: fstest.MapFS{"routes.json": {Data: []byte(`[{"method":"GET","path":"/a"}]`)}}, release: release}
+		loaded := make(chan error)
+		go func() {
+			_, err := stub.LoadConfigFS(fsys, "routes.json")
+			loaded <- err
+		}()
+
+		assert.Eventually(t, func() bool { return readyz(t, stub) == http.StatusServiceUnavailable }, time.Second, 10*time.Millisecond)
+		close(release)
+		require.NoError(t, <-loaded)
+		assert.Equal(t, http.StatusOK, readyz(t, stub))
+	})
+
+	t.Run("waits for dependencies", func(t *testing.T) {
+		t.Parallel()
+
+		dep := NewStub(noopLogger(), WithReadinessGate())
+		require.NoError(t, dep.Start())
+		defer dep.Close()
+
+		stub := NewStub(noopLogger(), WithDependencies(dep.URL()+"/readyz"))
+		require.NoError(t, stub.Start())
+		defer stub.Close()
+
+		assert.Equal(t, http.StatusServiceUnavailable, readyz(t, stub))
+		dep.MarkReady()
+		assert.Equal(t, http.StatusOK, readyz(t, stub))
+	})
+}
+
+// blockingFS holds every Open until release is closed.
+type blockingFS struct {
+	fsys    fs.FS
+	release chan struct{}
+}
+
+func (f blockingFS) Open(name string) (fs.File, error) {
+	<-f.release
+	return f.fsys.Open(name)
+}
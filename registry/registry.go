@@ -0,0 +1,345 @@
+// Package registry emulates the Docker Registry HTTP API v2 (pull and push of
+// manifests and blobs, including chunked uploads) with in-memory storage.
+package registry
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/alesr/stubsrv"
+)
+
+// maxNameDepth is the number of path components supported in repository
+// names, e.g. "library/alpine" has two.
+const maxNameDepth = 3
+
+const defaultManifestType = "application/vnd.oci.image.manifest.v1+json"
+
+type manifest struct {
+	digest    string
+	mediaType string
+	body      []byte
+}
+
+type Registry struct {
+	mu        sync.Mutex
+	blobs     map[string][]byte
+	manifests map[string]map[string]manifest
+	uploads   map[string]*bytes.Buffer
+}
+
+// New registers the registry v2 routes on the stub.
+func New(stub *stubsrv.Stub) *Registry {
+	reg := Registry{
+		blobs:     make(map[string][]byte),
+		manifests: make(map[string]map[string]manifest),
+		uploads:   make(map[string]*bytes.Buffer),
+	}
+
+	stub.AddHandler(http.MethodGet, "/v2/", reg.handleBase)
+	stub.AddHandler(http.MethodGet, "/v2", reg.handleBase)
+
+	name := "/v2"
+	for i := 1; i <= maxNameDepth; i++ {
+		name += "/:name" + strconv.Itoa(i)
+
+		stub.AddHandler(http.MethodGet, name+"/tags/list", reg.handleTags)
+		stub.AddHandler(http.MethodGet, name+"/manifests/:reference", reg.handleGetManifest)
+		stub.AddHandler(http.MethodHead, name+"/manifests/:reference", reg.handleGetManifest)
+		stub.AddHandler(http.MethodPut, name+"/manifests/:reference", reg.handlePutManifest)
+		stub.AddHandler(http.MethodDelete, name+"/manifests/:reference", reg.handleDeleteManifest)
+		stub.AddHandler(http.MethodGet, name+"/blobs/:digest", reg.handleGetBlob)
+		stub.AddHandler(http.MethodHead, name+"/blobs/:digest", reg.handleGetBlob)
+		stub.AddHandler(http.MethodPost, name+"/blobs/uploads", reg.handleStartUpload)
+		stub.AddHandler(http.MethodPatch, name+"/blobs/uploads/:uuid", reg.handlePatchUpload)
+		stub.AddHandler(http.MethodPut, name+"/blobs/uploads/:uuid", reg.handleFinishUpload)
+	}
+	return &reg
+}
+
+// PushBlob stores data and returns its digest.
+func (reg *Registry) PushBlob(data []byte) string {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	d := digest(data)
+	reg.blobs[d] = data
+	return d
+}
+
+// PushManifest stores a manifest under name:tag and returns its digest.
+func (reg *Registry) PushManifest(name, tag, mediaType string, body []byte) string {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	return reg.putManifest(name, tag, mediaType, body)
+}
+
+func (reg *Registry) Tags(name string) []string {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	return reg.tags(name)
+}
+
+func (reg *Registry) HasBlob(digest string) bool {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	_, ok := reg.blobs[digest]
+	return ok
+}
+
+func (reg *Registry) putManifest(name, ref, mediaType string, body []byte) string {
+	if mediaType == "" {
+		mediaType = defaultManifestType
+	}
+	m := manifest{digest: digest(body), mediaType: mediaType, body: body}
+
+	repo, ok := reg.manifests[name]
+	if !ok {
+		repo = make(map[string]manifest)
+		reg.manifests[name] = repo
+	}
+	repo[m.digest] = m
+	repo[ref] = m
+	return m.digest
+}
+
+func (reg *Registry) tags(name string) []string {
+	var tags []string
+	for ref := range reg.manifests[name] {
+		if !strings.HasPrefix(ref, "sha256:") {
+			tags = append(tags, ref)
+		}
+	}
+	slices.Sort(tags)
+	return tags
+}
+
+func (reg *Registry) handleBase(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Docker-Distribution-API-Version", "registry/2.0")
+	writeJSON(w, http.StatusOK, struct{}{})
+}
+
+func (reg *Registry) handleTags(w http.ResponseWriter, r *http.Request) {
+	name, _ := splitPath(r.URL.Path, "/tags/list")
+
+	reg.mu.Lock()
+	_, ok := reg.manifests[name]
+	tags := reg.tags(name)
+	reg.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, "NAME_UNKNOWN", "repository name not known to registry")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"name": name, "tags": tags})
+}
+
+func (reg *Registry) handleGetManifest(w http.ResponseWriter, r *http.Request) {
+	name, ref := splitPath(r.URL.Path, "/manifests/")
+
+	reg.mu.Lock()
+	m, ok := reg.manifests[name][ref]
+	reg.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", "manifest unknown")
+		return
+	}
+
+	w.Header().Set("Content-Type", m.mediaType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(m.body)))
+	w.Header().Set("Docker-Content-Digest", m.digest)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(m.body)
+}
+
+func (reg *Registry) handlePutManifest(w http.ResponseWriter, r *http.Request) {
+	name, ref := splitPath(r.URL.Path, "/manifests/")
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil || len(body) == 0 {
+		writeError(w, http.StatusBadRequest, "MANIFEST_INVALID", "manifest invalid")
+		return
+	}
+	if strings.HasPrefix(ref, "sha256:") && ref != digest(body) {
+		writeError(w, http.StatusBadRequest, "DIGEST_INVALID", "provided digest did not match uploaded content")
+		return
+	}
+
+	reg.mu.Lock()
+	d := reg.putManifest(name, ref, r.Header.Get("Content-Type"), body)
+	reg.mu.Unlock()
+
+	w.Header().Set("Location", "/v2/"+name+"/manifests/"+d)
+	w.Header().Set("Docker-Content-Digest", d)
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (reg *Registry) handleDeleteManifest(w http.ResponseWriter, r *http.Request) {
+	name, ref := splitPath(r.URL.Path, "/manifests/")
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	repo := reg.manifests[name]
+	if _, ok := repo[ref]; !ok || !strings.HasPrefix(ref, "sha256:") {
+		writeError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", "manifest unknown")
+		return
+	}
+	for k, m := range repo {
+		if m.digest == ref {
+			delete(repo, k)
+		}
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (reg *Registry) handleGetBlob(w http.ResponseWriter, r *http.Request) {
+	_, d := splitPath(r.URL.Path, "/blobs/")
+
+	reg.mu.Lock()
+	data, ok := reg.blobs[d]
+	reg.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, "BLOB_UNKNOWN", "blob unknown to registry")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("Docker-Content-Digest", d)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
+
+func (reg *Registry) handleStartUpload(w http.ResponseWriter, r *http.Request) {
+	name, _ := splitPath(strings.TrimSuffix(r.URL.Path, "/"), "/blobs/uploads")
+
+	// monolithic upload in a single POST
+	if d := r.URL.Query().Get("digest"); d != "" {
+		body, _ := io.ReadAll(r.Body)
+		reg.commitBlob(w, name, d, body)
+		return
+	}
+
+	id := newUUID()
+	reg.mu.Lock()
+	reg.uploads[id] = new(bytes.Buffer)
+	reg.mu.Unlock()
+
+	writeUploadStatus(w, http.StatusAccepted, name, id, 0)
+}
+
+func (reg *Registry) handlePatchUpload(w http.ResponseWriter, r *http.Request) {
+	name, id := splitPath(r.URL.Path, "/blobs/uploads/")
+
+	reg.mu.Lock()
+	buf, ok := reg.uploads[id]
+	if ok {
+		_, _ = io.Copy(buf, r.Body)
+	}
+	var size int
+	if ok {
+		size = buf.Len()
+	}
+	reg.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, "BLOB_UPLOAD_UNKNOWN", "blob upload unknown to registry")
+		return
+	}
+	writeUploadStatus(w, http.StatusAccepted, name, id, size)
+}
+
+func (reg *Registry) handleFinishUpload(w http.ResponseWriter, r *http.Request) {
+	name, id := splitPath(r.URL.Path, "/blobs/uploads/")
+
+	reg.mu.Lock()
+	buf, ok := reg.uploads[id]
+	if ok {
+		_, _ = io.Copy(buf, r.Body)
+		delete(reg.uploads, id)
+	}
+	reg.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, "BLOB_UPLOAD_UNKNOWN", "blob upload unknown to registry")
+		return
+	}
+	reg.commitBlob(w, name, r.URL.Query().Get("digest"), buf.Bytes())
+}
+
+func (reg *Registry) commitBlob(w http.ResponseWriter, name, want string, data []byte) {
+	if got := digest(data); want != got {
+		writeError(w, http.StatusBadRequest, "DIGEST_INVALID", fmt.Sprintf("digest %q does not match uploaded content %q", want, got))
+		return
+	}
+
+	reg.mu.Lock()
+	reg.blobs[want] = data
+	reg.mu.Unlock()
+
+	w.Header().Set("Location", "/v2/"+name+"/blobs/"+want)
+	w.Header().Set("Docker-Content-Digest", want)
+	w.WriteHeader(http.StatusCreated)
+}
+
+func writeUploadStatus(w http.ResponseWriter, status int, name, id string, size int) {
+	end := size - 1
+	if end < 0 {
+		end = 0
+	}
+	w.Header().Set("Location", "/v2/"+name+"/blobs/uploads/"+id)
+	w.Header().Set("Range", fmt.Sprintf("0-%d", end))
+	w.Header().Set("Docker-Upload-UUID", id)
+	w.WriteHeader(status)
+}
+
+// splitPath splits /v2/<name><sep><rest> into name and rest.
+func splitPath(p, sep string) (string, string) {
+	p = strings.TrimPrefix(p, "/v2/")
+	i := strings.LastIndex(p, sep)
+	if i < 0 {
+		return p, ""
+	}
+	return p[:i], p[i+len(sep):]
+}
+
+func digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func newUUID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	type regError struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+	writeJSON(w, status, map[string][]regError{"errors": {{Code: code, Message: message}}})
+}
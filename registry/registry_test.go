@@ -0,0 +1,129 @@
+package registry
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/alesr/stubsrv"
+	"github.com/alesr/stubsrv/internal/stubtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry_Pull(t *testing.T) {
+	t.Parallel()
+
+	stub, reg := newRegistry(t)
+
+	layer := reg.PushBlob([]byte("layer"))
+	manifestDigest := reg.PushManifest("library/alpine", "3.20", "", []byte(`{"layers":["`+layer+`"]}`))
+
+	resp, body := stubtest.Do(t, http.MethodGet, stub.URL()+"/v2/", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "registry/2.0", resp.Header.Get("Docker-Distribution-API-Version"))
+
+	resp, body = stubtest.Do(t, http.MethodGet, stub.URL()+"/v2/library/alpine/manifests/3.20", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, manifestDigest, resp.Header.Get("Docker-Content-Digest"))
+	assert.Equal(t, defaultManifestType, resp.Header.Get("Content-Type"))
+	assert.Contains(t, body, layer)
+
+	resp, _ = stubtest.Do(t, http.MethodHead, stub.URL()+"/v2/library/alpine/manifests/"+manifestDigest, "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, body = stubtest.Do(t, http.MethodGet, stub.URL()+"/v2/library/alpine/blobs/"+layer, "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "layer", body)
+
+	resp, body = stubtest.Do(t, http.MethodGet, stub.URL()+"/v2/library/alpine/tags/list", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.JSONEq(t, `{"name":"library/alpine","tags":["3.20"]}`, body)
+
+	resp, body = stubtest.Do(t, http.MethodGet, stub.URL()+"/v2/library/alpine/manifests/latest", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Contains(t, body, "MANIFEST_UNKNOWN")
+}
+
+func TestRegistry_ChunkedPush(t *testing.T) {
+	t.Parallel()
+
+	stub, reg := newRegistry(t)
+	data := []byte("hello, registry")
+	d := digest(data)
+
+	resp, _ := stubtest.Do(t, http.MethodPost, stub.URL()+"/v2/app/blobs/uploads/", "")
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	location := resp.Header.Get("Location")
+	assert.Equal(t, "0-0", resp.Header.Get("Range"))
+
+	resp, _ = stubtest.Do(t, http.MethodPatch, stub.URL()+location, string(data[:5]))
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	assert.Equal(t, "0-4", resp.Header.Get("Range"))
+
+	resp, _ = stubtest.Do(t, http.MethodPut, stub.URL()+location+"?digest=sha256:bad", string(data[5:]))
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.False(t, reg.HasBlob(d))
+
+	resp, _ = stubtest.Do(t, http.MethodPost, stub.URL()+"/v2/app/blobs/uploads/", "")
+	location = resp.Header.Get("Location")
+	stubtest.Do(t, http.MethodPatch, stub.URL()+location, string(data[:5]))
+
+	resp, _ = stubtest.Do(t, http.MethodPut, stub.URL()+location+"?digest="+d, string(data[5:]))
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, d, resp.Header.Get("Docker-Content-Digest"))
+	assert.True(t, reg.HasBlob(d))
+
+	resp, _ = stubtest.Do(t, http.MethodPut, stub.URL()+"/v2/app/manifests/v1", `{"layers":["`+d+`"]}`)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, []string{"v1"}, reg.Tags("app"))
+
+	resp, _ = stubtest.Do(t, http.MethodDelete, stub.URL()+"/v2/app/manifests/"+resp.Header.Get("Docker-Content-Digest"), "")
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	assert.Empty(t, reg.Tags("app"))
+}
+
+func TestRegistry_MonolithicPush(t *testing.T) {
+	t.Parallel()
+
+	stub, reg := newRegistry(t)
+	data := []byte("single shot")
+
+	resp, _ := stubtest.Do(t, http.MethodPost, stub.URL()+"/v2/a/b/c/blobs/uploads/?digest="+digest(data), string(data))
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "/v2/a/b/c/blobs/"+digest(data), resp.Header.Get("Location"))
+	assert.True(t, reg.HasBlob(digest(data)))
+}
+
+func TestSplitPath(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name         string
+		givenPath    string
+		givenSep     string
+		expectedName string
+		expectedRest string
+	}{
+		{name: "single component", givenPath: "/v2/app/manifests/v1", givenSep: "/manifests/", expectedName: "app", expectedRest: "v1"},
+		{name: "nested name", givenPath: "/v2/library/alpine/blobs/sha256:abc", givenSep: "/blobs/", expectedName: "library/alpine", expectedRest: "sha256:abc"},
+		{name: "tags list", givenPath: "/v2/a/b/tags/list", givenSep: "/tags/list", expectedName: "a/b", expectedRest: ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			name, rest := splitPath(tc.givenPath, tc.givenSep)
+			assert.Equal(t, tc.expectedName, name)
+			assert.Equal(t, tc.expectedRest, rest)
+		})
+	}
+}
+
+func newRegistry(t *testing.T) (*stubsrv.Stub, *Registry) {
+	t.Helper()
+
+	var reg *Registry
+	stub := stubtest.New(t, func(stub *stubsrv.Stub) { reg = New(stub) })
+	return stub, reg
+}
@@ -0,0 +1,69 @@
+package stubsrv
+
+import (
+	"container/list"
+	"sync"
+)
+
+const routeCacheSize = 1024
+
+// routeCache is an LRU of the exact or unconstrained template route
+// picked for "METHOD /path", see Stub.pathRoute. Those picks depend on
+// nothing else in the request, so they can be reused until the routes
+// change. Misses are cached too. Lookups reorder the LRU, so it has its
+// own lock for dispatch running under Stub.mu's read lock.
+type routeCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List // front is most recent
+	entries map[string]*list.Element
+}
+
+type routeCacheEntry struct {
+	key string
+	tr  templateRoute
+	ok  bool
+}
+
+func newRouteCache(size int) *routeCache {
+	return &routeCache{size: size, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+func (c *routeCache) get(key string) (templateRoute, bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, hit := c.entries[key]
+	if !hit {
+		return templateRoute{}, false, false
+	}
+	c.order.MoveToFront(el)
+	e := el.Value.(*routeCacheEntry)
+	return e.tr, e.ok, true
+}
+
+func (c *routeCache) put(key string, tr templateRoute, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, hit := c.entries[key]; hit {
+		c.order.MoveToFront(el)
+		el.Value = &routeCacheEntry{key: key, tr: tr, ok: ok}
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&routeCacheEntry{key: key, tr: tr, ok: ok})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*routeCacheEntry).key)
+	}
+}
+
+func (c *routeCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.order.Init()
+	clear(c.entries)
+}
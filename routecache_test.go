@@ -0,0 +1,99 @@
+package stubsrv
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouteCache(t *testing.T) {
+	t.Parallel()
+
+	c := newRouteCache(2)
+	c.put("GET /a", templateRoute{method: "GET"}, true)
+	c.put("GET /b", templateRoute{}, false)
+
+	_, ok, hit := c.get("GET /a")
+	assert.True(t, hit)
+	assert.True(t, ok)
+
+	// /b is now the least recently used
+	c.put("GET /c", templateRoute{}, true)
+	_, _, hit = c.get("GET /b")
+	assert.False(t, hit)
+	_, ok, hit = c.get("GET /c")
+	assert.True(t, hit)
+	assert.True(t, ok)
+
+	c.clear()
+	_, _, hit = c.get("GET /a")
+	assert.False(t, hit)
+	assert.Zero(t, c.order.Len())
+}
+
+func TestStub_RouteCacheInvalidation(t *testing.T) {
+	t.Parallel()
+
+	stub := NewStub(noopLogger())
+	require.NoError(t, stub.Start())
+	defer stub.Close()
+
+	status := func() int {
+		resp, err := http.Get(stub.URL() + "/users/1")
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusNotFound, status(), "caches the miss")
+
+	id := controlAdd(t, stub, `{"method":"GET","path":"/users/:id","status":200}`)
+	assert.Equal(t, http.StatusOK, status())
+	assert.Equal(t, http.StatusOK, status(), "served from the cache")
+
+	controlDo(t, stub, http.MethodPut, "/_control/handlers/"+id, `{"method":"GET","path":"/users/:id","status":202}`, http.StatusOK, nil)
+	assert.Equal(t, http.StatusAccepted, status())
+
+	controlDo(t, stub, http.MethodDelete, "/_control/handlers/"+id, "", http.StatusNoContent, nil)
+	assert.Equal(t, http.StatusNotFound, status())
+
+	stub.AddHandler(http.MethodGet, "/users/:id", func(w http.ResponseWriter, r *http.Request) {})
+	stub.Reset()
+	assert.Equal(t, http.StatusNotFound, status())
+}
+
+func TestStub_ConcurrentDispatch(t *testing.T) {
+	t.Parallel()
+
+	for _, opts := range [][]Option{nil, {WithRouter(DefaultRouter{})}} {
+		stub := NewStub(noopLogger(), opts...)
+		stub.AddHandler(http.MethodGet, "/users/:id", func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(PathParam(r, "id")))
+		})
+		require.NoError(t, stub.Start())
+		defer stub.Close()
+
+		var wg sync.WaitGroup
+		for i := range 8 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := range 50 {
+					id := strconv.Itoa(i*100 + j)
+					w := httptest.NewRecorder()
+					stub.Server.Config.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/"+id, nil))
+					assert.Equal(t, id, w.Body.String())
+				}
+			}()
+		}
+		for i := range 20 {
+			stub.AddHandler(http.MethodGet, "/other/"+strconv.Itoa(i), func(w http.ResponseWriter, r *http.Request) {})
+		}
+		wg.Wait()
+	}
+}
@@ -0,0 +1,154 @@
+package stubsrv
+
+import (
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Route is a registered route as a Router sees it.
+type Route struct {
+	ID     string
+	Method string
+	// Path is the path the route was registered with, possibly a template
+	// such as /users/:id.
+	Path     string
+	Query    map[string]string
+	Priority int
+	// Spec is set for routes added from a DynamicHandlerSpec.
+	Spec *DynamicHandlerSpec
+
+	template bool
+	segments []string
+	info     routeInfo
+}
+
+// Matches reports whether r satisfies the route's method, path, query and
+// matchers, as the stub's own routing requires.
+func (rt Route) Matches(r *http.Request) bool {
+	if !rt.template {
+		return rt.Method == r.Method && rt.Path == r.URL.Path
+	}
+	return templateRoute{method: rt.Method, segments: rt.segments, queries: rt.Query, info: rt.info}.match(r)
+}
+
+// Constrained reports whether the route matches on more than method and
+// path, through query constraints or matchers.
+func (rt Route) Constrained() bool {
+	return len(rt.Query) > 0 || len(rt.info.matchers) > 0
+}
+
+// Router picks the route serving a request, replacing the stub's routing
+// strategy. The stub keeps recording requests, running global middlewares,
+// and answering 404 or 405 when no route is picked. See WithRouter.
+type Router interface {
+	// Route returns the route serving r among routes, or false. routes is
+	// in the order the stub's own routing ranks them and must not be
+	// modified. Route is called concurrently with the stub's read lock
+	// held, so it must not call back into the stub.
+	Route(r *http.Request, routes []Route) (Route, bool)
+}
+
+// DefaultRouter is the stub's own routing: the first matching route in
+// the ranked list wins. Custom routers can fall back to it.
+type DefaultRouter struct{}
+
+func (DefaultRouter) Route(r *http.Request, routes []Route) (Route, bool) {
+	for _, rt := range routes {
+		if rt.Matches(r) {
+			return rt, true
+		}
+	}
+	return Route{}, false
+}
+
+// WithRouter routes requests with router instead of the built-in routing.
+// Path parameters are extracted from the picked route's template when it
+// matches the request path.
+func WithRouter(router Router) Option {
+	return func(cfg *stubConfig) {
+		cfg.router = router
+	}
+}
+
+// customRoute routes r with s.router. Callers must hold s.mu for reading.
+func (s *Stub) customRoute(r *http.Request) (http.Handler, map[string]string, bool) {
+	rt, ok := s.router.Route(r, s.routeTable())
+	if !ok || rt.info.id == "" {
+		return nil, nil, false
+	}
+
+	var params map[string]string
+	if rt.template && pathMatch(rt.segments, r.URL.Path) {
+		params = pathParams(rt.segments, r.URL.Path)
+	}
+	return rt.info.build(), params, true
+}
+
+// routeTable returns every route in the order the built-in routing ranks
+// them, rebuilt after the routes change. Callers must hold s.mu for
+// reading.
+func (s *Stub) routeTable() []Route {
+	if list := s.routeList.Load(); list != nil {
+		return *list
+	}
+	s.derivedMu.Lock()
+	defer s.derivedMu.Unlock()
+	if list := s.routeList.Load(); list != nil {
+		return *list
+	}
+
+	type ranked struct {
+		tr    templateRoute
+		path  string
+		exact bool
+	}
+	order := make([]ranked, 0, len(s.routers)+len(s.templateRoutes))
+	for _, tr := range s.templateRoutes {
+		order = append(order, ranked{tr: tr, path: "/" + strings.Join(tr.segments, "/")})
+	}
+
+	keys := slices.Collect(maps.Keys(s.routers))
+	slices.SortFunc(keys, func(a, b string) int {
+		ai, _ := strconv.Atoi(s.routers[a].id)
+		bi, _ := strconv.Atoi(s.routers[b].id)
+		return ai - bi
+	})
+	for _, key := range keys {
+		// exact routes win ties
+		et := exactRoute(key, s.routers[key])
+		i := slices.IndexFunc(order, func(rk ranked) bool { return !rk.tr.outranks(et) })
+		if i < 0 {
+			i = len(order)
+		}
+		_, path, _ := strings.Cut(key, " ")
+		order = slices.Insert(order, i, ranked{tr: et, path: path, exact: true})
+	}
+
+	list := make([]Route, len(order))
+	for i, rk := range order {
+		list[i] = Route{
+			ID:       rk.tr.info.id,
+			Method:   rk.tr.method,
+			Path:     rk.path,
+			Query:    rk.tr.queries,
+			Priority: rk.tr.info.priority,
+			Spec:     rk.tr.info.spec,
+			template: !rk.exact,
+			segments: rk.tr.segments,
+			info:     rk.tr.info,
+		}
+	}
+	s.routeList.Store(&list)
+	return list
+}
+
+// routesChanged drops what is derived from the routes. Callers must hold
+// s.mu.
+func (s *Stub) routesChanged() {
+	s.routeCache.clear()
+	s.routeList.Store(nil)
+	s.routeTrie.Store(nil)
+}
@@ -0,0 +1,77 @@
+package stubsrv
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// caseInsensitiveRouter matches paths ignoring case, falling back to the
+// default routing.
+type caseInsensitiveRouter struct {
+	seen *[]string
+}
+
+func (cr caseInsensitiveRouter) Route(r *http.Request, routes []Route) (Route, bool) {
+	*cr.seen = (*cr.seen)[:0]
+	for _, rt := range routes {
+		*cr.seen = append(*cr.seen, rt.Path)
+	}
+
+	lower := r.Clone(r.Context())
+	lower.URL.Path = strings.ToLower(r.URL.Path)
+	return DefaultRouter{}.Route(lower, routes)
+}
+
+func TestWithRouter(t *testing.T) {
+	t.Parallel()
+
+	var seen []string
+	stub := NewStub(noopLogger(), WithRouter(caseInsensitiveRouter{seen: &seen}))
+	stub.AddHandler(http.MethodGet, "/users/:id", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("user " + PathParam(r, "id")))
+	})
+	stub.AddHandler(http.MethodGet, "/health", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	})
+	stub.AddMatchedHandler(http.MethodGet, "/users/:id", []Matcher{MatchHeaders(map[string]string{"X-Admin": "1"})},
+		func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("admin"))
+		})
+	require.NoError(t, stub.Start())
+	defer stub.Close()
+
+	get := func(path string, header http.Header) (int, string) {
+		req, err := http.NewRequest(http.MethodGet, stub.URL()+path, nil)
+		require.NoError(t, err)
+		req.Header = header
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		return resp.StatusCode, readAll(t, resp)
+	}
+
+	status, body := get("/HEALTH", nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "ok", body)
+	assert.Equal(t, []string{"/users/:id", "/health", "/users/:id"}, seen, "routes come in routing order")
+
+	_, body = get("/users/42", nil)
+	assert.Equal(t, "user 42", body)
+	_, body = get("/users/42", http.Header{"X-Admin": {"1"}})
+	assert.Equal(t, "admin", body)
+
+	status, _ = get("/missing", nil)
+	assert.Equal(t, http.StatusNotFound, status)
+	assert.Len(t, stub.Requests(), 4)
+
+	// the table is rebuilt when routes change
+	controlAdd(t, stub, `{"method":"GET","path":"/dynamic","body":"dyn"}`)
+	_, body = get("/DYNAMIC", nil)
+	assert.Equal(t, "dyn", body)
+
+	assert.Contains(t, stub.Info().Features, "custom_router")
+}
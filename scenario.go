@@ -0,0 +1,135 @@
+package stubsrv
+
+import (
+	"encoding/json"
+	"log/slog"
+	"maps"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// ScenarioStarted is the state every scenario begins in.
+const ScenarioStarted = "Started"
+
+type scenarios struct {
+	mu     sync.Mutex
+	states map[string]string
+	order  []string // names by first change, for eviction
+	limits Limits
+}
+
+func (sc *scenarios) get(name string) string {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	if state, ok := sc.states[name]; ok {
+		return state
+	}
+	return ScenarioStarted
+}
+
+// set moves name to state. It reports false when the limits reject a new
+// scenario.
+func (sc *scenarios) set(name, state string) bool {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	if sc.states == nil {
+		sc.states = make(map[string]string)
+	}
+	if _, ok := sc.states[name]; !ok {
+		if limit := sc.limits.MaxScenarios; limit > 0 && len(sc.states) >= limit {
+			if sc.limits.Policy == LimitReject {
+				return false
+			}
+			delete(sc.states, sc.order[0])
+			sc.order = sc.order[1:]
+		}
+		sc.order = append(sc.order, name)
+	}
+	sc.states[name] = state
+	return true
+}
+
+func (sc *scenarios) all() map[string]string {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	return maps.Clone(sc.states)
+}
+
+func (sc *scenarios) reset() {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	sc.states = nil
+	sc.order = nil
+}
+
+// WhenState returns a matcher accepting requests while scenario is in state.
+func (s *Stub) WhenState(scenario, state string) Matcher {
+	return func(*http.Request) bool {
+		return s.scenarios.get(scenario) == state
+	}
+}
+
+// ThenState returns a middleware moving scenario to state once the route
+// has responded.
+func (s *Stub) ThenState(scenario, state string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r)
+			if !s.scenarios.set(scenario, state) {
+				s.logger.Warn("Scenario limit reached", slog.String("scenario", scenario))
+				return
+			}
+			s.logger.Debug("Scenario state changed", slog.String("scenario", scenario), slog.String("state", state))
+		})
+	}
+}
+
+// ScenarioState returns the current state of scenario.
+func (s *Stub) ScenarioState(scenario string) string {
+	return s.scenarios.get(scenario)
+}
+
+// SetScenarioState forces scenario into state. It is a no-op when the
+// scenario limit rejects it.
+func (s *Stub) SetScenarioState(scenario, state string) {
+	s.scenarios.set(scenario, state)
+}
+
+// controlScenarios serves the scenario states:
+//
+//	GET /_control/scenarios          states of scenarios that left Started
+//	PUT /_control/scenarios/{name}   {"state":"..."}
+func (s *Stub) controlScenarios(w http.ResponseWriter, r *http.Request) {
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/_control/scenarios"), "/")
+
+	switch {
+	case r.Method == http.MethodGet && name == "":
+		states := s.scenarios.all()
+		if states == nil {
+			states = map[string]string{}
+		}
+		writeJSON(w, http.StatusOK, states)
+	case r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, map[string]string{"state": s.scenarios.get(name)})
+	case r.Method == http.MethodPut && name != "":
+		var body struct {
+			State string `json:"state"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.State == "" {
+			http.Error(w, "state is required", http.StatusBadRequest)
+			return
+		}
+		if !s.scenarios.set(name, body.State) {
+			http.Error(w, "scenario limit reached", http.StatusInsufficientStorage)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
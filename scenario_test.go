@@ -0,0 +1,61 @@
+package stubsrv
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStub_Scenarios(t *testing.T) {
+	t.Parallel()
+
+	t.Run("spec routes move through states", func(t *testing.T) {
+		t.Parallel()
+
+		stub := NewStub(noopLogger())
+		require.NoError(t, stub.Start())
+		defer stub.Close()
+
+		controlAdd(t, stub, `{"method":"POST","path":"/orders","status":201,"scenario":"order","when_state":"Started","then_state":"created"}`)
+		controlAdd(t, stub, `{"method":"POST","path":"/orders","status":409,"scenario":"order","when_state":"created"}`)
+		controlAdd(t, stub, `{"method":"GET","path":"/orders/:id","body":"{\"status\":\"created\"}","scenario":"order","when_state":"created"}`)
+		controlAdd(t, stub, `{"method":"GET","path":"/orders/:id","status":404}`)
+		controlDo(t, stub, http.MethodPost, "/_control/handlers", `{"method":"GET","path":"/x","when_state":"a"}`, http.StatusBadRequest, nil)
+
+		controlDo(t, stub, http.MethodGet, "/orders/1", "", http.StatusNotFound, nil)
+		controlDo(t, stub, http.MethodPost, "/orders", "", http.StatusCreated, nil)
+		assert.JSONEq(t, `{"status":"created"}`, getBody(t, stub.URL()+"/orders/1"))
+		controlDo(t, stub, http.MethodPost, "/orders", "", http.StatusConflict, nil)
+
+		var states map[string]string
+		controlDo(t, stub, http.MethodGet, "/_control/scenarios", "", http.StatusOK, &states)
+		assert.Equal(t, map[string]string{"order": "created"}, states)
+
+		controlDo(t, stub, http.MethodPut, "/_control/scenarios/order", `{"state":"Started"}`, http.StatusNoContent, nil)
+		controlDo(t, stub, http.MethodPost, "/orders", "", http.StatusCreated, nil)
+
+		stub.Reset()
+		assert.Equal(t, ScenarioStarted, stub.ScenarioState("order"))
+	})
+
+	t.Run("Go API", func(t *testing.T) {
+		t.Parallel()
+
+		stub := NewStub(noopLogger())
+		stub.AddMatchedHandler(http.MethodPost, "/login", []Matcher{stub.WhenState("auth", ScenarioStarted)}, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+		}, stub.ThenState("auth", "retried"))
+		stub.AddMatchedHandler(http.MethodPost, "/login", []Matcher{stub.WhenState("auth", "retried")}, func(w http.ResponseWriter, r *http.Request) {})
+		require.NoError(t, stub.Start())
+		defer stub.Close()
+
+		controlDo(t, stub, http.MethodPost, "/login", "", http.StatusUnauthorized, nil)
+		assert.Equal(t, "retried", stub.ScenarioState("auth"))
+		controlDo(t, stub, http.MethodPost, "/login", "", http.StatusOK, nil)
+
+		stub.SetScenarioState("auth", ScenarioStarted)
+		controlDo(t, stub, http.MethodPost, "/login", "", http.StatusUnauthorized, nil)
+	})
+}
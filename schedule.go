@@ -0,0 +1,108 @@
+package stubsrv
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronField bounds, in minute hour day-of-month month day-of-week order.
+var cronBounds = [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 6}}
+
+// schedule is a parsed five-field cron expression, one bitset per field.
+type schedule [5]uint64
+
+func parseSchedule(spec string) (schedule, error) {
+	var sched schedule
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return sched, fmt.Errorf("schedule %q: want 5 fields, got %d", spec, len(fields))
+	}
+
+	for i, field := range fields {
+		lo, hi := cronBounds[i][0], cronBounds[i][1]
+		for part := range strings.SplitSeq(field, ",") {
+			bits, err := parseCronPart(part, lo, hi)
+			if err != nil {
+				return sched, fmt.Errorf("schedule %q: %w", spec, err)
+			}
+			sched[i] |= bits
+		}
+	}
+	return sched, nil
+}
+
+// parseCronPart parses "*", "n", "a-b" with an optional "/step".
+func parseCronPart(part string, lo, hi int) (uint64, error) {
+	rng, rawStep, hasStep := strings.Cut(part, "/")
+
+	step := 1
+	if hasStep {
+		var err error
+		if step, err = strconv.Atoi(rawStep); err != nil || step <= 0 {
+			return 0, fmt.Errorf("invalid step %q", rawStep)
+		}
+	}
+
+	from, to := lo, hi
+	if rng != "*" {
+		rawFrom, rawTo, isRange := strings.Cut(rng, "-")
+		var err error
+		if from, err = strconv.Atoi(rawFrom); err != nil {
+			return 0, fmt.Errorf("invalid value %q", rawFrom)
+		}
+		to = from
+		if isRange {
+			if to, err = strconv.Atoi(rawTo); err != nil {
+				return 0, fmt.Errorf("invalid value %q", rawTo)
+			}
+		} else if hasStep {
+			to = hi
+		}
+	}
+	if from < lo || to > hi || from > to {
+		return 0, fmt.Errorf("%q out of range %d-%d", part, lo, hi)
+	}
+
+	var bits uint64
+	for v := from; v <= to; v += step {
+		bits |= 1 << v
+	}
+	return bits, nil
+}
+
+func (sched schedule) match(t time.Time) bool {
+	values := [5]int{t.Minute(), t.Hour(), t.Day(), int(t.Month()), int(t.Weekday())}
+	for i, v := range values {
+		if sched[i]&(1<<v) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// During returns a matcher accepting requests while the stub clock, see
+// WithClock, is inside the window described by spec, a five-field cron
+// expression ("minute hour day-of-month month day-of-week") supporting *,
+// lists, ranges and steps. "10-20 * * * *" matches from minute 10 to 20 of
+// every hour. All fields must match. It panics if spec is invalid.
+func (s *Stub) During(spec string) Matcher {
+	m, err := s.scheduleMatcher(spec)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+func (s *Stub) scheduleMatcher(spec string) (Matcher, error) {
+	sched, err := parseSchedule(spec)
+	if err != nil {
+		return nil, err
+	}
+	return func(*http.Request) bool {
+		return sched.match(s.now())
+	}, nil
+}
@@ -0,0 +1,103 @@
+package stubsrv
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSchedule(t *testing.T) {
+	t.Parallel()
+
+	monday1015 := time.Date(2024, 1, 1, 10, 15, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name        string
+		givenSpec   string
+		givenTime   time.Time
+		expected    bool
+		expectedErr bool
+	}{
+		{name: "every minute", givenSpec: "* * * * *", givenTime: monday1015, expected: true},
+		{name: "inside minute range", givenSpec: "10-20 * * * *", givenTime: monday1015, expected: true},
+		{name: "outside minute range", givenSpec: "10-14 * * * *", givenTime: monday1015, expected: false},
+		{name: "list", givenSpec: "0,15,30 * * * *", givenTime: monday1015, expected: true},
+		{name: "step", givenSpec: "*/5 * * * *", givenTime: monday1015, expected: true},
+		{name: "step from value", givenSpec: "1/7 * * * *", givenTime: monday1015, expected: true},
+		{name: "weekday mismatch", givenSpec: "* * * * 2", givenTime: monday1015, expected: false},
+		{name: "hour and weekday", givenSpec: "* 9-17 * * 1-5", givenTime: monday1015, expected: true},
+		{name: "too few fields", givenSpec: "* * *", expectedErr: true},
+		{name: "out of range", givenSpec: "60 * * * *", expectedErr: true},
+		{name: "bad step", givenSpec: "*/0 * * * *", expectedErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			sched, err := parseSchedule(tc.givenSpec)
+			if tc.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, sched.match(tc.givenTime))
+		})
+	}
+}
+
+func TestStub_During(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu  sync.Mutex
+		now = time.Date(2024, 1, 1, 10, 5, 0, 0, time.UTC)
+	)
+	clock := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	advance := func(d time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		now = now.Add(d)
+	}
+
+	stub := NewStub(noopLogger(), WithClock(clock))
+	stub.AddHandler(http.MethodGet, "/status", func(w http.ResponseWriter, r *http.Request) {})
+	stub.AddMatchedHandler(http.MethodGet, "/status", []Matcher{stub.During("10-20 * * * *")}, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	require.NoError(t, stub.Start())
+	defer stub.Close()
+
+	controlAdd(t, stub, `{"method":"GET","path":"/report","status":202,"schedule":"* 10 * * *"}`)
+	controlDo(t, stub, http.MethodPost, "/_control/handlers", `{"method":"GET","path":"/x","schedule":"bad"}`, http.StatusBadRequest, nil)
+
+	status := func(path string) int {
+		resp, err := http.Get(stub.URL() + path)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusOK, status("/status"))
+	assert.Equal(t, http.StatusAccepted, status("/report"))
+
+	advance(10 * time.Minute)
+	assert.Equal(t, http.StatusServiceUnavailable, status("/status"))
+
+	advance(time.Hour)
+	assert.Equal(t, http.StatusServiceUnavailable, status("/status"))
+	assert.Equal(t, http.StatusNotFound, status("/report"))
+
+	advance(11 * time.Minute)
+	assert.Equal(t, http.StatusOK, status("/status"))
+
+	assert.Panics(t, func() { stub.During("nope") })
+}
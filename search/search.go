@@ -0,0 +1,486 @@
+// Package search emulates a subset of the Elasticsearch/OpenSearch REST API:
+// document indexing, bulk requests and _search with naive in-memory query
+// evaluation or canned hits keyed by query hash.
+package search
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/alesr/stubsrv"
+)
+
+type document struct {
+	source  map[string]any
+	version int
+}
+
+type index struct {
+	docs   map[string]*document
+	order  []string
+	nextID int
+}
+
+type Cluster struct {
+	mu      sync.Mutex
+	indices map[string]*index
+	canned  map[string][]map[string]any
+}
+
+// New registers the index, document, bulk and search endpoints on the stub.
+func New(stub *stubsrv.Stub) *Cluster {
+	c := Cluster{
+		indices: make(map[string]*index),
+		canned:  make(map[string][]map[string]any),
+	}
+
+	stub.AddHandler(http.MethodPost, "/_bulk", c.handleBulk)
+	stub.AddHandler(http.MethodPut, "/:index", c.handleCreateIndex)
+	stub.AddHandler(http.MethodPost, "/:index/_bulk", c.handleBulk)
+	stub.AddHandler(http.MethodGet, "/:index/_search", c.handleSearch)
+	stub.AddHandler(http.MethodPost, "/:index/_search", c.handleSearch)
+	stub.AddHandler(http.MethodPost, "/:index/_doc", c.handleIndexDoc)
+	stub.AddHandler(http.MethodPut, "/:index/_doc/:id", c.handleIndexDoc)
+	stub.AddHandler(http.MethodPost, "/:index/_doc/:id", c.handleIndexDoc)
+	stub.AddHandler(http.MethodGet, "/:index/_doc/:id", c.handleGetDoc)
+	stub.AddHandler(http.MethodDelete, "/:index/_doc/:id", c.handleDeleteDoc)
+	return &c
+}
+
+// Index stores a document, creating the index when needed.
+func (c *Cluster) Index(indexName, id string, source map[string]any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.put(indexName, id, source)
+}
+
+// SetHits makes searches on indexName whose query is semantically equal to
+// query return hits verbatim instead of evaluating the query.
+func (c *Cluster) SetHits(indexName string, query json.RawMessage, hits []map[string]any) error {
+	key, err := queryKey(indexName, query)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.canned[key] = hits
+	return nil
+}
+
+func (c *Cluster) index(name string) *index {
+	idx, ok := c.indices[name]
+	if !ok {
+		idx = &index{docs: make(map[string]*document)}
+		c.indices[name] = idx
+	}
+	return idx
+}
+
+func (idx *index) generateID() string {
+	for {
+		idx.nextID++
+		id := strconv.Itoa(idx.nextID)
+		if _, taken := idx.docs[id]; !taken {
+			return id
+		}
+	}
+}
+
+func (c *Cluster) put(indexName, id string, source map[string]any) (string, *document, bool) {
+	idx := c.index(indexName)
+	if id == "" {
+		id = idx.generateID()
+	}
+
+	doc, exists := idx.docs[id]
+	if !exists {
+		doc = &document{}
+		idx.docs[id] = doc
+		idx.order = append(idx.order, id)
+	}
+	doc.source = source
+	doc.version++
+	return id, doc, !exists
+}
+
+func (c *Cluster) remove(indexName, id string) (*document, bool) {
+	idx, ok := c.indices[indexName]
+	if !ok {
+		return nil, false
+	}
+	doc, ok := idx.docs[id]
+	if !ok {
+		return nil, false
+	}
+	delete(idx.docs, id)
+	idx.order = slices.DeleteFunc(idx.order, func(v string) bool { return v == id })
+	return doc, true
+}
+
+func (c *Cluster) handleCreateIndex(w http.ResponseWriter, r *http.Request) {
+	name := pathSegment(r.URL.Path, 0)
+
+	c.mu.Lock()
+	_, exists := c.indices[name]
+	if !exists {
+		c.index(name)
+	}
+	c.mu.Unlock()
+
+	if exists {
+		writeError(w, http.StatusBadRequest, "resource_already_exists_exception", fmt.Sprintf("index [%s] already exists", name))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"acknowledged": true, "shards_acknowledged": true, "index": name})
+}
+
+func (c *Cluster) handleIndexDoc(w http.ResponseWriter, r *http.Request) {
+	indexName, id := pathSegment(r.URL.Path, 0), pathSegment(r.URL.Path, 2)
+
+	var source map[string]any
+	if err := json.NewDecoder(r.Body).Decode(&source); err != nil {
+		writeError(w, http.StatusBadRequest, "mapper_parsing_exception", "failed to parse: "+err.Error())
+		return
+	}
+
+	c.mu.Lock()
+	id, doc, created := c.put(indexName, id, source)
+	version := doc.version
+	c.mu.Unlock()
+
+	status, result := http.StatusOK, "updated"
+	if created {
+		status, result = http.StatusCreated, "created"
+	}
+	writeJSON(w, status, map[string]any{"_index": indexName, "_id": id, "_version": version, "result": result})
+}
+
+func (c *Cluster) handleGetDoc(w http.ResponseWriter, r *http.Request) {
+	indexName, id := pathSegment(r.URL.Path, 0), pathSegment(r.URL.Path, 2)
+
+	c.mu.Lock()
+	var doc *document
+	if idx, ok := c.indices[indexName]; ok {
+		doc = idx.docs[id]
+	}
+	var resp map[string]any
+	if doc != nil {
+		resp = map[string]any{"_index": indexName, "_id": id, "_version": doc.version, "found": true, "_source": doc.source}
+	}
+	c.mu.Unlock()
+
+	if resp == nil {
+		writeJSON(w, http.StatusNotFound, map[string]any{"_index": indexName, "_id": id, "found": false})
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (c *Cluster) handleDeleteDoc(w http.ResponseWriter, r *http.Request) {
+	indexName, id := pathSegment(r.URL.Path, 0), pathSegment(r.URL.Path, 2)
+
+	c.mu.Lock()
+	doc, ok := c.remove(indexName, id)
+	c.mu.Unlock()
+
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]any{"_index": indexName, "_id": id, "result": "not_found"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"_index": indexName, "_id": id, "_version": doc.version + 1, "result": "deleted"})
+}
+
+type bulkAction struct {
+	Index string `json:"_index"`
+	ID    string `json:"_id"`
+}
+
+func (c *Cluster) handleBulk(w http.ResponseWriter, r *http.Request) {
+	defaultIndex := ""
+	if p := strings.Trim(r.URL.Path, "/"); p != "_bulk" {
+		defaultIndex = pathSegment(r.URL.Path, 0)
+	}
+
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	var (
+		items     []map[string]any
+		hasErrors bool
+	)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var header map[string]bulkAction
+		if err := json.Unmarshal([]byte(line), &header); err != nil || len(header) != 1 {
+			writeError(w, http.StatusBadRequest, "illegal_argument_exception", "malformed action/metadata line")
+			return
+		}
+
+		for op, meta := range header {
+			if meta.Index == "" {
+				meta.Index = defaultIndex
+			}
+
+			item := map[string]any{"_index": meta.Index, "_id": meta.ID}
+			switch op {
+			case "index", "create":
+				var source map[string]any
+				if !scanner.Scan() || json.Unmarshal(scanner.Bytes(), &source) != nil {
+					writeError(w, http.StatusBadRequest, "illegal_argument_exception", "missing or invalid source for "+op)
+					return
+				}
+				if op == "create" && meta.ID != "" && c.index(meta.Index).docs[meta.ID] != nil {
+					item["status"] = http.StatusConflict
+					item["error"] = map[string]any{"type": "version_conflict_engine_exception", "reason": "document already exists"}
+					hasErrors = true
+					break
+				}
+				id, doc, created := c.put(meta.Index, meta.ID, source)
+				item["_id"], item["_version"] = id, doc.version
+				item["status"], item["result"] = http.StatusOK, "updated"
+				if created {
+					item["status"], item["result"] = http.StatusCreated, "created"
+				}
+			case "delete":
+				if _, ok := c.remove(meta.Index, meta.ID); ok {
+					item["status"], item["result"] = http.StatusOK, "deleted"
+				} else {
+					item["status"], item["result"] = http.StatusNotFound, "not_found"
+				}
+			default:
+				writeError(w, http.StatusBadRequest, "illegal_argument_exception", "unsupported bulk action "+op)
+				return
+			}
+			items = append(items, map[string]any{op: item})
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"took": 1, "errors": hasErrors, "items": items})
+}
+
+type searchRequest struct {
+	Query json.RawMessage `json:"query"`
+	Size  *int            `json:"size"`
+	From  int             `json:"from"`
+}
+
+func (c *Cluster) handleSearch(w http.ResponseWriter, r *http.Request) {
+	indexName := pathSegment(r.URL.Path, 0)
+
+	var req searchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, "parsing_exception", err.Error())
+		return
+	}
+	if len(req.Query) == 0 {
+		req.Query = json.RawMessage(`{"match_all":{}}`)
+	}
+
+	var q map[string]any
+	if err := json.Unmarshal(req.Query, &q); err != nil {
+		writeError(w, http.StatusBadRequest, "parsing_exception", err.Error())
+		return
+	}
+	key, _ := queryKey(indexName, req.Query)
+
+	c.mu.Lock()
+	hits, canned := c.canned[key]
+	if !canned {
+		idx, ok := c.indices[indexName]
+		if !ok {
+			c.mu.Unlock()
+			writeError(w, http.StatusNotFound, "index_not_found_exception", "no such index ["+indexName+"]")
+			return
+		}
+		hits = []map[string]any{}
+		for _, id := range idx.order {
+			if doc := idx.docs[id]; evaluate(q, doc.source) {
+				hits = append(hits, map[string]any{"_index": indexName, "_id": id, "_score": 1.0, "_source": doc.source})
+			}
+		}
+	}
+	c.mu.Unlock()
+
+	total := len(hits)
+	from := min(req.From, len(hits))
+	hits = hits[from:]
+	if req.Size != nil && *req.Size < len(hits) {
+		hits = hits[:*req.Size]
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"took":      1,
+		"timed_out": false,
+		"hits": map[string]any{
+			"total":     map[string]any{"value": total, "relation": "eq"},
+			"max_score": 1.0,
+			"hits":      hits,
+		},
+	})
+}
+
+// evaluate supports match_all, match, term, terms and bool queries.
+func evaluate(q map[string]any, source map[string]any) bool {
+	for kind, body := range q {
+		clause, _ := body.(map[string]any)
+
+		switch kind {
+		case "match_all":
+		case "match":
+			for field, v := range clause {
+				if !matchText(lookup(source, field), queryValue(v, "query")) {
+					return false
+				}
+			}
+		case "term":
+			for field, v := range clause {
+				if !equal(lookup(source, field), queryValue(v, "value")) {
+					return false
+				}
+			}
+		case "terms":
+			for field, v := range clause {
+				values, _ := v.([]any)
+				if !slices.ContainsFunc(values, func(want any) bool { return equal(lookup(source, field), want) }) {
+					return false
+				}
+			}
+		case "bool":
+			if !evaluateBool(clause, source) {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func evaluateBool(clause map[string]any, source map[string]any) bool {
+	for _, occur := range []string{"must", "filter"} {
+		for _, sub := range subQueries(clause[occur]) {
+			if !evaluate(sub, source) {
+				return false
+			}
+		}
+	}
+	for _, sub := range subQueries(clause["must_not"]) {
+		if evaluate(sub, source) {
+			return false
+		}
+	}
+	if should := subQueries(clause["should"]); len(should) > 0 {
+		return slices.ContainsFunc(should, func(sub map[string]any) bool { return evaluate(sub, source) })
+	}
+	return true
+}
+
+func subQueries(v any) []map[string]any {
+	switch t := v.(type) {
+	case map[string]any:
+		return []map[string]any{t}
+	case []any:
+		var subs []map[string]any
+		for _, item := range t {
+			if m, ok := item.(map[string]any); ok {
+				subs = append(subs, m)
+			}
+		}
+		return subs
+	}
+	return nil
+}
+
+// queryValue unwraps the long form {"field": {"query": v}}.
+func queryValue(v any, key string) any {
+	if m, ok := v.(map[string]any); ok {
+		return m[key]
+	}
+	return v
+}
+
+// matchText reports whether any token of want appears in got.
+func matchText(got, want any) bool {
+	gotTokens := strings.Fields(strings.ToLower(fmt.Sprint(got)))
+	for _, tok := range strings.Fields(strings.ToLower(fmt.Sprint(want))) {
+		if slices.Contains(gotTokens, tok) {
+			return true
+		}
+	}
+	return false
+}
+
+func equal(got, want any) bool {
+	if got == nil {
+		return false
+	}
+	return fmt.Sprint(got) == fmt.Sprint(want)
+}
+
+func lookup(source map[string]any, field string) any {
+	var cur any = source
+	for _, part := range strings.Split(field, ".") {
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return nil
+		}
+		cur = m[part]
+	}
+	return cur
+}
+
+func queryKey(indexName string, query json.RawMessage) (string, error) {
+	var v any
+	if err := json.Unmarshal(query, &v); err != nil {
+		return "", fmt.Errorf("could not parse query: %w", err)
+	}
+	// re-encoding sorts object keys, so equivalent queries hash the same
+	normalized, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("could not normalize query: %w", err)
+	}
+	sum := sha256.Sum256(append([]byte(indexName+"\x00"), normalized...))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func pathSegment(p string, i int) string {
+	segs := strings.Split(strings.Trim(p, "/"), "/")
+	if i >= len(segs) {
+		return ""
+	}
+	return segs[i]
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, typ, reason string) {
+	writeJSON(w, status, map[string]any{
+		"error":  map[string]any{"type": typ, "reason": reason},
+		"status": status,
+	})
+}
@@ -0,0 +1,176 @@
+package search
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/alesr/stubsrv"
+	"github.com/alesr/stubsrv/internal/stubtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCluster_Documents(t *testing.T) {
+	t.Parallel()
+
+	stub, _ := newCluster(t)
+
+	resp, body := stubtest.Do(t, http.MethodPut, stub.URL()+"/books", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, body, `"acknowledged":true`)
+
+	resp, _ = stubtest.Do(t, http.MethodPut, stub.URL()+"/books", "")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, body = stubtest.Do(t, http.MethodPut, stub.URL()+"/books/_doc/1", `{"title":"Dune"}`)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Contains(t, body, `"result":"created"`)
+
+	resp, body = stubtest.Do(t, http.MethodPut, stub.URL()+"/books/_doc/1", `{"title":"Dune Messiah"}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, body, `"_version":2`)
+
+	resp, body = stubtest.Do(t, http.MethodPost, stub.URL()+"/books/_doc", `{"title":"Emma"}`)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Contains(t, body, `"_id":"2"`)
+
+	resp, body = stubtest.Do(t, http.MethodGet, stub.URL()+"/books/_doc/2", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, body, `"_source":{"title":"Emma"}`)
+
+	resp, _ = stubtest.Do(t, http.MethodDelete, stub.URL()+"/books/_doc/1", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, body = stubtest.Do(t, http.MethodGet, stub.URL()+"/books/_doc/1", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Contains(t, body, `"found":false`)
+}
+
+func TestCluster_Bulk(t *testing.T) {
+	t.Parallel()
+
+	stub, _ := newCluster(t)
+
+	payload := strings.Join([]string{
+		`{"index":{"_index":"logs","_id":"a"}}`,
+		`{"level":"info"}`,
+		`{"create":{"_id":"b"}}`,
+		`{"level":"error"}`,
+		`{"create":{"_id":"a"}}`,
+		`{"level":"warn"}`,
+		`{"delete":{"_id":"missing"}}`,
+	}, "\n") + "\n"
+
+	resp, body := stubtest.Do(t, http.MethodPost, stub.URL()+"/logs/_bulk", payload)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var got struct {
+		Errors bool
+		Items  []map[string]struct{ Status int }
+	}
+	require.NoError(t, json.Unmarshal([]byte(body), &got))
+	assert.True(t, got.Errors)
+	require.Len(t, got.Items, 4)
+	assert.Equal(t, http.StatusCreated, got.Items[0]["index"].Status)
+	assert.Equal(t, http.StatusCreated, got.Items[1]["create"].Status)
+	assert.Equal(t, http.StatusConflict, got.Items[2]["create"].Status)
+	assert.Equal(t, http.StatusNotFound, got.Items[3]["delete"].Status)
+}
+
+func TestCluster_Search(t *testing.T) {
+	t.Parallel()
+
+	stub, c := newCluster(t)
+	c.Index("books", "1", map[string]any{"title": "The Hobbit", "genre": "fantasy", "meta": map[string]any{"year": 1937}})
+	c.Index("books", "2", map[string]any{"title": "Dune", "genre": "scifi", "meta": map[string]any{"year": 1965}})
+	c.Index("books", "3", map[string]any{"title": "The Left Hand of Darkness", "genre": "scifi", "meta": map[string]any{"year": 1969}})
+
+	testCases := []struct {
+		name          string
+		givenBody     string
+		expectedTotal int
+		expectedIDs   []string
+	}{
+		{name: "no body matches all", givenBody: "", expectedTotal: 3, expectedIDs: []string{"1", "2", "3"}},
+		{name: "match on any token", givenBody: `{"query":{"match":{"title":"hobbit darkness"}}}`, expectedTotal: 2, expectedIDs: []string{"1", "3"}},
+		{name: "term on nested field", givenBody: `{"query":{"term":{"meta.year":{"value":1965}}}}`, expectedTotal: 1, expectedIDs: []string{"2"}},
+		{name: "terms", givenBody: `{"query":{"terms":{"genre":["fantasy","poetry"]}}}`, expectedTotal: 1, expectedIDs: []string{"1"}},
+		{
+			name:          "bool with must and must_not",
+			givenBody:     `{"query":{"bool":{"filter":[{"term":{"genre":"scifi"}}],"must_not":{"match":{"title":"dune"}}}}}`,
+			expectedTotal: 1,
+			expectedIDs:   []string{"3"},
+		},
+		{name: "pagination", givenBody: `{"from":1,"size":1}`, expectedTotal: 3, expectedIDs: []string{"2"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			resp, body := stubtest.Do(t, http.MethodPost, stub.URL()+"/books/_search", tc.givenBody)
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+
+			total, ids := decodeHits(t, body)
+			assert.Equal(t, tc.expectedTotal, total)
+			assert.Equal(t, tc.expectedIDs, ids)
+		})
+	}
+
+	t.Run("unknown index", func(t *testing.T) {
+		t.Parallel()
+
+		resp, body := stubtest.Do(t, http.MethodGet, stub.URL()+"/nope/_search", "")
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		assert.Contains(t, body, "index_not_found_exception")
+	})
+}
+
+func TestCluster_SetHits(t *testing.T) {
+	t.Parallel()
+
+	stub, c := newCluster(t)
+	require.NoError(t, c.SetHits("products", json.RawMessage(`{"match":{"name":"lamp"}}`), []map[string]any{
+		{"_index": "products", "_id": "canned", "_source": map[string]any{"name": "Desk lamp"}},
+	}))
+
+	// key order and whitespace differ from the registered query
+	resp, body := stubtest.Do(t, http.MethodPost, stub.URL()+"/products/_search", `{ "query": { "match": { "name": "lamp" } } }`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	total, ids := decodeHits(t, body)
+	assert.Equal(t, 1, total)
+	assert.Equal(t, []string{"canned"}, ids)
+
+	assert.Error(t, c.SetHits("products", json.RawMessage(`{`), nil))
+}
+
+func newCluster(t *testing.T) (*stubsrv.Stub, *Cluster) {
+	t.Helper()
+
+	var c *Cluster
+	stub := stubtest.New(t, func(stub *stubsrv.Stub) { c = New(stub) })
+	return stub, c
+}
+
+func decodeHits(t *testing.T, body string) (int, []string) {
+	t.Helper()
+
+	var got struct {
+		Hits struct {
+			Total struct{ Value int }
+			Hits  []struct {
+				ID string `json:"_id"`
+			}
+		}
+	}
+	require.NoError(t, json.Unmarshal([]byte(body), &got))
+
+	ids := []string{}
+	for _, h := range got.Hits.Hits {
+		ids = append(ids, h.ID)
+	}
+	return got.Hits.Total.Value, ids
+}
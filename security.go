@@ -0,0 +1,93 @@
+package stubsrv
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// SecurityHeaders is a set of response headers production services send to
+// harden browsers and satisfy scanners. Empty fields are not sent.
+type SecurityHeaders struct {
+	// HSTSMaxAge sets Strict-Transport-Security.
+	HSTSMaxAge            time.Duration
+	HSTSIncludeSubdomains bool
+	HSTSPreload           bool
+	// ExpectCT sets the deprecated Expect-CT header, such as
+	// "max-age=86400, enforce", still checked by some scanners.
+	ExpectCT              string
+	ContentSecurityPolicy string
+	// NoSniff sets X-Content-Type-Options: nosniff.
+	NoSniff                 bool
+	FrameOptions            string
+	ReferrerPolicy          string
+	PermissionsPolicy       string
+	CrossOriginOpenerPolicy string
+}
+
+// DefaultSecurityHeaders returns a strict set of headers as recommended by
+// the OWASP Secure Headers Project.
+func DefaultSecurityHeaders() SecurityHeaders {
+	return SecurityHeaders{
+		HSTSMaxAge:              365 * 24 * time.Hour,
+		HSTSIncludeSubdomains:   true,
+		ContentSecurityPolicy:   "default-src 'none'; frame-ancestors 'none'",
+		NoSniff:                 true,
+		FrameOptions:            "DENY",
+		ReferrerPolicy:          "no-referrer",
+		PermissionsPolicy:       "geolocation=(), camera=(), microphone=()",
+		CrossOriginOpenerPolicy: "same-origin",
+	}
+}
+
+// WithSecurityHeaders sends h on every response from user routes,
+// including 404 and 405 answers, but not on control endpoints.
+func WithSecurityHeaders(h SecurityHeaders) Option {
+	return func(cfg *stubConfig) {
+		cfg.securityHeaders = &h
+	}
+}
+
+// Middleware returns a middleware sending h on a single route. Headers the
+// route sets itself take precedence.
+func (h SecurityHeaders) Middleware() Middleware {
+	headers := h.header()
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for k := range headers {
+				w.Header().Set(k, headers.Get(k))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (h SecurityHeaders) header() http.Header {
+	header := make(http.Header)
+	set := func(key, value string) {
+		if value != "" {
+			header.Set(key, value)
+		}
+	}
+
+	if h.HSTSMaxAge > 0 {
+		hsts := "max-age=" + strconv.Itoa(int(h.HSTSMaxAge.Seconds()))
+		if h.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+		if h.HSTSPreload {
+			hsts += "; preload"
+		}
+		set("Strict-Transport-Security", hsts)
+	}
+	set("Expect-CT", h.ExpectCT)
+	set("Content-Security-Policy", h.ContentSecurityPolicy)
+	if h.NoSniff {
+		set("X-Content-Type-Options", "nosniff")
+	}
+	set("X-Frame-Options", h.FrameOptions)
+	set("Referrer-Policy", h.ReferrerPolicy)
+	set("Permissions-Policy", h.PermissionsPolicy)
+	set("Cross-Origin-Opener-Policy", h.CrossOriginOpenerPolicy)
+	return header
+}
@@ -0,0 +1,81 @@
+package stubsrv
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithSecurityHeaders(t *testing.T) {
+	t.Parallel()
+
+	stub := NewStub(noopLogger(), WithSecurityHeaders(DefaultSecurityHeaders()))
+	stub.AddHandler(http.MethodGet, "/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Frame-Options", "SAMEORIGIN")
+	})
+	require.NoError(t, stub.Start())
+	t.Cleanup(stub.Close)
+
+	testCases := []struct {
+		name            string
+		givenPath       string
+		expectedHeaders map[string]string
+	}{
+		{
+			name:      "route",
+			givenPath: "/page",
+			expectedHeaders: map[string]string{
+				"Strict-Transport-Security": "max-age=31536000; includeSubDomains",
+				"X-Content-Type-Options":    "nosniff",
+				"Content-Security-Policy":   "default-src 'none'; frame-ancestors 'none'",
+				"X-Frame-Options":           "SAMEORIGIN",
+				"Expect-CT":                 "",
+			},
+		},
+		{
+			name:            "not found",
+			givenPath:       "/missing",
+			expectedHeaders: map[string]string{"X-Content-Type-Options": "nosniff", "X-Frame-Options": "DENY"},
+		},
+		{
+			name:            "control plane",
+			givenPath:       "/_control/handlers",
+			expectedHeaders: map[string]string{"X-Content-Type-Options": "", "Strict-Transport-Security": ""},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			resp, err := http.Get(stub.URL() + tc.givenPath)
+			require.NoError(t, err)
+			resp.Body.Close()
+
+			for k, v := range tc.expectedHeaders {
+				assert.Equal(t, v, resp.Header.Get(k), k)
+			}
+		})
+	}
+}
+
+func TestSecurityHeaders_Middleware(t *testing.T) {
+	t.Parallel()
+
+	stub := NewStub(noopLogger())
+	headers := SecurityHeaders{HSTSMaxAge: time.Hour, HSTSPreload: true, ExpectCT: "max-age=86400, enforce"}
+	stub.AddHandler(http.MethodGet, "/", func(w http.ResponseWriter, r *http.Request) {}, headers.Middleware())
+	require.NoError(t, stub.Start())
+	defer stub.Close()
+
+	resp, err := http.Get(stub.URL() + "/")
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, "max-age=3600; preload", resp.Header.Get("Strict-Transport-Security"))
+	assert.Equal(t, "max-age=86400, enforce", resp.Header.Get("Expect-CT"))
+	assert.Empty(t, resp.Header.Get("X-Content-Type-Options"))
+}
@@ -0,0 +1,74 @@
+package stubsrv
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SSEEvent is one event streamed by a route added with AddSSE. Only Data is
+// required.
+type SSEEvent struct {
+	ID    string
+	Event string
+	Data  string
+	// Retry, when set, tells the client how long to wait before reconnecting.
+	Retry time.Duration
+	// Delay, when set, replaces the route's interval before this event.
+	Delay time.Duration
+}
+
+// write frames e as text/event-stream, one data line per line of Data.
+func (e SSEEvent) write(b *strings.Builder) {
+	if e.ID != "" {
+		fmt.Fprintf(b, "id: %s\n", e.ID)
+	}
+	if e.Event != "" {
+		fmt.Fprintf(b, "event: %s\n", e.Event)
+	}
+	if e.Retry > 0 {
+		fmt.Fprintf(b, "retry: %d\n", e.Retry.Milliseconds())
+	}
+	for line := range strings.SplitSeq(e.Data, "\n") {
+		fmt.Fprintf(b, "data: %s\n", line)
+	}
+	b.WriteString("\n")
+}
+
+// AddSSE registers a GET route streaming events as Server-Sent Events,
+// waiting interval before each one, and closing the stream after the last.
+// Each event is flushed as soon as it is written.
+func (s *Stub) AddSSE(path string, events []SSEEvent, interval time.Duration, middlewares ...Middleware) {
+	s.AddHandler(http.MethodGet, path, func(w http.ResponseWriter, r *http.Request) {
+		rc := http.NewResponseController(w)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		_ = rc.Flush()
+
+		for _, e := range events {
+			wait := interval
+			if e.Delay > 0 {
+				wait = e.Delay
+			}
+			if wait > 0 {
+				select {
+				case <-time.After(wait):
+				case <-r.Context().Done():
+					return
+				}
+			}
+
+			var b strings.Builder
+			e.write(&b)
+			if _, err := w.Write([]byte(b.String())); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}, middlewares...)
+}
@@ -0,0 +1,54 @@
+package stubsrv
+
+import (
+	"bufio"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStub_AddSSE(t *testing.T) {
+	t.Parallel()
+
+	stub := NewStub(noopLogger())
+	stub.AddSSE("/events", []SSEEvent{
+		{ID: "1", Event: "greeting", Data: "hello", Retry: 3 * time.Second},
+		{Data: "line one\nline two"},
+		{ID: "3", Data: "slow", Delay: 50 * time.Millisecond},
+	}, 10*time.Millisecond)
+	require.NoError(t, stub.Start())
+	defer stub.Close()
+
+	start := time.Now()
+	resp, err := http.Get(stub.URL() + "/events")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "no-cache", resp.Header.Get("Cache-Control"))
+
+	var frames []string
+	var frame strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if scanner.Text() == "" {
+			frames = append(frames, frame.String())
+			frame.Reset()
+			continue
+		}
+		frame.WriteString(scanner.Text() + "\n")
+	}
+	require.NoError(t, scanner.Err())
+
+	assert.Equal(t, []string{
+		"id: 1\nevent: greeting\nretry: 3000\ndata: hello\n",
+		"data: line one\ndata: line two\n",
+		"id: 3\ndata: slow\n",
+	}, frames)
+	assert.GreaterOrEqual(t, time.Since(start), 70*time.Millisecond)
+}
@@ -0,0 +1,182 @@
+// Package stubclient drives a stub server running in another process, such
+// as cmd/stubsrv in a container, through its control API:
+//
+//	client := stubclient.New("http://localhost:8080")
+//	id, err := client.AddHandler(ctx, stubsrv.DynamicHandlerSpec{
+//		Method: "GET",
+//		Path:   "/users/:id",
+//		Body:   `{"name":"alice"}`,
+//	})
+package stubclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/alesr/stubsrv"
+)
+
+// StatusError is returned when the stub answers a control request with an
+// unexpected status.
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("stub answered %d: %s", e.StatusCode, e.Message)
+}
+
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	token      string
+}
+
+type Option func(*Client)
+
+// WithHTTPClient sets the client control requests are sent with, such as
+// stub.Client() for a stub served over TLS. Defaults to
+// http.DefaultClient.
+func WithHTTPClient(c *http.Client) Option {
+	return func(client *Client) {
+		client.httpClient = c
+	}
+}
+
+// WithToken sends token as a bearer token, for stubs started with
+// stubsrv.WithControlAuth.
+func WithToken(token string) Option {
+	return func(client *Client) {
+		client.token = token
+	}
+}
+
+// New returns a client for the stub whose control endpoints are at baseURL,
+// see stubsrv.Stub.ControlURL.
+func New(baseURL string, opts ...Option) *Client {
+	c := Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return &c
+}
+
+// AddHandler registers spec and returns the new route's ID.
+func (c *Client) AddHandler(ctx context.Context, spec stubsrv.DynamicHandlerSpec) (string, error) {
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/_control/handlers", spec, http.StatusCreated, &created); err != nil {
+		return "", err
+	}
+	return created.ID, nil
+}
+
+// AddHandlers registers every spec in one request, all or none of them,
+// and returns the new routes' IDs.
+func (c *Client) AddHandlers(ctx context.Context, specs ...stubsrv.DynamicHandlerSpec) ([]string, error) {
+	var created struct {
+		IDs []string `json:"ids"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/_control/handlers/bulk", specs, http.StatusCreated, &created); err != nil {
+		return nil, err
+	}
+	return created.IDs, nil
+}
+
+// ListHandlers returns every registered route ordered by ID.
+func (c *Client) ListHandlers(ctx context.Context) ([]stubsrv.HandlerInfo, error) {
+	var handlers []stubsrv.HandlerInfo
+	if err := c.do(ctx, http.MethodGet, "/_control/handlers", nil, http.StatusOK, &handlers); err != nil {
+		return nil, err
+	}
+	return handlers, nil
+}
+
+// DeleteHandler removes the route with id.
+func (c *Client) DeleteHandler(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/_control/handlers/"+url.PathEscape(id), nil, http.StatusNoContent, nil)
+}
+
+// Reset removes every route and clears the request journal, see
+// stubsrv.Stub.Reset.
+func (c *Client) Reset(ctx context.Context) error {
+	return c.do(ctx, http.MethodPost, "/_control/reset", nil, http.StatusNoContent, nil)
+}
+
+// GetRequests returns the requests the stub's routes received, in arrival
+// order.
+func (c *Client) GetRequests(ctx context.Context) ([]stubsrv.RecordedRequest, error) {
+	var recs []stubsrv.RecordedRequest
+	if err := c.do(ctx, http.MethodGet, "/_control/requests", nil, http.StatusOK, &recs); err != nil {
+		return nil, err
+	}
+	return recs, nil
+}
+
+// ClearRequests empties the stub's request journal, keeping its routes.
+func (c *Client) ClearRequests(ctx context.Context) error {
+	return c.do(ctx, http.MethodDelete, "/_control/requests", nil, http.StatusNoContent, nil)
+}
+
+// Verify checks the stub's request journal against spec. A spec that is not
+// satisfied is not an error; see stubsrv.VerifyResult.OK.
+func (c *Client) Verify(ctx context.Context, spec stubsrv.VerifySpec) (stubsrv.VerifyResult, error) {
+	var result stubsrv.VerifyResult
+	if err := c.do(ctx, http.MethodPost, "/_control/verify", spec, http.StatusOK, &result); err != nil {
+		return stubsrv.VerifyResult{}, err
+	}
+	return result, nil
+}
+
+// do sends in as JSON, unless it is nil, and decodes the response into out,
+// unless it is nil.
+func (c *Client) do(ctx context.Context, method, path string, in any, expectedStatus int, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("could not encode request: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return fmt.Errorf("could not create request: %w", err)
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not reach stub: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != expectedStatus {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+		return &StatusError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(msg))}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("could not decode response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package stubclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/alesr/stubsrv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient(t *testing.T) {
+	t.Parallel()
+
+	stub := stubsrv.NewStub(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.NoError(t, stub.Start())
+	defer stub.Close()
+
+	ctx := context.Background()
+	client := New(stub.URL() + "/")
+
+	id, err := client.AddHandler(ctx, stubsrv.DynamicHandlerSpec{
+		Method: http.MethodPost,
+		Path:   "/users",
+		Status: http.StatusCreated,
+		Body:   `{"id":"1"}`,
+	})
+	require.NoError(t, err)
+	assert.NotEmpty(t, id)
+
+	ids, err := client.AddHandlers(ctx,
+		stubsrv.DynamicHandlerSpec{Method: http.MethodGet, Path: "/users/:id"},
+		stubsrv.DynamicHandlerSpec{Method: http.MethodDelete, Path: "/users/:id", Status: http.StatusNoContent},
+	)
+	require.NoError(t, err)
+	assert.Len(t, ids, 2)
+
+	handlers, err := client.ListHandlers(ctx)
+	require.NoError(t, err)
+	require.Len(t, handlers, 3)
+	assert.Equal(t, id, handlers[0].ID)
+	assert.Equal(t, "/users", handlers[0].Path)
+
+	resp, err := http.Post(stub.URL()+"/users", "application/json", strings.NewReader(`{"name":"alice"}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	recs, err := client.GetRequests(ctx)
+	require.NoError(t, err)
+	require.Len(t, recs, 1)
+	assert.Equal(t, http.MethodPost, recs[0].Method)
+	assert.Equal(t, `{"name":"alice"}`, string(recs[0].Body))
+
+	result, err := client.Verify(ctx, stubsrv.VerifySpec{Method: http.MethodPost, Path: "/users", Body: "alice", BodyMode: stubsrv.BodyContains})
+	require.NoError(t, err)
+	assert.True(t, result.OK)
+	assert.Equal(t, 1, result.Matched)
+
+	require.NoError(t, client.ClearRequests(ctx))
+	recs, err = client.GetRequests(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, recs)
+
+	require.NoError(t, client.DeleteHandler(ctx, id))
+	err = client.DeleteHandler(ctx, id)
+	var statusErr *StatusError
+	require.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, http.StatusNotFound, statusErr.StatusCode)
+	assert.Equal(t, "handler not found", statusErr.Message)
+
+	_, err = client.AddHandler(ctx, stubsrv.DynamicHandlerSpec{Method: http.MethodGet, Path: "/x", Fault: "nope"})
+	require.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, http.StatusBadRequest, statusErr.StatusCode)
+
+	require.NoError(t, client.Reset(ctx))
+	recs, err = client.GetRequests(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, recs)
+}
+
+func TestClient_Unreachable(t *testing.T) {
+	t.Parallel()
+
+	_, err := New("http://127.0.0.1:1").ListHandlers(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "could not reach stub")
+}
+
+func TestClient_WithToken(t *testing.T) {
+	t.Parallel()
+
+	stub := stubsrv.NewStub(slog.New(slog.NewTextHandler(io.Discard, nil)), stubsrv.WithControlAuth("s3cret"))
+	require.NoError(t, stub.Start())
+	defer stub.Close()
+
+	var statusErr *StatusError
+	err := New(stub.ControlURL()).Reset(context.Background())
+	require.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, http.StatusUnauthorized, statusErr.StatusCode)
+
+	assert.NoError(t, New(stub.ControlURL(), WithToken("s3cret")).Reset(context.Background()))
+}
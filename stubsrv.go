@@ -1,20 +1,53 @@
 package stubsrv
 
 import (
-	"encoding/json"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
+	"io/fs"
 	"log/slog"
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 const defaultPort = "8008"
 
-type stubConfig struct{ port string }
+type stubConfig struct {
+	port      string
+	tls       bool
+	tlsConfig *tls.Config
+	now       func() time.Time
+	gateway   *GatewayConfig
+	strict    bool
+
+	gated        bool
+	dependencies []string
+	registrars   []namedRegistrar
+	grpc         bool
+	grpcPort     string
+	limits       Limits
+
+	callbackWorkers int
+	watchConfig     bool
+	profile         string
+	securityHeaders *SecurityHeaders
+	controlToken    string
+	bodyFiles       fs.FS
+	controlPort     string
+	router          Router
+
+	notFoundDiagnostics bool
+	clientDeadlines     bool
+}
 
 type Option func(*stubConfig)
 
@@ -24,12 +57,70 @@ func WithPort(port string) Option {
 	}
 }
 
+// WithTLS serves the stub over HTTPS using an auto-generated self-signed
+// certificate. Use Client to get an HTTP client that trusts it.
+func WithTLS() Option {
+	return func(cfg *stubConfig) {
+		cfg.tls = true
+	}
+}
+
+// WithTLSConfig serves the stub over HTTPS with the given configuration.
+// A self-signed certificate is generated when it has no certificates.
+func WithTLSConfig(tlsConfig *tls.Config) Option {
+	return func(cfg *stubConfig) {
+		cfg.tls = true
+		cfg.tlsConfig = tlsConfig
+	}
+}
+
+// WithClock sets the clock schedules are evaluated against, so tests can
+// move time forward without sleeping. Defaults to time.Now.
+func WithClock(now func() time.Time) Option {
+	return func(cfg *stubConfig) {
+		cfg.now = now
+	}
+}
+
+// clockKey holds the clock of the stub serving a request.
+type clockKey struct{}
+
+// requestNow returns the time on the clock of the stub serving r, see
+// WithClock, or the wall clock when r isn't served by a stub.
+func requestNow(r *http.Request) time.Time {
+	if now, ok := r.Context().Value(clockKey{}).(func() time.Time); ok {
+		return now()
+	}
+	return time.Now()
+}
+
+// WithStrictMode records requests answered with 404 or 405 as unexpected,
+// see VerifyNoUnexpectedRequests.
+func WithStrictMode() Option {
+	return func(cfg *stubConfig) {
+		cfg.strict = true
+	}
+}
+
 // Key: "METHOD /path"
 type routes map[string]routeInfo
 
 type routeInfo struct {
+	id          string
 	handler     http.Handler
 	middlewares []Middleware
+	matchers    []Matcher
+	fault       Fault
+	priority    int
+	spec        *DynamicHandlerSpec
+}
+
+func (ri routeInfo) build() http.Handler {
+	h := ri.handler
+	if ri.fault != "" {
+		h = faultHandler(ri.fault)
+	}
+	return chainMiddleware(h, ri.middlewares...)
 }
 
 type templateRoute struct {
@@ -39,23 +130,106 @@ type templateRoute struct {
 	info     routeInfo
 }
 
+// constrained reports whether the route matches on more than method and
+// path, so its matches can't be cached by method and path.
+func (tr templateRoute) constrained() bool {
+	return len(tr.queries) > 0 || len(tr.info.matchers) > 0
+}
+
+// outranks reports whether tr wins over other when both match a request:
+// higher priority first, then more literal path segments, then more query
+// and matcher constraints.
+func (tr templateRoute) outranks(other templateRoute) bool {
+	if tr.info.priority != other.info.priority {
+		return tr.info.priority > other.info.priority
+	}
+	if a, b := tr.literals(), other.literals(); a != b {
+		return a > b
+	}
+	return len(tr.queries)+len(tr.info.matchers) > len(other.queries)+len(other.info.matchers)
+}
+
+func (tr templateRoute) literals() int {
+	var n int
+	for _, seg := range tr.segments {
+		if seg != "*" && seg != "..." && !strings.HasPrefix(seg, ":") {
+			n++
+		}
+	}
+	return n
+}
+
+func (tr templateRoute) match(r *http.Request) bool {
+	return tr.method == r.Method &&
+		pathMatch(tr.segments, r.URL.Path) &&
+		queryMatch(tr.queries, r.URL.Query()) &&
+		matchersMatch(tr.info.matchers, r)
+}
+
 type Stub struct {
 	logger         *slog.Logger
-	mu             sync.Mutex
+	mu             sync.RWMutex
 	routers        routes
 	templateRoutes []templateRoute
 	baseURL        string
 	port           string
+	tls            bool
+	tlsConfig      *tls.Config
 	Server         *httptest.Server
 	mux            *http.ServeMux
 	closed         bool
+	journal        journal
+	errs           errorJournal
+	scenarios      scenarios
+	behaviors      map[string]Behavior
+	middlewares    []Middleware
+	nextRouteID    int
+	routeCache     *routeCache
+	routeList      atomic.Pointer[[]Route]
+	routeTrie      atomic.Pointer[routeTrie]
+	derivedMu      sync.Mutex // serializes building routeList and routeTrie
+	router         Router
+	diagnostics    bool
+	deadlines      bool
+	proxy          http.Handler
+	recordings     []DynamicHandlerSpec
+	recordingBytes int64
+	now            func() time.Time
+	gateway        *gateway
+	strict         bool
+	sequences      []*Sequence
+	expectations   []*Expectation
+	sources        []Source
+	started        time.Time
+	ready          bool
+	loading        int
+	dependencies   []string
+	hooks          hooks
+	registrars     []namedRegistrar
+	grpc           bool
+	grpcPort       string
+	grpcMethods    map[string]GRPCHandler
+	grpcServer     *http.Server
+	grpcAddr       string
+	callbacks      *callbackPool
+	watchConfig    bool
+	watchDone      chan struct{}
+	profile        string
+	control        http.Handler
+	controlMux     *http.ServeMux
+	controlPort    string
+	bodyFiles      fs.FS
+	controlServer  *httptest.Server
+	controlURL     string
 }
 
 func NewStub(logger *slog.Logger, opts ...Option) *Stub {
 	s := Stub{
-		logger:  logger.WithGroup("stubsrv"),
-		routers: make(routes),
-		port:    defaultPort,
+		logger:     logger.WithGroup("stubsrv"),
+		routers:    make(routes),
+		port:       defaultPort,
+		behaviors:  defaultBehaviors(),
+		routeCache: newRouteCache(routeCacheSize),
 	}
 
 	var cfg stubConfig
@@ -64,24 +238,78 @@ func NewStub(logger *slog.Logger, opts ...Option) *Stub {
 	}
 
 	s.port = cfg.port
+	s.tls = cfg.tls
+	s.tlsConfig = cfg.tlsConfig
+	s.now = cfg.now
+	s.strict = cfg.strict
+	s.ready = !cfg.gated
+	s.dependencies = cfg.dependencies
+	s.registrars = cfg.registrars
+	s.grpc = cfg.grpc
+	s.grpcPort = cfg.grpcPort
+	s.grpcMethods = make(map[string]GRPCHandler)
+	s.journal.limits = cfg.limits
+	s.callbacks = newCallbackPool(s.logger, cfg.callbackWorkers)
+	s.watchConfig = cfg.watchConfig
+	s.profile = cfg.profile
+	s.router = cfg.router
+	s.diagnostics = cfg.notFoundDiagnostics
+	s.deadlines = cfg.clientDeadlines
+	s.watchDone = make(chan struct{})
+	s.scenarios.limits = cfg.limits
+	if s.now == nil {
+		s.now = time.Now
+	}
+	if cfg.gateway != nil {
+		s.gateway = newGateway(*cfg.gateway, s.now)
+	}
 
 	s.mux = http.NewServeMux()
 
-	// control-plane endpoint
-	s.mux.HandleFunc("/_control/handlers", s.controlAddHandler)
+	// control-plane endpoints, served on their own port with WithControlPort
+	control := http.NewServeMux()
+	control.HandleFunc("/_control/handlers", s.controlHandlers)
+	control.HandleFunc("/_control/handlers/", s.controlHandlers)
+	control.HandleFunc("/_control/reset", s.controlReset)
+	control.HandleFunc("/_control/requests", s.controlRequests)
+	control.HandleFunc("/_control/verify", s.controlVerify)
+	control.HandleFunc("/_control/recordings", s.controlRecordings)
+	control.HandleFunc("/_control/scenarios", s.controlScenarios)
+	control.HandleFunc("/_control/scenarios/", s.controlScenarios)
+	control.HandleFunc("/_control/behaviors", s.controlBehaviors)
+	control.HandleFunc("/_control/behaviors/", s.controlBehaviors)
+	control.HandleFunc("/_control/info", s.controlInfo)
+	control.HandleFunc("/_control/ready", s.controlReady)
+	control.HandleFunc("/_control/config/apply", s.controlConfigApply)
+	control.HandleFunc("/_control/jwt", s.controlJWT)
+	control.HandleFunc("/_control/usage", s.controlUsage)
+	control.HandleFunc("/_control/deliveries", s.controlDeliveries)
+	control.HandleFunc("/_control/errors", s.controlErrors)
+	// routes added under /_control/, such as the control endpoints of
+	// sub-packages, belong to the control plane too
+	control.HandleFunc("/_control/", s.dispatch)
+	s.controlMux = control
+	s.control = s.controlAuth(cfg.controlToken, control)
+	s.controlPort = cfg.controlPort
+	s.bodyFiles = cfg.bodyFiles
+	if s.controlPort == "" {
+		s.mux.Handle("/_control/", s.control)
+	} else {
+		s.mux.Handle("/_control/", http.NotFoundHandler())
+	}
 
 	// readiness probe
-	s.mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodGet {
-			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
-			return
-		}
-		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write([]byte("ok"))
-	})
+	s.mux.HandleFunc("/readyz", s.readyz)
 
 	// dispatcher for user routes
-	s.mux.HandleFunc("/", s.dispatch)
+	var dispatch http.Handler = http.HandlerFunc(s.dispatch)
+	if s.gateway != nil {
+		dispatch = s.gateway.wrap(s.dispatch)
+	}
+	if cfg.securityHeaders != nil {
+		dispatch = cfg.securityHeaders.Middleware()(dispatch)
+	}
+	s.mux.Handle("/", dispatch)
 
 	return &s
 }
@@ -94,35 +322,158 @@ func (s *Stub) AddHandler(method, path string, handlerFunc http.HandlerFunc, mid
 		panic("cannot add handlers on a closed stub server")
 	}
 
+	s.addRoute(method, path, nil, routeInfo{
+		handler:     handlerFunc,
+		middlewares: middlewares,
+	})
+}
+
+// HandleControl serves handlerFunc at path on the control plane, next to the
+// built-in control endpoints: behind the control token and port, outside the
+// journal and the handlers list, and kept across Reset and ApplyConfig. It
+// is how sub-packages add their control endpoints. It panics when path is
+// not under /_control/ or is already served.
+func (s *Stub) HandleControl(path string, handlerFunc http.HandlerFunc) {
+	if !strings.HasPrefix(path, "/_control/") {
+		panic("control endpoint path must start with /_control/: " + path)
+	}
+	s.controlMux.HandleFunc(path, handlerFunc)
+}
+
+// Use registers middlewares wrapping every route, including routes added
+// later and through the control plane. They run before per-route middlewares.
+func (s *Stub) Use(middlewares ...Middleware) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.middlewares = append(s.middlewares, middlewares...)
+}
+
+// AddMatchedHandler is like AddHandler but the route only serves requests
+// accepted by every matcher. Other requests fall through to the remaining
+// routes, so several handlers can share a method and path.
+func (s *Stub) AddMatchedHandler(method, path string, matchers []Matcher, handlerFunc http.HandlerFunc, middlewares ...Middleware) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		panic("cannot add handlers on a closed stub server")
+	}
+
+	s.addRoute(method, path, nil, routeInfo{
+		handler:     handlerFunc,
+		middlewares: middlewares,
+		matchers:    matchers,
+	})
+}
+
+// addRoute registers info as an exact route, or as a template route when the
+// path has parameters or wildcards or the route has query or matcher
+// constraints, and returns the route ID.
+// Callers must hold s.mu.
+func (s *Stub) addRoute(method, path string, queries map[string]string, info routeInfo) string {
+	if info.id == "" {
+		s.nextRouteID++
+		info.id = strconv.Itoa(s.nextRouteID)
+	}
+
 	upperMethod := strings.ToUpper(method)
 
-	if strings.Contains(path, ":") {
+	if strings.ContainsAny(path, ":*") || strings.HasSuffix(path, "/...") || len(queries) > 0 || len(info.matchers) > 0 {
 		tr := templateRoute{
 			method:   upperMethod,
 			segments: strings.Split(strings.Trim(path, "/"), "/"),
-			queries:  nil,
-			info: routeInfo{
-				handler:     handlerFunc,
-				middlewares: middlewares,
-			},
+			queries:  queries,
+			info:     info,
+		}
+		// ties keep registration order
+		i := slices.IndexFunc(s.templateRoutes, tr.outranks)
+		if i < 0 {
+			i = len(s.templateRoutes)
 		}
-		s.templateRoutes = append(s.templateRoutes, tr)
+		s.templateRoutes = slices.Insert(s.templateRoutes, i, tr)
+		s.routesChanged()
 		s.logger.Debug("Template handler added", slog.String("method_path", upperMethod+" "+path))
-		return
+		s.hooks.routeRegistered(HandlerInfo{ID: info.id, Method: upperMethod, Path: path, Query: queries, Spec: info.spec})
+		return info.id
 	}
 
 	key := upperMethod + " " + path
-	s.routers[key] = routeInfo{
-		handler:     handlerFunc,
-		middlewares: middlewares,
-	}
+	s.routers[key] = info
+	s.routesChanged()
 	s.logger.Debug("Handler added", slog.String("method_path", key))
+	s.hooks.routeRegistered(HandlerInfo{ID: info.id, Method: upperMethod, Path: path, Spec: info.spec})
+	return info.id
+}
+
+// removeRoute deletes the route with the given ID. Callers must hold s.mu.
+func (s *Stub) removeRoute(id string) bool {
+	for k, info := range s.routers {
+		if info.id == id {
+			delete(s.routers, k)
+			s.routesChanged()
+			return true
+		}
+	}
+
+	n := len(s.templateRoutes)
+	s.templateRoutes = slices.DeleteFunc(s.templateRoutes, func(tr templateRoute) bool {
+		return tr.info.id == id
+	})
+	s.routesChanged()
+	return len(s.templateRoutes) < n
+}
+
+// removeRoutes deletes every route registered for method and path and
+// returns how many were removed. Callers must hold s.mu.
+func (s *Stub) removeRoutes(method, path string) int {
+	upperMethod := strings.ToUpper(method)
+
+	var removed int
+	if _, ok := s.routers[upperMethod+" "+path]; ok {
+		delete(s.routers, upperMethod+" "+path)
+		removed++
+	}
+
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	n := len(s.templateRoutes)
+	s.templateRoutes = slices.DeleteFunc(s.templateRoutes, func(tr templateRoute) bool {
+		return tr.method == upperMethod && slices.Equal(tr.segments, segments)
+	})
+	s.routesChanged()
+	return removed + n - len(s.templateRoutes)
 }
 
 func (s *Stub) Start() error {
+	if err := s.start(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	hooks, url := s.hooks.start, s.baseURL
+	s.mu.Unlock()
+
+	if err := s.register(url); err != nil {
+		s.mu.Lock()
+		finish := s.shutdown()
+		s.mu.Unlock()
+		finish()
+		return err
+	}
+
+	for _, fn := range hooks {
+		fn(url)
+	}
+	return nil
+}
+
+func (s *Stub) start() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	if s.closed {
+		return errors.New("stub server is closed")
+	}
 	if s.Server != nil {
 		return errors.New("stub server is already started")
 	}
@@ -134,24 +485,116 @@ func (s *Stub) Start() error {
 		return fmt.Errorf("could not listen on %s: %w", listenAddr, err)
 	}
 
+	if s.grpc {
+		if err := s.startGRPC(); err != nil {
+			_ = ln.Close()
+			return err
+		}
+	}
+
 	s.Server = &httptest.Server{
 		Listener: ln,
 		Config:   &http.Server{Handler: s.mux},
 	}
-	s.Server.Start()
+
+	if s.tls {
+		if s.tlsConfig != nil {
+			s.Server.TLS = s.tlsConfig.Clone()
+		}
+		s.Server.StartTLS()
+	} else {
+		s.Server.Start()
+	}
 	s.baseURL = s.Server.URL
 
+	if s.tls {
+		// the generated certificate only covers loopback addresses
+		_, port, _ := net.SplitHostPort(ln.Addr().String())
+		s.baseURL = "https://" + net.JoinHostPort("127.0.0.1", port)
+	}
+
+	if s.controlPort != "" {
+		if err := s.startControl(); err != nil {
+			s.Server.Close()
+			s.Server = nil
+			if s.grpcServer != nil {
+				_ = s.grpcServer.Close()
+				s.grpcServer = nil
+			}
+			return err
+		}
+	}
+	s.started = time.Now()
+
 	return nil
 }
 
 func (s *Stub) Close() {
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	running, hooks, url := s.Server != nil && !s.closed, s.hooks.stop, s.baseURL
+	s.mu.Unlock()
 
-	if s.Server != nil && !s.closed {
-		s.Server.Close()
-		s.closed = true
+	if running {
+		for _, fn := range hooks {
+			fn()
+		}
+		s.deregister(s.registrars, url)
 	}
+
+	s.mu.Lock()
+	finish := func() {}
+	if !s.closed {
+		finish = s.shutdown()
+	}
+	s.mu.Unlock()
+
+	finish()
+}
+
+// shutdown marks the stub closed and stops callback delivery and config
+// watchers. It returns a function closing the listeners and waiting for
+// callback workers, which must be called once s.mu is released since
+// in-flight requests may be waiting for it. Callers must hold s.mu.
+func (s *Stub) shutdown() func() {
+	s.callbacks.close()
+	close(s.watchDone)
+	s.closed = true
+
+	server, control, grpc := s.Server, s.controlServer, s.grpcServer
+	return func() {
+		if server != nil {
+			server.Close()
+		}
+		if control != nil {
+			control.Close()
+		}
+		if grpc != nil {
+			_ = grpc.Close()
+		}
+		s.callbacks.wait()
+	}
+}
+
+// Reset removes every route and expectation, clears the request journal and
+// recordings and returns scenarios to ScenarioStarted, while keeping the
+// listener up, so a shared stub can be reused across test cases.
+func (s *Stub) Reset() {
+	s.mu.Lock()
+	s.routers = make(routes)
+	s.templateRoutes = nil
+	s.routesChanged()
+	s.recordings, s.recordingBytes = nil, 0
+	s.sequences = nil
+	s.expectations = nil
+	s.sources = nil
+	clear(s.grpcMethods)
+	s.mu.Unlock()
+
+	s.journal.reset()
+	s.scenarios.reset()
+	s.callbacks.reset()
+	s.errs.reset()
+	s.logger.Debug("Stub reset")
 }
 
 func (s *Stub) URL() string {
@@ -164,93 +607,62 @@ func (s *Stub) URL() string {
 	return s.baseURL
 }
 
-type DynamicHandlerSpec struct {
-	Method  string            `json:"method"`
-	Path    string            `json:"path"`
-	Query   map[string]string `json:"query"`
-	Status  int               `json:"status"`
-	Body    string            `json:"body"`
-	Headers map[string]string `json:"headers"`
-}
-
-func (s *Stub) controlAddHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
-		return
-	}
-
-	var spec DynamicHandlerSpec
-
-	if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
-		http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
-		return
-	}
-	if spec.Method == "" || spec.Path == "" {
-		http.Error(w, "method and path are required", http.StatusBadRequest)
-		return
-	}
-	if spec.Status == 0 {
-		spec.Status = http.StatusOK
-	}
+// Certificate returns the certificate served in TLS mode, or nil.
+func (s *Stub) Certificate() *x509.Certificate {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	responseHandler := func(w http.ResponseWriter, r *http.Request) {
-		for k, v := range spec.Headers {
-			w.Header().Set(k, v)
-		}
-		w.WriteHeader(spec.Status)
-		if spec.Body != "" {
-			_, _ = w.Write([]byte(spec.Body))
-		}
+	if s.Server == nil || !s.tls {
+		return nil
 	}
+	return s.Server.Certificate()
+}
 
+// Client returns an HTTP client configured for the running stub, trusting
+// its certificate in TLS mode.
+func (s *Stub) Client() *http.Client {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if strings.Contains(spec.Path, ":") || len(spec.Query) > 0 {
-		tr := templateRoute{
-			method:   strings.ToUpper(spec.Method),
-			segments: strings.Split(strings.Trim(spec.Path, "/"), "/"),
-			queries:  spec.Query,
-			info: routeInfo{
-				handler: http.HandlerFunc(responseHandler),
-			},
-		}
-		s.templateRoutes = append(s.templateRoutes, tr)
-	} else {
-		key := strings.ToUpper(spec.Method) + " " + spec.Path
-		s.routers[key] = routeInfo{
-			handler: http.HandlerFunc(responseHandler),
-		}
+	if s.Server == nil {
+		return nil
 	}
-	w.WriteHeader(http.StatusCreated)
+	return s.Server.Client()
 }
 
 func (s *Stub) dispatch(w http.ResponseWriter, r *http.Request) {
-	key := strings.ToUpper(r.Method) + " " + r.URL.Path
+	// a request the journal's limits reject is still served
+	rec, _ := s.journal.record(r)
+	if s.deadlines {
+		var (
+			cancel context.CancelFunc
+			err    error
+		)
+		r, cancel, err = withClientDeadline(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer cancel()
+	}
 
-	s.mu.Lock()
-	info, ok := s.routers[key]
+	s.mu.RLock()
+	final, params, ok := s.route(r)
 	if ok {
-		final := chainMiddleware(info.handler, info.middlewares...)
-		s.mu.Unlock()
-		final.ServeHTTP(w, r)
+		final = chainMiddleware(final, s.middlewares...)
+		ctx := context.WithValue(r.Context(), clockKey{}, s.now)
+		if params != nil {
+			ctx = context.WithValue(ctx, pathParamsKey{}, params)
+		}
+		r = r.WithContext(ctx)
+		s.mu.RUnlock()
+		s.serveRecovering(final, w, r)
 		return
 	}
 
-	for _, tr := range s.templateRoutes {
-		if tr.method != r.Method {
-			continue
-		}
-		if !pathMatch(tr.segments, r.URL.Path) {
-			continue
-		}
-		if !queryMatch(tr.queries, r.URL.Query()) {
-			continue
-		}
-
-		final := chainMiddleware(tr.info.handler, tr.info.middlewares...)
-		s.mu.Unlock()
-		final.ServeHTTP(w, r)
+	if proxy := s.proxy; proxy != nil {
+		s.mu.RUnlock()
+		s.proxyAndRecord(proxy, w, r)
 		return
 	}
 
@@ -265,8 +677,9 @@ func (s *Stub) dispatch(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if !methodMismatch {
-		for _, tr := range s.templateRoutes {
-			if !pathMatch(tr.segments, r.URL.Path) {
+		for _, i := range s.templateIndex().lookup("", r.URL.Path) {
+			tr := s.templateRoutes[i]
+			if tr.method == r.Method {
 				continue
 			}
 			if !queryMatch(tr.queries, r.URL.Query()) {
@@ -276,11 +689,108 @@ func (s *Stub) dispatch(w http.ResponseWriter, r *http.Request) {
 			break
 		}
 	}
-	s.mu.Unlock()
+	var misses []RouteMiss
+	if !methodMismatch {
+		misses = s.routeMisses(r)
+	}
+	strict := s.strict
+	s.mu.RUnlock()
+
+	if strict {
+		s.journal.recordUnexpected(rec)
+		s.logger.Warn("Unexpected request", slog.String("method_path", r.Method+" "+r.URL.Path))
+	}
 
 	if methodMismatch {
 		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
 		return
 	}
+	if len(misses) > 0 {
+		summary := make([]string, len(misses))
+		for i, m := range misses {
+			summary[i] = m.String()
+		}
+		s.logger.Info("No route matched",
+			slog.String("method_path", r.Method+" "+r.URL.Path),
+			slog.String("near_misses", strings.Join(summary, "; ")),
+		)
+	}
+	if s.diagnostics {
+		if misses == nil {
+			misses = []RouteMiss{}
+		}
+		writeJSON(w, http.StatusNotFound, map[string]any{
+			"error":       "no route matched " + r.Method + " " + r.URL.Path,
+			"near_misses": misses,
+		})
+		return
+	}
+	if s.gateway != nil {
+		s.gateway.notFound(w, r)
+		return
+	}
 	http.NotFound(w, r)
 }
+
+// route finds the handler for r and its path parameters: the most specific
+// route matching r wins, as templateRoute.outranks orders them, with exact
+// routes winning ties, unless WithRouter replaced that strategy. Callers
+// must hold s.mu for reading.
+func (s *Stub) route(r *http.Request) (http.Handler, map[string]string, bool) {
+	if s.router != nil {
+		return s.customRoute(r)
+	}
+
+	key := strings.ToUpper(r.Method) + " " + r.URL.Path
+	base, ok := s.pathRoute(key, r)
+
+	// templateRoutes is sorted, so only the constrained routes outranking
+	// base can beat it
+	for _, i := range s.templateIndex().lookup(r.Method, r.URL.Path) {
+		tr := s.templateRoutes[i]
+		if ok && !tr.outranks(base) {
+			break
+		}
+		if tr.constrained() && tr.match(r) {
+			return tr.info.build(), pathParams(tr.segments, r.URL.Path), true
+		}
+	}
+	if !ok {
+		return nil, nil, false
+	}
+	return base.info.build(), pathParams(base.segments, r.URL.Path), true
+}
+
+// pathRoute returns the best route for key among the exact and
+// unconstrained template routes, which only depend on the method and path.
+// Callers must hold s.mu for reading.
+func (s *Stub) pathRoute(key string, r *http.Request) (templateRoute, bool) {
+	if tr, ok, hit := s.routeCache.get(key); hit {
+		return tr, ok
+	}
+
+	var (
+		tr templateRoute
+		ok bool
+	)
+	if info, exact := s.routers[key]; exact {
+		tr, ok = exactRoute(key, info), true
+	}
+	for _, i := range s.templateIndex().lookup(r.Method, r.URL.Path) {
+		if u := s.templateRoutes[i]; !u.constrained() {
+			if !ok || u.outranks(tr) {
+				tr, ok = u, true
+			}
+			break
+		}
+	}
+	s.routeCache.put(key, tr, ok)
+	return tr, ok
+}
+
+// exactRoute returns the exact route registered under key as a template
+// route without parameters, so it can be ranked against template routes.
+func exactRoute(key string, info routeInfo) templateRoute {
+	method, path, _ := strings.Cut(key, " ")
+	return templateRoute{method: method, segments: strings.Split(strings.Trim(path, "/"), "/"), info: info}
+}
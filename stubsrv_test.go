@@ -1,12 +1,14 @@
 package stubsrv
 
 import (
+	"crypto/tls"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"slices"
 	"strings"
 	"testing"
 
@@ -337,6 +339,19 @@ func TestStub_Close(t *testing.T) {
 		})
 	})
 
+	t.Run("rejects start after close", func(t *testing.T) {
+		t.Parallel()
+
+		stub := NewStub(noopLogger())
+		stub.Close()
+
+		require.EqualError(t, stub.Start(), "stub server is closed")
+		stub.Close()
+
+		assert.Nil(t, stub.Server)
+		assert.Empty(t, stub.URL())
+	})
+
 	t.Run("safe to call multiple times", func(t *testing.T) {
 		t.Parallel()
 
@@ -528,6 +543,373 @@ func TestStub_TemplateRouteMatching(t *testing.T) {
 	assert.Equal(t, http.StatusMethodNotAllowed, resp3.StatusCode)
 }
 
+func TestStub_RoutePriority(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name         string
+		givenRoutes  func(stub *Stub)
+		givenPath    string
+		givenHeader  http.Header
+		expectedBody string
+	}{
+		{
+			name: "more literal segments win over registration order",
+			givenRoutes: func(stub *Stub) {
+				stub.When(Get("/users/:id")).Reply(200).Body("any user")
+				stub.When(Get("/users/me")).WithQuery("v", "1").Reply(200).Body("me")
+			},
+			givenPath:    "/users/me?v=1",
+			expectedBody: "me",
+		},
+		{
+			name: "more constraints win",
+			givenRoutes: func(stub *Stub) {
+				stub.When(Get("/orders/:id")).WithHeader("X-Tenant", "acme").Reply(200).Body("tenant")
+				stub.When(Get("/orders/:id")).WithHeader("X-Tenant", "acme").WithHeader("X-Beta", "1").Reply(200).Body("tenant beta")
+			},
+			givenPath:    "/orders/1",
+			givenHeader:  http.Header{"X-Tenant": {"acme"}, "X-Beta": {"1"}},
+			expectedBody: "tenant beta",
+		},
+		{
+			name: "priority wins over specificity",
+			givenRoutes: func(stub *Stub) {
+				stub.When(Get("/files/report")).WithHeader("X-Tenant", "acme").Reply(200).Body("specific")
+				stub.When(Get("/files/:name")).WithHeader("X-Tenant", "acme").WithPriority(10).Reply(200).Body("prioritized")
+			},
+			givenPath:    "/files/report",
+			givenHeader:  http.Header{"X-Tenant": {"acme"}},
+			expectedBody: "prioritized",
+		},
+		{
+			name: "ties keep registration order",
+			givenRoutes: func(stub *Stub) {
+				stub.When(Get("/items/:id")).WithHeader("X-Tenant", "acme").Reply(200).Body("first")
+				stub.When(Get("/items/:id")).WithHeader("X-Tenant", "acme").Reply(200).Body("second")
+			},
+			givenPath:    "/items/1",
+			givenHeader:  http.Header{"X-Tenant": {"acme"}},
+			expectedBody: "first",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			stub := NewStub(noopLogger())
+			tc.givenRoutes(stub)
+			require.NoError(t, stub.Start())
+			defer stub.Close()
+
+			req, err := http.NewRequest(http.MethodGet, stub.URL()+tc.givenPath, nil)
+			require.NoError(t, err)
+			req.Header = tc.givenHeader
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, tc.expectedBody, readAll(t, resp))
+		})
+	}
+
+	t.Run("spec field", func(t *testing.T) {
+		t.Parallel()
+
+		stub := NewStub(noopLogger())
+		require.NoError(t, stub.Start())
+		defer stub.Close()
+
+		controlAdd(t, stub, `{"method":"GET","path":"/users/:id","match_headers":{"X-Tenant":"acme"},"body":"low"}`)
+		controlAdd(t, stub, `{"method":"GET","path":"/users/:id","match_headers":{"X-Tenant":"acme"},"body":"high","priority":5}`)
+
+		req, err := http.NewRequest(http.MethodGet, stub.URL()+"/users/1", nil)
+		require.NoError(t, err)
+		req.Header.Set("X-Tenant", "acme")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		assert.Equal(t, "high", readAll(t, resp))
+	})
+}
+
+func TestStub_RouteSpecificity(t *testing.T) {
+	t.Parallel()
+
+	type route struct {
+		path   string
+		tenant bool
+		body   string
+	}
+
+	testCases := []struct {
+		name         string
+		givenRoutes  []route
+		givenPath    string
+		expectedBody string
+	}{
+		{
+			name:         "exact route beats a constrained template",
+			givenRoutes:  []route{{path: "/users/:id", tenant: true, body: "template"}, {path: "/users/me", body: "exact"}},
+			givenPath:    "/users/me",
+			expectedBody: "exact",
+		},
+		{
+			name:         "literal segments beat constraints",
+			givenRoutes:  []route{{path: "/users/:id/:rel", tenant: true, body: "constrained"}, {path: "/users/:id/orders", body: "literal"}},
+			givenPath:    "/users/1/orders",
+			expectedBody: "literal",
+		},
+		{
+			name:         "constraints break ties on literals",
+			givenRoutes:  []route{{path: "/users/:id", body: "plain"}, {path: "/users/:id", tenant: true, body: "tenant"}},
+			givenPath:    "/users/1",
+			expectedBody: "tenant",
+		},
+		{
+			name:         "exact route beats a catch-all matching nothing",
+			givenRoutes:  []route{{path: "/files/...", body: "catch-all"}, {path: "/files", body: "exact"}},
+			givenPath:    "/files",
+			expectedBody: "exact",
+		},
+	}
+
+	for _, tc := range testCases {
+		for _, reversed := range []bool{false, true} {
+			for _, opts := range [][]Option{nil, {WithRouter(DefaultRouter{})}} {
+				t.Run(fmt.Sprintf("%s/reversed=%t/router=%t", tc.name, reversed, opts != nil), func(t *testing.T) {
+					t.Parallel()
+
+					routes := slices.Clone(tc.givenRoutes)
+					if reversed {
+						slices.Reverse(routes)
+					}
+
+					stub := NewStub(noopLogger(), opts...)
+					for _, rt := range routes {
+						rb := stub.When(Get(rt.path))
+						if rt.tenant {
+							rb.WithHeader("X-Tenant", "acme")
+						}
+						rb.Reply(http.StatusOK).Body(rt.body)
+					}
+					require.NoError(t, stub.Start())
+					defer stub.Close()
+
+					req, err := http.NewRequest(http.MethodGet, stub.URL()+tc.givenPath, nil)
+					require.NoError(t, err)
+					req.Header.Set("X-Tenant", "acme")
+					resp, err := http.DefaultClient.Do(req)
+					require.NoError(t, err)
+					defer resp.Body.Close()
+
+					assert.Equal(t, tc.expectedBody, readAll(t, resp))
+				})
+			}
+		}
+	}
+}
+
+func TestPathParam(t *testing.T) {
+	t.Parallel()
+
+	stub := NewStub(noopLogger())
+	stub.AddHandler(http.MethodGet, "/users/:id/orders/:orderId", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(PathParam(r, "id") + "/" + PathParam(r, "orderId") + "/" + PathParam(r, "missing")))
+	})
+	stub.AddHandler(http.MethodGet, "/plain", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("[" + PathParam(r, "id") + "]"))
+	})
+	require.NoError(t, stub.Start())
+	defer stub.Close()
+
+	assert.Equal(t, "42/7/", getBody(t, stub.URL()+"/users/42/orders/7"))
+	assert.Equal(t, "[]", getBody(t, stub.URL()+"/plain"))
+
+	t.Run("catch-all", func(t *testing.T) {
+		stub.AddHandler(http.MethodGet, "/files/:path*", func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("[" + PathParam(r, "path") + "]"))
+		})
+		stub.AddHandler(http.MethodGet, "/static/...", func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("static"))
+		})
+		stub.AddHandler(http.MethodGet, "/api/*/health", func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("healthy"))
+		})
+
+		assert.Equal(t, "[a/b/c.txt]", getBody(t, stub.URL()+"/files/a/b/c.txt"))
+		assert.Equal(t, "[]", getBody(t, stub.URL()+"/files"))
+		assert.Equal(t, "static", getBody(t, stub.URL()+"/static/css/site.css"))
+		assert.Equal(t, "healthy", getBody(t, stub.URL()+"/api/v1/health"))
+	})
+}
+
+func TestStub_AddMatchedHandler(t *testing.T) {
+	t.Parallel()
+
+	stub := NewStub(noopLogger())
+	stub.AddHandler(http.MethodGet, "/me", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+	stub.AddMatchedHandler(http.MethodGet, "/me", []Matcher{MatchHeader("Authorization", "Bearer x")}, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("alice"))
+	})
+	stub.AddMatchedHandler(http.MethodGet, "/only-json", []Matcher{MatchHeader("Accept", "application/json")}, func(w http.ResponseWriter, r *http.Request) {})
+	require.NoError(t, stub.Start())
+	t.Cleanup(stub.Close)
+
+	testCases := []struct {
+		name           string
+		givenPath      string
+		givenHeaders   map[string]string
+		expectedStatus int
+	}{
+		{name: "matching header", givenPath: "/me", givenHeaders: map[string]string{"Authorization": "Bearer x"}, expectedStatus: http.StatusOK},
+		{name: "falls through to route without matchers", givenPath: "/me", givenHeaders: map[string]string{"Authorization": "Bearer y"}, expectedStatus: http.StatusUnauthorized},
+		{name: "no candidate left", givenPath: "/only-json", expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			req, err := http.NewRequest(http.MethodGet, stub.URL()+tc.givenPath, nil)
+			require.NoError(t, err)
+			for k, v := range tc.givenHeaders {
+				req.Header.Set(k, v)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, tc.expectedStatus, resp.StatusCode)
+		})
+	}
+}
+
+func TestStub_Reset(t *testing.T) {
+	t.Parallel()
+
+	t.Run("clears routes and journal but keeps serving", func(t *testing.T) {
+		t.Parallel()
+
+		stub := NewStub(noopLogger())
+		stub.AddHandler(http.MethodGet, "/exact", func(w http.ResponseWriter, r *http.Request) {})
+		stub.AddHandler(http.MethodGet, "/tpl/:id", func(w http.ResponseWriter, r *http.Request) {})
+		require.NoError(t, stub.Start())
+		defer stub.Close()
+
+		resp, err := http.Get(stub.URL() + "/exact")
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Len(t, stub.Requests(), 1)
+
+		url := stub.URL()
+		stub.Reset()
+
+		assert.Empty(t, stub.routers)
+		assert.Empty(t, stub.templateRoutes)
+		assert.Empty(t, stub.Requests())
+		assert.Equal(t, url, stub.URL())
+
+		resp, err = http.Get(stub.URL() + "/tpl/1")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+		stub.AddHandler(http.MethodGet, "/exact", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+		})
+		resp, err = http.Get(stub.URL() + "/exact")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusTeapot, resp.StatusCode)
+	})
+
+	t.Run("control endpoint resets the stub", func(t *testing.T) {
+		t.Parallel()
+
+		stub := NewStub(noopLogger())
+		require.NoError(t, stub.Start())
+		defer stub.Close()
+
+		controlAdd(t, stub, `{"method":"GET","path":"/dynamic"}`)
+		controlDo(t, stub, http.MethodGet, "/_control/reset", "", http.StatusMethodNotAllowed, nil)
+		controlDo(t, stub, http.MethodPost, "/_control/reset", "", http.StatusNoContent, nil)
+
+		var got []HandlerInfo
+		controlDo(t, stub, http.MethodGet, "/_control/handlers", "", http.StatusOK, &got)
+		assert.Empty(t, got)
+	})
+}
+
+func TestStub_TLS(t *testing.T) {
+	t.Parallel()
+
+	t.Run("serves HTTPS trusted by the stub client", func(t *testing.T) {
+		t.Parallel()
+
+		stub := NewStub(noopLogger(), WithTLS())
+		stub.AddHandler(http.MethodGet, "/secure", func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("secret"))
+		})
+		require.NoError(t, stub.Start())
+		defer stub.Close()
+
+		assert.True(t, strings.HasPrefix(stub.URL(), "https://"))
+		require.NotNil(t, stub.Certificate())
+
+		resp, err := stub.Client().Get(stub.URL() + "/secure")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "secret", string(body))
+	})
+
+	t.Run("default client rejects the self-signed certificate", func(t *testing.T) {
+		t.Parallel()
+
+		stub := NewStub(noopLogger(), WithTLS())
+		require.NoError(t, stub.Start())
+		defer stub.Close()
+
+		_, err := http.Get(stub.URL() + "/readyz")
+		assert.Error(t, err)
+	})
+
+	t.Run("custom TLS config is applied", func(t *testing.T) {
+		t.Parallel()
+
+		stub := NewStub(noopLogger(), WithTLSConfig(&tls.Config{MinVersion: tls.VersionTLS13}))
+		require.NoError(t, stub.Start())
+		defer stub.Close()
+
+		client := stub.Client()
+		client.Transport.(*http.Transport).TLSClientConfig.MaxVersion = tls.VersionTLS12
+
+		_, err := client.Get(stub.URL() + "/readyz")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "protocol version")
+	})
+
+	t.Run("plain stub has no certificate", func(t *testing.T) {
+		t.Parallel()
+
+		stub := NewStub(noopLogger())
+		assert.Nil(t, stub.Client())
+
+		require.NoError(t, stub.Start())
+		defer stub.Close()
+
+		assert.Nil(t, stub.Certificate())
+		assert.NotNil(t, stub.Client())
+	})
+}
+
 func noopLogger() *slog.Logger {
 	return slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{}))
 }
@@ -0,0 +1,129 @@
+package telemetry
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+var errCorruptProto = errors.New("protobuf: corrupt input")
+
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// field is a single decoded protobuf field. Only the member matching the
+// wire type is set.
+type field struct {
+	num     int
+	varint  uint64
+	fixed64 uint64
+	bytes   []byte
+}
+
+// decodeFields walks one level of a protobuf message.
+func decodeFields(b []byte, fn func(f field) error) error {
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errCorruptProto
+		}
+		b = b[n:]
+
+		f := field{num: int(key >> 3)}
+		switch key & 0x07 {
+		case wireVarint:
+			f.varint, n = binary.Uvarint(b)
+			if n <= 0 {
+				return errCorruptProto
+			}
+			b = b[n:]
+		case wireFixed64:
+			if len(b) < 8 {
+				return errCorruptProto
+			}
+			f.fixed64 = binary.LittleEndian.Uint64(b)
+			b = b[8:]
+		case wireBytes:
+			length, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < length {
+				return errCorruptProto
+			}
+			f.bytes = b[n : n+int(length)]
+			b = b[n+int(length):]
+		case wireFixed32:
+			if len(b) < 4 {
+				return errCorruptProto
+			}
+			b = b[4:]
+			continue
+		default:
+			return errCorruptProto
+		}
+
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeWriteRequest decodes a Prometheus remote-write WriteRequest into
+// samples, one per (series, sample) pair.
+func decodeWriteRequest(b []byte) ([]Sample, error) {
+	var samples []Sample
+
+	err := decodeFields(b, func(f field) error {
+		if f.num != 1 { // timeseries
+			return nil
+		}
+
+		labels := make(map[string]string)
+		var points []Sample
+
+		err := decodeFields(f.bytes, func(f field) error {
+			switch f.num {
+			case 1: // label
+				var name, value string
+				err := decodeFields(f.bytes, func(f field) error {
+					switch f.num {
+					case 1:
+						name = string(f.bytes)
+					case 2:
+						value = string(f.bytes)
+					}
+					return nil
+				})
+				labels[name] = value
+				return err
+			case 2: // sample
+				var s Sample
+				err := decodeFields(f.bytes, func(f field) error {
+					switch f.num {
+					case 1:
+						s.Value = math.Float64frombits(f.fixed64)
+					case 2:
+						s.Timestamp = int64(f.varint)
+					}
+					return nil
+				})
+				points = append(points, s)
+				return err
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, p := range points {
+			p.Labels = labels
+			samples = append(samples, p)
+		}
+		return nil
+	})
+	return samples, err
+}
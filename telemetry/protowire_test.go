@@ -0,0 +1,75 @@
+package telemetry
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeWriteRequest(t *testing.T) {
+	t.Parallel()
+
+	t.Run("decodes series labels and samples", func(t *testing.T) {
+		t.Parallel()
+
+		req := encodeWriteRequest(
+			series{labels: [][2]string{{"__name__", "http_requests_total"}, {"code", "200"}}, samples: []Sample{{Value: 3, Timestamp: 1000}, {Value: 5, Timestamp: 2000}}},
+			series{labels: [][2]string{{"__name__", "up"}}, samples: []Sample{{Value: 1, Timestamp: 1000}}},
+		)
+
+		got, err := decodeWriteRequest(req)
+		require.NoError(t, err)
+		require.Len(t, got, 3)
+
+		assert.Equal(t, "http_requests_total", got[0].Name())
+		assert.Equal(t, "200", got[0].Labels["code"])
+		assert.Equal(t, 3.0, got[0].Value)
+		assert.Equal(t, int64(2000), got[1].Timestamp)
+		assert.Equal(t, "up", got[2].Name())
+	})
+
+	t.Run("rejects truncated input", func(t *testing.T) {
+		t.Parallel()
+
+		req := encodeWriteRequest(series{labels: [][2]string{{"__name__", "up"}}, samples: []Sample{{Value: 1}}})
+
+		_, err := decodeWriteRequest(req[:len(req)-3])
+		assert.ErrorIs(t, err, errCorruptProto)
+	})
+}
+
+type series struct {
+	labels  [][2]string
+	samples []Sample
+}
+
+func encodeWriteRequest(ss ...series) []byte {
+	var req []byte
+	for _, s := range ss {
+		var ts []byte
+		for _, l := range s.labels {
+			var label []byte
+			label = appendBytesField(label, 1, []byte(l[0]))
+			label = appendBytesField(label, 2, []byte(l[1]))
+			ts = appendBytesField(ts, 1, label)
+		}
+		for _, smp := range s.samples {
+			sample := binary.AppendUvarint(nil, 1<<3|wireFixed64)
+			sample = binary.LittleEndian.AppendUint64(sample, math.Float64bits(smp.Value))
+			sample = binary.AppendUvarint(sample, 2<<3|wireVarint)
+			sample = binary.AppendUvarint(sample, uint64(smp.Timestamp))
+			ts = appendBytesField(ts, 2, sample)
+		}
+		req = appendBytesField(req, 1, ts)
+	}
+	return req
+}
+
+func appendBytesField(b []byte, num int, v []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(num)<<3|wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
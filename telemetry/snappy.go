@@ -0,0 +1,109 @@
+package telemetry
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// maxDecodedSize caps the decoded length a payload may declare, so a few
+// bytes can't force a huge allocation.
+const maxDecodedSize = 64 << 20
+
+var (
+	errCorruptSnappy  = errors.New("snappy: corrupt input")
+	errSnappyTooLarge = errors.New("snappy: decoded length too large")
+)
+
+// decodeSnappy decompresses the snappy block format used by Prometheus
+// remote write.
+func decodeSnappy(src []byte) ([]byte, error) {
+	n, read := binary.Uvarint(src)
+	if read <= 0 {
+		return nil, errCorruptSnappy
+	}
+	if n > maxDecodedSize {
+		return nil, errSnappyTooLarge
+	}
+	src = src[read:]
+	dst := make([]byte, 0, n)
+
+	for len(src) > 0 {
+		tag := src[0]
+		src = src[1:]
+
+		switch tag & 0x03 {
+		case 0x00: // literal
+			length := int(tag >> 2)
+			if length >= 60 {
+				extra := length - 59
+				if len(src) < extra {
+					return nil, errCorruptSnappy
+				}
+				length = 0
+				for i := extra - 1; i >= 0; i-- {
+					length = length<<8 | int(src[i])
+				}
+				src = src[extra:]
+			}
+			length++
+			if len(src) < length || len(dst)+length > cap(dst) {
+				return nil, errCorruptSnappy
+			}
+			dst = append(dst, src[:length]...)
+			src = src[length:]
+			continue
+
+		case 0x01: // copy, 1-byte offset
+			if len(src) < 1 {
+				return nil, errCorruptSnappy
+			}
+			length := 4 + int(tag>>2)&0x07
+			offset := int(tag&0xe0)<<3 | int(src[0])
+			src = src[1:]
+			if err := appendCopy(&dst, offset, length); err != nil {
+				return nil, err
+			}
+
+		case 0x02: // copy, 2-byte offset
+			if len(src) < 2 {
+				return nil, errCorruptSnappy
+			}
+			length := 1 + int(tag>>2)
+			offset := int(binary.LittleEndian.Uint16(src))
+			src = src[2:]
+			if err := appendCopy(&dst, offset, length); err != nil {
+				return nil, err
+			}
+
+		case 0x03: // copy, 4-byte offset
+			if len(src) < 4 {
+				return nil, errCorruptSnappy
+			}
+			length := 1 + int(tag>>2)
+			offset := int(binary.LittleEndian.Uint32(src))
+			src = src[4:]
+			if err := appendCopy(&dst, offset, length); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if uint64(len(dst)) != n {
+		return nil, errCorruptSnappy
+	}
+	return dst, nil
+}
+
+// appendCopy appends length bytes starting offset bytes back. The regions
+// may overlap, which snappy uses to encode runs. Like literals, copies must
+// not grow dst beyond the declared length, its capacity.
+func appendCopy(dst *[]byte, offset, length int) error {
+	if offset <= 0 || offset > len(*dst) || len(*dst)+length > cap(*dst) {
+		return errCorruptSnappy
+	}
+	start := len(*dst) - offset
+	for i := range length {
+		*dst = append(*dst, (*dst)[start+i])
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package telemetry
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeSnappy(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name        string
+		given       []byte
+		expected    string
+		expectedErr bool
+	}{
+		{
+			name:     "short literal",
+			given:    []byte{0x03, 0x08, 'a', 'b', 'c'},
+			expected: "abc",
+		},
+		{
+			name:     "literal with one length byte",
+			given:    encodeSnappyLiteral([]byte(strings.Repeat("x", 100))),
+			expected: strings.Repeat("x", 100),
+		},
+		{
+			name:     "overlapping copy with 1-byte offset",
+			given:    []byte{0x09, 0x08, 'a', 'b', 'c', 0x09, 0x03},
+			expected: "abcabcabc",
+		},
+		{
+			name:     "copy with 2-byte offset",
+			given:    []byte{0x06, 0x08, 'a', 'b', 'c', 0x0a, 0x03, 0x00},
+			expected: "abcabc",
+		},
+		{
+			name:        "length mismatch",
+			given:       []byte{0x05, 0x08, 'a', 'b', 'c'},
+			expectedErr: true,
+		},
+		{
+			name:        "copy before start",
+			given:       []byte{0x06, 0x08, 'a', 'b', 'c', 0x09, 0x09},
+			expectedErr: true,
+		},
+		{
+			name:        "declared length too large",
+			given:       binary.AppendUvarint(nil, 1<<62),
+			expectedErr: true,
+		},
+		{
+			name:        "copy past declared length",
+			given:       []byte{0x04, 0x08, 'a', 'b', 'c', 0x09, 0x03},
+			expectedErr: true,
+		},
+		{
+			name:        "truncated literal",
+			given:       []byte{0x03, 0x08, 'a'},
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := decodeSnappy(tc.given)
+			if tc.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, string(got))
+		})
+	}
+}
+
+// encodeSnappyLiteral encodes src as literals only, which is valid snappy.
+func encodeSnappyLiteral(src []byte) []byte {
+	dst := binary.AppendUvarint(nil, uint64(len(src)))
+	for len(src) > 0 {
+		chunk := src[:min(len(src), 256)]
+		src = src[len(chunk):]
+
+		n := len(chunk) - 1
+		if n < 60 {
+			dst = append(dst, byte(n<<2))
+		} else {
+			dst = append(dst, 60<<2, byte(n))
+		}
+		dst = append(dst, chunk...)
+	}
+	return dst
+}
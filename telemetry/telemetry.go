@@ -0,0 +1,260 @@
+// Package telemetry emulates metrics and trace ingest endpoints, decoding
+// and storing received payloads so telemetry-exporting code can be verified
+// end to end.
+//
+// Routes:
+//
+//	POST /api/v1/write   Prometheus remote write (snappy-compressed protobuf)
+//	POST /v1/metrics     OTLP/HTTP metrics, JSON encoding
+//	POST /v1/traces      OTLP/HTTP traces, JSON encoding
+package telemetry
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/alesr/stubsrv"
+)
+
+// maxBodySize caps the size of ingested payloads.
+const maxBodySize = 32 << 20
+
+// Sample is one metric data point. The metric name is in Labels["__name__"].
+// Timestamp is in milliseconds since the epoch.
+type Sample struct {
+	Labels    map[string]string
+	Value     float64
+	Timestamp int64
+}
+
+func (s Sample) Name() string { return s.Labels["__name__"] }
+
+type Span struct {
+	TraceID      string
+	SpanID       string
+	ParentSpanID string
+	Name         string
+	Attributes   map[string]string
+}
+
+type Sink struct {
+	mu      sync.Mutex
+	samples []Sample
+	spans   []Span
+}
+
+func New(stub *stubsrv.Stub) *Sink {
+	var sink Sink
+
+	stub.AddHandler(http.MethodPost, "/api/v1/write", sink.handleRemoteWrite)
+	stub.AddHandler(http.MethodPost, "/v1/metrics", sink.handleOTLPMetrics)
+	stub.AddHandler(http.MethodPost, "/v1/traces", sink.handleOTLPTraces)
+	return &sink
+}
+
+func (sink *Sink) Samples() []Sample {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+
+	return append([]Sample(nil), sink.samples...)
+}
+
+// SamplesFor returns the samples of the named metric.
+func (sink *Sink) SamplesFor(name string) []Sample {
+	var matched []Sample
+	for _, s := range sink.Samples() {
+		if s.Name() == name {
+			matched = append(matched, s)
+		}
+	}
+	return matched
+}
+
+func (sink *Sink) Spans() []Span {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+
+	return append([]Span(nil), sink.spans...)
+}
+
+func (sink *Sink) handleRemoteWrite(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	raw, err := decodeSnappy(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	samples, err := decodeWriteRequest(raw)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sink.mu.Lock()
+	sink.samples = append(sink.samples, samples...)
+	sink.mu.Unlock()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type otlpAttribute struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue *string  `json:"stringValue"`
+		IntValue    *string  `json:"intValue"`
+		DoubleValue *float64 `json:"doubleValue"`
+		BoolValue   *bool    `json:"boolValue"`
+	} `json:"value"`
+}
+
+type otlpDataPoint struct {
+	Attributes   []otlpAttribute `json:"attributes"`
+	TimeUnixNano string          `json:"timeUnixNano"`
+	AsDouble     *float64        `json:"asDouble"`
+	AsInt        *string         `json:"asInt"`
+}
+
+type otlpMetricsRequest struct {
+	ResourceMetrics []struct {
+		ScopeMetrics []struct {
+			Metrics []struct {
+				Name  string `json:"name"`
+				Gauge *struct {
+					DataPoints []otlpDataPoint `json:"dataPoints"`
+				} `json:"gauge"`
+				Sum *struct {
+					DataPoints []otlpDataPoint `json:"dataPoints"`
+				} `json:"sum"`
+			} `json:"metrics"`
+		} `json:"scopeMetrics"`
+	} `json:"resourceMetrics"`
+}
+
+func (sink *Sink) handleOTLPMetrics(w http.ResponseWriter, r *http.Request) {
+	var req otlpMetricsRequest
+	if !decodeOTLP(w, r, &req) {
+		return
+	}
+
+	var samples []Sample
+	for _, rm := range req.ResourceMetrics {
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				var points []otlpDataPoint
+				if m.Gauge != nil {
+					points = append(points, m.Gauge.DataPoints...)
+				}
+				if m.Sum != nil {
+					points = append(points, m.Sum.DataPoints...)
+				}
+
+				for _, p := range points {
+					s := Sample{Labels: attributes(p.Attributes)}
+					s.Labels["__name__"] = m.Name
+					switch {
+					case p.AsDouble != nil:
+						s.Value = *p.AsDouble
+					case p.AsInt != nil:
+						v, _ := strconv.ParseInt(*p.AsInt, 10, 64)
+						s.Value = float64(v)
+					}
+					nanos, _ := strconv.ParseInt(p.TimeUnixNano, 10, 64)
+					s.Timestamp = nanos / 1e6
+					samples = append(samples, s)
+				}
+			}
+		}
+	}
+
+	sink.mu.Lock()
+	sink.samples = append(sink.samples, samples...)
+	sink.mu.Unlock()
+
+	writeJSON(w, map[string]any{})
+}
+
+type otlpTracesRequest struct {
+	ResourceSpans []struct {
+		ScopeSpans []struct {
+			Spans []struct {
+				TraceID      string          `json:"traceId"`
+				SpanID       string          `json:"spanId"`
+				ParentSpanID string          `json:"parentSpanId"`
+				Name         string          `json:"name"`
+				Attributes   []otlpAttribute `json:"attributes"`
+			} `json:"spans"`
+		} `json:"scopeSpans"`
+	} `json:"resourceSpans"`
+}
+
+func (sink *Sink) handleOTLPTraces(w http.ResponseWriter, r *http.Request) {
+	var req otlpTracesRequest
+	if !decodeOTLP(w, r, &req) {
+		return
+	}
+
+	var spans []Span
+	for _, rs := range req.ResourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			for _, sp := range ss.Spans {
+				spans = append(spans, Span{
+					TraceID:      sp.TraceID,
+					SpanID:       sp.SpanID,
+					ParentSpanID: sp.ParentSpanID,
+					Name:         sp.Name,
+					Attributes:   attributes(sp.Attributes),
+				})
+			}
+		}
+	}
+
+	sink.mu.Lock()
+	sink.spans = append(sink.spans, spans...)
+	sink.mu.Unlock()
+
+	writeJSON(w, map[string]any{})
+}
+
+func decodeOTLP(w http.ResponseWriter, r *http.Request, v any) bool {
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		http.Error(w, "only the OTLP JSON encoding is supported", http.StatusUnsupportedMediaType)
+		return false
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(v); err != nil {
+		http.Error(w, "invalid OTLP payload: "+err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func attributes(attrs []otlpAttribute) map[string]string {
+	out := make(map[string]string, len(attrs))
+	for _, a := range attrs {
+		switch v := a.Value; {
+		case v.StringValue != nil:
+			out[a.Key] = *v.StringValue
+		case v.IntValue != nil:
+			out[a.Key] = *v.IntValue
+		case v.DoubleValue != nil:
+			out[a.Key] = strconv.FormatFloat(*v.DoubleValue, 'g', -1, 64)
+		case v.BoolValue != nil:
+			out[a.Key] = fmt.Sprint(*v.BoolValue)
+		}
+	}
+	return out
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
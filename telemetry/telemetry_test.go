@@ -0,0 +1,95 @@
+package telemetry
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/alesr/stubsrv"
+	"github.com/alesr/stubsrv/internal/stubtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSink_RemoteWrite(t *testing.T) {
+	t.Parallel()
+
+	stub, sink := newSink(t)
+
+	payload := encodeSnappyLiteral(encodeWriteRequest(
+		series{labels: [][2]string{{"__name__", "jobs_processed_total"}, {"queue", "email"}}, samples: []Sample{{Value: 42, Timestamp: 1700000000000}}},
+	))
+
+	resp, err := http.Post(stub.URL()+"/api/v1/write", "application/x-protobuf", bytes.NewReader(payload))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	got := sink.SamplesFor("jobs_processed_total")
+	require.Len(t, got, 1)
+	assert.Equal(t, 42.0, got[0].Value)
+	assert.Equal(t, "email", got[0].Labels["queue"])
+
+	resp, err = http.Post(stub.URL()+"/api/v1/write", "application/x-protobuf", strings.NewReader("garbage"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestSink_OTLPMetrics(t *testing.T) {
+	t.Parallel()
+
+	stub, sink := newSink(t)
+
+	payload := `{"resourceMetrics":[{"scopeMetrics":[{"metrics":[
+		{"name":"queue_depth","gauge":{"dataPoints":[{"asDouble":7.5,"timeUnixNano":"1700000000000000000","attributes":[{"key":"queue","value":{"stringValue":"email"}}]}]}},
+		{"name":"requests","sum":{"dataPoints":[{"asInt":"12","attributes":[{"key":"ok","value":{"boolValue":true}}]}]}}
+	]}]}]}`
+
+	resp, err := http.Post(stub.URL()+"/v1/metrics", "application/json", strings.NewReader(payload))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	samples := sink.Samples()
+	require.Len(t, samples, 2)
+	assert.Equal(t, Sample{Labels: map[string]string{"__name__": "queue_depth", "queue": "email"}, Value: 7.5, Timestamp: 1700000000000}, samples[0])
+	assert.Equal(t, 12.0, samples[1].Value)
+	assert.Equal(t, "true", samples[1].Labels["ok"])
+
+	resp, err = http.Post(stub.URL()+"/v1/metrics", "application/x-protobuf", strings.NewReader(""))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+}
+
+func TestSink_OTLPTraces(t *testing.T) {
+	t.Parallel()
+
+	stub, sink := newSink(t)
+
+	payload := `{"resourceSpans":[{"scopeSpans":[{"spans":[
+		{"traceId":"t1","spanId":"s1","name":"GET /users","attributes":[{"key":"http.status_code","value":{"intValue":"200"}}]},
+		{"traceId":"t1","spanId":"s2","parentSpanId":"s1","name":"db.query"}
+	]}]}]}`
+
+	resp, err := http.Post(stub.URL()+"/v1/traces", "application/json; charset=utf-8", strings.NewReader(payload))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	spans := sink.Spans()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "GET /users", spans[0].Name)
+	assert.Equal(t, "200", spans[0].Attributes["http.status_code"])
+	assert.Equal(t, "s1", spans[1].ParentSpanID)
+}
+
+func newSink(t *testing.T) (*stubsrv.Stub, *Sink) {
+	t.Helper()
+
+	var sink *Sink
+	stub := stubtest.New(t, func(stub *stubsrv.Stub) { sink = New(stub) })
+	return stub, sink
+}
@@ -0,0 +1,115 @@
+package stubsrv
+
+import (
+	"slices"
+	"strings"
+)
+
+// routeTrie indexes template routes by method and path segments, so
+// finding the routes whose path matches a request takes time in the length
+// of the path rather than in the number of routes.
+type routeTrie struct {
+	methods map[string]*trieNode
+}
+
+type trieNode struct {
+	literals map[string]*trieNode
+	// wildcard follows ":param" and "*" segments.
+	wildcard *trieNode
+	// routes end at this node; catchAll routes end with a catch-all
+	// segment here, matching whatever remains of the path.
+	routes   []int
+	catchAll []int
+}
+
+// newRouteTrie indexes routes, which lookup then refers to by index.
+func newRouteTrie(routes []templateRoute) *routeTrie {
+	t := routeTrie{methods: make(map[string]*trieNode)}
+	for i, tr := range routes {
+		n := t.methods[tr.method]
+		if n == nil {
+			n = new(trieNode)
+			t.methods[tr.method] = n
+		}
+		n.insert(tr.segments, i)
+	}
+	return &t
+}
+
+func (n *trieNode) insert(segments []string, i int) {
+	for j, seg := range segments {
+		if isCatchAll(seg) && j == len(segments)-1 {
+			n.catchAll = append(n.catchAll, i)
+			return
+		}
+
+		var next *trieNode
+		if seg == "*" || strings.HasPrefix(seg, ":") {
+			if n.wildcard == nil {
+				n.wildcard = new(trieNode)
+			}
+			next = n.wildcard
+		} else {
+			if n.literals == nil {
+				n.literals = make(map[string]*trieNode)
+			}
+			if next = n.literals[seg]; next == nil {
+				next = new(trieNode)
+				n.literals[seg] = next
+			}
+		}
+		n = next
+	}
+	n.routes = append(n.routes, i)
+}
+
+// lookup returns, in ascending order, the indexes of the routes for method,
+// or for any method when it is "", whose path template matches path, as
+// pathMatch does.
+func (t *routeTrie) lookup(method, path string) []int {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+
+	var found []int
+	if method != "" {
+		if n := t.methods[method]; n != nil {
+			found = n.collect(segments, found)
+		}
+	} else {
+		for _, n := range t.methods {
+			found = n.collect(segments, found)
+		}
+	}
+	slices.Sort(found)
+	return found
+}
+
+func (n *trieNode) collect(segments []string, found []int) []int {
+	found = append(found, n.catchAll...)
+	if len(segments) == 0 {
+		return append(found, n.routes...)
+	}
+	if next := n.literals[segments[0]]; next != nil {
+		found = next.collect(segments[1:], found)
+	}
+	if n.wildcard != nil {
+		found = n.wildcard.collect(segments[1:], found)
+	}
+	return found
+}
+
+// templateIndex returns the trie of s.templateRoutes, rebuilt after the
+// routes change. Callers must hold s.mu for reading.
+func (s *Stub) templateIndex() *routeTrie {
+	if t := s.routeTrie.Load(); t != nil {
+		return t
+	}
+	s.derivedMu.Lock()
+	defer s.derivedMu.Unlock()
+	if t := s.routeTrie.Load(); t != nil {
+		return t
+	}
+
+	t := newRouteTrie(s.templateRoutes)
+	s.routeTrie.Store(t)
+	return t
+}
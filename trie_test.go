@@ -0,0 +1,91 @@
+package stubsrv
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouteTrie_Lookup(t *testing.T) {
+	t.Parallel()
+
+	templates := []string{
+		"GET /users/:id",
+		"GET /users/me",
+		"GET /users/:id/posts",
+		"GET /files/...",
+		"GET /files/:path*",
+		"GET /a/.../b",
+		"GET /*/settings",
+		"GET /...",
+		"GET /",
+		"POST /users/:id",
+	}
+	routes := make([]templateRoute, len(templates))
+	for i, tpl := range templates {
+		method, path, _ := strings.Cut(tpl, " ")
+		routes[i] = templateRoute{method: method, segments: strings.Split(strings.Trim(path, "/"), "/")}
+	}
+	trie := newRouteTrie(routes)
+
+	tests := []struct {
+		name           string
+		givenMethod    string
+		givenPath      string
+		expectedRoutes []int
+	}{
+		{name: "param and literal", givenMethod: "GET", givenPath: "/users/me", expectedRoutes: []int{0, 1, 7}},
+		{name: "nested", givenMethod: "GET", givenPath: "/users/42/posts", expectedRoutes: []int{2, 7}},
+		{name: "catch-all matches nothing", givenMethod: "GET", givenPath: "/files", expectedRoutes: []int{3, 4, 7}},
+		{name: "catch-all matches many", givenMethod: "GET", givenPath: "/files/a/b/c", expectedRoutes: []int{3, 4, 7}},
+		{name: "non-final dots are literal", givenMethod: "GET", givenPath: "/a/.../b", expectedRoutes: []int{5, 7}},
+		{name: "wildcard", givenMethod: "GET", givenPath: "/users/settings", expectedRoutes: []int{0, 6, 7}},
+		{name: "root", givenMethod: "GET", givenPath: "/", expectedRoutes: []int{7, 8}},
+		{name: "other method", givenMethod: "POST", givenPath: "/users/me", expectedRoutes: []int{9}},
+		{name: "any method", givenPath: "/users/me", expectedRoutes: []int{0, 1, 7, 9}},
+		{name: "unknown method", givenMethod: "PUT", givenPath: "/users/me", expectedRoutes: nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := trie.lookup(tc.givenMethod, tc.givenPath)
+			assert.Equal(t, tc.expectedRoutes, got)
+
+			for _, i := range got {
+				assert.True(t, pathMatch(routes[i].segments, tc.givenPath), templates[i])
+			}
+		})
+	}
+}
+
+func TestStub_ManyTemplateRoutes(t *testing.T) {
+	t.Parallel()
+
+	stub := NewStub(noopLogger())
+	for i := range 500 {
+		stub.AddHandler(http.MethodGet, "/r"+strconv.Itoa(i)+"/:id", func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(strconv.Itoa(i) + " " + PathParam(r, "id")))
+		})
+	}
+	require.NoError(t, stub.Start())
+	defer stub.Close()
+	id := controlAdd(t, stub, `{"method":"GET","path":"/r7/:id","query":{"v":"2"},"status":200,"body":"constrained"}`)
+
+	assert.Equal(t, "499 x", getBody(t, stub.URL()+"/r499/x"))
+	assert.Equal(t, "7 x", getBody(t, stub.URL()+"/r7/x"))
+	assert.Equal(t, "constrained", getBody(t, stub.URL()+"/r7/x?v=2"))
+
+	controlDo(t, stub, http.MethodDelete, "/_control/handlers/"+id, "", http.StatusNoContent, nil)
+	assert.Equal(t, "7 x", getBody(t, stub.URL()+"/r7/x?v=2"))
+
+	resp, err := http.Post(stub.URL()+"/r3/x", "text/plain", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
@@ -0,0 +1,267 @@
+// Package txn simulates a participant in a two-phase commit, tracking the
+// state of each transaction by ID and failing phases on demand, for testing
+// clients that orchestrate distributed transactions or sagas.
+//
+// Routes, relative to the configured prefix:
+//
+//	POST <prefix>/:id/prepare     vote to commit, moving the transaction to "prepared"
+//	POST <prefix>/:id/commit      commit a prepared transaction
+//	POST <prefix>/:id/rollback    abort a transaction that is not committed
+//	GET  <prefix>/:id             the transaction and the phase calls it received
+//	PUT  /_control<prefix>/failures/:phase   inject a failure from a JSON Failure body
+//	DELETE /_control<prefix>/failures/:phase
+//
+// Phases are idempotent, as coordinators retry them: preparing a prepared
+// transaction or committing a committed one succeeds again. Rolling back an
+// unknown transaction succeeds too, following presumed abort. Invalid
+// transitions, such as committing an unprepared transaction, answer 409.
+package txn
+
+import (
+	"cmp"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alesr/stubsrv"
+)
+
+type State string
+
+const (
+	StatePrepared   State = "prepared"
+	StateCommitted  State = "committed"
+	StateRolledBack State = "rolled_back"
+)
+
+type Phase string
+
+const (
+	PhasePrepare  Phase = "prepare"
+	PhaseCommit   Phase = "commit"
+	PhaseRollback Phase = "rollback"
+)
+
+func (ph Phase) valid() bool {
+	return ph == PhasePrepare || ph == PhaseCommit || ph == PhaseRollback
+}
+
+// Failure makes a phase fail instead of succeeding.
+type Failure struct {
+	// Status is answered instead of 200, 500 when zero. A 409 on prepare
+	// is a "no" vote.
+	Status int `json:"status"`
+	// ID restricts the failure to one transaction.
+	ID string `json:"id,omitempty"`
+	// Times is how many calls fail before the phase succeeds again, so
+	// retries can be exercised. Zero fails every call.
+	Times int `json:"times,omitempty"`
+	// Applied changes the state despite the failure, as when a commit
+	// succeeds but its response is lost.
+	Applied bool `json:"applied,omitempty"`
+}
+
+func (f Failure) valid() bool {
+	return f.Status == 0 || f.Status >= 400 && f.Status <= 599
+}
+
+// Call is a phase call a transaction received.
+type Call struct {
+	Phase  Phase     `json:"phase"`
+	Status int       `json:"status"`
+	Time   time.Time `json:"time"`
+}
+
+type Transaction struct {
+	ID    string `json:"id"`
+	State State  `json:"state"`
+	Calls []Call `json:"calls"`
+}
+
+type Participant struct {
+	mu       sync.Mutex
+	txs      map[string]*Transaction
+	failures map[Phase]*Failure
+}
+
+func New(stub *stubsrv.Stub, prefix string) *Participant {
+	p := Participant{
+		txs:      make(map[string]*Transaction),
+		failures: make(map[Phase]*Failure),
+	}
+
+	prefix = strings.TrimSuffix(prefix, "/")
+	for _, ph := range []Phase{PhasePrepare, PhaseCommit, PhaseRollback} {
+		stub.AddHandler(http.MethodPost, prefix+"/:id/"+string(ph), func(w http.ResponseWriter, r *http.Request) {
+			p.handlePhase(w, r, ph)
+		})
+	}
+	stub.AddHandler(http.MethodGet, prefix+"/:id", p.handleGet)
+	stub.AddHandler(http.MethodPut, "/_control"+prefix+"/failures/:phase", p.handleSetFailure)
+	stub.AddHandler(http.MethodDelete, "/_control"+prefix+"/failures/:phase", p.handleDeleteFailure)
+	return &p
+}
+
+// Fail makes phase fail as f describes, replacing any failure set for it.
+// It panics if phase is unknown or f.Status is not an error status.
+func (p *Participant) Fail(phase Phase, f Failure) {
+	if !phase.valid() {
+		panic("unknown phase: " + string(phase))
+	}
+	if !f.valid() {
+		panic("failure status must be an error status")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.failures[phase] = &f
+}
+
+// ClearFailures makes every phase succeed again.
+func (p *Participant) ClearFailures() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	clear(p.failures)
+}
+
+// Transaction returns the transaction with id, if it received any phase.
+func (p *Participant) Transaction(id string) (Transaction, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	tx, ok := p.txs[id]
+	if !ok {
+		return Transaction{}, false
+	}
+	return tx.clone(), true
+}
+
+func (tx *Transaction) clone() Transaction {
+	c := *tx
+	c.Calls = append([]Call(nil), tx.Calls...)
+	return c
+}
+
+// next returns the state phase moves tx to, or false when the transition
+// is invalid. tx is nil for unknown transactions.
+func next(tx *Transaction, phase Phase) (State, bool) {
+	var current State
+	if tx != nil {
+		current = tx.State
+	}
+
+	switch phase {
+	case PhasePrepare:
+		return StatePrepared, current == "" || current == StatePrepared
+	case PhaseCommit:
+		return StateCommitted, current == StatePrepared || current == StateCommitted
+	default:
+		return StateRolledBack, current != StateCommitted
+	}
+}
+
+func (p *Participant) handlePhase(w http.ResponseWriter, r *http.Request, phase Phase) {
+	id := stubsrv.PathParam(r, "id")
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	tx := p.txs[id]
+	if tx == nil && phase == PhaseCommit {
+		http.Error(w, "transaction not found", http.StatusNotFound)
+		return
+	}
+	if tx == nil {
+		tx = &Transaction{ID: id}
+		p.txs[id] = tx
+	}
+
+	state, ok := next(tx, phase)
+	status, msg := http.StatusOK, ""
+	if !ok {
+		status = http.StatusConflict
+		msg = "cannot " + string(phase) + " a transaction that is " + cmp.Or(string(tx.State), "not prepared")
+	} else if f := p.failure(id, phase); f != nil {
+		status = cmp.Or(f.Status, http.StatusInternalServerError)
+		msg = "injected " + string(phase) + " failure"
+		ok = f.Applied
+	}
+	if ok {
+		tx.State = state
+	}
+	tx.Calls = append(tx.Calls, Call{Phase: phase, Status: status, Time: time.Now()})
+
+	body := map[string]string{"id": id, "state": string(tx.State)}
+	if msg != "" {
+		body["error"] = msg
+	}
+	writeJSON(w, status, body)
+}
+
+// failure returns the failure applying to this call of phase for id, and
+// counts it. Callers must hold p.mu.
+func (p *Participant) failure(id string, phase Phase) *Failure {
+	f := p.failures[phase]
+	if f == nil || f.ID != "" && f.ID != id {
+		return nil
+	}
+	if f.Times > 0 {
+		f.Times--
+		if f.Times == 0 {
+			delete(p.failures, phase)
+		}
+	}
+	return f
+}
+
+func (p *Participant) handleGet(w http.ResponseWriter, r *http.Request) {
+	tx, ok := p.Transaction(stubsrv.PathParam(r, "id"))
+	if !ok {
+		http.Error(w, "transaction not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, tx)
+}
+
+func (p *Participant) handleSetFailure(w http.ResponseWriter, r *http.Request) {
+	phase := Phase(stubsrv.PathParam(r, "phase"))
+	if !phase.valid() {
+		http.Error(w, "unknown phase: "+string(phase), http.StatusBadRequest)
+		return
+	}
+	var f Failure
+	if err := json.NewDecoder(r.Body).Decode(&f); err != nil {
+		http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !f.valid() {
+		http.Error(w, "status must be an error status", http.StatusBadRequest)
+		return
+	}
+	p.Fail(phase, f)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (p *Participant) handleDeleteFailure(w http.ResponseWriter, r *http.Request) {
+	phase := Phase(stubsrv.PathParam(r, "phase"))
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.failures[phase]; !ok {
+		http.NotFound(w, r)
+		return
+	}
+	delete(p.failures, phase)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
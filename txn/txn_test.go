@@ -0,0 +1,179 @@
+package txn
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/alesr/stubsrv"
+	"github.com/alesr/stubsrv/internal/stubtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParticipant_Transitions(t *testing.T) {
+	t.Parallel()
+
+	type step struct {
+		phase          Phase
+		expectedStatus int
+		expectedState  State
+	}
+
+	testCases := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "commit",
+			steps: []step{
+				{PhasePrepare, http.StatusOK, StatePrepared},
+				{PhasePrepare, http.StatusOK, StatePrepared},
+				{PhaseCommit, http.StatusOK, StateCommitted},
+				{PhaseCommit, http.StatusOK, StateCommitted},
+				{PhaseRollback, http.StatusConflict, StateCommitted},
+				{PhasePrepare, http.StatusConflict, StateCommitted},
+			},
+		},
+		{
+			name: "rollback",
+			steps: []step{
+				{PhasePrepare, http.StatusOK, StatePrepared},
+				{PhaseRollback, http.StatusOK, StateRolledBack},
+				{PhaseCommit, http.StatusConflict, StateRolledBack},
+				{PhaseRollback, http.StatusOK, StateRolledBack},
+			},
+		},
+		{
+			name: "presumed abort",
+			steps: []step{
+				{PhaseRollback, http.StatusOK, StateRolledBack},
+				{PhasePrepare, http.StatusConflict, StateRolledBack},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			stub, _ := newParticipant(t)
+			for _, s := range tc.steps {
+				resp, body := stubtest.Do(t, http.MethodPost, stub.URL()+"/tx/t1/"+string(s.phase), "")
+				assert.Equal(t, s.expectedStatus, resp.StatusCode, s.phase)
+
+				var got map[string]string
+				require.NoError(t, json.Unmarshal([]byte(body), &got))
+				assert.Equal(t, string(s.expectedState), got["state"], s.phase)
+			}
+
+			resp, body := stubtest.Do(t, http.MethodGet, stub.URL()+"/tx/t1", "")
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			var tx Transaction
+			require.NoError(t, json.Unmarshal([]byte(body), &tx))
+			assert.Len(t, tx.Calls, len(tc.steps))
+		})
+	}
+
+	t.Run("commit of an unknown transaction", func(t *testing.T) {
+		t.Parallel()
+
+		stub, _ := newParticipant(t)
+		resp, _ := stubtest.Do(t, http.MethodPost, stub.URL()+"/tx/nope/commit", "")
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		resp, _ = stubtest.Do(t, http.MethodGet, stub.URL()+"/tx/nope", "")
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func TestParticipant_Failures(t *testing.T) {
+	t.Parallel()
+
+	t.Run("retried commit", func(t *testing.T) {
+		t.Parallel()
+
+		stub, p := newParticipant(t)
+		p.Fail(PhaseCommit, Failure{Status: http.StatusServiceUnavailable, Times: 2})
+
+		stubtest.Do(t, http.MethodPost, stub.URL()+"/tx/t1/prepare", "")
+		for range 2 {
+			resp, _ := stubtest.Do(t, http.MethodPost, stub.URL()+"/tx/t1/commit", "")
+			assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+		}
+		resp, _ := stubtest.Do(t, http.MethodPost, stub.URL()+"/tx/t1/commit", "")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		tx, ok := p.Transaction("t1")
+		require.True(t, ok)
+		assert.Equal(t, StateCommitted, tx.State)
+		var statuses []int
+		for _, c := range tx.Calls {
+			statuses = append(statuses, c.Status)
+		}
+		assert.Equal(t, []int{200, 503, 503, 200}, statuses)
+	})
+
+	t.Run("no vote for one transaction", func(t *testing.T) {
+		t.Parallel()
+
+		stub, _ := newParticipant(t)
+		resp, _ := stubtest.Do(t, http.MethodPut, stub.URL()+"/_control/tx/failures/prepare", `{"status":409,"id":"t2"}`)
+		require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+		resp, _ = stubtest.Do(t, http.MethodPost, stub.URL()+"/tx/t1/prepare", "")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		resp, body := stubtest.Do(t, http.MethodPost, stub.URL()+"/tx/t2/prepare", "")
+		assert.Equal(t, http.StatusConflict, resp.StatusCode)
+		assert.JSONEq(t, `{"id":"t2","state":"","error":"injected prepare failure"}`, body)
+
+		resp, body = stubtest.Do(t, http.MethodPost, stub.URL()+"/tx/t2/commit", "")
+		assert.Equal(t, http.StatusConflict, resp.StatusCode)
+		assert.JSONEq(t, `{"id":"t2","state":"","error":"cannot commit a transaction that is not prepared"}`, body)
+
+		resp, _ = stubtest.Do(t, http.MethodDelete, stub.URL()+"/_control/tx/failures/prepare", "")
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+		resp, _ = stubtest.Do(t, http.MethodPost, stub.URL()+"/tx/t2/prepare", "")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("applied commit with a lost response", func(t *testing.T) {
+		t.Parallel()
+
+		stub, p := newParticipant(t)
+		p.Fail(PhaseCommit, Failure{Applied: true})
+
+		stubtest.Do(t, http.MethodPost, stub.URL()+"/tx/t1/prepare", "")
+		resp, _ := stubtest.Do(t, http.MethodPost, stub.URL()+"/tx/t1/commit", "")
+		assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+
+		tx, _ := p.Transaction("t1")
+		assert.Equal(t, StateCommitted, tx.State)
+
+		p.ClearFailures()
+		resp, _ = stubtest.Do(t, http.MethodPost, stub.URL()+"/tx/t1/commit", "")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("invalid failures", func(t *testing.T) {
+		t.Parallel()
+
+		stub, p := newParticipant(t)
+		resp, _ := stubtest.Do(t, http.MethodPut, stub.URL()+"/_control/tx/failures/finish", `{}`)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		resp, _ = stubtest.Do(t, http.MethodPut, stub.URL()+"/_control/tx/failures/commit", `{"status":200}`)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		resp, _ = stubtest.Do(t, http.MethodDelete, stub.URL()+"/_control/tx/failures/commit", "")
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+		assert.Panics(t, func() { p.Fail("finish", Failure{}) })
+		assert.Panics(t, func() { p.Fail(PhaseCommit, Failure{Status: 204}) })
+	})
+}
+
+func newParticipant(t *testing.T) (*stubsrv.Stub, *Participant) {
+	t.Helper()
+
+	var p *Participant
+	stub := stubtest.New(t, func(stub *stubsrv.Stub) { p = New(stub, "/tx") })
+	return stub, p
+}
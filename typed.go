@@ -0,0 +1,64 @@
+package stubsrv
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// Validator is implemented by request types that check themselves once
+// decoded. JSONHandler answers 400 with the error when Validate fails.
+type Validator interface {
+	Validate() error
+}
+
+// JSONHandler adapts typed logic to a handler. The request body is
+// decoded into Req, left as its zero value when the body is empty, and
+// validated when Req implements Validator; either failing answers 400. fn's
+// Resp is encoded as JSON with its status, or 200 when it is 0:
+//
+//	stub.AddHandler(http.MethodPost, "/users", stubsrv.JSONHandler(
+//		func(ctx context.Context, req createUser) (user, int, error) {
+//			return user{ID: "1", Name: req.Name}, http.StatusCreated, nil
+//		}))
+//
+// When fn returns an error, it answers {"error": "<message>"} with its
+// status, or 500 when that is not an error status, and 5xx errors are
+// recorded with ReportError.
+func JSONHandler[Req, Resp any](fn func(ctx context.Context, req Req) (Resp, int, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req Req
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			writeJSONError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+			return
+		}
+		if v, ok := any(&req).(Validator); ok {
+			if err := v.Validate(); err != nil {
+				writeJSONError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+
+		resp, status, err := fn(r.Context(), req)
+		if err != nil {
+			if status < http.StatusBadRequest {
+				status = http.StatusInternalServerError
+			}
+			if status >= http.StatusInternalServerError {
+				ReportError(r, err)
+			}
+			writeJSONError(w, status, err.Error())
+			return
+		}
+		if status == 0 {
+			status = http.StatusOK
+		}
+		writeJSON(w, status, resp)
+	}
+}
+
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
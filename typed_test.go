@@ -0,0 +1,123 @@
+package stubsrv
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type createUser struct {
+	Name string `json:"name"`
+}
+
+func (c *createUser) Validate() error {
+	if c.Name == "" {
+		return errors.New("name is required")
+	}
+	return nil
+}
+
+type user struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestJSONHandler(t *testing.T) {
+	t.Parallel()
+
+	stub := NewStub(noopLogger())
+	stub.AddHandler(http.MethodPost, "/users", JSONHandler(func(ctx context.Context, req createUser) (user, int, error) {
+		switch req.Name {
+		case "taken":
+			return user{}, http.StatusConflict, errors.New("name taken")
+		case "boom":
+			return user{}, 0, errors.New("database down")
+		}
+		return user{ID: "1", Name: req.Name}, http.StatusCreated, nil
+	}))
+	stub.AddHandler(http.MethodGet, "/ping", JSONHandler(func(ctx context.Context, _ struct{}) (map[string]bool, int, error) {
+		return map[string]bool{"ok": true}, 0, nil
+	}))
+	require.NoError(t, stub.Start())
+	defer stub.Close()
+
+	testCases := []struct {
+		name           string
+		givenMethod    string
+		givenPath      string
+		givenBody      string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "decodes the request and encodes the response",
+			givenMethod:    http.MethodPost,
+			givenPath:      "/users",
+			givenBody:      `{"name":"alice"}`,
+			expectedStatus: http.StatusCreated,
+			expectedBody:   `{"id":"1","name":"alice"}`,
+		},
+		{
+			name:           "malformed body",
+			givenMethod:    http.MethodPost,
+			givenPath:      "/users",
+			givenBody:      `{"name":`,
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"invalid request body: unexpected EOF"}`,
+		},
+		{
+			name:           "validation failure",
+			givenMethod:    http.MethodPost,
+			givenPath:      "/users",
+			givenBody:      `{}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"name is required"}`,
+		},
+		{
+			name:           "error with its status",
+			givenMethod:    http.MethodPost,
+			givenPath:      "/users",
+			givenBody:      `{"name":"taken"}`,
+			expectedStatus: http.StatusConflict,
+			expectedBody:   `{"error":"name taken"}`,
+		},
+		{
+			name:           "error without status",
+			givenMethod:    http.MethodPost,
+			givenPath:      "/users",
+			givenBody:      `{"name":"boom"}`,
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   `{"error":"database down"}`,
+		},
+		{
+			name:           "empty body and default status",
+			givenMethod:    http.MethodGet,
+			givenPath:      "/ping",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"ok":true}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(tc.givenMethod, stub.URL()+tc.givenPath, strings.NewReader(tc.givenBody))
+			require.NoError(t, err)
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, tc.expectedStatus, resp.StatusCode)
+			assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+			assert.JSONEq(t, tc.expectedBody, readAll(t, resp))
+		})
+	}
+
+	errs := stub.HandlerErrors()
+	require.Len(t, errs, 1, "only server errors are reported")
+	assert.Equal(t, "database down", errs[0].Message)
+}
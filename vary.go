@@ -0,0 +1,100 @@
+package stubsrv
+
+import (
+	"errors"
+	"hash/fnv"
+	"maps"
+	"net/http"
+	"strings"
+)
+
+// varyAttribute returns the function extracting a vary_by attribute from a
+// request: method, path, body, or query.<name>, header.<name> or
+// param.<name> for a query parameter, header or path parameter.
+func varyAttribute(attr string) (func(r *http.Request) string, error) {
+	switch attr {
+	case "method":
+		return func(r *http.Request) string { return r.Method }, nil
+	case "path":
+		return func(r *http.Request) string { return r.URL.Path }, nil
+	case "body":
+		return func(r *http.Request) string { return string(peekBody(r)) }, nil
+	}
+
+	kind, name, ok := strings.Cut(attr, ".")
+	if ok && name != "" {
+		switch kind {
+		case "query":
+			return func(r *http.Request) string { return r.URL.Query().Get(name) }, nil
+		case "header":
+			return func(r *http.Request) string { return r.Header.Get(name) }, nil
+		case "param":
+			return func(r *http.Request) string { return PathParam(r, name) }, nil
+		}
+	}
+	return nil, errors.New("unknown vary_by attribute: " + attr)
+}
+
+// specVariants validates spec's variants and returns the handler picking
+// among them. Variants inherit the spec's status and headers.
+func specVariants(spec *DynamicHandlerSpec) (http.HandlerFunc, error) {
+	if len(spec.Variants) == 0 || len(spec.VaryBy) == 0 {
+		return nil, errors.New("variants and vary_by require each other")
+	}
+	if spec.Body != "" || len(spec.Chunks) > 0 || spec.BodyFile != "" {
+		return nil, errors.New("variants are mutually exclusive with body, chunks and body_file")
+	}
+
+	variants := make([]SpecResponse, len(spec.Variants))
+	for i, v := range spec.Variants {
+		if err := v.validate(); err != nil {
+			return nil, err
+		}
+		if v.Status == 0 {
+			v.Status = spec.Status
+		}
+		headers := maps.Clone(spec.Headers)
+		if headers == nil {
+			headers = make(map[string]string)
+		}
+		maps.Copy(headers, v.Headers)
+		v.Headers = headers
+		variants[i] = v
+	}
+	return variantHandler(spec.VaryBy, variants)
+}
+
+// variantHandler serves the variant the request's vary_by attributes hash
+// to. The same attributes always pick the same variant, and adding a
+// variant only moves the requests that now pick it.
+func variantHandler(varyBy []string, variants []SpecResponse) (http.HandlerFunc, error) {
+	attrs := make([]func(r *http.Request) string, 0, len(varyBy))
+	for _, attr := range varyBy {
+		fn, err := varyAttribute(attr)
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, fn)
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		h := fnv.New64a()
+		for _, attr := range attrs {
+			_, _ = h.Write([]byte(attr(r)))
+			_, _ = h.Write([]byte{0})
+		}
+		variants[jumpHash(h.Sum64(), len(variants))].write(w, r)
+	}, nil
+}
+
+// jumpHash maps key to one of n buckets with Lamping and Veach's jump
+// consistent hash.
+func jumpHash(key uint64, n int) int {
+	var b, j int64 = -1, 0
+	for j < int64(n) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
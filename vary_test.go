@@ -0,0 +1,82 @@
+package stubsrv
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStub_SpecVariants(t *testing.T) {
+	t.Parallel()
+
+	stub := NewStub(noopLogger())
+	require.NoError(t, stub.Start())
+	defer stub.Close()
+
+	controlAdd(t, stub, `{
+		"method": "GET",
+		"path": "/users/:id",
+		"headers": {"Content-Type": "application/json"},
+		"vary_by": ["param.id"],
+		"variants": [
+			{"body": "{\"tier\":\"free\"}"},
+			{"body": "{\"tier\":\"pro\"}"},
+			{"status": 404, "body": "{\"error\":\"gone\"}"}
+		],
+		"branches": [{"when": {"params": {"id": "admin"}}, "then": {"body": "admin"}}]
+	}`)
+
+	get := func(path string) (int, string, string) {
+		resp, err := http.Get(stub.URL() + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		return resp.StatusCode, resp.Header.Get("Content-Type"), readAll(t, resp)
+	}
+
+	seen := make(map[string]bool)
+	for i := range 50 {
+		path := fmt.Sprintf("/users/%d", i)
+		status, contentType, body := get(path)
+		againStatus, _, againBody := get(path)
+		assert.Equal(t, "application/json", contentType, "variants inherit the spec's headers")
+		assert.Equal(t, status, againStatus, "the same request gets the same variant")
+		assert.Equal(t, body, againBody, "the same request gets the same variant")
+		seen[body] = true
+	}
+	assert.Len(t, seen, 3, "every variant is served")
+
+	_, _, body := get("/users/admin")
+	assert.Equal(t, "admin", body, "branches are tried before variants")
+
+	for _, spec := range []string{
+		`{"method":"GET","path":"/x","variants":[{"body":"a"}]}`,
+		`{"method":"GET","path":"/x","vary_by":["path"]}`,
+		`{"method":"GET","path":"/x","vary_by":["cookie.session"],"variants":[{"body":"a"}]}`,
+		`{"method":"GET","path":"/x","body":"b","vary_by":["path"],"variants":[{"body":"a"}]}`,
+	} {
+		controlDo(t, stub, http.MethodPost, "/_control/handlers", spec, http.StatusBadRequest, nil)
+	}
+}
+
+func TestJumpHash(t *testing.T) {
+	t.Parallel()
+
+	// growing from n to n+1 buckets only moves keys into the new bucket
+	const keys = 1000
+	for n := 1; n < 10; n++ {
+		var moved int
+		for key := range uint64(keys) {
+			before, after := jumpHash(key, n), jumpHash(key, n+1)
+			require.Less(t, before, n)
+			if before != after {
+				assert.Equal(t, n, after)
+				moved++
+			}
+		}
+		assert.InDelta(t, keys/(n+1), moved, keys/10)
+	}
+}
@@ -0,0 +1,126 @@
+package stubsrv
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// maxNearMisses caps the near misses a VerifyResult lists.
+const maxNearMisses = 10
+
+// VerifySpec describes requests expected in the journal. Empty fields match
+// any request.
+type VerifySpec struct {
+	Method string `json:"method"`
+	// Path may be a template such as /users/:id.
+	Path     string            `json:"path"`
+	Query    map[string]string `json:"query"`
+	Headers  map[string]string `json:"headers"`
+	Body     string            `json:"body"`
+	BodyMode BodyMatchMode     `json:"body_mode"`
+	// Count is the exact number of matching requests expected. Without it,
+	// at least one is.
+	Count *int `json:"count"`
+}
+
+// VerifyResult reports how the journal compares to a VerifySpec.
+type VerifyResult struct {
+	OK      bool `json:"ok"`
+	Matched int  `json:"matched"`
+	// NearMisses lists, when OK is false, the recorded requests that
+	// failed the fewest criteria, closest first.
+	NearMisses []NearMiss `json:"near_misses,omitempty"`
+}
+
+// NearMiss is a recorded request that did not satisfy a VerifySpec, with
+// the criteria it failed: method, path, query, headers or body.
+type NearMiss struct {
+	Request    RecordedRequest `json:"request"`
+	Mismatches []string        `json:"mismatches"`
+}
+
+// Verify checks the journal against spec, as POST /_control/verify does for
+// test runners in other processes. It fails only when spec is invalid.
+func (s *Stub) Verify(spec VerifySpec) (VerifyResult, error) {
+	var body Matcher
+	if spec.Body != "" || spec.BodyMode != "" {
+		m, err := bodyMatcher(cmp.Or(spec.BodyMode, BodyExact), spec.Body)
+		if err != nil {
+			return VerifyResult{}, err
+		}
+		body = m
+	}
+	method := strings.ToUpper(spec.Method)
+	var segments []string
+	if spec.Path != "" {
+		segments = strings.Split(strings.Trim(spec.Path, "/"), "/")
+	}
+
+	var (
+		result VerifyResult
+		misses []NearMiss
+	)
+	for _, rec := range s.journal.all() {
+		var mismatches []string
+		if method != "" && rec.Method != method {
+			mismatches = append(mismatches, "method")
+		}
+		if segments != nil && !pathMatch(segments, rec.Path) {
+			mismatches = append(mismatches, "path")
+		}
+		if !queryMatch(spec.Query, rec.Query) {
+			mismatches = append(mismatches, "query")
+		}
+		if !MatchHeaders(spec.Headers)(&http.Request{Header: rec.Header}) {
+			mismatches = append(mismatches, "headers")
+		}
+		if body != nil && !body(&http.Request{Body: io.NopCloser(bytes.NewReader(rec.Body))}) {
+			mismatches = append(mismatches, "body")
+		}
+
+		if len(mismatches) == 0 {
+			result.Matched++
+			continue
+		}
+		misses = append(misses, NearMiss{Request: rec, Mismatches: mismatches})
+	}
+
+	if spec.Count != nil {
+		result.OK = result.Matched == *spec.Count
+	} else {
+		result.OK = result.Matched > 0
+	}
+	if !result.OK {
+		slices.SortStableFunc(misses, func(a, b NearMiss) int {
+			return len(a.Mismatches) - len(b.Mismatches)
+		})
+		result.NearMisses = misses[:min(len(misses), maxNearMisses)]
+	}
+	return result, nil
+}
+
+// controlVerify serves POST /_control/verify, checking the journal against
+// the VerifySpec in the body.
+func (s *Stub) controlVerify(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	var spec VerifySpec
+	if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+		http.Error(w, "invalid verify spec: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	result, err := s.Verify(spec)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
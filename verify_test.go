@@ -0,0 +1,104 @@
+package stubsrv
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStub_Verify(t *testing.T) {
+	t.Parallel()
+
+	stub := NewStub(noopLogger())
+	require.NoError(t, stub.Start())
+	defer stub.Close()
+
+	send := func(method, path, body string, header http.Header) {
+		req, err := http.NewRequest(method, stub.URL()+path, strings.NewReader(body))
+		require.NoError(t, err)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	send(http.MethodPost, "/orders?dry_run=1", `{"qty":2}`, http.Header{"X-Tenant": {"acme"}})
+	send(http.MethodPost, "/orders", `{"qty":3}`, nil)
+	send(http.MethodGet, "/orders/7", "", nil)
+
+	count := func(n int) *int { return &n }
+
+	testCases := []struct {
+		name               string
+		givenSpec          VerifySpec
+		expectedOK         bool
+		expectedMatched    int
+		expectedMismatches [][]string
+	}{
+		{
+			name:            "path template",
+			givenSpec:       VerifySpec{Method: "get", Path: "/orders/:id"},
+			expectedOK:      true,
+			expectedMatched: 1,
+		},
+		{
+			name:            "exact count",
+			givenSpec:       VerifySpec{Method: http.MethodPost, Path: "/orders", Count: count(2)},
+			expectedOK:      true,
+			expectedMatched: 2,
+		},
+		{
+			name: "query, headers and JSON body",
+			givenSpec: VerifySpec{
+				Path:     "/orders",
+				Query:    map[string]string{"dry_run": "1"},
+				Headers:  map[string]string{"X-Tenant": "acme"},
+				Body:     `{ "qty": 2 }`,
+				BodyMode: BodyJSON,
+			},
+			expectedOK:      true,
+			expectedMatched: 1,
+		},
+		{
+			name:               "near misses closest first",
+			givenSpec:          VerifySpec{Method: http.MethodPost, Path: "/orders", Body: `{"qty":5}`, BodyMode: BodyJSON},
+			expectedMatched:    0,
+			expectedMismatches: [][]string{{"body"}, {"body"}, {"method", "path", "body"}},
+		},
+		{
+			name:               "count off",
+			givenSpec:          VerifySpec{Method: http.MethodGet, Count: count(0)},
+			expectedMatched:    1,
+			expectedMismatches: [][]string{{"method"}, {"method"}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			spec, err := json.Marshal(tc.givenSpec)
+			require.NoError(t, err)
+
+			var got VerifyResult
+			controlDo(t, stub, http.MethodPost, "/_control/verify", string(spec), http.StatusOK, &got)
+
+			assert.Equal(t, tc.expectedOK, got.OK)
+			assert.Equal(t, tc.expectedMatched, got.Matched)
+
+			var mismatches [][]string
+			for _, miss := range got.NearMisses {
+				mismatches = append(mismatches, miss.Mismatches)
+			}
+			assert.Equal(t, tc.expectedMismatches, mismatches)
+		})
+	}
+
+	controlDo(t, stub, http.MethodPost, "/_control/verify", `{"body":"(","body_mode":"regex"}`, http.StatusBadRequest, nil)
+	controlDo(t, stub, http.MethodPost, "/_control/verify", `{`, http.StatusBadRequest, nil)
+	controlDo(t, stub, http.MethodGet, "/_control/verify", "", http.StatusMethodNotAllowed, nil)
+}
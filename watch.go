@@ -0,0 +1,74 @@
+package stubsrv
+
+import (
+	"crypto/sha256"
+	"log/slog"
+	"maps"
+	"os"
+	"time"
+)
+
+const watchInterval = 250 * time.Millisecond
+
+// WithWatchConfig reloads files loaded with LoadConfig whenever they, or
+// the body files they reference, change. The file's routes are swapped in
+// one step, as with ApplyConfig; an invalid edit is logged and the routes
+// loaded last stay in place. Files are polled, so edits take effect within
+// a fraction of a second.
+func WithWatchConfig() Option {
+	return func(cfg *stubConfig) {
+		cfg.watchConfig = true
+	}
+}
+
+// watchConfigFile reloads configPath, whose routes are ids, until the stub
+// is closed. files holds the hash of every file the last load read.
+func (s *Stub) watchConfigFile(configPath string, files map[string][sha256.Size]byte, ids []string) {
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.watchDone:
+			return
+		}
+
+		if !filesChanged(files) {
+			continue
+		}
+
+		next := make(map[string][sha256.Size]byte)
+		newIDs, err := s.loadConfigFile(configPath, next, ids)
+		if err != nil {
+			// remember the broken state so it is reported once
+			for name := range files {
+				next[name] = hashFile(name)
+			}
+			maps.Copy(files, next)
+			s.logger.Warn("Could not reload config", slog.String("path", configPath), slog.String("error", err.Error()))
+			continue
+		}
+		files, ids = next, newIDs
+		s.logger.Info("Config reloaded", slog.String("path", configPath), slog.Int("routes", len(ids)))
+	}
+}
+
+func filesChanged(files map[string][sha256.Size]byte) bool {
+	for name, sum := range files {
+		if hashFile(name) != sum {
+			return true
+		}
+	}
+	return false
+}
+
+// hashFile returns the SHA-256 of name, or the zero hash when it can't be
+// read.
+func hashFile(name string) [sha256.Size]byte {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return [sha256.Size]byte{}
+	}
+	return sha256.Sum256(data)
+}
@@ -0,0 +1,72 @@
+package stubsrv
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStub_WatchConfig(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "routes.json")
+	write := func(name, data string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(data), 0o600))
+	}
+	write("user.json", `{"name":"alice"}`)
+	write("routes.json", `[{"method":"GET","path":"/user","body_file":"user.json"},{"method":"GET","path":"/old"}]`)
+
+	stub := NewStub(noopLogger(), WithWatchConfig())
+	stub.AddHandler(http.MethodGet, "/kept", func(w http.ResponseWriter, r *http.Request) {})
+	require.NoError(t, stub.Start())
+	defer stub.Close()
+
+	_, err := stub.LoadConfig(configPath)
+	require.NoError(t, err)
+
+	get := func(path string) (int, string) {
+		resp, err := http.Get(stub.URL() + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		return resp.StatusCode, readAll(t, resp)
+	}
+	eventually := func(path string, expectedStatus int, expectedBody string) {
+		t.Helper()
+		assert.Eventually(t, func() bool {
+			status, body := get(path)
+			return status == expectedStatus && body == expectedBody
+		}, 3*time.Second, 20*time.Millisecond)
+	}
+
+	_, body := get("/user")
+	assert.Equal(t, `{"name":"alice"}`, body)
+
+	// edited body file
+	write("user.json", `{"name":"bob"}`)
+	eventually("/user", http.StatusOK, `{"name":"bob"}`)
+
+	// edited config: /old is dropped, /new added
+	write("routes.json", `[{"method":"GET","path":"/user","body_file":"user.json"},{"method":"GET","path":"/new","status":201}]`)
+	eventually("/new", http.StatusCreated, "")
+	status, _ := get("/old")
+	assert.Equal(t, http.StatusNotFound, status)
+
+	// a broken edit keeps the routes loaded last
+	write("routes.json", `[{"method":"GET","path":"/broken","fault":"nope"}]`)
+	time.Sleep(3 * watchInterval)
+	status, _ = get("/new")
+	assert.Equal(t, http.StatusCreated, status)
+
+	status, _ = get("/kept")
+	assert.Equal(t, http.StatusOK, status)
+
+	sources := stub.Info().Sources
+	require.Len(t, sources, 1)
+	assert.Equal(t, 2, sources[0].Routes)
+}
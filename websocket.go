@@ -0,0 +1,322 @@
+package stubsrv
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// WebSocket close codes, see RFC 6455 section 7.4.1.
+const (
+	WSCloseNormal          = 1000
+	WSCloseGoingAway       = 1001
+	WSCloseProtocolError   = 1002
+	WSCloseUnsupportedData = 1003
+	WSClosePolicyViolation = 1008
+	WSCloseInternalError   = 1011
+)
+
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xA
+
+	wsGUID           = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	wsMaxMessageSize = 16 << 20
+)
+
+// WSCloseError is returned by Receive once the peer has closed the
+// connection.
+type WSCloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *WSCloseError) Error() string {
+	return fmt.Sprintf("websocket closed: %d %s", e.Code, e.Reason)
+}
+
+// WSConn is the server side of a WebSocket connection accepted by a route
+// added with AddWebSocket.
+type WSConn struct {
+	conn    net.Conn
+	buf     *bufio.ReadWriter
+	request *http.Request
+	client  bool
+
+	wmu    sync.Mutex
+	closed bool
+}
+
+// Request returns the HTTP request that opened the connection.
+func (c *WSConn) Request() *http.Request {
+	return c.request
+}
+
+// Send sends msg as a text message.
+func (c *WSConn) Send(msg string) error {
+	return c.writeFrame(wsOpText, []byte(msg))
+}
+
+// SendBinary sends data as a binary message.
+func (c *WSConn) SendBinary(data []byte) error {
+	return c.writeFrame(wsOpBinary, data)
+}
+
+// Receive returns the next text or binary message. Pings are answered
+// while waiting. Once the peer closes, it returns a *WSCloseError.
+func (c *WSConn) Receive() (string, error) {
+	var (
+		msg    []byte
+		inData bool
+	)
+	for {
+		fin, op, payload, err := readWSFrame(c.buf.Reader)
+		if err != nil {
+			return "", err
+		}
+
+		switch op {
+		case wsOpPing:
+			if err := c.writeFrame(wsOpPong, payload); err != nil {
+				return "", err
+			}
+			continue
+		case wsOpPong:
+			continue
+		case wsOpClose:
+			closeErr := &WSCloseError{Code: WSCloseNormal}
+			if len(payload) >= 2 {
+				closeErr.Code = int(binary.BigEndian.Uint16(payload))
+				closeErr.Reason = string(payload[2:])
+			}
+			_ = c.Close(closeErr.Code, "")
+			return "", closeErr
+		case wsOpText, wsOpBinary:
+			if inData {
+				return "", errors.New("websocket: new message before the previous one finished")
+			}
+			inData = true
+		case wsOpContinuation:
+			if !inData {
+				return "", errors.New("websocket: unexpected continuation frame")
+			}
+		default:
+			return "", fmt.Errorf("websocket: unknown opcode %#x", op)
+		}
+
+		msg = append(msg, payload...)
+		if len(msg) > wsMaxMessageSize {
+			_ = c.Close(WSClosePolicyViolation, "message too large")
+			return "", errors.New("websocket: message too large")
+		}
+		if fin {
+			return string(msg), nil
+		}
+	}
+}
+
+// Expect receives the next message and fails unless it equals msg. The
+// connection is closed with WSClosePolicyViolation on mismatch.
+func (c *WSConn) Expect(msg string) error {
+	got, err := c.Receive()
+	if err != nil {
+		return err
+	}
+	if got != msg {
+		_ = c.Close(WSClosePolicyViolation, "unexpected message")
+		return fmt.Errorf("websocket: expected message %q, got %q", msg, got)
+	}
+	return nil
+}
+
+// Close sends a close frame with code and reason. Further calls are no-ops.
+func (c *WSConn) Close(code int, reason string) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+	return c.flushFrame(wsOpClose, append(payload, reason...))
+}
+
+func (c *WSConn) writeFrame(op byte, payload []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	if c.closed {
+		return errors.New("websocket: connection closed")
+	}
+	return c.flushFrame(op, payload)
+}
+
+// flushFrame writes one frame. Callers must hold c.wmu.
+func (c *WSConn) flushFrame(op byte, payload []byte) error {
+	if err := writeWSFrame(c.buf.Writer, op, payload, c.client); err != nil {
+		return err
+	}
+	return c.buf.Flush()
+}
+
+// AddWebSocket registers a GET route that upgrades to a WebSocket and hands
+// the connection to fn. The connection is closed with WSCloseNormal when fn
+// returns, unless fn already closed it. Requests without an upgrade are
+// answered with 426.
+func (s *Stub) AddWebSocket(path string, fn func(conn *WSConn), middlewares ...Middleware) {
+	s.AddHandler(http.MethodGet, path, func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgradeWebSocket(w, r)
+		if err != nil {
+			s.logger.Debug("WebSocket upgrade failed", slog.String("error", err.Error()))
+			return
+		}
+		defer conn.conn.Close()
+
+		fn(conn)
+		_ = conn.Close(WSCloseNormal, "")
+	}, middlewares...)
+}
+
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (*WSConn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if !headerHasToken(r.Header, "Connection", "upgrade") || !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		w.Header().Set("Upgrade", "websocket")
+		http.Error(w, "websocket upgrade required", http.StatusUpgradeRequired)
+		return nil, errors.New("not a websocket request")
+	}
+	if key == "" || r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported websocket handshake", http.StatusBadRequest)
+		return nil, errors.New("bad websocket handshake")
+	}
+
+	conn, buf, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		ReportError(r, err)
+		http.Error(w, "websocket requires a hijackable HTTP/1.x connection", http.StatusInternalServerError)
+		return nil, err
+	}
+
+	_, _ = buf.WriteString("HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + wsAccept(key) + "\r\n\r\n")
+	if err := buf.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &WSConn{conn: conn, buf: buf, request: r}, nil
+}
+
+func wsAccept(key string) string {
+	sum := sha1.Sum([]byte(key + wsGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for t := range strings.SplitSeq(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func writeWSFrame(w io.Writer, op byte, payload []byte, mask bool) error {
+	header := []byte{0x80 | op, 0}
+	var maskBit byte
+	if mask {
+		maskBit = 0x80
+	}
+
+	switch n := len(payload); {
+	case n < 126:
+		header[1] = maskBit | byte(n)
+	case n <= 0xFFFF:
+		header[1] = maskBit | 126
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header[1] = maskBit | 127
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+
+	if mask {
+		// clients must mask, but the key need not be unpredictable here
+		key := [4]byte{0x5a, 0x17, 0xc3, 0x9e}
+		header = append(header, key[:]...)
+		masked := make([]byte, len(payload))
+		for i, b := range payload {
+			masked[i] = b ^ key[i%4]
+		}
+		payload = masked
+	}
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+func readWSFrame(r io.Reader) (fin bool, op byte, payload []byte, err error) {
+	var head [2]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin, op = head[0]&0x80 != 0, head[0]&0x0F
+
+	n := uint64(head[1] & 0x7F)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if n > wsMaxMessageSize {
+		return false, 0, nil, errors.New("websocket: frame too large")
+	}
+
+	var key [4]byte
+	masked := head[1]&0x80 != 0
+	if masked {
+		if _, err := io.ReadFull(r, key[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+
+	payload = make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= key[i%4]
+		}
+	}
+	return fin, op, payload, nil
+}
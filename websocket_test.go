@@ -0,0 +1,108 @@
+package stubsrv
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStub_AddWebSocket(t *testing.T) {
+	t.Parallel()
+
+	stub := NewStub(noopLogger())
+	stub.AddWebSocket("/ws/:room", func(conn *WSConn) {
+		if err := conn.Expect("hello"); err != nil {
+			return
+		}
+		_ = conn.Send("welcome to " + PathParam(conn.Request(), "room"))
+		_ = conn.SendBinary([]byte{1, 2, 3})
+		for {
+			msg, err := conn.Receive()
+			if err != nil {
+				return
+			}
+			if msg == "bye" {
+				_ = conn.Close(WSCloseGoingAway, "done")
+				return
+			}
+			_ = conn.Send(msg)
+		}
+	})
+	require.NoError(t, stub.Start())
+	t.Cleanup(stub.Close)
+
+	t.Run("scripted exchange", func(t *testing.T) {
+		t.Parallel()
+
+		client := dialWS(t, stub.URL()+"/ws/lobby")
+
+		require.NoError(t, client.Send("hello"))
+		require.NoError(t, client.Expect("welcome to lobby"))
+		require.NoError(t, client.Expect("\x01\x02\x03"))
+
+		long := strings.Repeat("x", 70000)
+		require.NoError(t, client.Send(long))
+		require.NoError(t, client.Expect(long))
+
+		require.NoError(t, client.Send("bye"))
+		_, err := client.Receive()
+		var closeErr *WSCloseError
+		require.ErrorAs(t, err, &closeErr)
+		assert.Equal(t, WSCloseGoingAway, closeErr.Code)
+		assert.Equal(t, "done", closeErr.Reason)
+	})
+
+	t.Run("closes on unexpected message", func(t *testing.T) {
+		t.Parallel()
+
+		client := dialWS(t, stub.URL()+"/ws/lobby")
+
+		require.NoError(t, client.Send("hi"))
+		_, err := client.Receive()
+		var closeErr *WSCloseError
+		require.ErrorAs(t, err, &closeErr)
+		assert.Equal(t, WSClosePolicyViolation, closeErr.Code)
+	})
+
+	t.Run("plain request gets 426", func(t *testing.T) {
+		t.Parallel()
+
+		resp, err := http.Get(stub.URL() + "/ws/lobby")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusUpgradeRequired, resp.StatusCode)
+	})
+}
+
+func dialWS(t *testing.T, rawURL string) *WSConn {
+	t.Helper()
+
+	u, err := url.Parse(rawURL)
+	require.NoError(t, err)
+
+	conn, err := net.Dial("tcp", u.Host)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	require.NoError(t, err)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	require.NoError(t, req.Write(conn))
+
+	buf := bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+	resp, err := http.ReadResponse(buf.Reader, req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	require.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", resp.Header.Get("Sec-WebSocket-Accept"))
+
+	return &WSConn{conn: conn, buf: buf, request: req, client: true}
+}
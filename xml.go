@@ -0,0 +1,351 @@
+package stubsrv
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// MatchXPath matches XML requests in which expr selects a node whose text
+// is value, or any node when value is empty. It panics if expr is invalid.
+//
+// expr supports a subset of XPath 1.0: absolute (/a/b) and descendant
+// (//b) steps, * wildcards, text() and @attr as final steps, and
+// [@attr='v'], [@attr] and [child='v'] predicates. Names are compared
+// without their namespace prefix, so //Body matches soap:Body.
+func MatchXPath(expr, value string) Matcher {
+	m, err := xpathMatcher(expr, value)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+func xpathMatcher(expr, value string) (Matcher, error) {
+	steps, err := parseXPath(expr)
+	if err != nil {
+		return nil, err
+	}
+	return func(r *http.Request) bool {
+		doc, err := parseXML(peekBody(r))
+		if err != nil {
+			return false
+		}
+		for _, got := range evalXPath(doc, steps) {
+			if value == "" || strings.TrimSpace(got) == value {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+type xmlNode struct {
+	name     string
+	attrs    map[string]string
+	children []*xmlNode
+	text     strings.Builder
+}
+
+// innerText returns the concatenated character data of n and its
+// descendants.
+func (n *xmlNode) innerText() string {
+	if len(n.children) == 0 {
+		return n.text.String()
+	}
+	var b strings.Builder
+	b.WriteString(n.text.String())
+	for _, c := range n.children {
+		b.WriteString(c.innerText())
+	}
+	return b.String()
+}
+
+// parseXML returns a document node whose only child is the root element.
+func parseXML(data []byte) (*xmlNode, error) {
+	doc := &xmlNode{}
+	stack := []*xmlNode{doc}
+
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		top := stack[len(stack)-1]
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &xmlNode{name: t.Name.Local, attrs: make(map[string]string, len(t.Attr))}
+			for _, a := range t.Attr {
+				n.attrs[a.Name.Local] = a.Value
+			}
+			top.children = append(top.children, n)
+			stack = append(stack, n)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			top.text.Write(t)
+		}
+	}
+	if len(doc.children) != 1 {
+		return nil, errors.New("expected a single root element")
+	}
+	return doc, nil
+}
+
+type xpathStep struct {
+	descendant bool
+	name       string // element name, *, text() or @attr
+	predicates []xpathPredicate
+}
+
+type xpathPredicate struct {
+	attr  bool
+	name  string
+	value string
+	any   bool // existence only
+}
+
+func parseXPath(expr string) ([]xpathStep, error) {
+	if !strings.HasPrefix(expr, "/") {
+		return nil, fmt.Errorf("xpath %q must start with / or //", expr)
+	}
+
+	var steps []xpathStep
+	for i := 0; i < len(expr); {
+		var step xpathStep
+		i++ // the slash
+		if i < len(expr) && expr[i] == '/' {
+			step.descendant = true
+			i++
+		}
+
+		// read up to the next slash outside brackets and quotes
+		start, depth, quote := i, 0, byte(0)
+	scan:
+		for ; i < len(expr); i++ {
+			c := expr[i]
+			switch {
+			case quote != 0:
+				if c == quote {
+					quote = 0
+				}
+			case c == '\'' || c == '"':
+				quote = c
+			case c == '[':
+				depth++
+			case c == ']':
+				depth--
+			case c == '/' && depth == 0:
+				break scan
+			}
+		}
+		if err := step.parse(expr[start:i]); err != nil {
+			return nil, fmt.Errorf("invalid xpath %q: %w", expr, err)
+		}
+		steps = append(steps, step)
+	}
+
+	for j, s := range steps[:len(steps)-1] {
+		if s.name == "text()" || strings.HasPrefix(s.name, "@") {
+			return nil, fmt.Errorf("invalid xpath %q: %s must be the last step", expr, steps[j].name)
+		}
+	}
+	return steps, nil
+}
+
+func (s *xpathStep) parse(raw string) error {
+	name, preds, _ := strings.Cut(raw, "[")
+	s.name = localName(name)
+	if s.name == "" {
+		return errors.New("empty step")
+	}
+	if preds == "" {
+		return nil
+	}
+
+	for _, p := range strings.Split(strings.TrimSuffix(preds, "]"), "][") {
+		var pred xpathPredicate
+		key, value, hasValue := strings.Cut(p, "=")
+		key = strings.TrimSpace(key)
+		if pred.attr = strings.HasPrefix(key, "@"); pred.attr {
+			key = key[1:]
+		}
+		pred.name = localName(key)
+
+		if !hasValue {
+			pred.any = true
+		} else {
+			value = strings.TrimSpace(value)
+			if len(value) < 2 || (value[0] != '\'' && value[0] != '"') || value[len(value)-1] != value[0] {
+				return fmt.Errorf("predicate value %s must be quoted", value)
+			}
+			pred.value = value[1 : len(value)-1]
+		}
+		s.predicates = append(s.predicates, pred)
+	}
+	return nil
+}
+
+func localName(name string) string {
+	if strings.HasPrefix(name, "@") {
+		return "@" + localName(name[1:])
+	}
+	if i := strings.LastIndexByte(name, ':'); i >= 0 {
+		return name[i+1:]
+	}
+	return name
+}
+
+// evalXPath returns the text of every node steps select from doc.
+func evalXPath(doc *xmlNode, steps []xpathStep) []string {
+	nodes := []*xmlNode{doc}
+	for _, step := range steps {
+		var candidates []*xmlNode
+		for _, n := range nodes {
+			if step.descendant {
+				candidates = append(candidates, descendantsOrSelf(n)...)
+			} else {
+				candidates = append(candidates, n)
+			}
+		}
+
+		switch {
+		case step.name == "text()":
+			var out []string
+			for _, n := range candidates {
+				out = append(out, n.text.String())
+			}
+			return out
+		case strings.HasPrefix(step.name, "@"):
+			var out []string
+			for _, n := range candidates {
+				if v, ok := n.attrs[step.name[1:]]; ok {
+					out = append(out, v)
+				}
+			}
+			return out
+		}
+
+		nodes = nil
+		for _, n := range candidates {
+			for _, c := range n.children {
+				if (step.name == "*" || c.name == step.name) && c.satisfies(step.predicates) {
+					nodes = append(nodes, c)
+				}
+			}
+		}
+	}
+
+	out := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		out = append(out, n.innerText())
+	}
+	return out
+}
+
+func descendantsOrSelf(n *xmlNode) []*xmlNode {
+	out := []*xmlNode{n}
+	for _, c := range n.children {
+		out = append(out, descendantsOrSelf(c)...)
+	}
+	return out
+}
+
+func (n *xmlNode) satisfies(preds []xpathPredicate) bool {
+	for _, p := range preds {
+		if p.attr {
+			v, ok := n.attrs[p.name]
+			if !ok || !p.any && v != p.value {
+				return false
+			}
+			continue
+		}
+
+		found := false
+		for _, c := range n.children {
+			if c.name == p.name && (p.any || strings.TrimSpace(c.innerText()) == p.value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// XMLResponse returns a handler answering status with v encoded by
+// encoding/xml, preceded by the XML declaration.
+func XMLResponse(status int, v any) http.HandlerFunc {
+	body, err := xml.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return xmlHandler(status, "application/xml", append([]byte(xml.Header), body...))
+}
+
+const soapEnvelopeNS = "http://schemas.xmlsoap.org/soap/envelope/"
+
+// SOAPResponse returns a handler answering 200 with a SOAP 1.1 envelope
+// whose body holds v encoded by encoding/xml.
+func SOAPResponse(v any) http.HandlerFunc {
+	body, err := xml.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return xmlHandler(http.StatusOK, "text/xml; charset=utf-8", soapEnvelope(body))
+}
+
+// SOAPFault returns a handler answering 500 with a SOAP 1.1 fault, as SOAP
+// over HTTP requires. code is a fault code such as soap:Client or
+// soap:Server.
+func SOAPFault(code, message string) http.HandlerFunc {
+	var b bytes.Buffer
+	b.WriteString("<soap:Fault><faultcode>")
+	_ = xml.EscapeText(&b, []byte(code))
+	b.WriteString("</faultcode><faultstring>")
+	_ = xml.EscapeText(&b, []byte(message))
+	b.WriteString("</faultstring></soap:Fault>")
+	return xmlHandler(http.StatusInternalServerError, "text/xml; charset=utf-8", soapEnvelope(b.Bytes()))
+}
+
+func soapEnvelope(body []byte) []byte {
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	b.WriteString(`<soap:Envelope xmlns:soap="` + soapEnvelopeNS + `"><soap:Body>`)
+	b.Write(body)
+	b.WriteString("</soap:Body></soap:Envelope>")
+	return b.Bytes()
+}
+
+func xmlHandler(status int, contentType string, body []byte) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		w.WriteHeader(status)
+		_, _ = w.Write(body)
+	}
+}
+
+// ServeWSDL answers GET path?wsdl with wsdl, the way SOAP services publish
+// their contract. The parameter name is case-insensitive.
+func (s *Stub) ServeWSDL(path string, wsdl []byte) {
+	hasWSDL := func(r *http.Request) bool {
+		for k := range r.URL.Query() {
+			if strings.EqualFold(k, "wsdl") {
+				return true
+			}
+		}
+		return false
+	}
+	s.AddMatchedHandler(http.MethodGet, path, []Matcher{hasWSDL}, xmlHandler(http.StatusOK, "text/xml; charset=utf-8", wsdl))
+}
@@ -0,0 +1,148 @@
+package stubsrv
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const getUserEnvelope = `<?xml version="1.0"?>
+<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/" xmlns:u="urn:users">
+  <soap:Header><u:Auth token="t0k3n"/></soap:Header>
+  <soap:Body>
+    <u:GetUser version="2">
+      <u:id>42</u:id>
+      <u:fields><u:field>name</u:field><u:field>email</u:field></u:fields>
+    </u:GetUser>
+  </soap:Body>
+</soap:Envelope>`
+
+func TestMatchXPath(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name      string
+		givenExpr string
+		givenVal  string
+		givenBody string
+		expected  bool
+	}{
+		{name: "absolute path ignoring prefixes", givenExpr: "/Envelope/Body/GetUser/id", givenVal: "42", givenBody: getUserEnvelope, expected: true},
+		{name: "prefixed steps", givenExpr: "/soap:Envelope/soap:Body/u:GetUser/u:id", givenVal: "42", givenBody: getUserEnvelope, expected: true},
+		{name: "descendant", givenExpr: "//GetUser/id", givenVal: "42", givenBody: getUserEnvelope, expected: true},
+		{name: "value differs", givenExpr: "//GetUser/id", givenVal: "7", givenBody: getUserEnvelope, expected: false},
+		{name: "any of several nodes", givenExpr: "//fields/field", givenVal: "email", givenBody: getUserEnvelope, expected: true},
+		{name: "existence", givenExpr: "//Body/GetUser", givenBody: getUserEnvelope, expected: true},
+		{name: "missing node", givenExpr: "//Body/DeleteUser", givenBody: getUserEnvelope, expected: false},
+		{name: "attribute", givenExpr: "//Header/Auth/@token", givenVal: "t0k3n", givenBody: getUserEnvelope, expected: true},
+		{name: "attribute predicate", givenExpr: "//GetUser[@version='2']/id", givenVal: "42", givenBody: getUserEnvelope, expected: true},
+		{name: "failing attribute predicate", givenExpr: "//GetUser[@version='1']", givenBody: getUserEnvelope, expected: false},
+		{name: "child predicate", givenExpr: "//*[id='42']/fields/field", givenVal: "name", givenBody: getUserEnvelope, expected: true},
+		{name: "text step", givenExpr: "//id/text()", givenVal: "42", givenBody: getUserEnvelope, expected: true},
+		{name: "not XML", givenExpr: "//id", givenBody: `{"id":42}`, expected: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			req, err := http.NewRequest(http.MethodPost, "/", strings.NewReader(tc.givenBody))
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, MatchXPath(tc.givenExpr, tc.givenVal)(req))
+		})
+	}
+
+	for _, expr := range []string{"id", "//id/text()/x", "//a[@b=c]", "//"} {
+		assert.Panics(t, func() { MatchXPath(expr, "") }, expr)
+	}
+}
+
+func TestStub_SOAP(t *testing.T) {
+	t.Parallel()
+
+	type user struct {
+		XMLName xml.Name `xml:"urn:users GetUserResponse"`
+		ID      int      `xml:"id"`
+		Name    string   `xml:"name"`
+	}
+
+	stub := NewStub(noopLogger())
+	stub.AddMatchedHandler(http.MethodPost, "/users", []Matcher{MatchXPath("//GetUser/id", "42")}, SOAPResponse(user{ID: 42, Name: "alice"}))
+	stub.When(Post("/users")).WithXPath("//GetUser/id", "9").Reply(http.StatusGone).Empty()
+	stub.ServeWSDL("/users", []byte(`<definitions name="Users"/>`))
+	stub.AddHandler(http.MethodGet, "/users.xml", XMLResponse(http.StatusOK, user{ID: 1, Name: "bob"}))
+	require.NoError(t, stub.Start())
+	t.Cleanup(stub.Close)
+
+	controlAdd(t, stub, `{"method":"POST","path":"/users","match_xpath":{"//GetUser/id":"7"},"status":404}`)
+	controlDo(t, stub, http.MethodPost, "/_control/handlers", `{"method":"POST","path":"/x","match_xpath":{"id":""}}`, http.StatusBadRequest, nil)
+	// routes are tried in order, so the catch-all fault goes last
+	stub.AddMatchedHandler(http.MethodPost, "/users", []Matcher{MatchXPath("//GetUser/id", "")}, SOAPFault("soap:Client", "no such user <id>"))
+
+	post := func(t *testing.T, id string) *http.Response {
+		t.Helper()
+
+		body := strings.Replace(getUserEnvelope, "<u:id>42</u:id>", "<u:id>"+id+"</u:id>", 1)
+		resp, err := http.Post(stub.URL()+"/users", "text/xml", strings.NewReader(body))
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	t.Run("response envelope", func(t *testing.T) {
+		t.Parallel()
+
+		resp := post(t, "42")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "text/xml; charset=utf-8", resp.Header.Get("Content-Type"))
+		assert.Equal(t, xml.Header+`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>`+
+			`<GetUserResponse xmlns="urn:users"><id>42</id><name>alice</name></GetUserResponse>`+
+			`</soap:Body></soap:Envelope>`, readAll(t, resp))
+	})
+
+	t.Run("fault", func(t *testing.T) {
+		t.Parallel()
+
+		resp := post(t, "1")
+		assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+		assert.Contains(t, readAll(t, resp), `<soap:Fault><faultcode>soap:Client</faultcode><faultstring>no such user &lt;id&gt;</faultstring></soap:Fault>`)
+	})
+
+	t.Run("spec", func(t *testing.T) {
+		t.Parallel()
+
+		assert.Equal(t, http.StatusNotFound, post(t, "7").StatusCode)
+	})
+
+	t.Run("builder", func(t *testing.T) {
+		t.Parallel()
+
+		assert.Equal(t, http.StatusGone, post(t, "9").StatusCode)
+	})
+
+	t.Run("WSDL", func(t *testing.T) {
+		t.Parallel()
+
+		resp, err := http.Get(stub.URL() + "/users?WSDL")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, `<definitions name="Users"/>`, readAll(t, resp))
+	})
+
+	t.Run("XML response", func(t *testing.T) {
+		t.Parallel()
+
+		resp, err := http.Get(stub.URL() + "/users.xml")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		assert.Equal(t, "application/xml", resp.Header.Get("Content-Type"))
+		assert.Equal(t, xml.Header+`<GetUserResponse xmlns="urn:users"><id>1</id><name>bob</name></GetUserResponse>`, readAll(t, resp))
+	})
+}
@@ -0,0 +1,43 @@
+//go:build !stubsrv_stdlib
+
+package stubsrv
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// decodeYAML decodes a YAML or JSON document into a tree whose maps have
+// string keys, ready to go through encoding/json. Building with the
+// stubsrv_stdlib tag drops YAML, the package's only third-party dependency,
+// see yaml_stdlib.go.
+func decodeYAML(data []byte) (any, error) {
+	var tree any
+	if err := yaml.Unmarshal(data, &tree); err != nil {
+		return nil, err
+	}
+	return stringKeys(tree), nil
+}
+
+func stringKeys(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, val := range v {
+			v[k] = stringKeys(val)
+		}
+		return v
+	case map[any]any:
+		out := make(map[string]any, len(v))
+		for k, val := range v {
+			out[fmt.Sprint(k)] = stringKeys(val)
+		}
+		return out
+	case []any:
+		for i, val := range v {
+			v[i] = stringKeys(val)
+		}
+		return v
+	}
+	return v
+}
@@ -0,0 +1,24 @@
+//go:build stubsrv_stdlib
+
+package stubsrv
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+)
+
+// decodeYAML decodes a JSON document. YAML support is left out of builds
+// with the stubsrv_stdlib tag.
+func decodeYAML(data []byte) (any, error) {
+	var tree any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&tree); err != nil {
+		return nil, errors.New("only JSON is supported in builds with the stubsrv_stdlib tag: " + err.Error())
+	}
+	if dec.More() {
+		return nil, errors.New("unexpected data after the JSON document")
+	}
+	return tree, nil
+}
@@ -0,0 +1,28 @@
+//go:build stubsrv_stdlib
+
+package stubsrv
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	configFixture = "testdata/config.json"
+	userFixture   = "testdata/fixture_user.json"
+)
+
+func TestParseConfig_StdlibOnly(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := ParseConfig([]byte(`[{"method":"GET","path":"/health","status":204}]`))
+	require.NoError(t, err)
+	require.Len(t, cfg.Routes, 1)
+	assert.Equal(t, 204, cfg.Routes[0].Status)
+
+	_, err = ParseConfig([]byte("- method: GET\n  path: /health\n"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "only JSON is supported")
+}
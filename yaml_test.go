@@ -0,0 +1,54 @@
+//go:build !stubsrv_stdlib
+
+package stubsrv
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Fixtures are YAML unless YAML support is left out.
+const (
+	configFixture = "testdata/config.yaml"
+	userFixture   = "testdata/fixture_user.yaml"
+)
+
+func TestParseConfig_YAML(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := ParseConfig([]byte(`
+strict: true
+behaviors:
+  gone: {status: 410}
+routes:
+  - {method: GET, path: /users/:id, status: 200}
+  - {method: GET, path: /old, behavior: gone}
+`))
+	require.NoError(t, err)
+	assert.Len(t, cfg.Routes, 2)
+	assert.True(t, *cfg.Strict)
+
+	_, err = ParseConfig([]byte("routes:\n  - {method: GET, path: /, stauts: 200}\n"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown field")
+}
+
+func TestParseConfig_YAMLAnchors(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := ParseConfig([]byte(`
+routes:
+  - &json
+    method: GET
+    path: /a
+    headers: {Content-Type: application/json}
+  - <<: *json
+    path: /b
+`))
+	require.NoError(t, err)
+	require.Len(t, cfg.Routes, 2)
+	assert.Equal(t, "/b", cfg.Routes[1].Path)
+	assert.Equal(t, "application/json", cfg.Routes[1].Headers["Content-Type"])
+}